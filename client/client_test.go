@@ -794,7 +794,9 @@ func setupClientBenchData(useRPC, useSSL bool, numVersions, numKeys int, b *test
 	}
 
 	if r, ok := s.Engines[0].(*engine.RocksDB); ok {
-		r.CompactRange(nil, nil)
+		if err := r.CompactRange(nil, nil); err != nil {
+			b.Fatal(err)
+		}
 	}
 
 	return s, kv
@@ -66,6 +66,12 @@ const (
 	// string address of the node. E.g. node:1 => 127.0.0.1:24001
 	KeyNodeIDPrefix = "node"
 
+	// KeyNodeLivenessPrefix is the key prefix for gossiping node
+	// liveness. The actual key is suffixed with the decimal
+	// representation of the node id and the value is a proto.Timestamp
+	// after which the node is considered dead unless it heartbeats.
+	KeyNodeLivenessPrefix = "liveness"
+
 	// KeySentinel is a key for gossip which must not expire or
 	// else the node considers itself partitioned and will retry with
 	// bootstrap hosts.  The sentinel is gossiped by the node that holds
@@ -99,6 +105,11 @@ func MakeNodeIDKey(nodeID proto.NodeID) string {
 	return MakeKey(KeyNodeIDPrefix, nodeID.String())
 }
 
+// MakeNodeLivenessKey returns the gossip key for node liveness info.
+func MakeNodeLivenessKey(nodeID proto.NodeID) string {
+	return MakeKey(KeyNodeLivenessPrefix, nodeID.String())
+}
+
 // MakeCapacityKey returns the gossip key for the given store's capacity.
 func MakeCapacityKey(nodeID proto.NodeID, storeID proto.StoreID) string {
 	return MakeKey(KeyCapacityPrefix, nodeID.String(), "-", storeID.String())
@@ -56,6 +56,9 @@ var (
 	// LocalStoreIdentSuffix stores an immutable identifier for this
 	// store, created when the store is first bootstrapped.
 	LocalStoreIdentSuffix = proto.Key("iden")
+	// LocalStoreIDAllocHighWaterSuffix stores the highest value of an
+	// ID generator key observed by this store's ID allocator.
+	LocalStoreIDAllocHighWaterSuffix = proto.Key("idhw")
 
 	// LocalRangeIDPrefix is the prefix identifying per-range data
 	// indexed by Raft ID. The Raft ID is appended to this prefix,
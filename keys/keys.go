@@ -21,8 +21,10 @@ package keys
 import (
 	"bytes"
 	"fmt"
+	"math"
 
 	"github.com/cockroachdb/cockroach/proto"
+	"github.com/cockroachdb/cockroach/util"
 	"github.com/cockroachdb/cockroach/util/encoding"
 	"github.com/cockroachdb/cockroach/util/log"
 )
@@ -44,6 +46,12 @@ func StoreIdentKey() proto.Key {
 	return MakeStoreKey(LocalStoreIdentSuffix, proto.Key{})
 }
 
+// StoreIDAllocHighWaterKey returns a store-local key for the
+// high-water mark of the ID allocator using the given generator key.
+func StoreIDAllocHighWaterKey(idKey proto.Key) proto.Key {
+	return MakeStoreKey(LocalStoreIDAllocHighWaterSuffix, idKey)
+}
+
 // StoreStatusKey returns the key for accessing the store status for the
 // specified store ID.
 func StoreStatusKey(storeID int32) proto.Key {
@@ -133,6 +141,17 @@ func ResponseCacheKey(raftID int64, cmdID *proto.ClientCmdID) proto.Key {
 	return MakeRangeIDKey(raftID, LocalResponseCacheSuffix, detail)
 }
 
+// RangeLocalKeys returns the bounds [start, end) of all range-local
+// keys addressed by the specified Raft ID (e.g. the Raft log, Raft
+// state, range stats and response cache). The span is suitable for
+// iterating over or clearing all such keys at once, for example when
+// a replica is removed. Range-local keys addressed by the range's
+// start key (e.g. the range descriptor) are not included.
+func RangeLocalKeys(raftID int64) (start, end proto.Key) {
+	start = MakeKey(LocalRangeIDPrefix, encoding.EncodeUvarint(nil, uint64(raftID)))
+	return start, start.PrefixEnd()
+}
+
 // MakeRangeKey creates a range-local key based on the range
 // start key, metadata key suffix, and optional detail (e.g. the
 // transaction ID for a txn record, etc.).
@@ -292,3 +311,40 @@ func MetaScanBounds(key proto.Key) (proto.Key, proto.Key) {
 	// Otherwise find the first entry greater than the given key in the same meta prefix.
 	return key.Next(), proto.Key(key[:len(Meta1Prefix)]).PrefixEnd()
 }
+
+// MVCCVersionTimestampSize is the size of the encoded timestamp
+// suffix of an MVCC version key.
+const MVCCVersionTimestampSize = 12
+
+// DecodeMVCCKey decodes a raw engine key, as encoded on the MVCC write
+// path by engine.MVCCEncodeKey or engine.MVCCEncodeVersionKey, into
+// its logical key and timestamp. Keys for MVCC metadata and raw
+// values have no timestamp suffix and decode with a zero timestamp.
+// An error is returned if the input is malformed.
+func DecodeMVCCKey(encoded []byte) (proto.Key, proto.Timestamp, error) {
+	key, ts, _, err := DecodeMVCCVersionKey(encoded)
+	return key, ts, err
+}
+
+// DecodeMVCCVersionKey is like DecodeMVCCKey, but additionally returns
+// whether the key has a timestamp suffix, that is, whether it is the
+// key of an MVCC versioned value.
+func DecodeMVCCVersionKey(encoded []byte) (proto.Key, proto.Timestamp, bool, error) {
+	tsBytes, key, err := encoding.DecodeBytesChecked(encoded, nil)
+	if err != nil {
+		return nil, proto.ZeroTimestamp, false, util.Errorf("malformed MVCC key %q: %s", encoded, err)
+	}
+	if len(tsBytes) == 0 {
+		return key, proto.ZeroTimestamp, false, nil
+	}
+	if len(tsBytes) != MVCCVersionTimestampSize {
+		return nil, proto.ZeroTimestamp, false, util.Errorf("malformed MVCC key %q: expected %d timestamp bytes; got %d",
+			encoded, MVCCVersionTimestampSize, len(tsBytes))
+	}
+	tsBytes, wallTime := encoding.DecodeUint64Decreasing(tsBytes)
+	_, logical := encoding.DecodeUint32Decreasing(tsBytes)
+	if wallTime > math.MaxInt64 || logical > math.MaxInt32 {
+		return nil, proto.ZeroTimestamp, false, util.Errorf("malformed MVCC key %q: negative timestamp", encoded)
+	}
+	return key, proto.Timestamp{WallTime: int64(wallTime), Logical: int32(logical)}, true, nil
+}
@@ -19,10 +19,12 @@ package keys
 
 import (
 	"bytes"
+	"math"
 	"testing"
 
 	"github.com/cockroachdb/cockroach/proto"
 	"github.com/cockroachdb/cockroach/util"
+	"github.com/cockroachdb/cockroach/util/encoding"
 	"github.com/cockroachdb/cockroach/util/leaktest"
 )
 
@@ -52,6 +54,56 @@ func TestMakeKey(t *testing.T) {
 	}
 }
 
+// TestRangeLocalKeys verifies that the bounds returned by
+// RangeLocalKeys contain exactly the Raft ID-addressed local keys of
+// the given range.
+func TestRangeLocalKeys(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	localKeys := func(raftID int64) []proto.Key {
+		return []proto.Key{
+			RaftLogKey(raftID, 0),
+			RaftLogKey(raftID, math.MaxUint64),
+			RaftHardStateKey(raftID),
+			RaftTruncatedStateKey(raftID),
+			RaftAppliedIndexKey(raftID),
+			RaftLeaderLeaseKey(raftID),
+			RaftLastIndexKey(raftID),
+			RangeGCMetadataKey(raftID),
+			RangeLastVerificationTimestampKey(raftID),
+			RangeStatsKey(raftID),
+			ResponseCacheKey(raftID, &proto.ClientCmdID{WallTime: math.MaxInt64, Random: math.MaxInt64}),
+		}
+	}
+	otherKeys := []proto.Key{
+		RangeDescriptorKey(proto.Key("a")),
+		TransactionKey(proto.Key("a"), []byte("txn")),
+		proto.Key("a"),
+	}
+	raftIDs := []int64{1, 2, 255, 256, math.MaxInt64}
+	for _, raftID := range raftIDs {
+		start, end := RangeLocalKeys(raftID)
+		if !start.Less(end) {
+			t.Fatalf("%d: expected start %q < end %q", raftID, start, end)
+		}
+		contains := func(k proto.Key) bool {
+			return !k.Less(start) && k.Less(end)
+		}
+		for _, otherID := range raftIDs {
+			for _, k := range localKeys(otherID) {
+				if contains(k) != (otherID == raftID) {
+					t.Errorf("%d: unexpected containment %t of key %q for raft ID %d",
+						raftID, contains(k), k, otherID)
+				}
+			}
+		}
+		for _, k := range otherKeys {
+			if contains(k) {
+				t.Errorf("%d: unexpected containment of key %q", raftID, k)
+			}
+		}
+	}
+}
+
 func TestKeyAddress(t *testing.T) {
 	defer leaktest.AfterTest(t)
 	testCases := []struct {
@@ -178,3 +230,43 @@ func TestValidateRangeMetaKey(t *testing.T) {
 		}
 	}
 }
+
+// TestDecodeMVCCKeyMalformed verifies that malformed engine keys are
+// reported as errors instead of causing panics.
+func TestDecodeMVCCKeyMalformed(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	valid := encoding.EncodeBytes(nil, []byte("a\x00b"))
+	ts := encoding.EncodeUint32Decreasing(encoding.EncodeUint64Decreasing(nil, 1), 1)
+	testCases := [][]byte{
+		// No terminator.
+		[]byte("abc"),
+		valid[:len(valid)-1],
+		// Bad escape sequences.
+		{0x00},
+		{0x00, 0x03},
+		{0xff},
+		{0xff, 0x01},
+		// Timestamp suffix of the wrong length.
+		append(append([]byte(nil), valid...), ts[:len(ts)-1]...),
+		append(append(append([]byte(nil), valid...), ts...), 0x00),
+		// Negative wall time.
+		append(append([]byte(nil), valid...), encoding.EncodeUint32Decreasing(
+			encoding.EncodeUint64Decreasing(nil, math.MaxUint64), 0)...),
+	}
+	for i, encoded := range testCases {
+		if key, ts, err := DecodeMVCCKey(encoded); err == nil {
+			t.Errorf("%d: expected error decoding %q; got %q, %s", i, encoded, key, ts)
+		}
+	}
+
+	// Randomly truncated and corrupted version keys must never panic.
+	rng, _ := util.NewPseudoRand()
+	versionKey := append(append([]byte(nil), valid...), ts...)
+	for i := 0; i < 1000; i++ {
+		encoded := append([]byte(nil), versionKey[:rng.Intn(len(versionKey)+1)]...)
+		if len(encoded) > 0 {
+			encoded[rng.Intn(len(encoded))] = byte(rng.Intn(256))
+		}
+		DecodeMVCCKey(encoded)
+	}
+}
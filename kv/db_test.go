@@ -139,6 +139,8 @@ func TestKVDBInternalMethods(t *testing.T) {
 		{&proto.InternalResolveIntentRangeRequest{}, &proto.InternalResolveIntentRangeResponse{}},
 		{&proto.InternalMergeRequest{}, &proto.InternalMergeResponse{}},
 		{&proto.InternalTruncateLogRequest{}, &proto.InternalTruncateLogResponse{}},
+		{&proto.InternalComputeChecksumRequest{}, &proto.InternalComputeChecksumResponse{}},
+		{&proto.InternalWriteBatchRequest{}, &proto.InternalWriteBatchResponse{}},
 	}
 	// Verify non-public methods experience bad request errors.
 	db := createTestClient(t, s.ServingAddr())
@@ -529,6 +529,11 @@ func (ds *DistSender) sendAttempt(desc *proto.RangeDescriptor, call client.Call)
 		case *proto.RangeNotFoundError, *proto.RangeKeyMismatchError:
 			// Range descriptor might be out of date - evict it.
 			ds.rangeCache.EvictCachedRangeDescriptor(args.Header().Key, desc)
+			// A key mismatch carries the range's current bounds; drop any
+			// cached descriptors made stale by the split or merge.
+			if mErr, ok := tErr.(*proto.RangeKeyMismatchError); ok && mErr.Range != nil {
+				ds.rangeCache.InvalidateRangeDescriptors(mErr.Range.StartKey)
+			}
 			// On addressing errors, don't backoff; retry immediately.
 			return retry.Reset, nil
 		case *proto.NotLeaderError:
@@ -18,6 +18,8 @@
 package kv_test
 
 import (
+	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -30,6 +32,7 @@ import (
 	"github.com/cockroachdb/cockroach/server"
 	"github.com/cockroachdb/cockroach/storage"
 	"github.com/cockroachdb/cockroach/storage/engine"
+	"github.com/cockroachdb/cockroach/util"
 	"github.com/cockroachdb/cockroach/util/hlc"
 	"github.com/cockroachdb/cockroach/util/log"
 )
@@ -199,3 +202,63 @@ func TestSplitByMeta2KeyMax(t *testing.T) {
 		t.Error("range split on Meta2KeyMax timed out")
 	}
 }
+
+// TestMultiRangeBatchedIntentResolution verifies that intents written
+// by a transaction spanning two ranges are cleaned up on commit using
+// a bounded number of batched resolve commands, split by range.
+func TestMultiRangeBatchedIntentResolution(t *testing.T) {
+	s, _ := setupMultipleRanges(t)
+	defer s.Stop()
+
+	// Count resolve intent commands sent by the coordinator.
+	var resolves int32
+	ds := kv.NewDistSender(&kv.DistSenderContext{Clock: s.Clock()}, s.Gossip())
+	sender := client.SenderFunc(func(ctx context.Context, call client.Call) {
+		switch call.Method() {
+		case proto.InternalResolveIntent, proto.InternalResolveIntentRange:
+			atomic.AddInt32(&resolves, 1)
+		}
+		ds.Send(ctx, call)
+	})
+	stopper := util.NewStopper()
+	defer stopper.Stop()
+	tds := kv.NewTxnCoordSender(sender, s.Clock(), false, stopper)
+	db, err := client.Open("//root@", client.SenderOpt(tds))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Write 250 keys to each of the two ranges in a single transaction.
+	const numKeys = 500
+	if err := db.Tx(func(tx *client.Tx) error {
+		for i := 0; i < numKeys; i++ {
+			key := fmt.Sprintf("%c%03d", 'a'+i%2, i)
+			if err := tx.Put(key, "value"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Wait for all intents to be resolved; a consistent scan without a
+	// transaction fails on any remaining intent.
+	util.SucceedsWithin(t, 5*time.Second, func() error {
+		rows, err := engine.MVCCScan(s.Engines[0], proto.Key("a"), proto.Key("c"), 0,
+			s.Clock().Now(), true, nil)
+		if err != nil {
+			return err
+		}
+		if len(rows) != numKeys {
+			return util.Errorf("expected %d rows; got %d", numKeys, len(rows))
+		}
+		return nil
+	})
+
+	// Each range receives at most ceil(250/100) batches, excluding the
+	// intent which is resolved along with the transaction record.
+	if r := atomic.LoadInt32(&resolves); r > 6 {
+		t.Errorf("expected at most 6 resolve commands; got %d", r)
+	}
+}
@@ -572,6 +572,8 @@ func TestVerifyPermissions(t *testing.T) {
 		&proto.InternalMergeRequest{},
 		&proto.InternalTruncateLogRequest{},
 		&proto.InternalLeaderLeaseRequest{},
+		&proto.InternalComputeChecksumRequest{},
+		&proto.InternalWriteBatchRequest{},
 		&proto.InternalBatchRequest{},
 	}
 
@@ -73,6 +73,11 @@ func (rls *retryableLocalSender) Send(_ context.Context, call client.Call) {
 		// reset header.Replica and engage retry loop.
 		if err := call.Reply.Header().GoError(); err != nil {
 			if _, ok := err.(*proto.RangeKeyMismatchError); ok {
+				// A request which spans multiple ranges can't be routed
+				// by the local sender; retrying won't change that.
+				if rls.spansRanges(call.Args.Header()) {
+					return retry.Break, nil
+				}
 				// Clear request replica.
 				call.Args.Header().Replica = proto.Replica{}
 				return retry.Continue, nil
@@ -85,6 +90,20 @@ func (rls *retryableLocalSender) Send(_ context.Context, call client.Call) {
 	}
 }
 
+// spansRanges returns true if the start key of the request's key
+// range is addressable locally but the key range as a whole is not
+// contained within a single range.
+func (rls *retryableLocalSender) spansRanges(header *proto.RequestHeader) bool {
+	if len(header.EndKey) == 0 {
+		return false
+	}
+	if _, _, err := rls.lookupReplica(header.Key, nil); err != nil {
+		return false
+	}
+	_, _, err := rls.lookupReplica(header.Key, header.EndKey)
+	return err != nil
+}
+
 // A LocalTestCluster encapsulates an in-memory instantiation of a
 // cockroach node with a single store using a local sender. Example
 // usage of a LocalTestCluster follows:
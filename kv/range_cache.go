@@ -136,6 +136,7 @@ func (rmc *rangeDescriptorCache) LookupRangeDescriptor(key proto.Key,
 		// the correct range. Using the start key would require using
 		// Floor() which is a possibility for our llrb-based OrderedCache
 		// but not possible for RocksDB.
+		rmc.clearOverlappingCachedRangeDescriptorsLocked(&rs[i])
 		rmc.rangeCache.Add(rangeCacheKey(keys.RangeMetaKey(rs[i].EndKey)), &rs[i])
 	}
 	if len(rs) == 0 {
@@ -187,6 +188,64 @@ func (rmc *rangeDescriptorCache) EvictCachedRangeDescriptor(descKey proto.Key, s
 	}
 }
 
+// InvalidateRangeDescriptors evicts the cached descriptors made stale by a
+// split or merge of the range starting at startKey. The cached descriptor
+// containing startKey is evicted along with the descriptor of the range
+// immediately following it, which a merge may have absorbed. Unlike
+// EvictCachedRangeDescriptor, the cached meta descriptors are left intact,
+// so a subsequent lookup only has to re-read the affected entries.
+func (rmc *rangeDescriptorCache) InvalidateRangeDescriptors(startKey proto.Key) {
+	rmc.rangeCacheMu.Lock()
+	defer rmc.rangeCacheMu.Unlock()
+
+	rngKey, cachedDesc := rmc.getCachedRangeDescriptorLocked(startKey)
+	if cachedDesc == nil {
+		return
+	}
+	if log.V(1) {
+		log.Infof("invalidate cached descriptor: key=%s desc=%s", startKey, cachedDesc)
+	}
+	rmc.rangeCache.Del(rngKey)
+
+	if nextKey, nextDesc := rmc.getCachedRangeDescriptorLocked(cachedDesc.EndKey); nextDesc != nil {
+		if log.V(1) {
+			log.Infof("invalidate overlapping descriptor: key=%s desc=%s", cachedDesc.EndKey, nextDesc)
+		}
+		rmc.rangeCache.Del(nextKey)
+	}
+}
+
+// clearOverlappingCachedRangeDescriptorsLocked evicts all cached
+// descriptors overlapping the key span of desc. A split leaves the
+// descriptor of the original range cached under its end key, where it
+// would shadow the new right-hand side for keys beyond the split point,
+// so it needs to be cleared when the left-hand side is cached. Since the
+// cache is indexed by end key, the entries to check are those ending
+// within desc and the first one ending beyond it.
+// It is assumed that the caller holds a write lock on rmc.rangeCacheMu.
+func (rmc *rangeDescriptorCache) clearOverlappingCachedRangeDescriptorsLocked(desc *proto.RangeDescriptor) {
+	endMetaKey := keys.RangeMetaKey(desc.EndKey)
+	metaKey := keys.RangeMetaKey(desc.StartKey.Next())
+	for {
+		k, v, ok := rmc.rangeCache.Ceil(rangeCacheKey(metaKey))
+		if !ok {
+			return
+		}
+		metaKey = proto.Key(k.(rangeCacheKey))
+		cachedDesc := v.(*proto.RangeDescriptor)
+		if cachedDesc.StartKey.Less(desc.EndKey) && desc.StartKey.Less(cachedDesc.EndKey) {
+			if log.V(1) {
+				log.Infof("clear overlapping descriptor: key=%s desc=%s", metaKey, cachedDesc)
+			}
+			rmc.rangeCache.Del(k)
+		}
+		if endMetaKey.Less(metaKey) {
+			return
+		}
+		metaKey = metaKey.Next()
+	}
+}
+
 // getCachedRangeDescriptor is a helper function to retrieve the descriptor of
 // the range which contains the given key, if present in the cache. It
 // acquires a read lock on rmc.rangeCacheMu before delegating to
@@ -214,3 +214,82 @@ func TestRangeCache(t *testing.T) {
 	db.assertHitCount(t, 2)
 
 }
+
+// TestRangeCacheInvalidate verifies that invalidating the cache at a range's
+// start key evicts that range and the one following it, leaving the
+// remaining entries and the meta descriptors cached.
+func TestRangeCacheInvalidate(t *testing.T) {
+	db := newTestDescriptorDB()
+	for _, char := range "abcdefgh" {
+		db.splitRange(t, proto.Key(string(char)))
+	}
+	db.cache = newRangeDescriptorCache(db, 2<<10)
+
+	// The lookup caches [b,c), [c,d) and [d,e).
+	doLookup(t, db.cache, "ba")
+	db.assertHitCount(t, 2)
+
+	db.cache.InvalidateRangeDescriptors(proto.Key("b"))
+	for _, key := range []string{"ba", "ca"} {
+		if _, desc := db.cache.getCachedRangeDescriptor(proto.Key(key)); desc != nil {
+			t.Errorf("expected descriptor for %q to be evicted; got %s", key, desc)
+		}
+	}
+	if _, desc := db.cache.getCachedRangeDescriptor(proto.Key("da")); desc == nil {
+		t.Errorf("expected descriptor for %q to remain cached", "da")
+	}
+
+	// The lookup misses, but the meta descriptor is still cached.
+	doLookup(t, db.cache, "ba")
+	db.assertHitCount(t, 1)
+	doLookup(t, db.cache, "ca")
+	db.assertHitCount(t, 0)
+
+	// Invalidating an uncached key is a no-op.
+	db.cache.InvalidateRangeDescriptors(proto.Key("x"))
+	doLookup(t, db.cache, "da")
+	db.assertHitCount(t, 0)
+}
+
+// TestRangeCacheSplit verifies that caching either half of a split range
+// evicts the stale descriptor of the range before the split, so that
+// keys beyond the split point are re-resolved.
+func TestRangeCacheSplit(t *testing.T) {
+	db := newTestDescriptorDB()
+	for _, char := range "abcdefgh" {
+		db.splitRange(t, proto.Key(string(char)))
+	}
+	db.splitRange(t, proto.Key("aa"))
+	db.cache = newRangeDescriptorCache(db, 2<<10)
+
+	// The lookup caches [b,c), [c,d) and [d,e).
+	doLookup(t, db.cache, "ba")
+	db.assertHitCount(t, 2)
+
+	// After the split, the cache still serves the stale descriptor.
+	db.splitRange(t, proto.Key("bm"))
+	if desc := doLookup(t, db.cache, "bz"); !desc.StartKey.Equal(proto.Key("b")) {
+		t.Errorf("expected stale descriptor starting at %q; got %s", "b", desc)
+	}
+	db.assertHitCount(t, 0)
+
+	// This lookup caches [a,aa), [aa,b) and [b,bm), the last of which
+	// overlaps the stale [b,c).
+	doLookup(t, db.cache, "a")
+	db.assertHitCount(t, 1)
+	if _, desc := db.cache.getCachedRangeDescriptor(proto.Key("bz")); desc != nil {
+		t.Errorf("expected stale descriptor to be evicted; got %s", desc)
+	}
+	if _, desc := db.cache.getCachedRangeDescriptor(proto.Key("ca")); desc == nil {
+		t.Errorf("expected descriptor for %q to remain cached", "ca")
+	}
+
+	if desc := doLookup(t, db.cache, "bz"); !desc.StartKey.Equal(proto.Key("bm")) {
+		t.Errorf("expected descriptor starting at %q; got %s", "bm", desc)
+	}
+	db.assertHitCount(t, 1)
+	if desc := doLookup(t, db.cache, "ba"); !desc.EndKey.Equal(proto.Key("bm")) {
+		t.Errorf("expected descriptor ending at %q; got %s", "bm", desc)
+	}
+	db.assertHitCount(t, 0)
+}
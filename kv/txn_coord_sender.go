@@ -37,6 +37,11 @@ import (
 	gogoproto "github.com/gogo/protobuf/proto"
 )
 
+// maxIntentsPerResolve bounds the number of point intents cleaned up
+// via a single InternalResolveIntentRange command when a transaction
+// ends. Intents on the same range are batched up to this limit.
+const maxIntentsPerResolve = 100
+
 // txnMetadata holds information about an ongoing transaction, as
 // seen from the perspective of this coordinator. It records all
 // keys (and key ranges) mutated as part of the transaction for
@@ -63,6 +68,8 @@ type txnMetadata struct {
 	// keys stores key ranges affected by this transaction through this
 	// coordinator. By keeping this record, the coordinator will be able
 	// to update the write intent when the transaction is committed.
+	// Each entry's value is the raft ID of the range which served the
+	// write (or zero if unknown) and is used to batch cleanup by range.
 	keys *cache.IntervalCache
 
 	// lastUpdateNanos is the latest wall time in nanos the client sent
@@ -82,8 +89,9 @@ type txnMetadata struct {
 
 // addKeyRange adds the specified key range to the interval cache,
 // taking care not to add this range if existing entries already
-// completely cover the range.
-func (tm *txnMetadata) addKeyRange(start, end proto.Key) {
+// completely cover the range. raftID identifies the range to which
+// the write was addressed.
+func (tm *txnMetadata) addKeyRange(start, end proto.Key, raftID int64) {
 	// This gives us a memory-efficient end key if end is empty.
 	// The most common case for keys in the intents interval map
 	// is for single keys. However, the interval cache requires
@@ -103,7 +111,7 @@ func (tm *txnMetadata) addKeyRange(start, end proto.Key) {
 	}
 
 	// Since no existing key range fully covered this range, add it now.
-	tm.keys.Add(key, nil)
+	tm.keys.Add(key, raftID)
 }
 
 // setLastUpdate updates the wall time (in nanoseconds) since the most
@@ -124,6 +132,14 @@ func (tm *txnMetadata) hasClientAbandonedCoord(nowNanos int64) bool {
 // transaction has covered, clears the keys cache and closes the
 // metadata heartbeat. Any keys listed in the resolved slice have
 // already been resolved and do not receive resolve intent commands.
+//
+// Point intents which were written to the same range are resolved in
+// batches of up to maxIntentsPerResolve keys, each via a single
+// InternalResolveIntentRange command spanning the batch.
+//
+// If the transaction committed and all intents are resolved
+// successfully, the transaction record is marked accordingly, which
+// allows the range holding it to garbage collect it.
 func (tm *txnMetadata) close(txn *proto.Transaction, resolved []proto.Key, sender client.Sender, stopper *util.Stopper) {
 	close(tm.txnEnd) // stop heartbeat
 	if tm.keys.Len() > 0 {
@@ -131,59 +147,175 @@ func (tm *txnMetadata) close(txn *proto.Transaction, resolved []proto.Key, sende
 			log.Infof("cleaning up %d intent(s) for transaction %s", tm.keys.Len(), txn)
 		}
 	}
+	res := &intentResolution{}
+	var batch []proto.Key
+	var batchRaftID int64
+	flush := func() {
+		switch len(batch) {
+		case 0:
+			return
+		case 1:
+			resolveIntents(txn, resolveIntentCall(txn, batch[0], nil), nil, sender, stopper, res)
+		default:
+			key, endKey := batch[0], batch[0].Next()
+			for _, k := range batch[1:] {
+				if k.Less(key) {
+					key = k
+				}
+				if !k.Less(endKey) {
+					endKey = k.Next()
+				}
+			}
+			resolveIntents(txn, resolveIntentCall(txn, key, endKey), batch, sender, stopper, res)
+		}
+		batch = nil
+	}
 	for _, o := range tm.keys.GetOverlaps(proto.KeyMin, proto.KeyMax) {
 		// If the op was range based, end key != start key: resolve a range.
-		var call client.Call
 		key := o.Key.Start().(proto.Key)
 		endKey := o.Key.End().(proto.Key)
 		if !key.Next().Equal(endKey) {
-			call.Args = &proto.InternalResolveIntentRangeRequest{
-				RequestHeader: proto.RequestHeader{
-					Timestamp: txn.Timestamp,
-					Key:       key,
-					EndKey:    endKey,
-					User:      storage.UserRoot,
-					Txn:       txn,
-				},
-			}
-			call.Reply = &proto.InternalResolveIntentRangeResponse{}
-		} else {
-			// Check if the key has already been resolved; skip if yes.
-			found := false
-			for _, k := range resolved {
-				if key.Equal(k) {
-					found = true
-				}
-			}
-			if found {
-				continue
+			resolveIntents(txn, resolveIntentCall(txn, key, endKey), nil, sender, stopper, res)
+			continue
+		}
+		// Check if the key has already been resolved; skip if yes.
+		found := false
+		for _, k := range resolved {
+			if key.Equal(k) {
+				found = true
 			}
-			call.Args = &proto.InternalResolveIntentRequest{
+		}
+		if found {
+			continue
+		}
+		// Range-local keys and keys for which the range is unknown
+		// are resolved individually.
+		raftID, _ := o.Value.(int64)
+		if raftID == 0 || key.Less(keys.LocalMax) {
+			resolveIntents(txn, resolveIntentCall(txn, key, nil), nil, sender, stopper, res)
+			continue
+		}
+		if raftID != batchRaftID || len(batch) >= maxIntentsPerResolve {
+			flush()
+		}
+		batch = append(batch, key)
+		batchRaftID = raftID
+	}
+	flush()
+	tm.keys.Clear()
+	if txn.Status == proto.COMMITTED {
+		markIntentsResolved(txn, res, sender, stopper)
+	}
+}
+
+// intentResolution tracks the outcome of the resolve intent commands
+// sent on behalf of a transaction.
+type intentResolution struct {
+	sync.WaitGroup
+	failed int32 // Accessed atomically; non-zero if any cleanup failed
+}
+
+// fail records that an intent could not be resolved.
+func (ir *intentResolution) fail() {
+	atomic.StoreInt32(&ir.failed, 1)
+}
+
+// markIntentsResolved waits for the supplied intent resolution to
+// complete and, if no intent failed to resolve, sends a heartbeat
+// carrying IntentsResolved to the transaction record. This is best
+// effort; a record which isn't marked is simply never garbage
+// collected.
+func markIntentsResolved(txn *proto.Transaction, res *intentResolution, sender client.Sender, stopper *util.Stopper) {
+	if !stopper.StartTask() {
+		return
+	}
+	go func() {
+		defer stopper.FinishTask()
+		res.Wait()
+		if atomic.LoadInt32(&res.failed) != 0 {
+			return
+		}
+		resolvedTxn := gogoproto.Clone(txn).(*proto.Transaction)
+		resolvedTxn.IntentsResolved = gogoproto.Bool(true)
+		call := client.Call{
+			Args: &proto.InternalHeartbeatTxnRequest{
 				RequestHeader: proto.RequestHeader{
 					Timestamp: txn.Timestamp,
-					Key:       key,
+					Key:       txn.Key,
 					User:      storage.UserRoot,
-					Txn:       txn,
+					Txn:       resolvedTxn,
 				},
+			},
+			Reply: &proto.InternalHeartbeatTxnResponse{},
+		}
+		sender.Send(context.TODO(), call)
+		if err := call.Reply.Header().GoError(); err != nil {
+			log.Warningf("failed to mark intents of %s resolved: %s", txn, err)
+		}
+	}()
+}
+
+// resolveIntentCall returns a call which resolves the intent for key
+// or, if endKey is non-empty, all intents in [key, endKey).
+func resolveIntentCall(txn *proto.Transaction, key, endKey proto.Key) client.Call {
+	header := proto.RequestHeader{
+		Timestamp: txn.Timestamp,
+		Key:       key,
+		EndKey:    endKey,
+		User:      storage.UserRoot,
+		Txn:       txn,
+	}
+	if len(endKey) > 0 {
+		return client.Call{
+			Args:  &proto.InternalResolveIntentRangeRequest{RequestHeader: header},
+			Reply: &proto.InternalResolveIntentRangeResponse{},
+		}
+	}
+	return client.Call{
+		Args:  &proto.InternalResolveIntentRequest{RequestHeader: header},
+		Reply: &proto.InternalResolveIntentResponse{},
+	}
+}
+
+// resolveIntents sends the supplied resolve intent call. We don't care
+// about the reply; these are best effort. We simply fire and forget,
+// each in its own goroutine. If the call fails and fallback is not
+// empty, the fallback keys are resolved one at a time instead. This
+// happens if a batch of intents no longer lies within a single range,
+// as when the range was split after the intents were written. Failures
+// are recorded in res.
+func resolveIntents(txn *proto.Transaction, call client.Call, fallback []proto.Key, sender client.Sender, stopper *util.Stopper, res *intentResolution) {
+	if !stopper.StartTask() {
+		res.fail()
+		return
+	}
+	res.Add(1)
+	go func() {
+		defer res.Done()
+		defer stopper.FinishTask()
+		if log.V(2) {
+			log.Infof("cleaning up intent %q for txn %s", call.Args.Header().Key, txn)
+		}
+		sender.Send(context.TODO(), call)
+		if err := call.Reply.Header().GoError(); err != nil {
+			if len(fallback) == 0 {
+				log.Warningf("failed to cleanup %q intent: %s", call.Args.Header().Key, err)
+				res.fail()
+				return
 			}
-			call.Reply = &proto.InternalResolveIntentResponse{}
-		}
-		// We don't care about the reply channel; these are best
-		// effort. We simply fire and forget, each in its own goroutine.
-		if stopper.StartTask() {
-			go func() {
-				if log.V(2) {
-					log.Infof("cleaning up intent %q for txn %s", call.Args.Header().Key, txn)
-				}
+			if log.V(1) {
+				log.Infof("failed to cleanup %d intents in batch; resolving individually: %s", len(fallback), err)
+			}
+			for _, key := range fallback {
+				call := resolveIntentCall(txn, key, nil)
 				sender.Send(context.TODO(), call)
-				if call.Reply.Header().Error != nil {
-					log.Warningf("failed to cleanup %q intent: %s", call.Args.Header().Key, call.Reply.Header().GoError())
+				if err := call.Reply.Header().GoError(); err != nil {
+					log.Warningf("failed to cleanup %q intent: %s", key, err)
+					res.fail()
 				}
-				stopper.FinishTask()
-			}()
+			}
 		}
-	}
-	tm.keys.Clear()
+	}()
 }
 
 // A TxnCoordSender is an implementation of client.Sender which
@@ -306,6 +438,7 @@ func (tc *TxnCoordSender) sendOne(call client.Call) {
 			startNS = tc.clock.PhysicalNow()
 		}
 	}
+	origIntentCount := header.Txn.GetIntentCount()
 
 	// Send the command through wrapped sender.
 	tc.wrapped.Send(context.TODO(), call)
@@ -315,6 +448,10 @@ func (tc *TxnCoordSender) sendOne(call client.Call) {
 		if call.Reply.Header().Txn == nil {
 			call.Reply.Header().Txn = gogoproto.Clone(header.Txn).(*proto.Transaction)
 		}
+		// The reply txn reflects the intents written on only one of
+		// the ranges a range-spanning call touched; account for those
+		// written on all of them.
+		call.Reply.Header().Txn.SetIntentCount(origIntentCount + call.Reply.Header().IntentsWritten)
 		tc.updateResponseTxn(header, call.Reply.Header())
 	}
 
@@ -337,7 +474,7 @@ func (tc *TxnCoordSender) sendOne(call client.Call) {
 			tc.heartbeat(txnMeta)
 		}
 		txnMeta.setLastUpdate(tc.clock.PhysicalNow())
-		txnMeta.addKeyRange(header.Key, header.EndKey)
+		txnMeta.addKeyRange(header.Key, header.EndKey, header.RaftID)
 		tc.Unlock()
 	}
 
@@ -19,6 +19,7 @@ package kv
 
 import (
 	"bytes"
+	"fmt"
 	"reflect"
 	"sync/atomic"
 	"testing"
@@ -343,8 +344,8 @@ func verifyCleanup(key proto.Key, db *client.KV, eng engine.Engine, t *testing.T
 }
 
 // TestTxnCoordSenderEndTxn verifies that ending a transaction
-// sends resolve write intent requests and removes the transaction
-// from the txns map.
+// sends resolve write intent requests, removes the transaction
+// from the txns map and marks the record's intents as resolved.
 func TestTxnCoordSenderEndTxn(t *testing.T) {
 	s := createTestDB(t)
 	defer s.Stop()
@@ -377,6 +378,13 @@ func TestTxnCoordSenderEndTxn(t *testing.T) {
 		t.Fatal(etReply.GoError())
 	}
 	verifyCleanup(key, kv, s.Eng, t)
+
+	if err := util.IsTrueWithin(func() bool {
+		ok, txn, err := getTxn(kv, txn)
+		return ok && err == nil && txn.Status == proto.COMMITTED && txn.GetIntentsResolved()
+	}, 500*time.Millisecond); err != nil {
+		t.Errorf("expected transaction record to be marked resolved within 500ms")
+	}
 }
 
 // TestTxnCoordSenderCleanupOnAborted verifies that if a txn receives a
@@ -617,3 +625,44 @@ func TestTxnCoordSenderBatchTransaction(t *testing.T) {
 		}
 	}
 }
+
+// TestTxnCoordSenderLargeBatchSplit verifies that a large batch is never
+// sent as a single command: each of its requests reaches the wrapped
+// sender individually, so no one command approaches the batch's size.
+func TestTxnCoordSenderLargeBatchSplit(t *testing.T) {
+	stopper := util.NewStopper()
+	defer stopper.Stop()
+	clock := hlc.NewClock(hlc.UnixNano)
+	var sizes []int
+	ts := NewTxnCoordSender(newTestSender(func(call client.Call) {
+		if _, ok := call.Args.(*proto.PutRequest); !ok {
+			t.Errorf("expected individual put; got %s", call.Args.Method())
+		}
+		sizes = append(sizes, gogoproto.Size(call.Args))
+	}), clock, false, stopper)
+
+	const numPuts = 1000
+	bArgs := &proto.InternalBatchRequest{}
+	bReply := &proto.InternalBatchResponse{}
+	for i := 0; i < numPuts; i++ {
+		bArgs.Add(&proto.PutRequest{
+			RequestHeader: proto.RequestHeader{Key: proto.Key(fmt.Sprintf("key-%04d", i))},
+			Value:         proto.Value{Bytes: make([]byte, 100)},
+		})
+	}
+	batchSize := gogoproto.Size(bArgs)
+	ts.Send(context.Background(), client.Call{Args: bArgs, Reply: bReply})
+	if err := bReply.GoError(); err != nil {
+		t.Fatal(err)
+	}
+	if len(sizes) != numPuts {
+		t.Fatalf("expected %d commands; got %d", numPuts, len(sizes))
+	}
+	// Each command should carry roughly its share of the batch.
+	maxSize := 2 * batchSize / numPuts
+	for i, size := range sizes {
+		if size > maxSize {
+			t.Errorf("%d: expected command of at most %d bytes; got %d", i, maxSize, size)
+		}
+	}
+}
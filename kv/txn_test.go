@@ -34,6 +34,7 @@ import (
 	"github.com/cockroachdb/cockroach/storage/engine"
 	"github.com/cockroachdb/cockroach/util"
 	"github.com/cockroachdb/cockroach/util/hlc"
+	"github.com/cockroachdb/cockroach/util/retry"
 )
 
 // TestTxnDBBasics verifies that a simple transaction can be run and
@@ -619,3 +620,52 @@ func TestTxnRestartedSerializableTimestampRegression(t *testing.T) {
 	// Wait for txnA to finish.
 	<-ch
 }
+
+// TestTxnPriorityPreventsLivelock runs two series of transactions
+// which write the same two keys in opposite order. Because restarted
+// transactions increase their priority and ties are broken
+// deterministically, each transaction must commit within a bounded
+// number of attempts rather than aborting the other indefinitely.
+func TestTxnPriorityPreventsLivelock(t *testing.T) {
+	s := createTestDB(t)
+	defer s.Stop()
+	defer func(opts retry.Options) {
+		client.DefaultTxnRetryOptions = opts
+	}(client.DefaultTxnRetryOptions)
+	client.DefaultTxnRetryOptions.Backoff = 1 * time.Millisecond
+	client.DefaultTxnRetryOptions.MaxBackoff = 10 * time.Millisecond
+
+	const numTxns = 10
+	const maxAttempts = 10
+	keys := []proto.Key{proto.Key("a"), proto.Key("b")}
+	errs := make(chan error, len(keys))
+	var wg sync.WaitGroup
+	wg.Add(len(keys))
+	for i := range keys {
+		go func(first, second proto.Key) {
+			defer wg.Done()
+			for j := 0; j < numTxns; j++ {
+				attempts := 0
+				if err := s.DB.Tx(func(tx *client.Tx) error {
+					if attempts++; attempts > maxAttempts {
+						return util.Errorf("txn writing %q, %q did not commit within %d attempts", first, second, maxAttempts)
+					}
+					for _, key := range []proto.Key{first, second} {
+						if err := tx.Put(key, fmt.Sprintf("value-%d", j)); err != nil {
+							return err
+						}
+					}
+					return nil
+				}); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(keys[i], keys[len(keys)-1-i])
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
@@ -42,6 +42,29 @@ var ErrGroupDeleted = errors.New("group deleted")
 // node was stopped.
 var ErrStopped = errors.New("stopped")
 
+// ErrNotLeader is returned for read index requests to a node which is not,
+// or is no longer known to be, the established leader of the group. The
+// error is retryable.
+var ErrNotLeader error = notLeaderError{}
+
+type notLeaderError struct{}
+
+// Error implements the error interface.
+func (notLeaderError) Error() string {
+	return "not the established leader of the group"
+}
+
+// CanRetry implements the util.Retryable interface.
+func (notLeaderError) CanRetry() bool { return true }
+
+// A ReadIndexResult is the outcome of a ReadIndex request. On success,
+// Index is the index the state machine must have applied before a
+// linearizable read may be served.
+type ReadIndexResult struct {
+	Index uint64
+	Err   error
+}
+
 // Config contains the parameters necessary to construct a MultiRaft object.
 type Config struct {
 	Storage   Storage
@@ -105,6 +128,7 @@ type MultiRaft struct {
 	createGroupChan chan *createGroupOp
 	removeGroupChan chan *removeGroupOp
 	proposalChan    chan *proposal
+	readIndexChan   chan *readIndexRequest
 	// callbackChan is a generic hook to run a callback in the raft thread.
 	callbackChan chan func()
 }
@@ -154,6 +178,7 @@ func NewMultiRaft(nodeID proto.RaftNodeID, config *Config, stopper *util.Stopper
 		createGroupChan: make(chan *createGroupOp),
 		removeGroupChan: make(chan *removeGroupOp),
 		proposalChan:    make(chan *proposal),
+		readIndexChan:   make(chan *readIndexRequest),
 		callbackChan:    make(chan func()),
 	}
 
@@ -363,6 +388,23 @@ func (m *MultiRaft) ChangeGroupMembership(groupID uint64, commandID string,
 	return ch
 }
 
+// ReadIndex requests an index at which the local node may serve a
+// linearizable read of the given group without appending to the log.
+// The node must be the group's leader; it confirms its leadership by
+// collecting heartbeat responses from a quorum, and the returned index
+// covers every command committed when the request was made. The result
+// is written to the returned channel. If leadership can't be confirmed
+// or is lost in the meantime, the result carries ErrNotLeader.
+func (m *MultiRaft) ReadIndex(groupID uint64) <-chan ReadIndexResult {
+	ch := make(chan ReadIndexResult, 1)
+	select {
+	case m.readIndexChan <- &readIndexRequest{groupID: groupID, ch: ch}:
+	case <-m.stopper.ShouldStop():
+		ch <- ReadIndexResult{Err: ErrStopped}
+	}
+	return ch
+}
+
 // Status returns the current status of the given group.
 func (m *MultiRaft) Status(groupID uint64) *raft.Status {
 	return m.multiNode.Status(groupID)
@@ -375,6 +417,26 @@ type proposal struct {
 	ch        chan<- error
 }
 
+// readIndexRequest is a pending ReadIndex request. It is confirmed
+// once a quorum of the group has acknowledged the leader in its
+// current term, in response to a confirmation round sent after the
+// request was made.
+type readIndexRequest struct {
+	groupID uint64
+	ch      chan<- ReadIndexResult
+	// index is the commit index and term the leader's term when the
+	// request was made.
+	index uint64
+	term  uint64
+	// seq is the confirmation round sent for the request.
+	seq    uint64
+	quorum int
+	// members are the group's members when the request was made; acks
+	// those of them which have confirmed the leader.
+	members map[proto.RaftNodeID]struct{}
+	acks    map[proto.RaftNodeID]struct{}
+}
+
 // group represents the state of a consensus group.
 type group struct {
 	// committedTerm is the term of the most recently committed entry.
@@ -394,6 +456,16 @@ type group struct {
 	// re-added at any time, and we don't want a writeTask started by
 	// an earlier incarnation to be fed into a later one.
 	writing bool
+
+	// processedIndex is the index of the last committed entry handed to
+	// the application, and eventIndex that of the last one which
+	// produced an event. The application's applied index reaches
+	// eventIndex once it has consumed those events.
+	processedIndex uint64
+	eventIndex     uint64
+	// pendingReads contains the ReadIndex requests which haven't been
+	// answered yet.
+	pendingReads []*readIndexRequest
 }
 
 type createGroupOp struct {
@@ -432,6 +504,10 @@ type state struct {
 	groups    map[uint64]*group
 	nodes     map[proto.RaftNodeID]*node
 	writeTask *writeTask
+	// readSeq numbers the rounds of read index confirmations. It is
+	// carried in the Index field of confirmation requests and echoed in
+	// responses.
+	readSeq uint64
 }
 
 func newState(m *MultiRaft) *state {
@@ -500,10 +576,14 @@ func (s *state) start() {
 					log.Infof("node %v: group %v got message %.200s", s.nodeID, req.GroupID,
 						raft.DescribeMessage(req.Message, s.EntryFormatter))
 				}
-				switch req.Message.Type {
-				case raftpb.MsgHeartbeat:
+				switch {
+				case req.Message.Type == raftpb.MsgHeartbeat && req.GroupID != noGroup:
+					s.confirmReadIndex(req)
+				case req.Message.Type == raftpb.MsgHeartbeatResp && req.GroupID != noGroup:
+					s.ackReads(req)
+				case req.Message.Type == raftpb.MsgHeartbeat:
 					s.fanoutHeartbeat(req)
-				case raftpb.MsgHeartbeatResp:
+				case req.Message.Type == raftpb.MsgHeartbeatResp:
 					s.fanoutHeartbeatResponse(proto.RaftNodeID(req.Message.From))
 				default:
 					// We only want to lazily create the group if it's not heartbeat-related;
@@ -540,6 +620,9 @@ func (s *state) start() {
 			case prop := <-s.proposalChan:
 				s.propose(prop)
 
+			case req := <-s.readIndexChan:
+				s.readIndex(req)
+
 			case readyGroups = <-raftReady:
 				// readyGroups are saved in a local variable until they can be sent to
 				// the write task (and then the real work happens after the write is
@@ -573,6 +656,7 @@ func (s *state) start() {
 				if ticks >= s.HeartbeatIntervalTicks {
 					ticks = 0
 					s.coalescedHeartbeat()
+					s.retryReadConfirmations()
 				}
 
 			case cb := <-s.callbackChan:
@@ -705,7 +789,9 @@ func (s *state) createGroup(groupID uint64) error {
 		return err
 	}
 	s.groups[groupID] = &group{
-		pending: map[string]*proposal{},
+		pending:        map[string]*proposal{},
+		processedIndex: appliedIndex,
+		eventIndex:     appliedIndex,
 	}
 
 	for _, nodeID := range cs.Nodes {
@@ -740,6 +826,7 @@ func (s *state) removeGroup(op *removeGroupOp, readyGroups map[uint64]raft.Ready
 	// Group creation is lazy and idempotent; so is removal.
 	g, ok := s.groups[op.groupID]
 	if !ok {
+		s.notifyGroupRemoved(op.groupID)
 		op.ch <- nil
 		return
 	}
@@ -751,6 +838,7 @@ func (s *state) removeGroup(op *removeGroupOp, readyGroups map[uint64]raft.Ready
 	for _, prop := range g.pending {
 		s.removePending(g, prop, ErrGroupDeleted)
 	}
+	s.failReads(g, ErrGroupDeleted)
 
 	if err := s.multiNode.RemoveGroup(op.groupID); err != nil {
 		op.ch <- err
@@ -770,9 +858,18 @@ func (s *state) removeGroup(op *removeGroupOp, readyGroups map[uint64]raft.Ready
 	}
 
 	delete(s.groups, op.groupID)
+	s.notifyGroupRemoved(op.groupID)
 	op.ch <- nil
 }
 
+// notifyGroupRemoved tells the transport, if it keeps per-group state,
+// that the group has been removed.
+func (s *state) notifyGroupRemoved(groupID uint64) {
+	if l, ok := s.Transport.(GroupRemovalListener); ok {
+		l.GroupRemoved(groupID)
+	}
+}
+
 func (s *state) propose(p *proposal) {
 	g, ok := s.groups[p.groupID]
 	if !ok {
@@ -786,6 +883,148 @@ func (s *state) propose(p *proposal) {
 	p.fn()
 }
 
+// readIndex starts processing a ReadIndex request. The request is
+// rejected unless the local node leads the group and has committed an
+// entry in its current term; otherwise the commit index is recorded
+// and the group's other members are asked to confirm the leadership.
+func (s *state) readIndex(req *readIndexRequest) {
+	g, ok := s.groups[req.groupID]
+	if !ok {
+		req.ch <- ReadIndexResult{Err: ErrGroupDeleted}
+		return
+	}
+	status := s.multiNode.Status(req.groupID)
+	if status == nil || status.RaftState != raft.StateLeader || g.leader != s.nodeID ||
+		g.committedTerm != status.Term {
+		req.ch <- ReadIndexResult{Err: ErrNotLeader}
+		return
+	}
+	req.index = status.Commit
+	req.term = status.Term
+	req.quorum = len(status.Progress)/2 + 1
+	req.members = map[proto.RaftNodeID]struct{}{}
+	for id := range status.Progress {
+		req.members[proto.RaftNodeID(id)] = struct{}{}
+	}
+	req.acks = map[proto.RaftNodeID]struct{}{s.nodeID: {}}
+	g.pendingReads = append(g.pendingReads, req)
+	req.seq = s.requestReadConfirmations(req.groupID, status)
+	s.maybeFinishReads(req.groupID, g)
+}
+
+// requestReadConfirmations starts a new confirmation round, asking the
+// group's other members to confirm the local node's leadership in its
+// current term. Returns the round's sequence number.
+func (s *state) requestReadConfirmations(groupID uint64, status *raft.Status) uint64 {
+	s.readSeq++
+	for id := range status.Progress {
+		if proto.RaftNodeID(id) == s.nodeID {
+			continue
+		}
+		s.sendMessage(groupID, raftpb.Message{
+			From:  uint64(s.nodeID),
+			To:    id,
+			Type:  raftpb.MsgHeartbeat,
+			Term:  status.Term,
+			Index: s.readSeq,
+		})
+	}
+	return s.readSeq
+}
+
+// retryReadConfirmations starts a new confirmation round for each
+// group with reads still waiting for a quorum, in case members which
+// had not yet learned of the leader or whose responses were lost
+// ignored the previous round.
+func (s *state) retryReadConfirmations() {
+	for groupID, g := range s.groups {
+		if len(g.pendingReads) == 0 {
+			continue
+		}
+		if status := s.multiNode.Status(groupID); status != nil && status.RaftState == raft.StateLeader {
+			s.requestReadConfirmations(groupID, status)
+		}
+	}
+}
+
+// confirmReadIndex answers a leader's request to confirm its
+// leadership of a group for a pending read. Unlike a coalesced
+// heartbeat, the response is specific to the group and is only sent
+// if the local node still follows the sender in the request's term.
+// Once a quorum has moved on to a higher term, a deposed leader can
+// thus no longer gather the confirmations it needs.
+func (s *state) confirmReadIndex(req *RaftMessageRequest) {
+	g, ok := s.groups[req.GroupID]
+	if !ok || g.leader != proto.RaftNodeID(req.Message.From) {
+		return
+	}
+	if status := s.multiNode.Status(req.GroupID); status == nil || status.Term != req.Message.Term {
+		return
+	}
+	s.sendMessage(req.GroupID, raftpb.Message{
+		From:  uint64(s.nodeID),
+		To:    req.Message.From,
+		Type:  raftpb.MsgHeartbeatResp,
+		Term:  req.Message.Term,
+		Index: req.Message.Index,
+	})
+}
+
+// ackReads records a member's confirmation of the local node's
+// leadership, acknowledging the group's pending reads of the same term
+// whose confirmation round the response answers or precedes.
+func (s *state) ackReads(req *RaftMessageRequest) {
+	g, ok := s.groups[req.GroupID]
+	if !ok || len(g.pendingReads) == 0 {
+		return
+	}
+	nodeID := proto.RaftNodeID(req.Message.From)
+	for _, read := range g.pendingReads {
+		if _, ok := read.members[nodeID]; !ok {
+			continue
+		}
+		if read.term == req.Message.Term && read.seq <= req.Message.Index {
+			read.acks[nodeID] = struct{}{}
+		}
+	}
+	s.maybeFinishReads(req.GroupID, g)
+}
+
+// maybeFinishReads answers the group's pending reads which have been
+// confirmed by a quorum once all entries up to their commit index
+// have been handed to the application.
+func (s *state) maybeFinishReads(groupID uint64, g *group) {
+	if len(g.pendingReads) == 0 {
+		return
+	}
+	var status *raft.Status
+	remaining := g.pendingReads[:0]
+	for _, req := range g.pendingReads {
+		if len(req.acks) < req.quorum || g.processedIndex < req.index {
+			remaining = append(remaining, req)
+			continue
+		}
+		if status == nil {
+			status = s.multiNode.Status(groupID)
+		}
+		if status == nil || status.RaftState != raft.StateLeader || status.Term != req.term {
+			req.ch <- ReadIndexResult{Err: ErrNotLeader}
+			continue
+		}
+		req.ch <- ReadIndexResult{Index: g.eventIndex}
+	}
+	g.pendingReads = remaining
+}
+
+// failReads answers all of the group's pending reads with the given
+// error.
+func (s *state) failReads(g *group, err error) {
+	for _, req := range g.pendingReads {
+		req.ch <- ReadIndexResult{Err: err}
+	}
+	g.pendingReads = nil
+}
+
 func (s *state) logRaftReady(readyGroups map[uint64]raft.Ready) {
 	for groupID, ready := range readyGroups {
 		if log.V(5) {
@@ -970,6 +1209,10 @@ func (s *state) maybeSendLeaderEvent(groupID uint64, g *group, ready *raft.Ready
 	if ready.SoftState != nil {
 		// Always save the leader whenever we get a SoftState.
 		g.leader = proto.RaftNodeID(ready.SoftState.Lead)
+		if g.leader != s.nodeID {
+			// Reads can't be confirmed without leadership.
+			s.failReads(g, ErrNotLeader)
+		}
 	}
 	if len(ready.CommittedEntries) > 0 {
 		term = ready.CommittedEntries[len(ready.CommittedEntries)-1].Term
@@ -1024,9 +1267,17 @@ func (s *state) handleWriteResponse(response *writeResponse, readyGroups map[uin
 			// This could be done with a Callback as in EventMembershipChangeCommitted
 			// or perhaps we should move away from a channel to a callback-based system.
 			s.removePending(g, g.pending[commandID], nil /* err */)
+			if entry.Type == raftpb.EntryConfChange || entry.Data != nil {
+				g.eventIndex = entry.Index
+			}
+			g.processedIndex = entry.Index
 		}
 
 		if !raft.IsEmptySnap(ready.Snapshot) {
+			if index := ready.Snapshot.Metadata.Index; index > g.processedIndex {
+				g.processedIndex = index
+				g.eventIndex = index
+			}
 			// Sync the group/node mapping with the information contained in the snapshot.
 			for _, nodeID := range ready.Snapshot.Metadata.ConfState.Nodes {
 				// TODO(bdarnell): if we had any information that predated this snapshot
@@ -1039,6 +1290,7 @@ func (s *state) handleWriteResponse(response *writeResponse, readyGroups map[uin
 
 		// Process SoftState and leader changes.
 		s.maybeSendLeaderEvent(groupID, g, &ready)
+		s.maybeFinishReads(groupID, g)
 
 		// Send all messages.
 		for _, msg := range ready.Messages {
@@ -262,6 +262,54 @@ func TestCommand(t *testing.T) {
 	}
 }
 
+// TestReadIndex verifies that the leader serves a read index covering
+// all committed commands without appending to its log, and that
+// followers refuse read index requests.
+func TestReadIndex(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	stopper := util.NewStopper()
+	cluster := newTestCluster(nil, 3, stopper, t)
+	defer stopper.Stop()
+	groupID := uint64(1)
+	cluster.createGroup(groupID, 0, 3)
+	cluster.triggerElection(0, groupID)
+	cluster.waitForElection(0)
+
+	cluster.nodes[0].SubmitCommand(groupID, makeCommandID(), []byte("command"))
+	var commitIndex uint64
+	for i, events := range cluster.events {
+		commit := <-events.CommandCommitted
+		if i == 0 {
+			commitIndex = commit.Index
+		}
+	}
+
+	gs := cluster.storages[0].GroupStorage(groupID)
+	lastIndex, err := gs.LastIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := <-cluster.nodes[0].ReadIndex(groupID)
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if res.Index != commitIndex {
+		t.Errorf("expected read index %d, got %d", commitIndex, res.Index)
+	}
+	if newLastIndex, err := gs.LastIndex(); err != nil {
+		t.Fatal(err)
+	} else if newLastIndex != lastIndex {
+		t.Errorf("expected last index to remain %d, got %d", lastIndex, newLastIndex)
+	}
+
+	if res := <-cluster.nodes[1].ReadIndex(groupID); res.Err != ErrNotLeader {
+		t.Errorf("expected ErrNotLeader from follower, got %v", res.Err)
+	}
+	if res := <-cluster.nodes[0].ReadIndex(7); res.Err != ErrGroupDeleted {
+		t.Errorf("expected ErrGroupDeleted for unknown group, got %v", res.Err)
+	}
+}
+
 func TestSlowStorage(t *testing.T) {
 	defer leaktest.AfterTest(t)
 	stopper := util.NewStopper()
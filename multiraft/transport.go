@@ -50,6 +50,14 @@ type Transport interface {
 	Close()
 }
 
+// A GroupRemovalListener is a Transport which keeps per-group state,
+// such as partially received messages. MultiRaft calls GroupRemoved
+// when a group is removed from the local node so that this state can
+// be discarded.
+type GroupRemovalListener interface {
+	GroupRemoved(groupID uint64)
+}
+
 // RaftMessageRequest wraps a raft message.
 type RaftMessageRequest struct {
 	GroupID uint64
@@ -121,12 +121,13 @@ func (rh *RequestHeader) GetOrCreateCmdID(walltime int64) (cmdID ClientCmdID) {
 }
 
 // Combine is used by range-spanning Response types (e.g. Scan or DeleteRange)
-// to merge their headers.
+// to merge their headers. The intents written on each range are summed.
 func (rh *ResponseHeader) Combine(otherRH *ResponseHeader) {
 	if rh != nil {
 		if ts := otherRH.GetTimestamp(); rh.Timestamp.Less(ts) {
 			rh.Timestamp = ts
 		}
+		rh.IntentsWritten += otherRH.GetIntentsWritten()
 		if rh.Txn != nil && otherRH.GetTxn() == nil {
 			rh.Txn = nil
 		}
@@ -368,6 +369,12 @@ func (*InternalLeaderLeaseRequest) Method() Method { return InternalLeaderLease
 // Method implements the Request interface.
 func (*InternalTruncateLogRequest) Method() Method { return InternalTruncateLog }
 
+// Method implements the Request interface.
+func (*InternalComputeChecksumRequest) Method() Method { return InternalComputeChecksum }
+
+// Method implements the Request interface.
+func (*InternalWriteBatchRequest) Method() Method { return InternalWriteBatch }
+
 // Method implements the Request interface.
 func (*InternalBatchRequest) Method() Method { return InternalBatch }
 
@@ -433,6 +440,14 @@ func (*InternalTruncateLogRequest) CreateReply() Response { return &InternalTrun
 // CreateReply implements the Request interface.
 func (*InternalLeaderLeaseRequest) CreateReply() Response { return &InternalLeaderLeaseResponse{} }
 
+// CreateReply implements the Request interface.
+func (*InternalComputeChecksumRequest) CreateReply() Response {
+	return &InternalComputeChecksumResponse{}
+}
+
+// CreateReply implements the Request interface.
+func (*InternalWriteBatchRequest) CreateReply() Response { return &InternalWriteBatchResponse{} }
+
 // CreateReply implements the Request interface.
 func (*InternalBatchRequest) CreateReply() Response { return &InternalBatchResponse{} }
 
@@ -456,4 +471,6 @@ func (*InternalResolveIntentRangeRequest) flags() int { return isWrite | isRange
 func (*InternalMergeRequest) flags() int              { return isWrite }
 func (*InternalTruncateLogRequest) flags() int        { return isWrite }
 func (*InternalLeaderLeaseRequest) flags() int        { return isWrite }
+func (*InternalComputeChecksumRequest) flags() int    { return isWrite }
+func (*InternalWriteBatchRequest) flags() int         { return isWrite | isRange }
 func (*InternalBatchRequest) flags() int              { return isWrite }
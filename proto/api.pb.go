@@ -71,9 +71,9 @@ const (
 	// mechanism relies on clocks to determine lease expirations.
 	CONSISTENT ReadConsistencyType = 0
 	// CONSENSUS requires that reads must achieve consensus. This is a
-	// stronger guarantee of consistency than CONSISTENT.
-	//
-	// TODO(spencer): current unimplemented.
+	// stronger guarantee of consistency than CONSISTENT. The leader
+	// confirms its leadership with a quorum of replicas and serves the
+	// read once it has applied all previously committed commands.
 	CONSENSUS ReadConsistencyType = 1
 	// INCONSISTENT reads return the latest available, committed values.
 	// They are more efficient, but may read stale values as pending
@@ -195,8 +195,13 @@ type RequestHeader struct {
 	// ReadConsistency specifies the consistency for read
 	// operations. The default is CONSISTENT. This value is ignored for
 	// write operations.
-	ReadConsistency  ReadConsistencyType `protobuf:"varint,10,opt,name=read_consistency,enum=cockroach.proto.ReadConsistencyType" json:"read_consistency"`
-	XXX_unrecognized []byte              `json:"-"`
+	ReadConsistency ReadConsistencyType `protobuf:"varint,10,opt,name=read_consistency,enum=cockroach.proto.ReadConsistencyType" json:"read_consistency"`
+	// MaxIntents is the number of write intents the request's
+	// transaction may hold once the request has executed. It is set by
+	// the range leader before proposing a transactional write, so that
+	// all replicas enforce the same limit. Zero means no limit.
+	MaxIntents       int64  `protobuf:"varint,11,opt,name=max_intents" json:"max_intents"`
+	XXX_unrecognized []byte `json:"-"`
 }
 
 func (m *RequestHeader) Reset()         { *m = RequestHeader{} }
@@ -261,6 +266,13 @@ func (m *RequestHeader) GetReadConsistency() ReadConsistencyType {
 	return CONSISTENT
 }
 
+func (m *RequestHeader) GetMaxIntents() int64 {
+	if m != nil {
+		return m.MaxIntents
+	}
+	return 0
+}
+
 // ResponseHeader is returned with every storage node response.
 type ResponseHeader struct {
 	// Error is non-nil if an error occurred.
@@ -276,8 +288,12 @@ type ResponseHeader struct {
 	// Transaction is non-nil if the request specified a non-nil
 	// transaction. The transaction timestamp and/or priority may have
 	// been updated, depending on the outcome of the request.
-	Txn              *Transaction `protobuf:"bytes,3,opt,name=txn" json:"txn,omitempty"`
-	XXX_unrecognized []byte       `json:"-"`
+	Txn *Transaction `protobuf:"bytes,3,opt,name=txn" json:"txn,omitempty"`
+	// IntentsWritten is the number of write intents laid down by the
+	// request. The counts of a range-spanning request are summed over
+	// all ranges it touched.
+	IntentsWritten   int64  `protobuf:"varint,4,opt,name=intents_written" json:"intents_written"`
+	XXX_unrecognized []byte `json:"-"`
 }
 
 func (m *ResponseHeader) Reset()         { *m = ResponseHeader{} }
@@ -305,6 +321,13 @@ func (m *ResponseHeader) GetTxn() *Transaction {
 	return nil
 }
 
+func (m *ResponseHeader) GetIntentsWritten() int64 {
+	if m != nil {
+		return m.IntentsWritten
+	}
+	return 0
+}
+
 // A GetRequest is arguments to the Get() method.
 type GetRequest struct {
 	RequestHeader    `protobuf:"bytes,1,opt,name=header,embedded=header" json:"header"`
@@ -1189,6 +1212,21 @@ func (m *RequestHeader) Unmarshal(data []byte) error {
 					break
 				}
 			}
+		case 11:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field MaxIntents", wireType)
+			}
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				m.MaxIntents |= (int64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			var sizeOfWire int
 			for {
@@ -1310,6 +1348,21 @@ func (m *ResponseHeader) Unmarshal(data []byte) error {
 				return err
 			}
 			index = postIndex
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field IntentsWritten", wireType)
+			}
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				m.IntentsWritten |= (int64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			var sizeOfWire int
 			for {
@@ -3824,6 +3877,7 @@ func (m *RequestHeader) Size() (n int) {
 		n += 1 + l + sovApi(uint64(l))
 	}
 	n += 1 + sovApi(uint64(m.ReadConsistency))
+	n += 1 + sovApi(uint64(m.MaxIntents))
 	if m.XXX_unrecognized != nil {
 		n += len(m.XXX_unrecognized)
 	}
@@ -3843,6 +3897,7 @@ func (m *ResponseHeader) Size() (n int) {
 		l = m.Txn.Size()
 		n += 1 + l + sovApi(uint64(l))
 	}
+	n += 1 + sovApi(uint64(m.IntentsWritten))
 	if m.XXX_unrecognized != nil {
 		n += len(m.XXX_unrecognized)
 	}
@@ -4342,6 +4397,9 @@ func (m *RequestHeader) MarshalTo(data []byte) (n int, err error) {
 	data[i] = 0x50
 	i++
 	i = encodeVarintApi(data, i, uint64(m.ReadConsistency))
+	data[i] = 0x58
+	i++
+	i = encodeVarintApi(data, i, uint64(m.MaxIntents))
 	if m.XXX_unrecognized != nil {
 		i += copy(data[i:], m.XXX_unrecognized)
 	}
@@ -4391,6 +4449,9 @@ func (m *ResponseHeader) MarshalTo(data []byte) (n int, err error) {
 		}
 		i += n9
 	}
+	data[i] = 0x20
+	i++
+	i = encodeVarintApi(data, i, uint64(m.IntentsWritten))
 	if m.XXX_unrecognized != nil {
 		i += copy(data[i:], m.XXX_unrecognized)
 	}
@@ -162,8 +162,11 @@ type ZoneConfig struct {
 	RangeMaxBytes int64        `protobuf:"varint,3,opt,name=range_max_bytes" json:"range_max_bytes" yaml:"range_max_bytes,omitempty"`
 	// If GC policy is not set, uses the next highest, non-null policy
 	// in the zone config hierarchy, up to the default policy if necessary.
-	GC               *GCPolicy `protobuf:"bytes,4,opt,name=gc" json:"gc,omitempty" yaml:"gc,omitempty"`
-	XXX_unrecognized []byte    `json:"-"`
+	GC *GCPolicy `protobuf:"bytes,4,opt,name=gc" json:"gc,omitempty" yaml:"gc,omitempty"`
+	// RangeMaxLiveBytes, if non-zero, is the number of live bytes
+	// above which a range is split, independent of its total size.
+	RangeMaxLiveBytes int64  `protobuf:"varint,5,opt,name=range_max_live_bytes" json:"range_max_live_bytes" yaml:"range_max_live_bytes,omitempty"`
+	XXX_unrecognized  []byte `json:"-"`
 }
 
 func (m *ZoneConfig) Reset()         { *m = ZoneConfig{} }
@@ -198,6 +201,13 @@ func (m *ZoneConfig) GetGC() *GCPolicy {
 	return nil
 }
 
+func (m *ZoneConfig) GetRangeMaxLiveBytes() int64 {
+	if m != nil {
+		return m.RangeMaxLiveBytes
+	}
+	return 0
+}
+
 // RangeTree holds the root node and size of the range tree.
 type RangeTree struct {
 	RootKey          Key    `protobuf:"bytes,1,opt,name=root_key,customtype=Key" json:"root_key"`
@@ -262,9 +272,14 @@ func (m *Addr) GetAddress() string {
 
 // StoreCapacity contains capacity information for a storage device.
 type StoreCapacity struct {
-	Capacity         int64  `protobuf:"varint,1,opt" json:"Capacity"`
-	Available        int64  `protobuf:"varint,2,opt" json:"Available"`
-	RangeCount       int32  `protobuf:"varint,3,opt" json:"RangeCount"`
+	Capacity   int64 `protobuf:"varint,1,opt" json:"Capacity"`
+	Available  int64 `protobuf:"varint,2,opt" json:"Available"`
+	RangeCount int32 `protobuf:"varint,3,opt" json:"RangeCount"`
+	// Used is the number of bytes in use on the storage device.
+	Used int64 `protobuf:"varint,4,opt" json:"Used"`
+	// LiveBytes is the sum of the live MVCC bytes of all ranges on the
+	// store.
+	LiveBytes        int64  `protobuf:"varint,5,opt" json:"LiveBytes"`
 	XXX_unrecognized []byte `json:"-"`
 }
 
@@ -293,6 +308,20 @@ func (m *StoreCapacity) GetRangeCount() int32 {
 	return 0
 }
 
+func (m *StoreCapacity) GetUsed() int64 {
+	if m != nil {
+		return m.Used
+	}
+	return 0
+}
+
+func (m *StoreCapacity) GetLiveBytes() int64 {
+	if m != nil {
+		return m.LiveBytes
+	}
+	return 0
+}
+
 // NodeDescriptor holds details on node physical/network topology.
 type NodeDescriptor struct {
 	NodeID           NodeID     `protobuf:"varint,1,opt,name=node_id,customtype=NodeID" json:"node_id"`
@@ -936,6 +965,21 @@ func (m *ZoneConfig) Unmarshal(data []byte) error {
 				return err
 			}
 			index = postIndex
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field RangeMaxLiveBytes", wireType)
+			}
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				m.RangeMaxLiveBytes |= (int64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			var sizeOfWire int
 			for {
@@ -1338,6 +1382,36 @@ func (m *StoreCapacity) Unmarshal(data []byte) error {
 					break
 				}
 			}
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Used", wireType)
+			}
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				m.Used |= (int64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field LiveBytes", wireType)
+			}
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				m.LiveBytes |= (int64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			var sizeOfWire int
 			for {
@@ -1701,6 +1775,7 @@ func (m *ZoneConfig) Size() (n int) {
 		l = m.GC.Size()
 		n += 1 + l + sovConfig(uint64(l))
 	}
+	n += 1 + sovConfig(uint64(m.RangeMaxLiveBytes))
 	if m.XXX_unrecognized != nil {
 		n += len(m.XXX_unrecognized)
 	}
@@ -1759,6 +1834,8 @@ func (m *StoreCapacity) Size() (n int) {
 	n += 1 + sovConfig(uint64(m.Capacity))
 	n += 1 + sovConfig(uint64(m.Available))
 	n += 1 + sovConfig(uint64(m.RangeCount))
+	n += 1 + sovConfig(uint64(m.Used))
+	n += 1 + sovConfig(uint64(m.LiveBytes))
 	if m.XXX_unrecognized != nil {
 		n += len(m.XXX_unrecognized)
 	}
@@ -2066,6 +2143,9 @@ func (m *ZoneConfig) MarshalTo(data []byte) (n int, err error) {
 		}
 		i += n3
 	}
+	data[i] = 0x28
+	i++
+	i = encodeVarintConfig(data, i, uint64(m.RangeMaxLiveBytes))
 	if m.XXX_unrecognized != nil {
 		i += copy(data[i:], m.XXX_unrecognized)
 	}
@@ -2219,6 +2299,12 @@ func (m *StoreCapacity) MarshalTo(data []byte) (n int, err error) {
 	data[i] = 0x18
 	i++
 	i = encodeVarintConfig(data, i, uint64(m.RangeCount))
+	data[i] = 0x20
+	i++
+	i = encodeVarintConfig(data, i, uint64(m.Used))
+	data[i] = 0x28
+	i++
+	i = encodeVarintConfig(data, i, uint64(m.LiveBytes))
 	if m.XXX_unrecognized != nil {
 		i += copy(data[i:], m.XXX_unrecognized)
 	}
@@ -78,17 +78,21 @@ func bytesNext(b []byte) []byte {
 	return append(append([]byte(nil), b...), 0)
 }
 
+// bytesPrefixEnd returns the smallest byte string which sorts after
+// all byte strings prefixed by b. Trailing \xff bytes are dropped and
+// the preceding byte incremented; a byte string consisting entirely of
+// \xff bytes has no such successor, and KeyMax is returned.
 func bytesPrefixEnd(b []byte) []byte {
 	end := append([]byte(nil), b...)
 	for i := len(end) - 1; i >= 0; i-- {
 		end[i] = end[i] + 1
 		if end[i] != 0 {
-			return end
+			return end[:i+1]
 		}
 	}
 	// This statement will only be reached if the key is already a
 	// maximal byte string (i.e. already \xff...).
-	return b
+	return KeyMax
 }
 
 // Next returns the next key in lexicographic sort order.
@@ -103,8 +107,9 @@ func (k EncodedKey) Next() EncodedKey {
 
 // PrefixEnd determines the end key given key as a prefix, that is the
 // key that sorts precisely behind all keys starting with prefix: "1"
-// is added to the final byte and the carry propagated. The special
-// cases of nil and KeyMin always returns KeyMax.
+// is added to the final byte and the carry propagated, dropping any
+// trailing \xff bytes. The special cases of nil, KeyMin and keys
+// consisting only of \xff bytes always return KeyMax.
 func (k Key) PrefixEnd() Key {
 	if len(k) == 0 {
 		return KeyMax
@@ -336,16 +341,29 @@ func (v *Value) InitChecksum(key []byte) {
 	}
 }
 
+// A ValueChecksumError indicates that a value's stored checksum does
+// not match the checksum computed from its key and contents, which
+// usually means the value was corrupted.
+type ValueChecksumError struct {
+	Key      Key
+	Expected uint32 // checksum stored with the value
+	Actual   uint32 // checksum computed from the key and value
+}
+
+// Error formats error.
+func (e *ValueChecksumError) Error() string {
+	return fmt.Sprintf("invalid checksum for key %s: expected %d, computed %d", e.Key, e.Expected, e.Actual)
+}
+
 // Verify verifies the value's Checksum matches a newly-computed
-// checksum of the value's contents. If the value's Checksum is not
-// set the verification is a noop. It also ensures that both Bytes
-// and Integer are not both set.
+// checksum of the value's contents, returning a ValueChecksumError on
+// mismatch. If the value's Checksum is not set the verification is a
+// noop. It also ensures that both Bytes and Integer are not both set.
 func (v *Value) Verify(key []byte) error {
 	if v.Checksum != nil {
 		cksum := v.computeChecksum(key)
 		if v.GetChecksum() != cksum {
-			return util.Errorf("invalid checksum (%d) for key %s, value [% x]",
-				cksum, Key(key), v)
+			return &ValueChecksumError{Key: Key(key), Expected: v.GetChecksum(), Actual: cksum}
 		}
 	}
 	if v.Bytes != nil && v.Integer != nil {
@@ -477,8 +495,14 @@ func (t *Transaction) Restart(userPriority, upgradePriority int32, timestamp Tim
 	t.OrigTimestamp = t.Timestamp
 	// Potentially upgrade priority both by creating a new random
 	// priority using userPriority and considering upgradePriority.
+	// The priority always increases on restart so that a transaction
+	// which repeatedly loses conflicts eventually prevails.
+	prevPriority := t.Priority
 	t.UpgradePriority(MakePriority(nil, userPriority))
 	t.UpgradePriority(upgradePriority)
+	if t.Priority == prevPriority && t.Priority < math.MaxInt32 {
+		t.Priority++
+	}
 }
 
 // Update ratchets priority, timestamp and original timestamp values (among
@@ -510,6 +534,22 @@ func (t *Transaction) Update(o *Transaction) {
 	t.CertainNodes = NodeList{Nodes: append(Int32Slice(nil),
 		o.CertainNodes.Nodes...)}
 	t.UpgradePriority(o.Priority)
+	// The coordinator has already summed the intents written on each
+	// range into o; see ResponseHeader.IntentsWritten.
+	if t.GetIntentCount() < o.GetIntentCount() {
+		t.SetIntentCount(o.GetIntentCount())
+	}
+}
+
+// SetIntentCount sets the number of write intents laid down by the
+// transaction. The count is left unset while it's zero, which keeps it
+// out of the serialized transaction.
+func (t *Transaction) SetIntentCount(count int64) {
+	if count == 0 {
+		t.IntentCount = nil
+		return
+	}
+	t.IntentCount = &count
 }
 
 // UpgradePriority sets transaction priority to the maximum of current
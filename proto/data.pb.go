@@ -514,8 +514,16 @@ type Transaction struct {
 	// Bits of this mechanism are found in the local sender, the range and the
 	// txn_coord_sender, with brief comments referring here.
 	// See https://github.com/cockroachdb/cockroach/pull/221.
-	CertainNodes     NodeList `protobuf:"bytes,12,opt,name=certain_nodes" json:"certain_nodes"`
-	XXX_unrecognized []byte   `json:"-"`
+	CertainNodes NodeList `protobuf:"bytes,12,opt,name=certain_nodes" json:"certain_nodes"`
+	// The number of write intents laid down by the transaction so far.
+	// Checked against the per-transaction intent limit on writes. Unset
+	// on the copies of the transaction stored with each intent.
+	IntentCount *int64 `protobuf:"varint,13,opt,name=intent_count" json:"intent_count,omitempty"`
+	// Set on a committed or aborted transaction record once all of the
+	// transaction's intents are known to have been resolved. Committed
+	// records may only be garbage collected after this has been set.
+	IntentsResolved  *bool  `protobuf:"varint,14,opt,name=intents_resolved" json:"intents_resolved,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
 }
 
 func (m *Transaction) Reset()      { *m = Transaction{} }
@@ -598,6 +606,20 @@ func (m *Transaction) GetCertainNodes() NodeList {
 	return NodeList{}
 }
 
+func (m *Transaction) GetIntentCount() int64 {
+	if m != nil && m.IntentCount != nil {
+		return *m.IntentCount
+	}
+	return 0
+}
+
+func (m *Transaction) GetIntentsResolved() bool {
+	if m != nil && m.IntentsResolved != nil {
+		return *m.IntentsResolved
+	}
+	return false
+}
+
 // Lease contains information about leader leases including the
 // expiration and lease holder.
 type Lease struct {
@@ -652,8 +674,11 @@ type MVCCMetadata struct {
 	// and subsequent version rows. If timestamp == (0, 0), then there
 	// is only a single MVCC metadata row with value inlined, and with
 	// empty timestamp, key_bytes, and val_bytes.
-	Value            *Value `protobuf:"bytes,6,opt,name=value" json:"value,omitempty"`
-	XXX_unrecognized []byte `json:"-"`
+	Value *Value `protobuf:"bytes,6,opt,name=value" json:"value,omitempty"`
+	// Expiration, if set, is the timestamp after which an inline value
+	// is treated as absent by reads and may be garbage collected.
+	Expiration       *Timestamp `protobuf:"bytes,7,opt,name=expiration" json:"expiration,omitempty"`
+	XXX_unrecognized []byte     `json:"-"`
 }
 
 func (m *MVCCMetadata) Reset()         { *m = MVCCMetadata{} }
@@ -702,6 +727,13 @@ func (m *MVCCMetadata) GetValue() *Value {
 	return nil
 }
 
+func (m *MVCCMetadata) GetExpiration() *Timestamp {
+	if m != nil {
+		return m.Expiration
+	}
+	return nil
+}
+
 // GCMetadata holds information about the last complete key/value
 // garbage collection scan of a range.
 type GCMetadata struct {
@@ -710,7 +742,14 @@ type GCMetadata struct {
 	// The oldest unresolved write intent in nanoseconds since epoch.
 	// Null if there are no unresolved write intents.
 	OldestIntentNanos *int64 `protobuf:"varint,2,opt,name=oldest_intent_nanos" json:"oldest_intent_nanos,omitempty"`
-	XXX_unrecognized  []byte `json:"-"`
+	// The GC TTL for the range in seconds. If set, overrides the TTL of
+	// the zone config's GC policy for this range.
+	TTLSeconds *int32 `protobuf:"varint,3,opt,name=ttl_seconds" json:"ttl_seconds,omitempty"`
+	// The GC threshold of the range. Versions older than this timestamp
+	// may have been garbage collected, so reads below it are refused.
+	// Null if the range has never been garbage collected.
+	Threshold        *Timestamp `protobuf:"bytes,4,opt,name=threshold" json:"threshold,omitempty"`
+	XXX_unrecognized []byte     `json:"-"`
 }
 
 func (m *GCMetadata) Reset()         { *m = GCMetadata{} }
@@ -731,6 +770,20 @@ func (m *GCMetadata) GetOldestIntentNanos() int64 {
 	return 0
 }
 
+func (m *GCMetadata) GetTTLSeconds() int32 {
+	if m != nil && m.TTLSeconds != nil {
+		return *m.TTLSeconds
+	}
+	return 0
+}
+
+func (m *GCMetadata) GetThreshold() *Timestamp {
+	if m != nil {
+		return m.Threshold
+	}
+	return nil
+}
+
 // MVCCStats tracks byte and instance counts for:
 //  - Live key/values (i.e. what a scan at current time will reveal;
 //    note that this includes intent keys and values, but not keys and
@@ -2239,6 +2292,41 @@ func (m *Transaction) Unmarshal(data []byte) error {
 				return err
 			}
 			index = postIndex
+		case 13:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field IntentCount", wireType)
+			}
+			var v int64
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				v |= (int64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.IntentCount = &v
+		case 14:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field IntentsResolved", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				v |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			b := bool(v != 0)
+			m.IntentsResolved = &b
 		default:
 			var sizeOfWire int
 			for {
@@ -2513,6 +2601,33 @@ func (m *MVCCMetadata) Unmarshal(data []byte) error {
 				return err
 			}
 			index = postIndex
+		case 7:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Expiration", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.Expiration == nil {
+				m.Expiration = &Timestamp{}
+			}
+			if err := m.Expiration.Unmarshal(data[index:postIndex]); err != nil {
+				return err
+			}
+			index = postIndex
 		default:
 			var sizeOfWire int
 			for {
@@ -2588,6 +2703,50 @@ func (m *GCMetadata) Unmarshal(data []byte) error {
 				}
 			}
 			m.OldestIntentNanos = &v
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field TTLSeconds", wireType)
+			}
+			var v int32
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				v |= (int32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.TTLSeconds = &v
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Threshold", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.Threshold == nil {
+				m.Threshold = &Timestamp{}
+			}
+			if err := m.Threshold.Unmarshal(data[index:postIndex]); err != nil {
+				return err
+			}
+			index = postIndex
 		default:
 			var sizeOfWire int
 			for {
@@ -3056,6 +3215,12 @@ func (m *Transaction) Size() (n int) {
 	n += 1 + l + sovData(uint64(l))
 	l = m.CertainNodes.Size()
 	n += 1 + l + sovData(uint64(l))
+	if m.IntentCount != nil {
+		n += 1 + sovData(uint64(*m.IntentCount))
+	}
+	if m.IntentsResolved != nil {
+		n += 2
+	}
 	if m.XXX_unrecognized != nil {
 		n += len(m.XXX_unrecognized)
 	}
@@ -3092,6 +3257,10 @@ func (m *MVCCMetadata) Size() (n int) {
 		l = m.Value.Size()
 		n += 1 + l + sovData(uint64(l))
 	}
+	if m.Expiration != nil {
+		l = m.Expiration.Size()
+		n += 1 + l + sovData(uint64(l))
+	}
 	if m.XXX_unrecognized != nil {
 		n += len(m.XXX_unrecognized)
 	}
@@ -3105,6 +3274,13 @@ func (m *GCMetadata) Size() (n int) {
 	if m.OldestIntentNanos != nil {
 		n += 1 + sovData(uint64(*m.OldestIntentNanos))
 	}
+	if m.TTLSeconds != nil {
+		n += 1 + sovData(uint64(*m.TTLSeconds))
+	}
+	if m.Threshold != nil {
+		l = m.Threshold.Size()
+		n += 1 + l + sovData(uint64(l))
+	}
 	if m.XXX_unrecognized != nil {
 		n += len(m.XXX_unrecognized)
 	}
@@ -3668,6 +3844,21 @@ func (m *Transaction) MarshalTo(data []byte) (n int, err error) {
 		return 0, err
 	}
 	i += n19
+	if m.IntentCount != nil {
+		data[i] = 0x68
+		i++
+		i = encodeVarintData(data, i, uint64(*m.IntentCount))
+	}
+	if m.IntentsResolved != nil {
+		data[i] = 0x70
+		i++
+		if *m.IntentsResolved {
+			data[i] = 1
+		} else {
+			data[i] = 0
+		}
+		i++
+	}
 	if m.XXX_unrecognized != nil {
 		i += copy(data[i:], m.XXX_unrecognized)
 	}
@@ -3771,6 +3962,16 @@ func (m *MVCCMetadata) MarshalTo(data []byte) (n int, err error) {
 		}
 		i += n24
 	}
+	if m.Expiration != nil {
+		data[i] = 0x3a
+		i++
+		i = encodeVarintData(data, i, uint64(m.Expiration.Size()))
+		n25, err := m.Expiration.MarshalTo(data[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n25
+	}
 	if m.XXX_unrecognized != nil {
 		i += copy(data[i:], m.XXX_unrecognized)
 	}
@@ -3800,6 +4001,21 @@ func (m *GCMetadata) MarshalTo(data []byte) (n int, err error) {
 		i++
 		i = encodeVarintData(data, i, uint64(*m.OldestIntentNanos))
 	}
+	if m.TTLSeconds != nil {
+		data[i] = 0x18
+		i++
+		i = encodeVarintData(data, i, uint64(*m.TTLSeconds))
+	}
+	if m.Threshold != nil {
+		data[i] = 0x22
+		i++
+		i = encodeVarintData(data, i, uint64(m.Threshold.Size()))
+		n26, err := m.Threshold.MarshalTo(data[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n26
+	}
 	if m.XXX_unrecognized != nil {
 		i += copy(data[i:], m.XXX_unrecognized)
 	}
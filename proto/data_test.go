@@ -73,18 +73,39 @@ func TestKeyPrefixEnd(t *testing.T) {
 	}{
 		{Key{}, KeyMax},
 		{Key{0}, Key{0x01}},
-		{Key{0xff}, Key{0xff}},
-		{Key{0xff, 0xff}, Key{0xff, 0xff}},
+		{Key{0xff}, KeyMax},
+		{Key{0xff, 0xff}, KeyMax},
+		{Key{0xff, 0xff, 0xff}, KeyMax},
 		{KeyMax, KeyMax},
 		{Key{0xff, 0xfe}, Key{0xff, 0xff}},
 		{Key{0x00, 0x00}, Key{0x00, 0x01}},
-		{Key{0x00, 0xff}, Key{0x01, 0x00}},
-		{Key{0x00, 0xff, 0xff}, Key{0x01, 0x00, 0x00}},
+		{Key{0x00, 0xff}, Key{0x01}},
+		{Key{0x00, 0xff, 0xff}, Key{0x01}},
+		{Key("a\xff"), Key("b")},
+		{Key("ab\xfe\xff"), Key("ab\xff")},
 	}
 	for i, c := range testCases {
 		if !bytes.Equal(c.key.PrefixEnd(), c.end) {
 			t.Errorf("%d: unexpected prefix end bytes for %q: %q", i, c.key, c.key.PrefixEnd())
 		}
+		if !bytes.Equal(EncodedKey(c.key).PrefixEnd(), c.end) {
+			t.Errorf("%d: unexpected encoded prefix end bytes for %q: %q", i, c.key, EncodedKey(c.key).PrefixEnd())
+		}
+	}
+
+	// The prefix end must sort after all keys with the prefix and no
+	// key without the prefix may sort between the prefix and its end.
+	prefix := Key("a\xff")
+	end := prefix.PrefixEnd()
+	for _, k := range []Key{prefix, Key("a\xff\x00"), Key("a\xff\xff\xff")} {
+		if !k.Less(end) {
+			t.Errorf("expected %q < prefix end %q", k, end)
+		}
+	}
+	for _, k := range []Key{Key("b"), Key("b\x00")} {
+		if k.Less(end) {
+			t.Errorf("expected sibling key %q >= prefix end %q", k, end)
+		}
 	}
 }
 
@@ -323,8 +344,13 @@ func TestValueChecksumWithBytes(t *testing.T) {
 	}
 	// Mess with value.
 	v.Bytes = []byte("abcd")
-	if err := v.Verify(k); err == nil {
-		t.Error("expected checksum verification failure on different value")
+	err := v.Verify(k)
+	cErr, ok := err.(*ValueChecksumError)
+	if !ok {
+		t.Fatalf("expected checksum verification failure on different value; got %v", err)
+	}
+	if !cErr.Key.Equal(k) || cErr.Expected != v.GetChecksum() || cErr.Actual != v.computeChecksum(k) {
+		t.Errorf("unexpected checksum error %+v", cErr)
 	}
 }
 
@@ -408,6 +434,25 @@ func TestTransactionString(t *testing.T) {
 	}
 }
 
+// TestTransactionRestartPriority verifies that a transaction's
+// priority increases on every restart, even when neither the random
+// nor the upgrade priority exceeds the current one.
+func TestTransactionRestartPriority(t *testing.T) {
+	txn := Transaction{Priority: math.MaxInt32 - 2}
+	for i := 0; i < 2; i++ {
+		prev := txn.Priority
+		txn.Restart(-1, 0, makeTS(0, 0))
+		if txn.Priority <= prev {
+			t.Errorf("%d: expected priority to increase from %d; got %d", i, prev, txn.Priority)
+		}
+	}
+	// The priority saturates at the maximum.
+	txn.Restart(-1, 0, makeTS(0, 0))
+	if txn.Priority != math.MaxInt32 {
+		t.Errorf("expected priority %d; got %d", math.MaxInt32, txn.Priority)
+	}
+}
+
 // TestNodeList verifies that its public methods Add() and Contain()
 // operate as expected.
 func TestNodeList(t *testing.T) {
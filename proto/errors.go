@@ -56,6 +56,17 @@ func (e *LeaseRejectedError) CanRetry() bool {
 	return false
 }
 
+// NewTxnIntentLimitExceededError initializes a new
+// TxnIntentLimitExceededError.
+func NewTxnIntentLimitExceededError(txn *Transaction, limit int64) *TxnIntentLimitExceededError {
+	return &TxnIntentLimitExceededError{Txn: *txn, Limit: limit}
+}
+
+// Error formats error.
+func (e *TxnIntentLimitExceededError) Error() string {
+	return fmt.Sprintf("txn %s exceeded limit of %d write intents", e.Txn, e.Limit)
+}
+
 // NewRangeNotFoundError initializes a new RangeNotFoundError.
 func NewRangeNotFoundError(raftID int64) *RangeNotFoundError {
 	return &RangeNotFoundError{
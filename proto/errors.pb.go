@@ -369,6 +369,32 @@ func (m *LeaseRejectedError) GetExisting() Lease {
 	return Lease{}
 }
 
+// A TxnIntentLimitExceededError indicates that a transaction tried to
+// lay down more write intents than the per-transaction limit allows.
+// The transaction should be aborted.
+type TxnIntentLimitExceededError struct {
+	Txn              Transaction `protobuf:"bytes,1,opt,name=txn" json:"txn"`
+	Limit            int64       `protobuf:"varint,2,opt,name=limit" json:"limit"`
+	XXX_unrecognized []byte      `json:"-"`
+}
+
+func (m *TxnIntentLimitExceededError) Reset()      { *m = TxnIntentLimitExceededError{} }
+func (*TxnIntentLimitExceededError) ProtoMessage() {}
+
+func (m *TxnIntentLimitExceededError) GetTxn() Transaction {
+	if m != nil {
+		return m.Txn
+	}
+	return Transaction{}
+}
+
+func (m *TxnIntentLimitExceededError) GetLimit() int64 {
+	if m != nil {
+		return m.Limit
+	}
+	return 0
+}
+
 // ErrorDetail is a union type containing all available errors.
 type ErrorDetail struct {
 	NotLeader                     *NotLeaderError                     `protobuf:"bytes,1,opt,name=not_leader" json:"not_leader,omitempty"`
@@ -384,6 +410,7 @@ type ErrorDetail struct {
 	OpRequiresTxn                 *OpRequiresTxnError                 `protobuf:"bytes,11,opt,name=op_requires_txn" json:"op_requires_txn,omitempty"`
 	ConditionFailed               *ConditionFailedError               `protobuf:"bytes,12,opt,name=condition_failed" json:"condition_failed,omitempty"`
 	LeaseRejected                 *LeaseRejectedError                 `protobuf:"bytes,13,opt,name=lease_rejected" json:"lease_rejected,omitempty"`
+	TxnIntentLimitExceeded        *TxnIntentLimitExceededError        `protobuf:"bytes,14,opt,name=txn_intent_limit_exceeded" json:"txn_intent_limit_exceeded,omitempty"`
 	XXX_unrecognized              []byte                              `json:"-"`
 }
 
@@ -481,6 +508,13 @@ func (m *ErrorDetail) GetLeaseRejected() *LeaseRejectedError {
 	return nil
 }
 
+func (m *ErrorDetail) GetTxnIntentLimitExceeded() *TxnIntentLimitExceededError {
+	if m != nil {
+		return m.TxnIntentLimitExceeded
+	}
+	return nil
+}
+
 // Error is a generic representation including a string message
 // and information about retryability.
 type Error struct {
@@ -1683,6 +1717,88 @@ func (m *LeaseRejectedError) Unmarshal(data []byte) error {
 
 	return nil
 }
+func (m *TxnIntentLimitExceededError) Unmarshal(data []byte) error {
+	l := len(data)
+	index := 0
+	for index < l {
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if index >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := data[index]
+			index++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Txn", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := m.Txn.Unmarshal(data[index:postIndex]); err != nil {
+				return err
+			}
+			index = postIndex
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Limit", wireType)
+			}
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				m.Limit |= (int64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			var sizeOfWire int
+			for {
+				sizeOfWire++
+				wire >>= 7
+				if wire == 0 {
+					break
+				}
+			}
+			index -= sizeOfWire
+			skippy, err := github_com_gogo_protobuf_proto.Skip(data[index:])
+			if err != nil {
+				return err
+			}
+			if (index + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, data[index:index+skippy]...)
+			index += skippy
+		}
+	}
+
+	return nil
+}
 func (m *ErrorDetail) Unmarshal(data []byte) error {
 	l := len(data)
 	index := 0
@@ -2053,6 +2169,33 @@ func (m *ErrorDetail) Unmarshal(data []byte) error {
 				return err
 			}
 			index = postIndex
+		case 14:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field TxnIntentLimitExceeded", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.TxnIntentLimitExceeded == nil {
+				m.TxnIntentLimitExceeded = &TxnIntentLimitExceededError{}
+			}
+			if err := m.TxnIntentLimitExceeded.Unmarshal(data[index:postIndex]); err != nil {
+				return err
+			}
+			index = postIndex
 		default:
 			var sizeOfWire int
 			for {
@@ -2241,6 +2384,9 @@ func (this *ErrorDetail) GetValue() interface{} {
 	if this.LeaseRejected != nil {
 		return this.LeaseRejected
 	}
+	if this.TxnIntentLimitExceeded != nil {
+		return this.TxnIntentLimitExceeded
+	}
 	return nil
 }
 
@@ -2272,6 +2418,8 @@ func (this *ErrorDetail) SetValue(value interface{}) bool {
 		this.ConditionFailed = vt
 	case *LeaseRejectedError:
 		this.LeaseRejected = vt
+	case *TxnIntentLimitExceededError:
+		this.TxnIntentLimitExceeded = vt
 	default:
 		return false
 	}
@@ -2461,6 +2609,18 @@ func (m *LeaseRejectedError) Size() (n int) {
 	return n
 }
 
+func (m *TxnIntentLimitExceededError) Size() (n int) {
+	var l int
+	_ = l
+	l = m.Txn.Size()
+	n += 1 + l + sovErrors(uint64(l))
+	n += 1 + sovErrors(uint64(m.Limit))
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
 func (m *ErrorDetail) Size() (n int) {
 	var l int
 	_ = l
@@ -2516,6 +2676,10 @@ func (m *ErrorDetail) Size() (n int) {
 		l = m.LeaseRejected.Size()
 		n += 1 + l + sovErrors(uint64(l))
 	}
+	if m.TxnIntentLimitExceeded != nil {
+		l = m.TxnIntentLimitExceeded.Size()
+		n += 1 + l + sovErrors(uint64(l))
+	}
 	if m.XXX_unrecognized != nil {
 		n += len(m.XXX_unrecognized)
 	}
@@ -3035,6 +3199,38 @@ func (m *LeaseRejectedError) MarshalTo(data []byte) (n int, err error) {
 	return i, nil
 }
 
+func (m *TxnIntentLimitExceededError) Marshal() (data []byte, err error) {
+	size := m.Size()
+	data = make([]byte, size)
+	n, err := m.MarshalTo(data)
+	if err != nil {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+func (m *TxnIntentLimitExceededError) MarshalTo(data []byte) (n int, err error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	data[i] = 0xa
+	i++
+	i = encodeVarintErrors(data, i, uint64(m.Txn.Size()))
+	n20, err := m.Txn.MarshalTo(data[i:])
+	if err != nil {
+		return 0, err
+	}
+	i += n20
+	data[i] = 0x10
+	i++
+	i = encodeVarintErrors(data, i, uint64(m.Limit))
+	if m.XXX_unrecognized != nil {
+		i += copy(data[i:], m.XXX_unrecognized)
+	}
+	return i, nil
+}
+
 func (m *ErrorDetail) Marshal() (data []byte, err error) {
 	size := m.Size()
 	data = make([]byte, size)
@@ -3180,6 +3376,16 @@ func (m *ErrorDetail) MarshalTo(data []byte) (n int, err error) {
 		}
 		i += n32
 	}
+	if m.TxnIntentLimitExceeded != nil {
+		data[i] = 0x72
+		i++
+		i = encodeVarintErrors(data, i, uint64(m.TxnIntentLimitExceeded.Size()))
+		n33, err := m.TxnIntentLimitExceeded.MarshalTo(data[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n33
+	}
 	if m.XXX_unrecognized != nil {
 		i += copy(data[i:], m.XXX_unrecognized)
 	}
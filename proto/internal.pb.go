@@ -469,6 +469,75 @@ func (m *InternalLeaderLeaseResponse) Reset()         { *m = InternalLeaderLease
 func (m *InternalLeaderLeaseResponse) String() string { return proto1.CompactTextString(m) }
 func (*InternalLeaderLeaseResponse) ProtoMessage()    {}
 
+// An InternalComputeChecksumRequest is arguments to the
+// InternalComputeChecksum() method. Since it is sent via raft, each
+// replica computes the checksum of the range's data at the same point
+// in the raft log, which makes the checksums of consistent replicas
+// identical.
+type InternalComputeChecksumRequest struct {
+	RequestHeader    `protobuf:"bytes,1,opt,name=header,embedded=header" json:"header"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *InternalComputeChecksumRequest) Reset()         { *m = InternalComputeChecksumRequest{} }
+func (m *InternalComputeChecksumRequest) String() string { return proto1.CompactTextString(m) }
+func (*InternalComputeChecksumRequest) ProtoMessage()    {}
+
+// An InternalComputeChecksumResponse is the response to an
+// InternalComputeChecksum() operation.
+type InternalComputeChecksumResponse struct {
+	ResponseHeader `protobuf:"bytes,1,opt,name=header,embedded=header" json:"header"`
+	// The SHA-512 checksum of the range's data computed by the replica
+	// which served the request.
+	Checksum         []byte `protobuf:"bytes,2,opt,name=checksum" json:"checksum,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *InternalComputeChecksumResponse) Reset()         { *m = InternalComputeChecksumResponse{} }
+func (m *InternalComputeChecksumResponse) String() string { return proto1.CompactTextString(m) }
+func (*InternalComputeChecksumResponse) ProtoMessage()    {}
+
+func (m *InternalComputeChecksumResponse) GetChecksum() []byte {
+	if m != nil {
+		return m.Checksum
+	}
+	return nil
+}
+
+// An InternalWriteBatchRequest is arguments to the
+// InternalWriteBatch() method. It carries a serialized RocksDB write
+// batch which is applied atomically to the range's data.
+type InternalWriteBatchRequest struct {
+	RequestHeader `protobuf:"bytes,1,opt,name=header,embedded=header" json:"header"`
+	// The serialized RocksDB write batch, optionally with prefix
+	// compressed keys. All of its keys must be MVCC-encoded and lie
+	// within the request's key span.
+	Repr             []byte `protobuf:"bytes,2,opt,name=repr" json:"repr,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *InternalWriteBatchRequest) Reset()         { *m = InternalWriteBatchRequest{} }
+func (m *InternalWriteBatchRequest) String() string { return proto1.CompactTextString(m) }
+func (*InternalWriteBatchRequest) ProtoMessage()    {}
+
+func (m *InternalWriteBatchRequest) GetRepr() []byte {
+	if m != nil {
+		return m.Repr
+	}
+	return nil
+}
+
+// An InternalWriteBatchResponse is the response to an
+// InternalWriteBatch() operation.
+type InternalWriteBatchResponse struct {
+	ResponseHeader   `protobuf:"bytes,1,opt,name=header,embedded=header" json:"header"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *InternalWriteBatchResponse) Reset()         { *m = InternalWriteBatchResponse{} }
+func (m *InternalWriteBatchResponse) String() string { return proto1.CompactTextString(m) }
+func (*InternalWriteBatchResponse) ProtoMessage()    {}
+
 // An InternalRequestUnion contains exactly one of the optional requests.
 // Non-internal values added to RequestUnion must be added here.
 type InternalRequestUnion struct {
@@ -854,6 +923,8 @@ type InternalRaftCommandUnion struct {
 	InternalGC                 *InternalGCRequest                 `protobuf:"bytes,38,opt,name=internal_gc" json:"internal_gc,omitempty"`
 	InternalLease              *InternalLeaderLeaseRequest        `protobuf:"bytes,39,opt,name=internal_lease" json:"internal_lease,omitempty"`
 	InternalBatch              *InternalBatchRequest              `protobuf:"bytes,40,opt,name=internal_batch" json:"internal_batch,omitempty"`
+	InternalComputeChecksum    *InternalComputeChecksumRequest    `protobuf:"bytes,41,opt,name=internal_compute_checksum" json:"internal_compute_checksum,omitempty"`
+	InternalWriteBatch         *InternalWriteBatchRequest         `protobuf:"bytes,42,opt,name=internal_write_batch" json:"internal_write_batch,omitempty"`
 	XXX_unrecognized           []byte                             `json:"-"`
 }
 
@@ -994,6 +1065,20 @@ func (m *InternalRaftCommandUnion) GetInternalBatch() *InternalBatchRequest {
 	return nil
 }
 
+func (m *InternalRaftCommandUnion) GetInternalComputeChecksum() *InternalComputeChecksumRequest {
+	if m != nil {
+		return m.InternalComputeChecksum
+	}
+	return nil
+}
+
+func (m *InternalRaftCommandUnion) GetInternalWriteBatch() *InternalWriteBatchRequest {
+	if m != nil {
+		return m.InternalWriteBatch
+	}
+	return nil
+}
+
 // An InternalRaftCommand is a command which can be serialized and
 // sent via raft.
 type InternalRaftCommand struct {
@@ -1039,7 +1124,16 @@ type RaftMessageRequest struct {
 	// The raft payload, an encoded raftpb.Message. We transmit the message as
 	// an opaque blob to avoid the complexity of importing proto files across
 	// packages.
-	Msg              []byte `protobuf:"bytes,2,opt,name=msg" json:"msg,omitempty"`
+	Msg []byte `protobuf:"bytes,2,opt,name=msg" json:"msg,omitempty"`
+	// Large snapshot messages are split into chunks of at most a
+	// configured size and sent as a sequence of requests sharing a
+	// snapshot_id. Msg then holds chunk chunk_index of chunk_count of the
+	// encoded message; the receiver reassembles the chunks before
+	// delivering the message. A chunk_count of zero denotes an unchunked
+	// message.
+	SnapshotID       uint64 `protobuf:"varint,3,opt,name=snapshot_id" json:"snapshot_id"`
+	ChunkIndex       uint32 `protobuf:"varint,4,opt,name=chunk_index" json:"chunk_index"`
+	ChunkCount       uint32 `protobuf:"varint,5,opt,name=chunk_count" json:"chunk_count"`
 	XXX_unrecognized []byte `json:"-"`
 }
 
@@ -1061,6 +1155,27 @@ func (m *RaftMessageRequest) GetMsg() []byte {
 	return nil
 }
 
+func (m *RaftMessageRequest) GetSnapshotID() uint64 {
+	if m != nil {
+		return m.SnapshotID
+	}
+	return 0
+}
+
+func (m *RaftMessageRequest) GetChunkIndex() uint32 {
+	if m != nil {
+		return m.ChunkIndex
+	}
+	return 0
+}
+
+func (m *RaftMessageRequest) GetChunkCount() uint32 {
+	if m != nil {
+		return m.ChunkCount
+	}
+	return 0
+}
+
 // RaftMessageResponse is an empty message returned by raft RPCs.
 type RaftMessageResponse struct {
 	XXX_unrecognized []byte `json:"-"`
@@ -2847,6 +2962,318 @@ func (m *InternalLeaderLeaseResponse) Unmarshal(data []byte) error {
 
 	return nil
 }
+func (m *InternalComputeChecksumRequest) Unmarshal(data []byte) error {
+	l := len(data)
+	index := 0
+	for index < l {
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if index >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := data[index]
+			index++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field RequestHeader", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := m.RequestHeader.Unmarshal(data[index:postIndex]); err != nil {
+				return err
+			}
+			index = postIndex
+		default:
+			var sizeOfWire int
+			for {
+				sizeOfWire++
+				wire >>= 7
+				if wire == 0 {
+					break
+				}
+			}
+			index -= sizeOfWire
+			skippy, err := github_com_gogo_protobuf_proto.Skip(data[index:])
+			if err != nil {
+				return err
+			}
+			if (index + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, data[index:index+skippy]...)
+			index += skippy
+		}
+	}
+
+	return nil
+}
+func (m *InternalComputeChecksumResponse) Unmarshal(data []byte) error {
+	l := len(data)
+	index := 0
+	for index < l {
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if index >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := data[index]
+			index++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ResponseHeader", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := m.ResponseHeader.Unmarshal(data[index:postIndex]); err != nil {
+				return err
+			}
+			index = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Checksum", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				byteLen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + byteLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Checksum = append([]byte{}, data[index:postIndex]...)
+			index = postIndex
+		default:
+			var sizeOfWire int
+			for {
+				sizeOfWire++
+				wire >>= 7
+				if wire == 0 {
+					break
+				}
+			}
+			index -= sizeOfWire
+			skippy, err := github_com_gogo_protobuf_proto.Skip(data[index:])
+			if err != nil {
+				return err
+			}
+			if (index + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, data[index:index+skippy]...)
+			index += skippy
+		}
+	}
+
+	return nil
+}
+func (m *InternalWriteBatchRequest) Unmarshal(data []byte) error {
+	l := len(data)
+	index := 0
+	for index < l {
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if index >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := data[index]
+			index++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field RequestHeader", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := m.RequestHeader.Unmarshal(data[index:postIndex]); err != nil {
+				return err
+			}
+			index = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Repr", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				byteLen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + byteLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Repr = append([]byte{}, data[index:postIndex]...)
+			index = postIndex
+		default:
+			var sizeOfWire int
+			for {
+				sizeOfWire++
+				wire >>= 7
+				if wire == 0 {
+					break
+				}
+			}
+			index -= sizeOfWire
+			skippy, err := github_com_gogo_protobuf_proto.Skip(data[index:])
+			if err != nil {
+				return err
+			}
+			if (index + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, data[index:index+skippy]...)
+			index += skippy
+		}
+	}
+
+	return nil
+}
+func (m *InternalWriteBatchResponse) Unmarshal(data []byte) error {
+	l := len(data)
+	index := 0
+	for index < l {
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if index >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := data[index]
+			index++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ResponseHeader", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := m.ResponseHeader.Unmarshal(data[index:postIndex]); err != nil {
+				return err
+			}
+			index = postIndex
+		default:
+			var sizeOfWire int
+			for {
+				sizeOfWire++
+				wire >>= 7
+				if wire == 0 {
+					break
+				}
+			}
+			index -= sizeOfWire
+			skippy, err := github_com_gogo_protobuf_proto.Skip(data[index:])
+			if err != nil {
+				return err
+			}
+			if (index + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, data[index:index+skippy]...)
+			index += skippy
+		}
+	}
+
+	return nil
+}
 func (m *InternalRequestUnion) Unmarshal(data []byte) error {
 	l := len(data)
 	index := 0
@@ -4525,13 +4952,67 @@ func (m *InternalRaftCommandUnion) Unmarshal(data []byte) error {
 			if m.InternalResolveIntentRange == nil {
 				m.InternalResolveIntentRange = &InternalResolveIntentRangeRequest{}
 			}
-			if err := m.InternalResolveIntentRange.Unmarshal(data[index:postIndex]); err != nil {
+			if err := m.InternalResolveIntentRange.Unmarshal(data[index:postIndex]); err != nil {
+				return err
+			}
+			index = postIndex
+		case 36:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field InternalMergeResponse", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.InternalMergeResponse == nil {
+				m.InternalMergeResponse = &InternalMergeRequest{}
+			}
+			if err := m.InternalMergeResponse.Unmarshal(data[index:postIndex]); err != nil {
+				return err
+			}
+			index = postIndex
+		case 37:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field InternalTruncateLog", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.InternalTruncateLog == nil {
+				m.InternalTruncateLog = &InternalTruncateLogRequest{}
+			}
+			if err := m.InternalTruncateLog.Unmarshal(data[index:postIndex]); err != nil {
 				return err
 			}
 			index = postIndex
-		case 36:
+		case 38:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field InternalMergeResponse", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field InternalGC", wireType)
 			}
 			var msglen int
 			for shift := uint(0); ; shift += 7 {
@@ -4549,16 +5030,16 @@ func (m *InternalRaftCommandUnion) Unmarshal(data []byte) error {
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			if m.InternalMergeResponse == nil {
-				m.InternalMergeResponse = &InternalMergeRequest{}
+			if m.InternalGC == nil {
+				m.InternalGC = &InternalGCRequest{}
 			}
-			if err := m.InternalMergeResponse.Unmarshal(data[index:postIndex]); err != nil {
+			if err := m.InternalGC.Unmarshal(data[index:postIndex]); err != nil {
 				return err
 			}
 			index = postIndex
-		case 37:
+		case 39:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field InternalTruncateLog", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field InternalLease", wireType)
 			}
 			var msglen int
 			for shift := uint(0); ; shift += 7 {
@@ -4576,16 +5057,16 @@ func (m *InternalRaftCommandUnion) Unmarshal(data []byte) error {
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			if m.InternalTruncateLog == nil {
-				m.InternalTruncateLog = &InternalTruncateLogRequest{}
+			if m.InternalLease == nil {
+				m.InternalLease = &InternalLeaderLeaseRequest{}
 			}
-			if err := m.InternalTruncateLog.Unmarshal(data[index:postIndex]); err != nil {
+			if err := m.InternalLease.Unmarshal(data[index:postIndex]); err != nil {
 				return err
 			}
 			index = postIndex
-		case 38:
+		case 40:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field InternalGC", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field InternalBatch", wireType)
 			}
 			var msglen int
 			for shift := uint(0); ; shift += 7 {
@@ -4603,16 +5084,16 @@ func (m *InternalRaftCommandUnion) Unmarshal(data []byte) error {
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			if m.InternalGC == nil {
-				m.InternalGC = &InternalGCRequest{}
+			if m.InternalBatch == nil {
+				m.InternalBatch = &InternalBatchRequest{}
 			}
-			if err := m.InternalGC.Unmarshal(data[index:postIndex]); err != nil {
+			if err := m.InternalBatch.Unmarshal(data[index:postIndex]); err != nil {
 				return err
 			}
 			index = postIndex
-		case 39:
+		case 41:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field InternalLease", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field InternalComputeChecksum", wireType)
 			}
 			var msglen int
 			for shift := uint(0); ; shift += 7 {
@@ -4630,16 +5111,16 @@ func (m *InternalRaftCommandUnion) Unmarshal(data []byte) error {
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			if m.InternalLease == nil {
-				m.InternalLease = &InternalLeaderLeaseRequest{}
+			if m.InternalComputeChecksum == nil {
+				m.InternalComputeChecksum = &InternalComputeChecksumRequest{}
 			}
-			if err := m.InternalLease.Unmarshal(data[index:postIndex]); err != nil {
+			if err := m.InternalComputeChecksum.Unmarshal(data[index:postIndex]); err != nil {
 				return err
 			}
 			index = postIndex
-		case 40:
+		case 42:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field InternalBatch", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field InternalWriteBatch", wireType)
 			}
 			var msglen int
 			for shift := uint(0); ; shift += 7 {
@@ -4657,10 +5138,10 @@ func (m *InternalRaftCommandUnion) Unmarshal(data []byte) error {
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			if m.InternalBatch == nil {
-				m.InternalBatch = &InternalBatchRequest{}
+			if m.InternalWriteBatch == nil {
+				m.InternalWriteBatch = &InternalWriteBatchRequest{}
 			}
-			if err := m.InternalBatch.Unmarshal(data[index:postIndex]); err != nil {
+			if err := m.InternalWriteBatch.Unmarshal(data[index:postIndex]); err != nil {
 				return err
 			}
 			index = postIndex
@@ -4841,6 +5322,51 @@ func (m *RaftMessageRequest) Unmarshal(data []byte) error {
 			}
 			m.Msg = append([]byte{}, data[index:postIndex]...)
 			index = postIndex
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SnapshotID", wireType)
+			}
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				m.SnapshotID |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ChunkIndex", wireType)
+			}
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				m.ChunkIndex |= (uint32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ChunkCount", wireType)
+			}
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				m.ChunkCount |= (uint32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			var sizeOfWire int
 			for {
@@ -5636,6 +6162,12 @@ func (this *InternalRaftCommandUnion) GetValue() interface{} {
 	if this.InternalBatch != nil {
 		return this.InternalBatch
 	}
+	if this.InternalComputeChecksum != nil {
+		return this.InternalComputeChecksum
+	}
+	if this.InternalWriteBatch != nil {
+		return this.InternalWriteBatch
+	}
 	return nil
 }
 
@@ -5679,6 +6211,10 @@ func (this *InternalRaftCommandUnion) SetValue(value interface{}) bool {
 		this.InternalLease = vt
 	case *InternalBatchRequest:
 		this.InternalBatch = vt
+	case *InternalComputeChecksumRequest:
+		this.InternalComputeChecksum = vt
+	case *InternalWriteBatchRequest:
+		this.InternalWriteBatch = vt
 	default:
 		return false
 	}
@@ -5926,6 +6462,57 @@ func (m *InternalLeaderLeaseResponse) Size() (n int) {
 	return n
 }
 
+func (m *InternalComputeChecksumRequest) Size() (n int) {
+	var l int
+	_ = l
+	l = m.RequestHeader.Size()
+	n += 1 + l + sovInternal(uint64(l))
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *InternalComputeChecksumResponse) Size() (n int) {
+	var l int
+	_ = l
+	l = m.ResponseHeader.Size()
+	n += 1 + l + sovInternal(uint64(l))
+	if m.Checksum != nil {
+		l = len(m.Checksum)
+		n += 1 + l + sovInternal(uint64(l))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *InternalWriteBatchRequest) Size() (n int) {
+	var l int
+	_ = l
+	l = m.RequestHeader.Size()
+	n += 1 + l + sovInternal(uint64(l))
+	if m.Repr != nil {
+		l = len(m.Repr)
+		n += 1 + l + sovInternal(uint64(l))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+func (m *InternalWriteBatchResponse) Size() (n int) {
+	var l int
+	_ = l
+	l = m.ResponseHeader.Size()
+	n += 1 + l + sovInternal(uint64(l))
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
 func (m *InternalRequestUnion) Size() (n int) {
 	var l int
 	_ = l
@@ -6210,6 +6797,14 @@ func (m *InternalRaftCommandUnion) Size() (n int) {
 		l = m.InternalBatch.Size()
 		n += 2 + l + sovInternal(uint64(l))
 	}
+	if m.InternalComputeChecksum != nil {
+		l = m.InternalComputeChecksum.Size()
+		n += 2 + l + sovInternal(uint64(l))
+	}
+	if m.InternalWriteBatch != nil {
+		l = m.InternalWriteBatch.Size()
+		n += 2 + l + sovInternal(uint64(l))
+	}
 	if m.XXX_unrecognized != nil {
 		n += len(m.XXX_unrecognized)
 	}
@@ -6237,6 +6832,9 @@ func (m *RaftMessageRequest) Size() (n int) {
 		l = len(m.Msg)
 		n += 1 + l + sovInternal(uint64(l))
 	}
+	n += 1 + sovInternal(uint64(m.SnapshotID))
+	n += 1 + sovInternal(uint64(m.ChunkIndex))
+	n += 1 + sovInternal(uint64(m.ChunkCount))
 	if m.XXX_unrecognized != nil {
 		n += len(m.XXX_unrecognized)
 	}
@@ -7001,6 +7599,133 @@ func (m *InternalLeaderLeaseResponse) MarshalTo(data []byte) (n int, err error)
 	return i, nil
 }
 
+func (m *InternalComputeChecksumRequest) Marshal() (data []byte, err error) {
+	size := m.Size()
+	data = make([]byte, size)
+	n, err := m.MarshalTo(data)
+	if err != nil {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+func (m *InternalComputeChecksumRequest) MarshalTo(data []byte) (n int, err error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	data[i] = 0xa
+	i++
+	i = encodeVarintInternal(data, i, uint64(m.RequestHeader.Size()))
+	n85, err := m.RequestHeader.MarshalTo(data[i:])
+	if err != nil {
+		return 0, err
+	}
+	i += n85
+	if m.XXX_unrecognized != nil {
+		i += copy(data[i:], m.XXX_unrecognized)
+	}
+	return i, nil
+}
+
+func (m *InternalComputeChecksumResponse) Marshal() (data []byte, err error) {
+	size := m.Size()
+	data = make([]byte, size)
+	n, err := m.MarshalTo(data)
+	if err != nil {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+func (m *InternalComputeChecksumResponse) MarshalTo(data []byte) (n int, err error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	data[i] = 0xa
+	i++
+	i = encodeVarintInternal(data, i, uint64(m.ResponseHeader.Size()))
+	n86, err := m.ResponseHeader.MarshalTo(data[i:])
+	if err != nil {
+		return 0, err
+	}
+	i += n86
+	if m.Checksum != nil {
+		data[i] = 0x12
+		i++
+		i = encodeVarintInternal(data, i, uint64(len(m.Checksum)))
+		i += copy(data[i:], m.Checksum)
+	}
+	if m.XXX_unrecognized != nil {
+		i += copy(data[i:], m.XXX_unrecognized)
+	}
+	return i, nil
+}
+
+func (m *InternalWriteBatchRequest) Marshal() (data []byte, err error) {
+	size := m.Size()
+	data = make([]byte, size)
+	n, err := m.MarshalTo(data)
+	if err != nil {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+func (m *InternalWriteBatchRequest) MarshalTo(data []byte) (n int, err error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	data[i] = 0xa
+	i++
+	i = encodeVarintInternal(data, i, uint64(m.RequestHeader.Size()))
+	n88, err := m.RequestHeader.MarshalTo(data[i:])
+	if err != nil {
+		return 0, err
+	}
+	i += n88
+	if m.Repr != nil {
+		data[i] = 0x12
+		i++
+		i = encodeVarintInternal(data, i, uint64(len(m.Repr)))
+		i += copy(data[i:], m.Repr)
+	}
+	if m.XXX_unrecognized != nil {
+		i += copy(data[i:], m.XXX_unrecognized)
+	}
+	return i, nil
+}
+func (m *InternalWriteBatchResponse) Marshal() (data []byte, err error) {
+	size := m.Size()
+	data = make([]byte, size)
+	n, err := m.MarshalTo(data)
+	if err != nil {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+func (m *InternalWriteBatchResponse) MarshalTo(data []byte) (n int, err error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	data[i] = 0xa
+	i++
+	i = encodeVarintInternal(data, i, uint64(m.ResponseHeader.Size()))
+	n89, err := m.ResponseHeader.MarshalTo(data[i:])
+	if err != nil {
+		return 0, err
+	}
+	i += n89
+	if m.XXX_unrecognized != nil {
+		i += copy(data[i:], m.XXX_unrecognized)
+	}
+	return i, nil
+}
+
 func (m *InternalRequestUnion) Marshal() (data []byte, err error) {
 	size := m.Size()
 	data = make([]byte, size)
@@ -7749,6 +8474,30 @@ func (m *InternalRaftCommandUnion) MarshalTo(data []byte) (n int, err error) {
 		}
 		i += n83
 	}
+	if m.InternalComputeChecksum != nil {
+		data[i] = 0xca
+		i++
+		data[i] = 0x2
+		i++
+		i = encodeVarintInternal(data, i, uint64(m.InternalComputeChecksum.Size()))
+		n87, err := m.InternalComputeChecksum.MarshalTo(data[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n87
+	}
+	if m.InternalWriteBatch != nil {
+		data[i] = 0xd2
+		i++
+		data[i] = 0x2
+		i++
+		i = encodeVarintInternal(data, i, uint64(m.InternalWriteBatch.Size()))
+		n90, err := m.InternalWriteBatch.MarshalTo(data[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n90
+	}
 	if m.XXX_unrecognized != nil {
 		i += copy(data[i:], m.XXX_unrecognized)
 	}
@@ -7814,6 +8563,15 @@ func (m *RaftMessageRequest) MarshalTo(data []byte) (n int, err error) {
 		i = encodeVarintInternal(data, i, uint64(len(m.Msg)))
 		i += copy(data[i:], m.Msg)
 	}
+	data[i] = 0x18
+	i++
+	i = encodeVarintInternal(data, i, uint64(m.SnapshotID))
+	data[i] = 0x20
+	i++
+	i = encodeVarintInternal(data, i, uint64(m.ChunkIndex))
+	data[i] = 0x28
+	i++
+	i = encodeVarintInternal(data, i, uint64(m.ChunkCount))
 	if m.XXX_unrecognized != nil {
 		i += copy(data[i:], m.XXX_unrecognized)
 	}
@@ -105,6 +105,12 @@ const (
 	InternalTruncateLog
 	// InternalLeaderLease requests a leader lease for a replica.
 	InternalLeaderLease
+	// InternalComputeChecksum computes a checksum of the range's data on
+	// each of its replicas.
+	InternalComputeChecksum
+	// InternalWriteBatch applies a serialized RocksDB write batch to the
+	// range's data.
+	InternalWriteBatch
 	// InternalBatch implements batch processing of commands. This is a
 	// superset of the Batch method.
 	InternalBatch
@@ -133,5 +139,7 @@ var AllMethods = map[string]Method{
 	InternalMerge.String():              InternalMerge,
 	InternalTruncateLog.String():        InternalTruncateLog,
 	InternalLeaderLease.String():        InternalLeaderLease,
+	InternalComputeChecksum.String():    InternalComputeChecksum,
+	InternalWriteBatch.String():         InternalWriteBatch,
 	InternalBatch.String():              InternalBatch,
 }
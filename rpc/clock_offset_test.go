@@ -24,6 +24,7 @@ import (
 	"time"
 
 	"github.com/cockroachdb/cockroach/proto"
+	"github.com/cockroachdb/cockroach/util"
 	"github.com/cockroachdb/cockroach/util/hlc"
 )
 
@@ -351,6 +352,31 @@ func TestIsHealthyOffsetInterval(t *testing.T) {
 	assertIntervalHealth(false, interval, maxOffset, t)
 }
 
+// TestMonitorRemoteOffsetsShutdown verifies that the node is shut down
+// via its stopper once a remote clock reading implies that the local
+// clock's offset exceeds MaxOffset.
+func TestMonitorRemoteOffsetsShutdown(t *testing.T) {
+	defer func(d time.Duration) { monitorInterval = d }(monitorInterval)
+	monitorInterval = time.Millisecond
+
+	manual := hlc.NewManualClock(0)
+	clock := hlc.NewClock(manual.UnixNano)
+	clock.SetMaxOffset(10 * time.Nanosecond)
+	remoteClocks := newRemoteClockMonitor(clock)
+	remoteClocks.UpdateOffset("0", proto.RemoteOffset{Offset: 100, Uncertainty: 1})
+
+	stopper := util.NewStopper()
+	stopper.RunWorker(func() {
+		remoteClocks.MonitorRemoteOffsets(stopper)
+	})
+	select {
+	case <-stopper.IsStopped():
+	case <-time.After(5 * time.Second):
+		stopper.Stop()
+		t.Fatal("expected the stopper to be stopped on clock offset violation")
+	}
+}
+
 func assertMajorityIntervalError(clocks *RemoteClockMonitor, t *testing.T) {
 	interval, err := clocks.findOffsetInterval()
 	expectedErr := MajorityIntervalNotFoundError{}
@@ -81,11 +81,33 @@ var flagUsage = map[string]string{
 `,
 	"gossip-interval": `
         Approximate interval (time.Duration) for gossiping new information to peers.
+`,
+	"liveness-timeout": `
+        Duration (time.Duration) for which a node's liveness heartbeat is
+        valid. Peers consider a node dead if it fails to heartbeat within
+        this duration.
+`,
+	"raft-snapshot-chunk-size": `
+        Maximum size in bytes of a message sent while streaming a raft
+        snapshot to another node. Larger snapshots are split into chunks.
 `,
 	"linearizable": `
         Enables linearizable behaviour of operations on this node by making
         sure that no commit timestamp is reported back to the client until all
         other node clocks have necessarily passed it.
+`,
+	"max-intents-per-txn": `
+        Maximum number of write intents a single transaction may lay down.
+        Transactions exceeding the limit are aborted. Zero disables the limit.
+`,
+	"max-command-bytes": `
+        Maximum size in bytes of a single client write command proposed to
+        Raft. Larger commands are refused. Zero disables the limit.
+`,
+	"split-large-commands": `
+        Split write batches larger than --max-command-bytes into several
+        commands, each under the limit, instead of refusing them. The
+        batch is then no longer applied atomically.
 `,
 	"insecure": `
         Run over plain HTTP. WARNING: this is strongly discouraged.
@@ -159,9 +181,19 @@ func initFlags(ctx *server.Context) {
 		f.StringVar(&ctx.GossipBootstrap, "gossip", ctx.GossipBootstrap, flagUsage["gossip"])
 		f.DurationVar(&ctx.GossipInterval, "gossip-interval", ctx.GossipInterval,
 			flagUsage["gossip-interval"])
+		f.DurationVar(&ctx.LivenessTimeout, "liveness-timeout", ctx.LivenessTimeout,
+			flagUsage["liveness-timeout"])
+		f.IntVar(&ctx.RaftSnapshotChunkSize, "raft-snapshot-chunk-size", ctx.RaftSnapshotChunkSize,
+			flagUsage["raft-snapshot-chunk-size"])
 
 		// KV flags.
 		f.BoolVar(&ctx.Linearizable, "linearizable", ctx.Linearizable, flagUsage["linearizable"])
+		f.Int64Var(&ctx.MaxIntentsPerTxn, "max-intents-per-txn", ctx.MaxIntentsPerTxn,
+			flagUsage["max-intents-per-txn"])
+		f.Int64Var(&ctx.MaxCommandBytes, "max-command-bytes", ctx.MaxCommandBytes,
+			flagUsage["max-command-bytes"])
+		f.BoolVar(&ctx.SplitLargeCommands, "split-large-commands", ctx.SplitLargeCommands,
+			flagUsage["split-large-commands"])
 
 		// Engine flags.
 		f.Int64Var(&ctx.CacheSize, "cache-size", ctx.CacheSize, flagUsage["cache-size"])
@@ -23,6 +23,7 @@ import (
 
 	"github.com/cockroachdb/cockroach/keys"
 	"github.com/cockroachdb/cockroach/proto"
+	"github.com/cockroachdb/cockroach/storage"
 
 	"github.com/spf13/cobra"
 )
@@ -129,15 +130,52 @@ func runMergeRange(cmd *cobra.Command, args []string) {
 	}
 }
 
+// A checkRangesCmd command checks the range addressing records.
+var checkRangesCmd = &cobra.Command{
+	Use:   "check [options]",
+	Short: "checks the range addressing records",
+	Long: `
+Checks the meta1 and meta2 range addressing records for gaps or
+overlaps between adjacent range descriptors.
+`,
+	Run: runCheckRanges,
+}
+
+func runCheckRanges(cmd *cobra.Command, args []string) {
+	if len(args) != 0 {
+		cmd.Usage()
+		return
+	}
+
+	kvDB := makeDBClient()
+	if kvDB == nil {
+		return
+	}
+	report, err := storage.CheckRangeAddressing(kvDB)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "check failed: %s\n", err)
+		osExit(1)
+		return
+	}
+	fmt.Printf("checked %d meta1 and %d meta2 records\n", report.Meta1Records, report.Meta2Records)
+	for _, p := range report.Problems {
+		fmt.Printf("\t%s\n", p)
+	}
+	if !report.Consistent() {
+		osExit(1)
+	}
+}
+
 var rangeCmds = []*cobra.Command{
 	lsRangesCmd,
 	splitRangeCmd,
 	mergeRangeCmd,
+	checkRangesCmd,
 }
 
 var rangeCmd = &cobra.Command{
 	Use:   "range",
-	Short: "list, split and merge ranges",
+	Short: "list, split, merge and check ranges",
 	Run: func(cmd *cobra.Command, args []string) {
 		cmd.Usage()
 	},
@@ -35,13 +35,17 @@ import (
 
 // Context defaults.
 const (
-	defaultAddr             = ":8080"
-	defaultMaxOffset        = 250 * time.Millisecond
-	defaultGossipInterval   = 2 * time.Second
-	defaultCacheSize        = 1 << 30 // GB
-	defaultScanInterval     = 10 * time.Minute
-	defaultScanMaxIdleTime  = 5 * time.Second
-	defaultMetricsFrequency = 10 * time.Second
+	defaultAddr              = ":8080"
+	defaultMaxOffset         = 250 * time.Millisecond
+	defaultGossipInterval    = 2 * time.Second
+	defaultCacheSize         = 1 << 30 // GB
+	defaultScanInterval      = 10 * time.Minute
+	defaultScanMaxIdleTime   = 5 * time.Second
+	defaultMetricsFrequency  = 10 * time.Second
+	defaultLivenessTimeout   = 10 * time.Second
+	defaultSnapshotChunkSize = 1 << 20 // MB
+	defaultMaxIntentsPerTxn  = 100000
+	defaultMaxCommandBytes   = 4 << 20 // 4MB
 )
 
 // Context holds parameters needed to setup a server.
@@ -120,18 +124,44 @@ type Context struct {
 	// MetricsFrequency determines the frequency at which the server should
 	// record internal metrics.
 	MetricsFrequency time.Duration
+
+	// LivenessTimeout is the duration for which a node's liveness
+	// heartbeat is valid. Peers consider a node dead if it hasn't
+	// heartbeated within this duration.
+	LivenessTimeout time.Duration
+
+	// RaftSnapshotChunkSize is the maximum size in bytes of a single
+	// message sent while streaming a raft snapshot to another node.
+	// Larger snapshots are split into chunks of this size.
+	RaftSnapshotChunkSize int
+
+	// MaxIntentsPerTxn is the maximum number of write intents a single
+	// transaction may lay down. A value <= 0 disables the limit.
+	MaxIntentsPerTxn int64
+
+	// MaxCommandBytes is the maximum size in bytes of a single client
+	// write command proposed to Raft. A value <= 0 disables the limit.
+	MaxCommandBytes int64
+
+	// SplitLargeCommands splits write batches exceeding MaxCommandBytes
+	// into several commands instead of refusing them.
+	SplitLargeCommands bool
 }
 
 // NewContext returns a Context with default values.
 func NewContext() *Context {
 	ctx := &Context{
-		Addr:             defaultAddr,
-		MaxOffset:        defaultMaxOffset,
-		GossipInterval:   defaultGossipInterval,
-		CacheSize:        defaultCacheSize,
-		ScanInterval:     defaultScanInterval,
-		ScanMaxIdleTime:  defaultScanMaxIdleTime,
-		MetricsFrequency: defaultMetricsFrequency,
+		Addr:                  defaultAddr,
+		MaxOffset:             defaultMaxOffset,
+		GossipInterval:        defaultGossipInterval,
+		CacheSize:             defaultCacheSize,
+		ScanInterval:          defaultScanInterval,
+		ScanMaxIdleTime:       defaultScanMaxIdleTime,
+		MetricsFrequency:      defaultMetricsFrequency,
+		LivenessTimeout:       defaultLivenessTimeout,
+		RaftSnapshotChunkSize: defaultSnapshotChunkSize,
+		MaxIntentsPerTxn:      defaultMaxIntentsPerTxn,
+		MaxCommandBytes:       defaultMaxCommandBytes,
 	}
 	// Initializes base context defaults.
 	ctx.InitDefaults()
@@ -71,6 +71,9 @@ type Node struct {
 	feed       status.NodeEventFeed // Feed publisher for local events
 	status     *status.NodeStatusMonitor
 	startedAt  int64
+	// livenessTimeout is the duration for which the node's liveness
+	// heartbeat is valid. Defaults to defaultLivenessTimeout if zero.
+	livenessTimeout time.Duration
 	// ScanCount is the number of times through the store scanning loop locked
 	// by the completedScan mutex.
 	completedScan *sync.Cond
@@ -260,6 +263,7 @@ func (n *Node) start(rpcServer *rpc.Server, engines []engine.Engine,
 	n.startedAt = n.ctx.Clock.Now().WallTime
 	n.startStoresScanner(stopper)
 	n.startGossip(stopper)
+	n.startLivenessHeartbeat(stopper)
 	n.startRuntimeStats(stopper)
 	log.Infof("Started node with %v engine(s) and attributes %v", engines, attrs.Attrs)
 	return nil
@@ -680,3 +684,15 @@ func (n *nodeServer) InternalLeaderLease(args *proto.InternalLeaderLeaseRequest,
 	reply *proto.InternalLeaderLeaseResponse) error {
 	return n.executeCmd(args, reply)
 }
+
+// InternalComputeChecksum .
+func (n *nodeServer) InternalComputeChecksum(args *proto.InternalComputeChecksumRequest,
+	reply *proto.InternalComputeChecksumResponse) error {
+	return n.executeCmd(args, reply)
+}
+
+// InternalWriteBatch .
+func (n *nodeServer) InternalWriteBatch(args *proto.InternalWriteBatchRequest,
+	reply *proto.InternalWriteBatchResponse) error {
+	return n.executeCmd(args, reply)
+}
@@ -0,0 +1,86 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package server
+
+import (
+	"encoding/gob"
+	"time"
+
+	"github.com/cockroachdb/cockroach/gossip"
+	"github.com/cockroachdb/cockroach/proto"
+	"github.com/cockroachdb/cockroach/util"
+	"github.com/cockroachdb/cockroach/util/log"
+)
+
+// livenessHeartbeatsPerTimeout is the number of liveness heartbeats
+// sent per liveness timeout, so that a node isn't considered dead if
+// an individual heartbeat is delayed.
+const livenessHeartbeatsPerTimeout = 3
+
+func init() {
+	gob.Register(proto.Timestamp{})
+}
+
+// getLivenessTimeout returns the node's liveness timeout.
+func (n *Node) getLivenessTimeout() time.Duration {
+	if n.livenessTimeout <= 0 {
+		return defaultLivenessTimeout
+	}
+	return n.livenessTimeout
+}
+
+// startLivenessHeartbeat loops on a periodic ticker to gossip the
+// node's liveness record. Liveness is gossiped directly by each node
+// and doesn't depend on any range, so heartbeats continue unaffected
+// by changes of range leadership.
+func (n *Node) startLivenessHeartbeat(stopper *util.Stopper) {
+	stopper.RunWorker(func() {
+		ticker := time.NewTicker(n.getLivenessTimeout() / livenessHeartbeatsPerTimeout)
+		defer ticker.Stop()
+		n.heartbeatLiveness() // one-off run before going to sleep
+		for {
+			select {
+			case <-ticker.C:
+				n.heartbeatLiveness()
+			case <-stopper.ShouldStop():
+				return
+			}
+		}
+	})
+}
+
+// heartbeatLiveness gossips the node's liveness record, carrying an
+// expiration of the current HLC time plus the liveness timeout.
+func (n *Node) heartbeatLiveness() {
+	if n.Descriptor.NodeID == 0 {
+		// The node ID hasn't been allocated yet.
+		return
+	}
+	expiration := n.ctx.Clock.Now()
+	expiration.WallTime += n.getLivenessTimeout().Nanoseconds()
+	key := gossip.MakeNodeLivenessKey(n.Descriptor.NodeID)
+	if err := n.ctx.Gossip.AddInfo(key, expiration, 0*time.Second); err != nil {
+		log.Warningf("node %d: unable to gossip liveness: %s", n.Descriptor.NodeID, err)
+	}
+}
+
+// IsLive returns whether the node with the given ID is live, that is
+// whether its most recently gossiped liveness expiration is later than
+// the current time of this node's clock. Nodes without a liveness
+// record are considered dead.
+func (n *Node) IsLive(nodeID proto.NodeID) bool {
+	return n.ctx.IsNodeLive(nodeID)
+}
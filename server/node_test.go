@@ -226,6 +226,60 @@ func TestNodeJoin(t *testing.T) {
 	}
 }
 
+// TestNodeLiveness verifies that nodes observe each other as live
+// while heartbeating and that a stopped node is observed as dead once
+// its liveness timeout has passed.
+func TestNodeLiveness(t *testing.T) {
+	stopper := util.NewStopper()
+	e := engine.NewInMem(proto.Attributes{}, 1<<20)
+	if _, err := BootstrapCluster("cluster-1", []engine.Engine{e}, stopper); err != nil {
+		t.Fatal(err)
+	}
+	stopper.Stop()
+
+	// Set an aggressive gossip interval to make sure information is exchanged tout de suite.
+	testContext.GossipInterval = gossip.TestInterval
+	const livenessTimeout = 250 * time.Millisecond
+	startNode := func(engines []engine.Engine, gossipBS net.Addr) (*rpc.Server, *Node, *util.Stopper) {
+		addr := util.CreateTestAddr("tcp")
+		if gossipBS == nil {
+			gossipBS = addr
+		}
+		rpcServer, _, node, stopper := createTestNode(addr, engines, gossipBS, t)
+		node.livenessTimeout = livenessTimeout
+		if err := node.start(rpcServer, engines, proto.Attributes{}, stopper); err != nil {
+			t.Fatal(err)
+		}
+		return rpcServer, node, stopper
+	}
+	server1, node1, stopper1 := startNode([]engine.Engine{e}, nil)
+	defer stopper1.Stop()
+	_, node2, stopper2 := startNode([]engine.Engine{engine.NewInMem(proto.Attributes{}, 1<<20)}, server1.Addr())
+
+	// Wait for node2 to be assigned a node ID and heartbeat.
+	if err := util.IsTrueWithin(func() bool {
+		return node2.Descriptor.NodeID != 0 && node1.IsLive(node2.Descriptor.NodeID) &&
+			node2.IsLive(node1.Descriptor.NodeID)
+	}, 5*time.Second); err != nil {
+		t.Fatalf("nodes did not observe each other as live: %s", err)
+	}
+
+	// Stop node2; node1 must observe it as dead after the timeout,
+	// while continuing to observe itself as live.
+	stopper2.Stop()
+	if err := util.IsTrueWithin(func() bool {
+		return !node1.IsLive(node2.Descriptor.NodeID)
+	}, 5*livenessTimeout); err != nil {
+		t.Fatalf("stopped node still observed as live: %s", err)
+	}
+	if !node1.IsLive(node1.Descriptor.NodeID) {
+		t.Error("expected node1 to observe itself as live")
+	}
+	if node1.IsLive(node2.Descriptor.NodeID + 1) {
+		t.Error("expected unknown node to not be live")
+	}
+}
+
 // TestCorruptedClusterID verifies that a node fails to start when a
 // store's cluster ID is empty.
 func TestCorruptedClusterID(t *testing.T) {
@@ -19,6 +19,7 @@
 package server
 
 import (
+	"math/rand"
 	"sync"
 	"time"
 
@@ -28,6 +29,7 @@ import (
 	"github.com/cockroachdb/cockroach/rpc"
 	"github.com/cockroachdb/cockroach/util"
 	"github.com/cockroachdb/cockroach/util/log"
+	"github.com/coreos/etcd/raft/raftpb"
 
 	gorpc "net/rpc"
 )
@@ -41,6 +43,9 @@ const (
 	// When no message has been sent to a Node for that duration, the
 	// corresponding instance of processQueue will shut down.
 	raftIdleTimeout = time.Minute
+	// A partially received chunked snapshot is discarded once no chunk
+	// of it has arrived for that duration.
+	snapshotChunkTimeout = time.Minute
 )
 
 // rpcTransport handles the rpc messages for multiraft.
@@ -51,17 +56,36 @@ type rpcTransport struct {
 	mu         sync.Mutex
 	servers    map[proto.RaftNodeID]multiraft.ServerInterface
 	queues     map[proto.RaftNodeID]chan *multiraft.RaftMessageRequest
+	// Snapshot messages larger than snapshotChunkSize bytes are sent
+	// in chunks; a non-positive size disables chunking.
+	snapshotChunkSize int
+	// snapshots holds the partially received chunked snapshot of each
+	// raft group, keyed by group ID.
+	snapshots map[uint64]*snapshotChunks
 }
 
-// newRPCTransport creates a new rpcTransport with specified gossip and rpc server.
-func newRPCTransport(gossip *gossip.Gossip, rpcServer *rpc.Server, rpcContext *rpc.Context) (
-	multiraft.Transport, error) {
+// snapshotChunks accumulates the chunks of a snapshot message until
+// all of them have been received.
+type snapshotChunks struct {
+	snapshotID uint64
+	chunks     [][]byte
+	received   int
+	lastChunk  time.Time // Arrival time of the most recent chunk
+}
+
+// newRPCTransport creates a new rpcTransport with specified gossip and rpc
+// server. Snapshot messages larger than snapshotChunkSize bytes are sent in
+// chunks of at most that size.
+func newRPCTransport(gossip *gossip.Gossip, rpcServer *rpc.Server, rpcContext *rpc.Context,
+	snapshotChunkSize int) (multiraft.Transport, error) {
 	t := &rpcTransport{
-		gossip:     gossip,
-		rpcServer:  rpcServer,
-		rpcContext: rpcContext,
-		servers:    make(map[proto.RaftNodeID]multiraft.ServerInterface),
-		queues:     make(map[proto.RaftNodeID]chan *multiraft.RaftMessageRequest),
+		gossip:            gossip,
+		rpcServer:         rpcServer,
+		rpcContext:        rpcContext,
+		servers:           make(map[proto.RaftNodeID]multiraft.ServerInterface),
+		queues:            make(map[proto.RaftNodeID]chan *multiraft.RaftMessageRequest),
+		snapshotChunkSize: snapshotChunkSize,
+		snapshots:         make(map[uint64]*snapshotChunks),
 	}
 
 	err := t.rpcServer.RegisterName(raftServiceName, (*transportRPCServer)(t))
@@ -79,9 +103,17 @@ type transportRPCServer rpcTransport
 // RaftMessage proxies the incoming request to the listening server interface.
 func (t *transportRPCServer) RaftMessage(protoReq *proto.RaftMessageRequest,
 	resp *proto.RaftMessageResponse) error {
+	msg := protoReq.Msg
+	if protoReq.ChunkCount > 0 {
+		var err error
+		if msg, err = (*rpcTransport)(t).addSnapshotChunk(protoReq); err != nil || msg == nil {
+			return err
+		}
+	}
+
 	// Convert from proto to internal formats.
 	req := &multiraft.RaftMessageRequest{GroupID: protoReq.GroupID}
-	if err := req.Message.Unmarshal(protoReq.Msg); err != nil {
+	if err := req.Message.Unmarshal(msg); err != nil {
 		return err
 	}
 
@@ -96,6 +128,102 @@ func (t *transportRPCServer) RaftMessage(protoReq *proto.RaftMessageRequest,
 	return util.Errorf("Unable to proxy message to node: %d", req.Message.To)
 }
 
+// addSnapshotChunk records a chunk of a snapshot message. Once all
+// chunks of the snapshot have arrived, they are removed and the
+// reassembled message is returned; until then, the returned message is
+// nil. Only the most recent snapshot of each group is retained: the
+// first chunk of a new snapshot discards any partially received
+// predecessor. Partial snapshots of other groups are discarded once
+// they have received no chunk for snapshotChunkTimeout, so that an
+// aborted transfer which raft never retries doesn't linger.
+func (t *rpcTransport) addSnapshotChunk(req *proto.RaftMessageRequest) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for groupID, pending := range t.snapshots {
+		if now.Sub(pending.lastChunk) > snapshotChunkTimeout {
+			if log.V(1) {
+				log.Infof("discarding stale partial snapshot %d of group %d", pending.snapshotID, groupID)
+			}
+			delete(t.snapshots, groupID)
+		}
+	}
+
+	if req.ChunkIndex >= req.ChunkCount {
+		return nil, util.Errorf("snapshot chunk %d out of range [0, %d)", req.ChunkIndex, req.ChunkCount)
+	}
+	pending, ok := t.snapshots[req.GroupID]
+	if ok && pending.snapshotID == req.SnapshotID && len(pending.chunks) != int(req.ChunkCount) {
+		delete(t.snapshots, req.GroupID)
+		return nil, util.Errorf("snapshot %d: expected %d chunks, got chunk of %d",
+			req.SnapshotID, len(pending.chunks), req.ChunkCount)
+	}
+	if !ok || pending.snapshotID != req.SnapshotID {
+		if ok && log.V(1) {
+			log.Infof("discarding partial snapshot %d of group %d", pending.snapshotID, req.GroupID)
+		}
+		pending = &snapshotChunks{
+			snapshotID: req.SnapshotID,
+			chunks:     make([][]byte, req.ChunkCount),
+		}
+		t.snapshots[req.GroupID] = pending
+	}
+	pending.lastChunk = now
+	if pending.chunks[req.ChunkIndex] == nil {
+		pending.chunks[req.ChunkIndex] = req.Msg
+		pending.received++
+	}
+	if pending.received < len(pending.chunks) {
+		return nil, nil
+	}
+
+	delete(t.snapshots, req.GroupID)
+	var size int
+	for _, chunk := range pending.chunks {
+		size += len(chunk)
+	}
+	msg := make([]byte, 0, size)
+	for _, chunk := range pending.chunks {
+		msg = append(msg, chunk...)
+	}
+	return msg, nil
+}
+
+// splitSnapshot splits an encoded snapshot message into a sequence of
+// requests carrying chunks of at most chunkSize bytes.
+func splitSnapshot(groupID, snapshotID uint64, msg []byte, chunkSize int) []*proto.RaftMessageRequest {
+	count := (len(msg) + chunkSize - 1) / chunkSize
+	reqs := make([]*proto.RaftMessageRequest, 0, count)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * chunkSize
+		if end > len(msg) {
+			end = len(msg)
+		}
+		reqs = append(reqs, &proto.RaftMessageRequest{
+			GroupID:    groupID,
+			Msg:        msg[i*chunkSize : end],
+			SnapshotID: snapshotID,
+			ChunkIndex: uint32(i),
+			ChunkCount: uint32(count),
+		})
+	}
+	return reqs
+}
+
+// sendSnapshotChunks sends an encoded snapshot message in chunks. Each
+// chunk is sent synchronously and the transfer is abandoned on the
+// first failure; the receiver discards the partial snapshot once raft
+// sends a new one, the group is removed or the snapshot times out.
+func (t *rpcTransport) sendSnapshotChunks(client *rpc.Client, groupID uint64, msg []byte) error {
+	for _, chunk := range splitSnapshot(groupID, uint64(rand.Int63()), msg, t.snapshotChunkSize) {
+		if err := client.Call(raftMessageName, chunk, &proto.RaftMessageResponse{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Listen implements the multiraft.Transport interface by registering a ServerInterface
 // to receive proxied messages.
 func (t *rpcTransport) Listen(id proto.RaftNodeID, server multiraft.ServerInterface) error {
@@ -112,6 +240,14 @@ func (t *rpcTransport) Stop(id proto.RaftNodeID) {
 	delete(t.servers, id)
 }
 
+// GroupRemoved implements the multiraft.GroupRemovalListener interface
+// by discarding any partially received snapshot of the group.
+func (t *rpcTransport) GroupRemoved(groupID uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.snapshots, groupID)
+}
+
 // processQueue creates a client and sends messages from its designated queue
 // via that client, exiting when the client fails or when it idles out. All
 // messages remaining in the queue at that point are lost and a new instance of
@@ -193,6 +329,13 @@ func (t *rpcTransport) processQueue(raftNodeID proto.RaftNodeID) {
 			log.Warningf("raft client for node %d unhealthy", nodeID)
 			return
 		}
+		if req.Message.Type == raftpb.MsgSnap && t.snapshotChunkSize > 0 &&
+			len(protoReq.Msg) > t.snapshotChunkSize {
+			if err := t.sendSnapshotChunks(client, req.GroupID, protoReq.Msg); err != nil {
+				log.Errorf("raft snapshot to node %d failed: %s", nodeID, err)
+			}
+			continue
+		}
 		client.Go(raftMessageName, protoReq, protoResp, done)
 
 		// TODO(tschottdorf): work around #1176 by wasting just a little
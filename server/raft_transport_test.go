@@ -18,6 +18,7 @@
 package server
 
 import (
+	"bytes"
 	"testing"
 	"time"
 
@@ -67,7 +68,7 @@ func TestSendAndReceive(t *testing.T) {
 		}
 		defer server.Close()
 
-		transport, err := newRPCTransport(g, server, rpcContext)
+		transport, err := newRPCTransport(g, server, rpcContext, 0)
 		if err != nil {
 			t.Fatalf("Unexpected error creating transport, Error: %s", err)
 		}
@@ -143,3 +144,194 @@ func TestSendAndReceive(t *testing.T) {
 		}
 	}
 }
+
+// TestSendChunkedSnapshot verifies that a snapshot larger than the chunk
+// size is sent in chunks and reassembled intact by the receiver.
+func TestSendChunkedSnapshot(t *testing.T) {
+	tlsConfig, err := testContext.GetServerTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopper := util.NewStopper()
+	defer stopper.Stop()
+	rpcContext := rpc.NewContext(hlc.NewClock(hlc.UnixNano), tlsConfig, stopper)
+	g := gossip.New(rpcContext, gossip.TestInterval, gossip.TestBootstrap)
+
+	server := rpc.NewServer(util.CreateTestAddr("tcp"), rpcContext)
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	const chunkSize = 64 << 10
+	transport, err := newRPCTransport(g, server, rpcContext, chunkSize)
+	if err != nil {
+		t.Fatalf("Unexpected error creating transport, Error: %s", err)
+	}
+	defer transport.Close()
+
+	var nodeIDs []proto.RaftNodeID
+	var channels []ChannelServer
+	for i := 1; i <= 2; i++ {
+		nodeID := proto.MakeRaftNodeID(proto.NodeID(i), 1)
+		channel := make(ChannelServer, 10)
+		if err := transport.Listen(nodeID, channel); err != nil {
+			t.Fatal(err)
+		}
+		if err := g.AddInfo(gossip.MakeNodeIDKey(proto.NodeID(i)),
+			&proto.NodeDescriptor{
+				Address: proto.Addr{
+					Network: server.Addr().Network(),
+					Address: server.Addr().String(),
+				},
+			},
+			time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		nodeIDs = append(nodeIDs, nodeID)
+		channels = append(channels, channel)
+	}
+
+	// A multi-megabyte snapshot spans many chunks.
+	data := make([]byte, 4<<20)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	req := &multiraft.RaftMessageRequest{
+		GroupID: 1,
+		Message: raftpb.Message{
+			From: uint64(nodeIDs[0]),
+			To:   uint64(nodeIDs[1]),
+			Type: raftpb.MsgSnap,
+			Snapshot: raftpb.Snapshot{
+				Data:     data,
+				Metadata: raftpb.SnapshotMetadata{Index: 10, Term: 1},
+			},
+		},
+	}
+	if err := transport.Send(req); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case received := <-channels[1]:
+		if received.Message.Type != raftpb.MsgSnap {
+			t.Fatalf("expected snapshot message, got %+v", received.Message.Type)
+		}
+		if !bytes.Equal(received.Message.Snapshot.Data, data) {
+			t.Errorf("snapshot data differs after reassembly")
+		}
+		if m := received.Message.Snapshot.Metadata; m.Index != 10 || m.Term != 1 {
+			t.Errorf("unexpected snapshot metadata %+v", m)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for snapshot")
+	}
+	if n := len(transport.(*rpcTransport).snapshots); n != 0 {
+		t.Errorf("expected no partial snapshots, got %d", n)
+	}
+}
+
+// TestSnapshotChunksAbort verifies that a partially received snapshot is
+// never delivered and is discarded when a new snapshot begins, when its
+// group is removed or once it has gone stale.
+func TestSnapshotChunksAbort(t *testing.T) {
+	channel := make(ChannelServer, 10)
+	nodeID := proto.MakeRaftNodeID(1, 1)
+	transport := &rpcTransport{
+		servers:   map[proto.RaftNodeID]multiraft.ServerInterface{nodeID: channel},
+		snapshots: make(map[uint64]*snapshotChunks),
+	}
+	server := (*transportRPCServer)(transport)
+
+	makeSnapshot := func(index uint64) []byte {
+		msg := raftpb.Message{
+			To:   uint64(nodeID),
+			Type: raftpb.MsgSnap,
+			Snapshot: raftpb.Snapshot{
+				Data:     bytes.Repeat([]byte{byte(index)}, 1000),
+				Metadata: raftpb.SnapshotMetadata{Index: index, Term: 1},
+			},
+		}
+		data, err := msg.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	// Deliver only the first half of a snapshot's chunks, as if the
+	// sender failed mid-transfer.
+	chunks := splitSnapshot(1, 1, makeSnapshot(5), 100)
+	for _, chunk := range chunks[:len(chunks)/2] {
+		if err := server.RaftMessage(chunk, &proto.RaftMessageResponse{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case req := <-channel:
+		t.Fatalf("unexpected delivery of partial snapshot %+v", req.Message.Snapshot.Metadata)
+	default:
+	}
+	if n := len(transport.snapshots); n != 1 {
+		t.Fatalf("expected 1 partial snapshot, got %d", n)
+	}
+
+	// A chunk claiming an index beyond its count is rejected.
+	bad := &proto.RaftMessageRequest{GroupID: 1, SnapshotID: 1, ChunkIndex: 2, ChunkCount: 2}
+	if err := server.RaftMessage(bad, &proto.RaftMessageResponse{}); err == nil {
+		t.Error("expected error for out of range chunk")
+	}
+
+	// The next snapshot replaces the partial one and is delivered in
+	// full, even with its chunks arriving out of order.
+	chunks = splitSnapshot(1, 2, makeSnapshot(7), 100)
+	for i := len(chunks) - 1; i >= 0; i-- {
+		if err := server.RaftMessage(chunks[i], &proto.RaftMessageResponse{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case req := <-channel:
+		if index := req.Message.Snapshot.Metadata.Index; index != 7 {
+			t.Errorf("expected snapshot at index 7, got %d", index)
+		}
+	default:
+		t.Fatal("expected snapshot to be delivered")
+	}
+	if n := len(transport.snapshots); n != 0 {
+		t.Errorf("expected no partial snapshots, got %d", n)
+	}
+
+	// Fail two more transfers mid-way, for groups 2 and 3, which raft
+	// never follows up with another snapshot.
+	for groupID := uint64(2); groupID <= 3; groupID++ {
+		chunks = splitSnapshot(groupID, groupID, makeSnapshot(9), 100)
+		if err := server.RaftMessage(chunks[0], &proto.RaftMessageResponse{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(transport.snapshots); n != 2 {
+		t.Fatalf("expected 2 partial snapshots, got %d", n)
+	}
+
+	// Removing group 2 discards its partial snapshot.
+	transport.GroupRemoved(2)
+	if _, ok := transport.snapshots[2]; ok {
+		t.Error("expected partial snapshot of removed group to be discarded")
+	}
+
+	// The partial snapshot of group 3 is discarded once it has gone
+	// stale, on the arrival of a chunk of any other snapshot.
+	transport.snapshots[3].lastChunk = time.Now().Add(-2 * snapshotChunkTimeout)
+	chunks = splitSnapshot(4, 4, makeSnapshot(11), 100)
+	if err := server.RaftMessage(chunks[0], &proto.RaftMessageResponse{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := transport.snapshots[3]; ok {
+		t.Error("expected stale partial snapshot to be discarded")
+	}
+	if n := len(transport.snapshots); n != 1 {
+		t.Errorf("expected 1 partial snapshot, got %d", n)
+	}
+}
@@ -102,7 +102,9 @@ func NewServer(ctx *Context, stopper *util.Stopper) (*Server, error) {
 	s.clock.SetMaxOffset(ctx.MaxOffset)
 
 	rpcContext := rpc.NewContext(s.clock, tlsConfig, stopper)
-	go rpcContext.RemoteClocks.MonitorRemoteOffsets()
+	s.stopper.RunWorker(func() {
+		rpcContext.RemoteClocks.MonitorRemoteOffsets(s.stopper)
+	})
 
 	s.rpc = rpc.NewServer(util.MakeUnresolvedAddr("tcp", addr), rpcContext)
 	s.stopper.AddCloser(s.rpc)
@@ -114,7 +116,7 @@ func NewServer(ctx *Context, stopper *util.Stopper) (*Server, error) {
 		return nil, err
 	}
 
-	s.raftTransport, err = newRPCTransport(s.gossip, s.rpc, rpcContext)
+	s.raftTransport, err = newRPCTransport(s.gossip, s.rpc, rpcContext, s.ctx.RaftSnapshotChunkSize)
 	if err != nil {
 		return nil, err
 	}
@@ -129,15 +131,19 @@ func NewServer(ctx *Context, stopper *util.Stopper) (*Server, error) {
 	s.kvREST = kv.NewRESTServer(s.db)
 	// TODO(bdarnell): make StoreConfig configurable.
 	nCtx := storage.StoreContext{
-		Clock:           s.clock,
-		DB:              s.db,
-		Gossip:          s.gossip,
-		Transport:       s.raftTransport,
-		ScanInterval:    s.ctx.ScanInterval,
-		ScanMaxIdleTime: s.ctx.ScanMaxIdleTime,
-		EventFeed:       &util.Feed{},
+		Clock:              s.clock,
+		DB:                 s.db,
+		Gossip:             s.gossip,
+		Transport:          s.raftTransport,
+		ScanInterval:       s.ctx.ScanInterval,
+		ScanMaxIdleTime:    s.ctx.ScanMaxIdleTime,
+		MaxIntentsPerTxn:   s.ctx.MaxIntentsPerTxn,
+		MaxCommandBytes:    s.ctx.MaxCommandBytes,
+		SplitLargeCommands: s.ctx.SplitLargeCommands,
+		EventFeed:          &util.Feed{},
 	}
 	s.node = NewNode(nCtx)
+	s.node.livenessTimeout = s.ctx.LivenessTimeout
 	s.admin = newAdminServer(s.db, s.stopper)
 	s.status = newStatusServer(s.db, s.gossip)
 	s.structuredDB = structured.NewDB(s.db)
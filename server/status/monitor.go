@@ -23,6 +23,7 @@ import (
 
 	"github.com/cockroachdb/cockroach/proto"
 	"github.com/cockroachdb/cockroach/storage"
+	"github.com/cockroachdb/cockroach/storage/engine"
 	"github.com/cockroachdb/cockroach/util"
 )
 
@@ -31,7 +32,10 @@ import (
 // components.
 type StoreStatusMonitor struct {
 	rangeDataAccumulator
-	ID proto.StoreID
+	ID          proto.StoreID
+	raftIDAlloc storage.IDAllocatorMetrics
+	rangeSizes  storage.RangeSizeHistogram
+	blockCache  engine.BlockCacheStats
 }
 
 // NodeStatusMonitor monitors the status of a server node. Status information
@@ -161,6 +165,36 @@ func (nsm *NodeStatusMonitor) OnEndScanRanges(event *storage.EndScanRangesEvent)
 	nsm.GetStoreMonitor(event.StoreID).endScanRanges(event)
 }
 
+// OnIDAllocatorMetrics receives IDAllocatorMetricsEvents retrieved from an
+// storage event subscription. This method is part of the implementation of
+// store.StoreEventListener.
+func (nsm *NodeStatusMonitor) OnIDAllocatorMetrics(event *storage.IDAllocatorMetricsEvent) {
+	ssm := nsm.GetStoreMonitor(event.StoreID)
+	ssm.Lock()
+	defer ssm.Unlock()
+	ssm.raftIDAlloc = event.Metrics
+}
+
+// OnRangeSizeHistogram receives RangeSizeHistogramEvents retrieved from
+// an storage event subscription. This method is part of the
+// implementation of store.StoreEventListener.
+func (nsm *NodeStatusMonitor) OnRangeSizeHistogram(event *storage.RangeSizeHistogramEvent) {
+	ssm := nsm.GetStoreMonitor(event.StoreID)
+	ssm.Lock()
+	defer ssm.Unlock()
+	ssm.rangeSizes = event.Histogram
+}
+
+// OnBlockCacheStats receives BlockCacheStatsEvents retrieved from an
+// storage event subscription. This method is part of the
+// implementation of store.StoreEventListener.
+func (nsm *NodeStatusMonitor) OnBlockCacheStats(event *storage.BlockCacheStatsEvent) {
+	ssm := nsm.GetStoreMonitor(event.StoreID)
+	ssm.Lock()
+	defer ssm.Unlock()
+	ssm.blockCache = event.Stats
+}
+
 // OnCallSuccess receives CallSuccessEvents from a node event subscription. This
 // method is part of the implementation of NodeEventListener.
 func (nsm *NodeStatusMonitor) OnCallSuccess(event *CallSuccessEvent) {
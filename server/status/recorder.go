@@ -22,6 +22,7 @@ import (
 	"sync/atomic"
 
 	"github.com/cockroachdb/cockroach/proto"
+	"github.com/cockroachdb/cockroach/storage"
 	"github.com/cockroachdb/cockroach/util/hlc"
 )
 
@@ -100,6 +101,16 @@ func (nsr *NodeStatusRecorder) GetTimeSeriesData() []proto.TimeSeriesData {
 		data = append(data, ssr.recordInt("gcbytesage", ssr.stats.GCBytesAge))
 		data = append(data, ssr.recordInt("lastupdatenanos", ssr.stats.LastUpdateNanos))
 		data = append(data, ssr.recordInt("ranges", ssr.rangeCount))
+		data = append(data, ssr.recordInt("raftidalloc.ids", ssr.raftIDAlloc.IDsAllocated))
+		data = append(data, ssr.recordInt("raftidalloc.increments", ssr.raftIDAlloc.BlocksFetched))
+		data = append(data, ssr.recordInt("raftidalloc.waits", ssr.raftIDAlloc.Waits))
+		for i, bound := range storage.RangeSizeBuckets {
+			data = append(data, ssr.recordInt(fmt.Sprintf("rangesize.le%d", bound), ssr.rangeSizeCount(i)))
+		}
+		data = append(data, ssr.recordInt("rangesize.inf", ssr.rangeSizeCount(len(storage.RangeSizeBuckets))))
+		data = append(data, ssr.recordInt("blockcache.capacity", ssr.blockCache.Capacity))
+		data = append(data, ssr.recordInt("blockcache.hits", ssr.blockCache.Hits))
+		data = append(data, ssr.recordInt("blockcache.misses", ssr.blockCache.Misses))
 	})
 	nsr.lastDataCount = len(data)
 	return data
@@ -112,6 +123,16 @@ type storeStatusRecorder struct {
 	timestampNanos int64
 }
 
+// rangeSizeCount returns the number of ranges in the i'th bucket of the
+// store's range size histogram, or zero if no histogram has been
+// received yet.
+func (ssr *storeStatusRecorder) rangeSizeCount(i int) int64 {
+	if i >= len(ssr.rangeSizes.Counts) {
+		return 0
+	}
+	return ssr.rangeSizes.Counts[i]
+}
+
 // recordInt records a single int64 value from the StoreStatusMonitor as a
 // proto.TimeSeriesData object.
 func (ssr *storeStatusRecorder) recordInt(name string, data int64) proto.TimeSeriesData {
@@ -25,6 +25,7 @@ import (
 
 	"github.com/cockroachdb/cockroach/proto"
 	"github.com/cockroachdb/cockroach/storage"
+	"github.com/cockroachdb/cockroach/storage/engine"
 	"github.com/cockroachdb/cockroach/util/hlc"
 )
 
@@ -111,6 +112,25 @@ func TestNodeStatusRecorder(t *testing.T) {
 		Desc:    desc1,
 		Delta:   stats,
 	})
+	monitor.OnIDAllocatorMetrics(&storage.IDAllocatorMetricsEvent{
+		StoreID: proto.StoreID(1),
+		Metrics: storage.IDAllocatorMetrics{
+			BlocksFetched: 2,
+			IDsAllocated:  15,
+			Waits:         1,
+		},
+	})
+	monitor.OnRangeSizeHistogram(&storage.RangeSizeHistogramEvent{
+		StoreID: proto.StoreID(1),
+		Histogram: storage.RangeSizeHistogram{
+			RangeCount: 2,
+			Counts:     []int64{1, 0, 0, 0, 1},
+		},
+	})
+	monitor.OnBlockCacheStats(&storage.BlockCacheStatsEvent{
+		StoreID: proto.StoreID(1),
+		Stats:   engine.BlockCacheStats{Capacity: 1 << 20, Hits: 30, Misses: 4},
+	})
 	// Node Events.
 	monitor.OnCallSuccess(&CallSuccessEvent{
 		NodeID: proto.NodeID(1),
@@ -166,6 +186,17 @@ func TestNodeStatusRecorder(t *testing.T) {
 		generateStoreData(1, "gcbytesage", 100, 30),
 		generateStoreData(1, "lastupdatenanos", 100, 3*1e9),
 		generateStoreData(1, "ranges", 100, 2),
+		generateStoreData(1, "raftidalloc.ids", 100, 15),
+		generateStoreData(1, "raftidalloc.increments", 100, 2),
+		generateStoreData(1, "raftidalloc.waits", 100, 1),
+		generateStoreData(1, "rangesize.le1048576", 100, 1),
+		generateStoreData(1, "rangesize.le4194304", 100, 0),
+		generateStoreData(1, "rangesize.le16777216", 100, 0),
+		generateStoreData(1, "rangesize.le67108864", 100, 0),
+		generateStoreData(1, "rangesize.inf", 100, 1),
+		generateStoreData(1, "blockcache.capacity", 100, 1<<20),
+		generateStoreData(1, "blockcache.hits", 100, 30),
+		generateStoreData(1, "blockcache.misses", 100, 4),
 
 		// Store 2 should have accumulated 1 copy of stats
 		generateStoreData(2, "livebytes", 100, 1),
@@ -180,6 +211,17 @@ func TestNodeStatusRecorder(t *testing.T) {
 		generateStoreData(2, "gcbytesage", 100, 10),
 		generateStoreData(2, "lastupdatenanos", 100, 1*1e9),
 		generateStoreData(2, "ranges", 100, 1),
+		generateStoreData(2, "raftidalloc.ids", 100, 0),
+		generateStoreData(2, "raftidalloc.increments", 100, 0),
+		generateStoreData(2, "raftidalloc.waits", 100, 0),
+		generateStoreData(2, "rangesize.le1048576", 100, 0),
+		generateStoreData(2, "rangesize.le4194304", 100, 0),
+		generateStoreData(2, "rangesize.le16777216", 100, 0),
+		generateStoreData(2, "rangesize.le67108864", 100, 0),
+		generateStoreData(2, "rangesize.inf", 100, 0),
+		generateStoreData(2, "blockcache.capacity", 100, 0),
+		generateStoreData(2, "blockcache.hits", 100, 0),
+		generateStoreData(2, "blockcache.misses", 100, 0),
 
 		// Node stats.
 		generateNodeData(1, "calls.success", 100, 2),
@@ -50,6 +50,9 @@ func validateZoneConfig(config gogoproto.Message) error {
 		return util.Errorf("RangeMinBytes %d is greater than or equal to RangeMaxBytes %d",
 			zConfig.RangeMinBytes, zConfig.RangeMaxBytes)
 	}
+	if zConfig.RangeMaxLiveBytes < 0 {
+		return util.Errorf("RangeMaxLiveBytes %d must not be negative", zConfig.RangeMaxLiveBytes)
+	}
 	return nil
 }
 
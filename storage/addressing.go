@@ -19,6 +19,7 @@ package storage
 
 import (
 	"bytes"
+	"fmt"
 
 	"github.com/cockroachdb/cockroach/client"
 	"github.com/cockroachdb/cockroach/keys"
@@ -103,3 +104,129 @@ func rangeAddressing(b *client.Batch, desc *proto.RangeDescriptor, action metaAc
 	}
 	return nil
 }
+
+// An AddressingProblem describes a gap or an overlap between two
+// adjacent range descriptors in the meta1 or meta2 addressing records.
+type AddressingProblem struct {
+	// Key is the addressing record key at which the problem was found.
+	Key proto.Key
+	// Left and Right are the adjacent descriptors. Left is nil if the
+	// first descriptor does not start at KeyMin and Right is nil if the
+	// last descriptor does not end at KeyMax.
+	Left, Right *proto.RangeDescriptor
+	// Overlap is true if the descriptors overlap and false if there is
+	// a gap between them.
+	Overlap bool
+}
+
+func (p AddressingProblem) String() string {
+	kind := "gap"
+	if p.Overlap {
+		kind = "overlap"
+	}
+	switch {
+	case p.Left == nil:
+		return fmt.Sprintf("%s at %q: first range %q-%q", kind, p.Key, p.Right.StartKey, p.Right.EndKey)
+	case p.Right == nil:
+		return fmt.Sprintf("%s at %q: last range %q-%q", kind, p.Key, p.Left.StartKey, p.Left.EndKey)
+	}
+	return fmt.Sprintf("%s at %q: %q-%q followed by %q-%q", kind, p.Key,
+		p.Left.StartKey, p.Left.EndKey, p.Right.StartKey, p.Right.EndKey)
+}
+
+// An AddressingReport is the result of a consistency check of the
+// range addressing records.
+type AddressingReport struct {
+	Meta1Records int // number of meta1 records scanned
+	Meta2Records int // number of meta2 records scanned
+	Problems     []AddressingProblem
+}
+
+// Consistent returns true if no gaps or overlaps were found.
+func (r *AddressingReport) Consistent() bool {
+	return len(r.Problems) == 0
+}
+
+// CheckRangeAddressing scans the meta1 and meta2 addressing records in
+// a single transaction and reports any gaps or overlaps between
+// adjacent range descriptors. The meta1 records must describe a
+// contiguous span starting at KeyMin and the meta2 records a contiguous
+// span ending at KeyMax. The two levels are joined by the range which
+// contains the first user key: it is addressed both by the meta1 record
+// for KeyMax and by the first meta2 record, so the two must agree.
+func CheckRangeAddressing(db *client.DB) (*AddressingReport, error) {
+	var meta1, meta2 []client.KeyValue
+	if err := db.Tx(func(tx *client.Tx) error {
+		b := &client.Batch{}
+		b.Scan(keys.Meta1Prefix, keys.Meta1Prefix.PrefixEnd(), 0)
+		b.Scan(keys.Meta2Prefix, keys.Meta2Prefix.PrefixEnd(), 0)
+		if err := tx.Run(b); err != nil {
+			return err
+		}
+		meta1, meta2 = b.Results[0].Rows, b.Results[1].Rows
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	report := &AddressingReport{Meta1Records: len(meta1), Meta2Records: len(meta2)}
+	descs1, err := checkAddressingRecords(report, meta1)
+	if err != nil {
+		return nil, err
+	}
+	descs2, err := checkAddressingRecords(report, meta2)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(descs1) > 0 && !descs1[0].StartKey.Equal(proto.KeyMin) {
+		report.Problems = append(report.Problems, AddressingProblem{
+			Key:   meta1[0].Key,
+			Right: descs1[0],
+		})
+	}
+	if len(descs1) > 0 && len(descs2) > 0 {
+		last, first := descs1[len(descs1)-1], descs2[0]
+		if !last.StartKey.Equal(first.StartKey) || !last.EndKey.Equal(first.EndKey) {
+			report.Problems = append(report.Problems, AddressingProblem{
+				Key:     meta2[0].Key,
+				Left:    last,
+				Right:   first,
+				Overlap: first.StartKey.Less(last.EndKey),
+			})
+		}
+	}
+	if len(descs2) > 0 && !descs2[len(descs2)-1].EndKey.Equal(proto.KeyMax) {
+		report.Problems = append(report.Problems, AddressingProblem{
+			Key:  meta2[len(meta2)-1].Key,
+			Left: descs2[len(descs2)-1],
+		})
+	}
+	return report, nil
+}
+
+// checkAddressingRecords decodes the range descriptors of the sorted
+// addressing records in rows and appends a problem to report for each
+// pair of adjacent descriptors which do not abut.
+func checkAddressingRecords(report *AddressingReport, rows []client.KeyValue) (
+	[]*proto.RangeDescriptor, error) {
+	descs := make([]*proto.RangeDescriptor, 0, len(rows))
+	for i, row := range rows {
+		desc := &proto.RangeDescriptor{}
+		if err := row.ValueProto(desc); err != nil {
+			return nil, util.Errorf("%s: unable to unmarshal range descriptor: %s", row.Key, err)
+		}
+		if i > 0 {
+			if prev := descs[i-1]; !prev.EndKey.Equal(desc.StartKey) {
+				report.Problems = append(report.Problems, AddressingProblem{
+					Key:     row.Key,
+					Left:    prev,
+					Right:   desc,
+					Overlap: desc.StartKey.Less(prev.EndKey),
+				})
+			}
+		}
+		descs = append(descs, desc)
+	}
+	return descs, nil
+}
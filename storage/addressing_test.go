@@ -209,3 +209,62 @@ func TestUpdateRangeAddressingSplitMeta1(t *testing.T) {
 		t.Error("expected failure trying to update addressing records for meta1 split")
 	}
 }
+
+// TestCheckRangeAddressing verifies that gaps and overlaps between
+// adjacent range descriptors in the addressing records are detected.
+func TestCheckRangeAddressing(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	store, _, stopper := createTestStore(t)
+	defer stopper.Stop()
+	db := store.DB()
+
+	report, err := CheckRangeAddressing(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Consistent() {
+		t.Fatalf("expected bootstrapped addressing to be consistent; got %v", report.Problems)
+	}
+	if report.Meta1Records != 1 || report.Meta2Records != 1 {
+		t.Errorf("expected 1 meta1 and 1 meta2 record; got %d and %d", report.Meta1Records, report.Meta2Records)
+	}
+
+	// Seed addressing records for KeyMin-"m" and "k"-KeyMax, which overlap.
+	left := &proto.RangeDescriptor{RaftID: 2, StartKey: proto.KeyMin, EndKey: proto.Key("m")}
+	right := &proto.RangeDescriptor{RaftID: 3, StartKey: proto.Key("k"), EndKey: proto.KeyMax}
+	b := &client.Batch{}
+	b.Put(meta1Key(proto.KeyMax), left)
+	b.Put(meta2Key(proto.Key("m")), left)
+	b.Put(meta2Key(proto.KeyMax), right)
+	if err := db.Run(b); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		rightStart proto.Key
+		expOverlap bool
+	}{
+		{proto.Key("k"), true},
+		{proto.Key("n"), false},
+	}
+	for i, test := range testCases {
+		right.StartKey = test.rightStart
+		if err := db.Put(meta2Key(proto.KeyMax), right); err != nil {
+			t.Fatal(err)
+		}
+		report, err := CheckRangeAddressing(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Problems) != 1 {
+			t.Fatalf("%d: expected 1 problem; got %v", i, report.Problems)
+		}
+		p := report.Problems[0]
+		if !p.Key.Equal(meta2Key(proto.KeyMax)) || p.Overlap != test.expOverlap {
+			t.Errorf("%d: expected overlap=%t at %q; got %s", i, test.expOverlap, meta2Key(proto.KeyMax), p)
+		}
+		if p.Left.RaftID != left.RaftID || p.Right.RaftID != right.RaftID {
+			t.Errorf("%d: expected ranges %d and %d; got %s and %s", i, left.RaftID, right.RaftID, p.Left, p.Right)
+		}
+	}
+}
@@ -43,6 +43,12 @@ const (
 	// is within rebalanceFromMean of the mean, it is considered a
 	// viable target to rebalance to.
 	rebalanceFromMean = 0.025 // 2.5%
+	// rebalanceMinImbalance: a store's replicas are only moved off of
+	// it if its fraction of bytes used exceeds the mean by at least
+	// this much or, when balancing by range count, if its range count
+	// exceeds the mean by at least this fraction of the mean. This
+	// prevents thrashing between nearly balanced stores.
+	rebalanceMinImbalance = 0.1 // 10%
 )
 
 // stat provides a running sample size and mean.
@@ -260,6 +266,42 @@ func (a *allocator) ShouldRebalance(s *proto.StoreDescriptor) bool {
 	return s.Capacity.FractionUsed() > sl.used.mean
 }
 
+// RebalanceSource returns the store holding one of the candidate
+// replicas which is most overweight according to the mean of stores
+// matching the required attributes. Returns nil if no candidate's
+// store exceeds the mean by at least rebalanceMinImbalance.
+func (a *allocator) RebalanceSource(required proto.Attributes, candidates []proto.Replica) *proto.StoreDescriptor {
+	a.Lock()
+	defer a.Unlock()
+	sl := a.getStoreList(required)
+
+	var source *proto.StoreDescriptor
+	var maxImbalance float64
+	for _, s := range sl.stores {
+		found := false
+		for _, replica := range candidates {
+			if replica.StoreID == s.StoreID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			continue
+		}
+		var imbalance float64
+		if sl.used.mean < minFractionUsedThreshold {
+			imbalance = (float64(s.Capacity.RangeCount) - sl.count.mean) / math.Max(sl.count.mean, 1)
+		} else {
+			imbalance = s.Capacity.FractionUsed() - sl.used.mean
+		}
+		if imbalance >= rebalanceMinImbalance && imbalance > maxImbalance {
+			source = s
+			maxImbalance = imbalance
+		}
+	}
+	return source
+}
+
 // selectRandom chooses count random store descriptors which match the
 // required attributes and do not include any of the existing
 // replicas. If the supplied filter is nil, it is ignored. Returns the
@@ -187,6 +187,53 @@ func TestStoreRangeMergeWithData(t *testing.T) {
 	}
 }
 
+// TestStoreRangeMergeTooLarge verifies that two ranges are not
+// merged if their combined size exceeds the range max bytes.
+func TestStoreRangeMergeTooLarge(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	store, stopper := createTestStore(t)
+	defer stopper.Stop()
+
+	aDesc, bDesc, err := createSplitRanges(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := proto.Key("testing!")
+	pArgs, pReply := putArgs([]byte("aaa"), content, aDesc.RaftID, store.StoreID())
+	if err := store.ExecuteCmd(context.Background(), client.Call{Args: pArgs, Reply: pReply}); err != nil {
+		t.Fatal(err)
+	}
+	pArgs, pReply = putArgs([]byte("ccc"), content, bDesc.RaftID, store.StoreID())
+	if err := store.ExecuteCmd(context.Background(), client.Call{Args: pArgs, Reply: pReply}); err != nil {
+		t.Fatal(err)
+	}
+
+	rangeA := store.LookupRange([]byte("a"), nil)
+	rangeB := store.LookupRange([]byte("c"), nil)
+	msA, msB := rangeA.GetMVCCStats(), rangeB.GetMVCCStats()
+	size := msA.KeyBytes + msA.ValBytes + msB.KeyBytes + msB.ValBytes
+
+	// Lower the max bytes below the combined size; the merge must fail.
+	rangeA.SetMaxBytes(size - 1)
+	args, reply := adminMergeArgs(proto.KeyMin, aDesc.RaftID, store.StoreID())
+	if err := store.ExecuteCmd(context.Background(), client.Call{Args: args, Reply: reply}); err == nil {
+		t.Fatal("expected merge of ranges exceeding max bytes to fail")
+	}
+	if rng := store.LookupRange([]byte("c"), nil); rng.Desc().RaftID != bDesc.RaftID {
+		t.Errorf("expected range %d to be unmerged; got %d", bDesc.RaftID, rng.Desc().RaftID)
+	}
+
+	// With enough room, the merge succeeds.
+	rangeA.SetMaxBytes(size)
+	args, reply = adminMergeArgs(proto.KeyMin, aDesc.RaftID, store.StoreID())
+	if err := store.ExecuteCmd(context.Background(), client.Call{Args: args, Reply: reply}); err != nil {
+		t.Fatal(err)
+	}
+	if rng := store.LookupRange([]byte("c"), nil); rng.Desc().RaftID != aDesc.RaftID {
+		t.Errorf("expected range %d to be merged into %d", bDesc.RaftID, aDesc.RaftID)
+	}
+}
+
 // TestStoreRangeMergeLastRange verifies that merging the last range is a noop.
 func TestStoreRangeMergeLastRange(t *testing.T) {
 	defer leaktest.AfterTest(t)
@@ -333,6 +333,73 @@ func TestRestoreReplicas(t *testing.T) {
 	}
 }
 
+// TestReplicaGCThreshold verifies that the GC threshold set by an
+// InternalGC command is applied on every replica of the range, and
+// that it survives a restart, so that a replica which didn't run the
+// GC queue still refuses reads below it.
+func TestReplicaGCThreshold(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	mtc := multiTestContext{}
+	mtc.Start(t, 2)
+	defer mtc.Stop()
+
+	rng, err := mtc.stores[0].GetRange(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rng.ChangeReplicas(proto.ADD_REPLICA,
+		proto.Replica{
+			NodeID:  mtc.stores[1].Ident.NodeID,
+			StoreID: mtc.stores[1].Ident.StoreID,
+		}); err != nil {
+		t.Fatal(err)
+	}
+
+	threshold := mtc.stores[0].Clock().Now()
+	gcArgs := &proto.InternalGCRequest{
+		RequestHeader: proto.RequestHeader{
+			Key:       proto.KeyMin,
+			Timestamp: threshold,
+			RaftID:    1,
+			Replica:   proto.Replica{StoreID: mtc.stores[0].StoreID()},
+		},
+		GCMeta: proto.GCMetadata{
+			LastScanNanos: threshold.WallTime,
+			Threshold:     &threshold,
+		},
+	}
+	if err := mtc.stores[0].ExecuteCmd(context.Background(), client.Call{Args: gcArgs, Reply: &proto.InternalGCResponse{}}); err != nil {
+		t.Fatal(err)
+	}
+
+	readBelow := func(store *storage.Store) error {
+		getArgs, getResp := getArgs([]byte("a"), 1, store.StoreID())
+		getArgs.Timestamp = proto.Timestamp{WallTime: threshold.WallTime - 1}
+		getArgs.ReadConsistency = proto.INCONSISTENT
+		err := store.ExecuteCmd(context.Background(), client.Call{Args: getArgs, Reply: getResp})
+		if err == nil {
+			return util.Errorf("store %d: read below the GC threshold succeeded", store.StoreID())
+		}
+		if !strings.Contains(err.Error(), "below the GC threshold") {
+			return util.Errorf("store %d: unexpected error %s", store.StoreID(), err)
+		}
+		return nil
+	}
+
+	// The follower refuses the read once it has applied the command.
+	util.SucceedsWithin(t, 1*time.Second, func() error {
+		return readBelow(mtc.stores[1])
+	})
+
+	// Both replicas reload the threshold on restart.
+	mtc.restart()
+	for _, store := range mtc.stores {
+		if err := readBelow(store); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
 func TestFailedReplicaChange(t *testing.T) {
 	defer leaktest.AfterTest(t)
 	defer func() {
@@ -575,6 +642,47 @@ func TestProgressWithDownNode(t *testing.T) {
 	verify([]int64{16, 16, 16})
 }
 
+// TestCheckConsistency verifies that replicas with identical data
+// produce identical checksums and that a replica whose engine is
+// modified behind raft's back is reported as inconsistent.
+func TestCheckConsistency(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	mtc := startMultiTestContext(t, 3)
+	defer mtc.Stop()
+
+	raftID := int64(1)
+	mtc.replicateRange(raftID, 0, 1, 2)
+
+	pArgs, pReply := putArgs([]byte("a"), []byte("value"), raftID, mtc.stores[0].StoreID())
+	if err := mtc.stores[0].ExecuteCmd(context.Background(), client.Call{Args: pArgs, Reply: pReply}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The checksum command is applied after the put on every replica,
+	// so no replica may be reported even if it hasn't caught up yet.
+	inconsistent, err := storage.CheckConsistency(context.Background(), mtc.stores, raftID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inconsistent) != 0 {
+		t.Fatalf("expected consistent replicas; got %v", inconsistent)
+	}
+
+	// Corrupt the third replica by writing directly to its engine.
+	if err := engine.MVCCPut(mtc.engines[2], nil, proto.Key("a"), mtc.clock.Now(),
+		proto.Value{Bytes: []byte("corrupt")}, nil); err != nil {
+		t.Fatal(err)
+	}
+	inconsistent, err = storage.CheckConsistency(context.Background(), mtc.stores, raftID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inconsistent) != 1 || inconsistent[0].StoreID != mtc.stores[2].StoreID() {
+		t.Errorf("expected only the replica on store %d to be inconsistent; got %v",
+			mtc.stores[2].StoreID(), inconsistent)
+	}
+}
+
 func TestReplicateAddAndRemove(t *testing.T) {
 	defer leaktest.AfterTest(t)
 
@@ -681,3 +789,291 @@ func TestRaftHeartbeats(t *testing.T) {
 		t.Errorf("while sleeping, term changed from %d to %d", initialTerm, status.Term)
 	}
 }
+
+// TestRaftLogQueueTruncation verifies that once all replicas have
+// applied a long stretch of the raft log, the raft log queue truncates
+// its prefix on every replica without disturbing the applied state.
+func TestRaftLogQueueTruncation(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	mtc := multiTestContext{}
+	mtc.Start(t, 3)
+	defer mtc.Stop()
+
+	mtc.replicateRange(1, 0, 1, 2)
+
+	var firstIndexes []uint64
+	for _, s := range mtc.stores {
+		rng, err := s.GetRange(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		firstIndex, err := rng.FirstIndex()
+		if err != nil {
+			t.Fatal(err)
+		}
+		firstIndexes = append(firstIndexes, firstIndex)
+	}
+
+	// Append many entries to the log.
+	const numIncrements = 200
+	for i := 0; i < numIncrements; i++ {
+		incArgs, incResp := incrementArgs([]byte("a"), 1, 1, mtc.stores[0].StoreID())
+		if err := mtc.stores[0].ExecuteCmd(context.Background(), client.Call{Args: incArgs, Reply: incResp}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	verifyValue := func(expected int64) {
+		util.SucceedsWithin(t, 1*time.Second, func() error {
+			for i, s := range mtc.stores {
+				getArgs, getResp := getArgs([]byte("a"), 1, s.StoreID())
+				getArgs.ReadConsistency = proto.INCONSISTENT
+				if err := s.ExecuteCmd(context.Background(), client.Call{Args: getArgs, Reply: getResp}); err != nil {
+					return err
+				}
+				if v := getResp.Value.GetInteger(); v != expected {
+					return util.Errorf("store %d: expected %d, got %d", i, expected, v)
+				}
+			}
+			return nil
+		})
+	}
+	// Wait for every replica to apply all entries.
+	verifyValue(numIncrements)
+
+	mtc.stores[0].ForceRaftLogScan(t)
+
+	// The first index advances on every replica.
+	util.SucceedsWithin(t, 1*time.Second, func() error {
+		for i, s := range mtc.stores {
+			rng, err := s.GetRange(1)
+			if err != nil {
+				return err
+			}
+			firstIndex, err := rng.FirstIndex()
+			if err != nil {
+				return err
+			}
+			if firstIndex <= firstIndexes[i] {
+				return util.Errorf("store %d: expected first index > %d, got %d", i, firstIndexes[i], firstIndex)
+			}
+		}
+		return nil
+	})
+
+	// The state machine is intact and the range still accepts commands.
+	verifyValue(numIncrements)
+	incArgs, incResp := incrementArgs([]byte("a"), 1, 1, mtc.stores[0].StoreID())
+	if err := mtc.stores[0].ExecuteCmd(context.Background(), client.Call{Args: incArgs, Reply: incResp}); err != nil {
+		t.Fatal(err)
+	}
+	verifyValue(numIncrements + 1)
+}
+
+// TestConsensusReadNoLogAppend verifies that a consensus read reflects
+// all previously committed writes without appending to the raft log.
+func TestConsensusReadNoLogAppend(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	mtc := multiTestContext{}
+	mtc.Start(t, 3)
+	defer mtc.Stop()
+
+	mtc.replicateRange(1, 0, 1, 2)
+
+	const numIncrements = 10
+	for i := 0; i < numIncrements; i++ {
+		incArgs, incResp := incrementArgs([]byte("a"), 1, 1, mtc.stores[0].StoreID())
+		if err := mtc.stores[0].ExecuteCmd(context.Background(), client.Call{Args: incArgs, Reply: incResp}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rng, err := mtc.stores[0].GetRange(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lastIndex, err := rng.LastIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	getArgs, getResp := getArgs([]byte("a"), 1, mtc.stores[0].StoreID())
+	getArgs.ReadConsistency = proto.CONSENSUS
+	if err := mtc.stores[0].ExecuteCmd(context.Background(), client.Call{Args: getArgs, Reply: getResp}); err != nil {
+		t.Fatal(err)
+	}
+	if v := getResp.Value.GetInteger(); v != numIncrements {
+		t.Errorf("expected %d, got %d", numIncrements, v)
+	}
+
+	if newLastIndex, err := rng.LastIndex(); err != nil {
+		t.Fatal(err)
+	} else if newLastIndex != lastIndex {
+		t.Errorf("expected last index to remain %d, got %d", lastIndex, newLastIndex)
+	}
+}
+
+// TestStoreDrain verifies that draining a store transfers the leader
+// leases it holds to a replica on a live node before returning and
+// that the drained store rejects new commands.
+func TestStoreDrain(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	mtc := startMultiTestContext(t, 3)
+	defer mtc.Stop()
+
+	// Gossip a liveness record for the third node only, so that the
+	// lease can't be handed to the second node's replica.
+	expiration := mtc.clock.Now()
+	expiration.WallTime += time.Minute.Nanoseconds()
+	liveNodeID := mtc.stores[2].Ident.NodeID
+	if err := mtc.stores[0].Gossip().AddInfo(gossip.MakeNodeLivenessKey(liveNodeID), expiration, 0*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	raftID := int64(1)
+	mtc.replicateRange(raftID, 0, 1, 2)
+
+	// Write through the first store so that it acquires the leader lease.
+	incArgs, incResp := incrementArgs([]byte("a"), 5, raftID, mtc.stores[0].StoreID())
+	if err := mtc.stores[0].ExecuteCmd(context.Background(), client.Call{Args: incArgs, Reply: incResp}); err != nil {
+		t.Fatal(err)
+	}
+	rng, err := mtc.stores[0].GetRange(raftID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if held, expired := rng.HasLeaderLease(mtc.clock.Now()); !held || expired {
+		t.Fatal("expected the first store to hold the leader lease")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := mtc.stores[0].Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The lease must have moved to one of the other stores.
+	now := mtc.clock.Now()
+	if held, expired := rng.HasLeaderLease(now); held && !expired {
+		t.Fatal("expected the drained store to have given up the leader lease")
+	}
+	for i, s := range mtc.stores[1:] {
+		r, err := s.GetRange(raftID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		held, expired := r.HasLeaderLease(now)
+		if e := s.Ident.NodeID == liveNodeID; (held && !expired) != e {
+			t.Errorf("store %d: expected leader lease held=%t; got held=%t, expired=%t", i+1, e, held, expired)
+		}
+	}
+
+	// The drained store rejects new commands.
+	getArgs, getResp := getArgs([]byte("a"), raftID, mtc.stores[0].StoreID())
+	err = mtc.stores[0].ExecuteCmd(context.Background(), client.Call{Args: getArgs, Reply: getResp})
+	if _, ok := err.(*proto.NotLeaderError); !ok {
+		t.Fatalf("expected a NotLeaderError from the drained store; got %v", err)
+	}
+}
+
+// TestStoreDrainTimeout verifies that a drain which can't hand off the
+// store's leader leases gives up when its context is done and that the
+// store then resumes serving commands.
+func TestStoreDrainTimeout(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	mtc := startMultiTestContext(t, 2)
+	defer mtc.Stop()
+
+	// No liveness records are gossiped, so there's no lease target.
+	raftID := int64(1)
+	mtc.replicateRange(raftID, 0, 1)
+	incArgs, incResp := incrementArgs([]byte("a"), 5, raftID, mtc.stores[0].StoreID())
+	if err := mtc.stores[0].ExecuteCmd(context.Background(), client.Call{Args: incArgs, Reply: incResp}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := mtc.stores[0].Drain(ctx); err == nil {
+		t.Fatal("expected drain to fail without a live lease target")
+	}
+	if mtc.stores[0].IsDraining() {
+		t.Fatal("expected the store to stop draining after a failed drain")
+	}
+	getArgs, getResp := getArgs([]byte("a"), raftID, mtc.stores[0].StoreID())
+	if err := mtc.stores[0].ExecuteCmd(context.Background(), client.Call{Args: getArgs, Reply: getResp}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRaftProposalQuota verifies that a range with a stalled follower
+// stops accepting proposals once its proposal quota is exhausted, and
+// resumes once the follower catches up and the quota is released.
+func TestRaftProposalQuota(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	sCtx := storage.TestStoreContext
+	// Any single proposal exhausts the quota.
+	sCtx.RaftProposalQuota = 1
+	mtc := multiTestContext{storeContext: &sCtx}
+	mtc.Start(t, 2)
+	defer mtc.Stop()
+
+	// With two replicas, a quorum requires the follower.
+	raftID := int64(1)
+	mtc.replicateRange(raftID, 0, 1)
+
+	key := proto.Key("a")
+	increment := func(ctx context.Context) error {
+		incArgs, incResp := incrementArgs(key, 5, raftID, mtc.stores[0].StoreID())
+		return mtc.stores[0].ExecuteCmd(ctx, client.Call{Args: incArgs, Reply: incResp})
+	}
+	// Acquire the leader lease while the follower is still up.
+	if err := increment(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Stall the follower and fill the quota with a proposal which cannot
+	// commit until the follower returns.
+	mtc.stopStore(1)
+	stalledErr := make(chan error, 1)
+	go func() {
+		stalledErr <- increment(context.Background())
+	}()
+
+	// Further proposals block on the quota until their context expires.
+	util.SucceedsWithin(t, time.Second, func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if err := increment(ctx); err == nil {
+			return util.Error("expected proposal to block on exhausted quota")
+		}
+		return nil
+	})
+	select {
+	case err := <-stalledErr:
+		t.Fatalf("unexpected completion of stalled proposal: %v", err)
+	default:
+	}
+
+	// Once the follower catches up, the stalled proposal commits, its
+	// quota is released and new proposals succeed.
+	mtc.restartStore(1)
+	if err := <-stalledErr; err != nil {
+		t.Fatal(err)
+	}
+	if err := increment(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	util.SucceedsWithin(t, time.Second, func() error {
+		for i, eng := range mtc.engines {
+			val, err := engine.MVCCGet(eng, key, mtc.clock.Now(), true, nil)
+			if err != nil {
+				return err
+			}
+			if v := val.GetInteger(); v != 15 {
+				return util.Errorf("expected store %d to have value 15; got %d", i, v)
+			}
+		}
+		return nil
+	})
+}
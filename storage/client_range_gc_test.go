@@ -21,7 +21,13 @@ import (
 	"testing"
 	"time"
 
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/client"
+	"github.com/cockroachdb/cockroach/keys"
+	"github.com/cockroachdb/cockroach/proto"
 	"github.com/cockroachdb/cockroach/storage"
+	"github.com/cockroachdb/cockroach/storage/engine"
 	"github.com/cockroachdb/cockroach/util"
 	"github.com/cockroachdb/cockroach/util/leaktest"
 )
@@ -55,3 +61,48 @@ func TestRangeGCQueueDropReplica(t *testing.T) {
 	mtc.stopStore(1)
 	mtc.restartStore(1)
 }
+
+// TestRangeGCQueueRemovedReplica verifies that a replica which applies
+// its own removal from the range is queued for GC and its data cleared
+// without waiting for the range scanner or the leader lease to expire.
+func TestRangeGCQueueRemovedReplica(t *testing.T) {
+	defer leaktest.AfterTest(t)
+
+	mtc := startMultiTestContext(t, 3)
+	defer mtc.Stop()
+	raftID := int64(1)
+	mtc.replicateRange(raftID, 0, 1, 2)
+
+	key := proto.Key("a")
+	incArgs, incResp := incrementArgs(key, 5, raftID, mtc.stores[0].StoreID())
+	if err := mtc.stores[0].ExecuteCmd(context.Background(), client.Call{Args: incArgs, Reply: incResp}); err != nil {
+		t.Fatal(err)
+	}
+	util.SucceedsWithin(t, time.Second, func() error {
+		if val, err := engine.MVCCGet(mtc.engines[1], key, mtc.clock.Now(), true, nil); err != nil || val == nil {
+			return util.Errorf("key %q not yet replicated: %v", key, err)
+		}
+		return nil
+	})
+
+	mtc.unreplicateRange(raftID, 0, 1)
+
+	util.SucceedsWithin(t, time.Second, func() error {
+		if _, err := mtc.stores[1].GetRange(raftID); err == nil {
+			return util.Error("expected range removal")
+		}
+		// Both the range-local and the user data must be cleared.
+		for _, k := range []proto.Key{keys.RangeDescriptorKey(proto.KeyMin), key} {
+			if val, err := engine.MVCCGet(mtc.engines[1], k, mtc.clock.Now(), true, nil); err != nil {
+				return err
+			} else if val != nil {
+				return util.Errorf("expected %q to be cleared", k)
+			}
+		}
+		return nil
+	})
+
+	// Restart the store to tear down the test cleanly.
+	mtc.stopStore(1)
+	mtc.restartStore(1)
+}
@@ -19,6 +19,7 @@ package storage_test
 
 import (
 	"bytes"
+	"fmt"
 	"math/rand"
 	"reflect"
 	"regexp"
@@ -113,6 +114,40 @@ func TestStoreRangeSplitAtRangeBounds(t *testing.T) {
 	}
 }
 
+// TestStoreAdminSplitAt verifies that AdminSplitAt splits a range at
+// the specified key and refuses to split at an existing boundary.
+func TestStoreAdminSplitAt(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	store, stopper := createTestStore(t)
+	defer stopper.Stop()
+
+	splitKey := proto.Key("m")
+	if err := store.AdminSplitAt(context.Background(), splitKey); err != nil {
+		t.Fatal(err)
+	}
+	left := store.LookupRange(proto.Key("a"), nil)
+	right := store.LookupRange(proto.Key("z"), nil)
+	if left == nil || right == nil || left == right {
+		t.Fatalf("expected two distinct ranges; got %v and %v", left, right)
+	}
+	if desc := left.Desc(); !desc.StartKey.Equal(proto.KeyMin) || !desc.EndKey.Equal(splitKey) {
+		t.Errorf("unexpected left range descriptor %+v", desc)
+	}
+	if desc := right.Desc(); !desc.StartKey.Equal(splitKey) || !desc.EndKey.Equal(proto.KeyMax) {
+		t.Errorf("unexpected right range descriptor %+v", desc)
+	}
+	if left.Desc().RaftID == right.Desc().RaftID {
+		t.Errorf("expected distinct raft IDs; got %d", left.Desc().RaftID)
+	}
+
+	// Splitting again at the same key fails.
+	if err := store.AdminSplitAt(context.Background(), splitKey); err == nil {
+		t.Error("expected error splitting at range boundary")
+	} else if matched, _ := regexp.MatchString("already a range boundary", err.Error()); !matched {
+		t.Errorf("expected range boundary error; got %s", err)
+	}
+}
+
 // TestStoreRangeSplitConcurrent verifies that concurrent range splits
 // of the same range are executed serially, and all but the first fail
 // because the split key is invalid after the first split succeeds.
@@ -411,6 +446,119 @@ func TestStoreZoneUpdateAndRangeSplit(t *testing.T) {
 	}
 }
 
+// TestStoreRangeSplitBalanced verifies that a range which grows past
+// its zone's RangeMaxBytes is split automatically by the split queue
+// and that the split key divides the range's bytes roughly in half.
+func TestStoreRangeSplitBalanced(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	store, stopper := createTestStore(t)
+	defer stopper.Stop()
+
+	maxBytes := int64(1 << 16)
+	rng := store.LookupRange(proto.KeyMin, nil)
+	fillRange(store, rng.Desc().RaftID, proto.Key("test"), maxBytes*3/2, t)
+
+	zoneConfig := &proto.ZoneConfig{
+		ReplicaAttrs: []proto.Attributes{
+			{},
+			{},
+			{},
+		},
+		RangeMinBytes: 1 << 8,
+		RangeMaxBytes: maxBytes,
+	}
+	key := keys.MakeKey(keys.ConfigZonePrefix, proto.KeyMin)
+	if err := store.DB().Put(key, zoneConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	var newRng *storage.Range
+	if err := util.IsTrueWithin(func() bool {
+		newRng = store.LookupRange(proto.Key("\xff\x00"), nil)
+		return newRng != rng
+	}, time.Second); err != nil {
+		t.Fatalf("expected range to split within 1s")
+	}
+
+	// Both halves must hold a comparable share of the bytes.
+	var ms, newMS proto.MVCCStats
+	if err := engine.MVCCGetRangeStats(store.Engine(), rng.Desc().RaftID, &ms); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.MVCCGetRangeStats(store.Engine(), newRng.Desc().RaftID, &newMS); err != nil {
+		t.Fatal(err)
+	}
+	size, newSize := ms.KeyBytes+ms.ValBytes, newMS.KeyBytes+newMS.ValBytes
+	if size > maxBytes || newSize > maxBytes {
+		t.Errorf("expected both ranges below %d bytes; got %d and %d", maxBytes, size, newSize)
+	}
+	if size < newSize/2 || newSize < size/2 {
+		t.Errorf("expected a balanced split; got %d and %d bytes", size, newSize)
+	}
+}
+
+// TestStoreRangeSplitOnLiveBytes verifies that a range whose live
+// bytes exceed its zone's RangeMaxLiveBytes is split by the split
+// queue, and that the split key lies near the median of the live data
+// rather than of the range's total bytes.
+func TestStoreRangeSplitOnLiveBytes(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	store, stopper := createTestStore(t)
+	defer stopper.Stop()
+
+	// Write 64 keys and delete the first half of them, so that all of
+	// the live data is in the second half of the key space.
+	const numKeys = 64
+	value := bytes.Repeat([]byte("X"), 1<<10)
+	key := func(i int) proto.Key {
+		return proto.Key(fmt.Sprintf("live%03d", i))
+	}
+	for i := 0; i < numKeys; i++ {
+		if err := store.DB().Put(key(i), value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < numKeys/2; i++ {
+		if err := store.DB().Del(key(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rng := store.LookupRange(proto.KeyMin, nil)
+	var ms proto.MVCCStats
+	if err := engine.MVCCGetRangeStats(store.Engine(), rng.Desc().RaftID, &ms); err != nil {
+		t.Fatal(err)
+	}
+	zoneConfig := &proto.ZoneConfig{
+		ReplicaAttrs: []proto.Attributes{
+			{},
+			{},
+			{},
+		},
+		RangeMinBytes:     1 << 8,
+		RangeMaxBytes:     64 << 20,
+		RangeMaxLiveBytes: ms.LiveBytes * 3 / 4,
+	}
+	if err := store.DB().Put(keys.MakeKey(keys.ConfigZonePrefix, proto.KeyMin), zoneConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	var newRng *storage.Range
+	if err := util.IsTrueWithin(func() bool {
+		newRng = store.LookupRange(key(numKeys-1), nil)
+		return newRng != rng
+	}, time.Second); err != nil {
+		t.Fatalf("expected range to split within 1s")
+	}
+
+	// The live keys are [numKeys/2, numKeys); expect a split close to
+	// their median.
+	splitKey := newRng.Desc().StartKey
+	if splitKey.Less(key(numKeys*5/8)) || key(numKeys*7/8).Less(splitKey) {
+		t.Errorf("expected split key between %q and %q; got %q", key(numKeys*5/8), key(numKeys*7/8), splitKey)
+	}
+}
+
 // TestStoreRangeSplitOnConfigs verifies that config changes to both
 // accounting and zone configs cause ranges to be split along prefix
 // boundaries.
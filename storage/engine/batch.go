@@ -0,0 +1,315 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package engine
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"github.com/cockroachdb/cockroach/proto"
+	"github.com/cockroachdb/cockroach/util"
+	gogoproto "github.com/gogo/protobuf/proto"
+)
+
+// The serialized form of a RocksDB write batch is a 12 byte header,
+// holding a little-endian 8 byte sequence number and 4 byte entry
+// count, followed by the entries. Each entry is a type tag followed by
+// a varint length-prefixed key and, for puts, a varint
+// length-prefixed value.
+//
+// With prefix compression, the prefixed flag is set in the type tag of
+// an entry whose key shares a prefix with the key of the preceding
+// entry. The key is then encoded as the varint length of the shared
+// prefix followed by the varint length-prefixed remainder of the key.
+// RocksDB doesn't understand such entries, so a batch built with
+// prefix compression can only be read with IterateBatchRepr.
+const (
+	batchHeaderSize = 12
+
+	batchTypeDeletion byte = 0x0
+	batchTypeValue    byte = 0x1
+
+	batchTypePrefixedFlag byte = 0x80
+)
+
+// RocksDBBatchBuilder builds the serialized form of a RocksDB write
+// batch without requiring an engine. This allows bulk data to be
+// prepared anywhere and shipped to a range via InternalWriteBatch.
+// Only puts and deletions are supported.
+type RocksDBBatchBuilder struct {
+	// PrefixCompression encodes each key as the length of the prefix it
+	// shares with the preceding key plus the remaining suffix. This
+	// shrinks batches of sequential keys, such as MVCC versions, which
+	// share long prefixes.
+	PrefixCompression bool
+
+	repr    []byte
+	count   uint32
+	lastKey []byte
+}
+
+func (b *RocksDBBatchBuilder) maybeInit() {
+	if b.repr == nil {
+		b.repr = make([]byte, batchHeaderSize)
+	}
+}
+
+// appendKey appends an entry of the given type with the given key,
+// encoding the key relative to the previous one if prefix compression
+// is enabled and the keys share a prefix.
+func (b *RocksDBBatchBuilder) appendKey(typ byte, key proto.EncodedKey) {
+	b.maybeInit()
+	b.count++
+	if !b.PrefixCompression {
+		b.repr = append(b.repr, typ)
+		b.repr = appendVarBytes(b.repr, key)
+		return
+	}
+	var shared int
+	for shared < len(key) && shared < len(b.lastKey) && key[shared] == b.lastKey[shared] {
+		shared++
+	}
+	b.lastKey = append(b.lastKey[:0], key...)
+	if shared == 0 {
+		b.repr = append(b.repr, typ)
+		b.repr = appendVarBytes(b.repr, key)
+		return
+	}
+	b.repr = append(b.repr, typ|batchTypePrefixedFlag)
+	b.repr = appendUvarint(b.repr, uint64(shared))
+	b.repr = appendVarBytes(b.repr, key[shared:])
+}
+
+// Put sets the value for the given key.
+func (b *RocksDBBatchBuilder) Put(key proto.EncodedKey, value []byte) {
+	b.appendKey(batchTypeValue, key)
+	b.repr = appendVarBytes(b.repr, value)
+}
+
+// Clear removes the item with the given key.
+func (b *RocksDBBatchBuilder) Clear(key proto.EncodedKey) {
+	b.appendKey(batchTypeDeletion, key)
+}
+
+// MVCCPut adds the metadata and version entries for a non-transactional
+// write of value to key at timestamp. The entries are the same as those
+// written by MVCCPut for a key without any existing versions, which
+// the key is assumed not to have.
+func (b *RocksDBBatchBuilder) MVCCPut(key proto.Key, timestamp proto.Timestamp, value proto.Value) error {
+	if len(key) == 0 {
+		return emptyKeyError()
+	}
+	valueBytes, err := gogoproto.Marshal(&proto.MVCCValue{Value: &value})
+	if err != nil {
+		return err
+	}
+	meta := proto.MVCCMetadata{
+		Timestamp: timestamp,
+		KeyBytes:  mvccVersionTimestampSize,
+		ValBytes:  int64(len(valueBytes)),
+	}
+	metaBytes, err := gogoproto.Marshal(&meta)
+	if err != nil {
+		return err
+	}
+	b.Put(MVCCEncodeKey(key), metaBytes)
+	b.Put(MVCCEncodeVersionKey(key, timestamp), valueBytes)
+	return nil
+}
+
+// Finish returns the serialized batch and resets the builder. The
+// PrefixCompression setting is retained. If it is set, the batch can
+// only be read with IterateBatchRepr and must not be handed to RocksDB.
+func (b *RocksDBBatchBuilder) Finish() []byte {
+	b.maybeInit()
+	binary.LittleEndian.PutUint32(b.repr[8:batchHeaderSize], b.count)
+	repr := b.repr
+	b.repr, b.count, b.lastKey = nil, 0, b.lastKey[:0]
+	return repr
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var vBuf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(vBuf[:], v)
+	return append(buf, vBuf[:n]...)
+}
+
+func appendVarBytes(buf, data []byte) []byte {
+	buf = appendUvarint(buf, uint64(len(data)))
+	return append(buf, data...)
+}
+
+func readVarBytes(repr []byte) ([]byte, []byte, error) {
+	l, n := binary.Uvarint(repr)
+	if n <= 0 || uint64(len(repr)-n) < l {
+		return nil, nil, util.Errorf("malformed batch entry")
+	}
+	return repr[n : n+int(l)], repr[n+int(l):], nil
+}
+
+// IterateBatchRepr invokes f for each entry of the serialized RocksDB
+// write batch repr, in the order in which the entries were added. The
+// value is nil for deletions. Keys of prefix compressed entries are
+// reconstructed in full. Merges and column family entries are not
+// supported and result in an error. If f returns an error, iteration
+// stops and the error is propagated.
+func IterateBatchRepr(repr []byte, f func(key proto.EncodedKey, value []byte) error) error {
+	return iterateBatchRepr(repr, true, f)
+}
+
+// VerifyRocksDBBatchRepr returns an error if repr is malformed or is
+// not readable by RocksDB, which is the case for batches built with
+// prefix compression. Any path which hands a serialized batch to
+// RocksDB directly, rather than decoding it with IterateBatchRepr, must
+// verify it first.
+func VerifyRocksDBBatchRepr(repr []byte) error {
+	return iterateBatchRepr(repr, false, func(proto.EncodedKey, []byte) error { return nil })
+}
+
+func iterateBatchRepr(repr []byte, allowPrefixed bool, f func(key proto.EncodedKey, value []byte) error) error {
+	if len(repr) < batchHeaderSize {
+		return util.Errorf("batch repr of %d bytes is too short", len(repr))
+	}
+	count := binary.LittleEndian.Uint32(repr[8:batchHeaderSize])
+	data := repr[batchHeaderSize:]
+	var lastKey []byte
+	for i := uint32(0); i < count; i++ {
+		if len(data) == 0 {
+			return util.Errorf("batch repr ended after %d of %d entries", i, count)
+		}
+		typ := data[0]
+		data = data[1:]
+		var shared uint64
+		if typ&batchTypePrefixedFlag != 0 {
+			if !allowPrefixed {
+				return util.Errorf("batch entry %d is prefix compressed and can't be read by RocksDB", i)
+			}
+			typ &^= batchTypePrefixedFlag
+			var n int
+			if shared, n = binary.Uvarint(data); n <= 0 || shared > uint64(len(lastKey)) {
+				return util.Errorf("malformed batch entry")
+			}
+			data = data[n:]
+		}
+		var key, value []byte
+		var err error
+		if key, data, err = readVarBytes(data); err != nil {
+			return err
+		}
+		if shared > 0 {
+			key = append(append(make([]byte, 0, int(shared)+len(key)), lastKey[:shared]...), key...)
+		}
+		lastKey = key
+		switch typ {
+		case batchTypeValue:
+			if value, data, err = readVarBytes(data); err != nil {
+				return err
+			}
+		case batchTypeDeletion:
+		default:
+			return util.Errorf("unsupported batch entry type %d", typ)
+		}
+		if err := f(key, value); err != nil {
+			return err
+		}
+	}
+	if len(data) != 0 {
+		return util.Errorf("batch repr has %d trailing bytes", len(data))
+	}
+	return nil
+}
+
+// A BatchReprSpan is one of the batches returned by SplitBatchRepr,
+// along with the span [Key, EndKey) of the MVCC keys it writes.
+type BatchReprSpan struct {
+	Repr        []byte
+	Key, EndKey proto.Key
+}
+
+// SplitBatchRepr splits the serialized RocksDB write batch repr into
+// batches of at most maxBytes bytes each. The entries of an MVCC key
+// are kept together and the batches are ordered by key, so that they
+// cover disjoint spans. The returned batches are built without prefix
+// compression. An error is returned if a key lies outside of the span
+// [start, end) or if the entries of a single key don't fit in
+// maxBytes.
+func SplitBatchRepr(repr []byte, start, end proto.Key, maxBytes int) ([]BatchReprSpan, error) {
+	type batchEntry struct {
+		encKey, value []byte
+	}
+	entriesByKey := map[string][]batchEntry{}
+	var sortedKeys []string
+	if err := IterateBatchRepr(repr, func(encKey proto.EncodedKey, value []byte) error {
+		key, _, _, err := mvccDecodeKey(encKey)
+		if err != nil {
+			return err
+		}
+		if key.Less(start) || !key.Less(end) {
+			return util.Errorf("batch key %q is outside of span [%q, %q)", key, start, end)
+		}
+		if _, ok := entriesByKey[string(key)]; !ok {
+			sortedKeys = append(sortedKeys, string(key))
+		}
+		entriesByKey[string(key)] = append(entriesByKey[string(key)], batchEntry{encKey, value})
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	sort.Strings(sortedKeys)
+
+	var spans []BatchReprSpan
+	var b RocksDBBatchBuilder
+	var spanKey, lastKey proto.Key
+	addEntries := func(entries []batchEntry) {
+		for _, e := range entries {
+			if e.value == nil {
+				b.Clear(e.encKey)
+			} else {
+				b.Put(e.encKey, e.value)
+			}
+		}
+	}
+	for _, k := range sortedKeys {
+		key, entries := proto.Key(k), entriesByKey[k]
+		b.maybeInit()
+		reprLen, count := len(b.repr), b.count
+		addEntries(entries)
+		if len(b.repr) <= maxBytes {
+			if spanKey == nil {
+				spanKey = key
+			}
+			lastKey = key
+			continue
+		}
+		if spanKey == nil {
+			return nil, util.Errorf("entries of batch key %q exceed %d bytes", key, maxBytes)
+		}
+		// Finish the batch without this key's entries and start a new
+		// one with them.
+		b.repr, b.count = b.repr[:reprLen], count
+		spans = append(spans, BatchReprSpan{Repr: b.Finish(), Key: spanKey, EndKey: lastKey.Next()})
+		spanKey, lastKey = nil, nil
+		addEntries(entries)
+		if len(b.repr) > maxBytes {
+			return nil, util.Errorf("entries of batch key %q exceed %d bytes", key, maxBytes)
+		}
+		spanKey, lastKey = key, key
+	}
+	if spanKey != nil {
+		spans = append(spans, BatchReprSpan{Repr: b.Finish(), Key: spanKey, EndKey: lastKey.Next()})
+	}
+	return spans, nil
+}
@@ -19,6 +19,8 @@ package engine
 
 import (
 	"bytes"
+	"encoding/binary"
+	"fmt"
 	"reflect"
 	"testing"
 
@@ -435,3 +437,177 @@ func TestBatchConcurrency(t *testing.T) {
 		t.Error("mismatch of \"a\"")
 	}
 }
+
+// TestRocksDBBatchBuilder verifies that the entries of a built batch
+// are read back in order and that malformed batches are rejected.
+func TestRocksDBBatchBuilder(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	var b RocksDBBatchBuilder
+	b.Put(proto.EncodedKey("a"), []byte("value"))
+	b.Put(proto.EncodedKey("b"), nil)
+	b.Clear(proto.EncodedKey("c"))
+	repr := b.Finish()
+
+	type entry struct {
+		key   string
+		value []byte
+	}
+	var entries []entry
+	if err := IterateBatchRepr(repr, func(key proto.EncodedKey, value []byte) error {
+		entries = append(entries, entry{string(key), value})
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	expEntries := []entry{{"a", []byte("value")}, {"b", []byte{}}, {"c", nil}}
+	if !reflect.DeepEqual(entries, expEntries) {
+		t.Errorf("expected entries %v; got %v", expEntries, entries)
+	}
+
+	// The builder is reset by Finish.
+	if err := IterateBatchRepr(b.Finish(), func(proto.EncodedKey, []byte) error {
+		t.Error("unexpected entry in empty batch")
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, malformed := range [][]byte{
+		nil,
+		repr[:batchHeaderSize],
+		repr[:len(repr)-1],
+		append(append([]byte(nil), repr...), 0),
+	} {
+		if err := IterateBatchRepr(malformed, func(proto.EncodedKey, []byte) error { return nil }); err == nil {
+			t.Errorf("%d: expected error for malformed batch", i)
+		}
+	}
+}
+
+// TestRocksDBBatchBuilderPrefixCompression builds batches of 10k
+// sequential MVCC keys with and without prefix compression and
+// verifies that compression shrinks the batch substantially while
+// reading back the same entries.
+func TestRocksDBBatchBuilderPrefixCompression(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	const numKeys = 10000
+	build := func(compress bool) []byte {
+		b := RocksDBBatchBuilder{PrefixCompression: compress}
+		for i := 0; i < numKeys; i++ {
+			key := proto.Key(fmt.Sprintf("/db/table/index/%05d", i))
+			b.Put(MVCCEncodeKey(key), []byte("meta"))
+			b.Put(MVCCEncodeVersionKey(key, makeTS(int64(i+1), 0)), value1.Bytes)
+		}
+		b.Clear(MVCCEncodeKey(proto.Key("/db/table/index/00000")))
+		return b.Finish()
+	}
+	readAll := func(repr []byte) []proto.RawKeyValue {
+		var kvs []proto.RawKeyValue
+		if err := IterateBatchRepr(repr, func(key proto.EncodedKey, value []byte) error {
+			kvs = append(kvs, proto.RawKeyValue{Key: key, Value: value})
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return kvs
+	}
+
+	plain, compressed := build(false), build(true)
+	if len(compressed)*3 > len(plain)*2 {
+		t.Errorf("expected compressed batch of %d bytes to be at least a third smaller than %d bytes",
+			len(compressed), len(plain))
+	}
+	plainKVs, compressedKVs := readAll(plain), readAll(compressed)
+	if len(plainKVs) != 2*numKeys+1 {
+		t.Fatalf("expected %d entries; got %d", 2*numKeys+1, len(plainKVs))
+	}
+	if !reflect.DeepEqual(plainKVs, compressedKVs) {
+		t.Error("expected compressed batch to read back the same entries")
+	}
+
+	// Only the uncompressed batch may be handed to RocksDB.
+	if err := VerifyRocksDBBatchRepr(plain); err != nil {
+		t.Errorf("expected plain batch to verify; got %s", err)
+	}
+	if err := VerifyRocksDBBatchRepr(compressed); err == nil {
+		t.Error("expected error verifying compressed batch for RocksDB")
+	}
+
+	// A shared prefix longer than the preceding key is rejected.
+	malformed := append([]byte(nil), compressed[:batchHeaderSize]...)
+	malformed = append(malformed, batchTypeDeletion|batchTypePrefixedFlag, 1, 1, 'a')
+	binary.LittleEndian.PutUint32(malformed[8:batchHeaderSize], 1)
+	if err := IterateBatchRepr(malformed, func(proto.EncodedKey, []byte) error { return nil }); err == nil {
+		t.Error("expected error for malformed prefix compressed entry")
+	}
+}
+
+// TestSplitBatchRepr verifies that SplitBatchRepr splits a batch into
+// batches under the size limit which cover disjoint spans in key
+// order, without separating the entries of a key.
+func TestSplitBatchRepr(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	const numKeys = 100
+	ts := makeTS(1, 0)
+	var b RocksDBBatchBuilder
+	// Add the keys in reverse order to verify the batches are sorted.
+	for i := numKeys - 1; i >= 0; i-- {
+		if err := b.MVCCPut(proto.Key(fmt.Sprintf("key%03d", i)), ts, proto.Value{Bytes: make([]byte, 50)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repr := b.Finish()
+
+	const maxBytes = 1000
+	spans, err := SplitBatchRepr(repr, proto.Key("key"), proto.Key("key").PrefixEnd(), maxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spans) < 2 {
+		t.Fatalf("expected batch of %d bytes to be split; got %d batches", len(repr), len(spans))
+	}
+	var i int
+	var lastEnd proto.Key
+	for j, span := range spans {
+		if len(span.Repr) > maxBytes {
+			t.Errorf("%d: expected batch of at most %d bytes; got %d", j, maxBytes, len(span.Repr))
+		}
+		if span.Key.Less(lastEnd) {
+			t.Errorf("%d: span [%q, %q) overlaps preceding span", j, span.Key, span.EndKey)
+		}
+		lastEnd = span.EndKey
+		var metas, versions int
+		if err := IterateBatchRepr(span.Repr, func(encKey proto.EncodedKey, _ []byte) error {
+			key, _, isValue := MVCCDecodeKey(encKey)
+			if key.Less(span.Key) || !key.Less(span.EndKey) {
+				t.Errorf("%d: key %q outside of span [%q, %q)", j, key, span.Key, span.EndKey)
+			}
+			if isValue {
+				versions++
+			} else {
+				if expKey := proto.Key(fmt.Sprintf("key%03d", i)); !key.Equal(expKey) {
+					t.Errorf("%d: expected key %q; got %q", j, expKey, key)
+				}
+				metas++
+				i++
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if metas != versions {
+			t.Errorf("%d: expected each key's entries together; got %d metas and %d versions", j, metas, versions)
+		}
+	}
+	if i != numKeys {
+		t.Errorf("expected %d keys; got %d", numKeys, i)
+	}
+
+	// Keys whose entries don't fit and keys outside the span are refused.
+	if _, err := SplitBatchRepr(repr, proto.Key("key"), proto.Key("key").PrefixEnd(), 50); err == nil {
+		t.Error("expected error splitting batch with keys larger than the limit")
+	}
+	if _, err := SplitBatchRepr(repr, proto.Key("key050"), proto.Key("key").PrefixEnd(), maxBytes); err == nil {
+		t.Error("expected error splitting batch with keys outside of the span")
+	}
+}
@@ -25,6 +25,7 @@
 #include "rocksdb/env.h"
 #include "rocksdb/merge_operator.h"
 #include "rocksdb/options.h"
+#include "rocksdb/statistics.h"
 #include "rocksdb/table.h"
 #include "rocksdb/utilities/write_batch_with_index.h"
 #include "cockroach/proto/api.pb.h"
@@ -51,6 +52,8 @@ struct DBBatch {
 struct DBEngine {
   rocksdb::DB* rep;
   rocksdb::Env* memenv;
+  std::shared_ptr<rocksdb::Cache> block_cache;
+  std::shared_ptr<rocksdb::Statistics> statistics;
 };
 
 struct DBIterator {
@@ -1089,6 +1092,7 @@ DBStatus DBOpen(DBEngine **db, DBSlice dir, DBOptions db_opts) {
   options.create_if_missing = true;
   options.info_log.reset(new DBLogger(db_opts.logging_enabled));
   options.merge_operator.reset(new DBMergeOperator);
+  options.statistics = rocksdb::CreateDBStatistics();
   options.table_factory.reset(rocksdb::NewBlockBasedTableFactory(table_options));
   options.write_buffer_size = 64 << 20;           // 64 MB
   options.target_file_size_base = 64 << 20;       // 64 MB
@@ -1108,6 +1112,8 @@ DBStatus DBOpen(DBEngine **db, DBSlice dir, DBOptions db_opts) {
   *db = new DBEngine;
   (*db)->rep = db_ptr;
   (*db)->memenv = memenv;
+  (*db)->block_cache = table_options.block_cache;
+  (*db)->statistics = options.statistics;
   return kSuccess;
 }
 
@@ -1157,6 +1163,14 @@ uint64_t DBApproximateSize(DBEngine* db, DBSlice start, DBSlice end) {
   return result;
 }
 
+DBCacheStats DBGetCacheStats(DBEngine* db) {
+  DBCacheStats stats;
+  stats.capacity = db->block_cache->GetCapacity();
+  stats.hits = db->statistics->getTickerCount(rocksdb::BLOCK_CACHE_HIT);
+  stats.misses = db->statistics->getTickerCount(rocksdb::BLOCK_CACHE_MISS);
+  return stats;
+}
+
 DBStatus DBPut(DBEngine* db, DBSlice key, DBSlice value) {
   rocksdb::WriteOptions options;
   return ToDBStatus(db->rep->Put(options, ToSlice(key), ToSlice(value)));
@@ -1232,6 +1246,21 @@ void DBIterSeekToLast(DBIterator* iter) {
   iter->rep->SeekToLast();
 }
 
+void DBIterSeekReverse(DBIterator* iter, DBSlice key) {
+  rocksdb::Iterator* const rep = iter->rep;
+  if (key.len > 0) {
+    const rocksdb::Slice target = ToSlice(key);
+    rep->Seek(target);
+    if (rep->Valid()) {
+      if (rep->key() != target) {
+        rep->Prev();
+      }
+      return;
+    }
+  }
+  rep->SeekToLast();
+}
+
 int DBIterValid(DBIterator* iter) {
   return iter->rep->Valid();
 }
@@ -1240,6 +1269,10 @@ void DBIterNext(DBIterator* iter) {
   iter->rep->Next();
 }
 
+void DBIterPrev(DBIterator* iter) {
+  iter->rep->Prev();
+}
+
 DBSlice DBIterKey(DBIterator* iter) {
   return ToDBSlice(iter->rep->key());
 }
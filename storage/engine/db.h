@@ -84,6 +84,18 @@ DBStatus DBCompactRange(DBEngine* db, DBSlice* start, DBSlice* end);
 // range [start,end].
 uint64_t DBApproximateSize(DBEngine* db, DBSlice start, DBSlice end);
 
+// DBCacheStats contains the capacity of the block cache and the
+// number of block cache hits and misses since the database was
+// opened.
+typedef struct {
+  int64_t capacity;
+  int64_t hits;
+  int64_t misses;
+} DBCacheStats;
+
+// Returns the capacity and hit/miss counters of the block cache.
+DBCacheStats DBGetCacheStats(DBEngine* db);
+
 // Sets the database entry for "key" to "value".
 DBStatus DBPut(DBEngine* db, DBSlice key, DBSlice value);
 
@@ -128,6 +140,11 @@ void DBIterSeekToFirst(DBIterator* iter);
 // Positions the iterator at the last key in the database.
 void DBIterSeekToLast(DBIterator* iter);
 
+// Positions the iterator at the last key that is <= "key". If "key"
+// is empty, the iterator is positioned at the last key in the
+// database.
+void DBIterSeekReverse(DBIterator* iter, DBSlice key);
+
 // Returns 1 if the iterator is positioned at a valid key/value pair
 // and 0 otherwise.
 int  DBIterValid(DBIterator* iter);
@@ -137,6 +154,11 @@ int  DBIterValid(DBIterator* iter);
 // last key.
 void DBIterNext(DBIterator* iter);
 
+// Moves the iterator back to the previous key. After this call,
+// DBIterValid() returns 1 iff the iterator was not positioned at the
+// first key.
+void DBIterPrev(DBIterator* iter);
+
 // Returns the key at the current iterator position. Note that a slice
 // is returned and the memory does not have to be freed.
 DBSlice DBIterKey(DBIterator* iter);
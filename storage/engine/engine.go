@@ -37,6 +37,10 @@ type Iterator interface {
 	// Seek advances the iterator to the first key in the engine which
 	// is >= the provided key.
 	Seek(key []byte)
+	// SeekReverse moves the iterator to the last key in the engine
+	// which is <= the provided key. If the key is empty, the iterator
+	// is positioned at the last key in the engine.
+	SeekReverse(key []byte)
 	// Valid returns true if the iterator is currently valid. An
 	// iterator which hasn't been seeked or has gone past the end of the
 	// key range is invalid.
@@ -45,6 +49,11 @@ type Iterator interface {
 	// iteration. After this call, the Valid() will be true if the
 	// iterator was not positioned at the last key.
 	Next()
+	// Prev moves the iterator back to the previous key/value in the
+	// iteration. After this call, Valid() will be true if the iterator
+	// was not positioned at the first key. Iterators over a batch do
+	// not support reverse iteration and return an error from Error().
+	Prev()
 	// Key returns the current key as a byte slice.
 	Key() proto.EncodedKey
 	// Value returns the current value as a byte slice.
@@ -54,6 +63,37 @@ type Iterator interface {
 	ValueProto(msg gogoproto.Message) error
 	// Error returns the error, if any, which the iterator encountered.
 	Error() error
+	// EnableStats starts counting the MVCC entries the iterator is
+	// positioned at. Counting costs extra work on every step, so it's
+	// off unless requested.
+	EnableStats()
+	// Stats returns counters describing the MVCC entries the iterator
+	// has been positioned at since EnableStats was called.
+	Stats() IteratorStats
+}
+
+// IteratorStats breaks down the MVCC entries visited by an iterator. A
+// scan visiting many more tombstones and versions than keys is slow
+// because its range needs garbage collection, not because the range
+// holds a lot of live data. Entries whose keys aren't MVCC-encoded are
+// not counted.
+type IteratorStats struct {
+	// KeysSeen is the number of metadata and inline entries visited.
+	KeysSeen int64
+	// TombstonesSkipped is the number of deletion tombstones visited.
+	TombstonesSkipped int64
+	// VersionsSkipped is the number of versions visited after a more
+	// recent version of the same key.
+	VersionsSkipped int64
+}
+
+// BlockCacheStats describes the engine's block cache. Hits and Misses
+// are cumulative since the engine was opened; comparing them over
+// time indicates whether the cache is sized appropriately.
+type BlockCacheStats struct {
+	Capacity int64
+	Hits     int64
+	Misses   int64
 }
 
 // Engine is the interface that wraps the core operations of a
@@ -110,9 +150,16 @@ type Engine interface {
 	// ApproximateSize returns the approximate number of bytes the engine is
 	// using to store data for the given range of keys.
 	ApproximateSize(start, end proto.EncodedKey) (uint64, error)
+	// BlockCacheStats returns the capacity of the engine's block cache
+	// and the number of hits and misses it has seen.
+	BlockCacheStats() BlockCacheStats
 	// Flush causes the engine to write all in-memory data to disk
 	// immediately.
 	Flush() error
+	// CompactRange forces a compaction of the given key range so that
+	// deleted and overwritten data is physically reclaimed. A nil start
+	// or end key compacts from the first or through the last key.
+	CompactRange(start, end proto.EncodedKey) error
 	// NewIterator returns a new instance of an Iterator over this
 	// engine. The caller must invoke Iterator.Close() when finished with
 	// the iterator to free resources.
@@ -120,8 +167,12 @@ type Engine interface {
 	// NewSnapshot returns a new instance of a read-only snapshot
 	// engine. Snapshots are instantaneous and, as long as they're
 	// released relatively quickly, inexpensive. Snapshots are released
-	// by invoking Close(). Note that snapshots must not be used after the
-	// original engine has been stopped.
+	// by invoking Close(). Iterators created from a snapshot see a
+	// stable, point-in-time view of the data regardless of concurrent
+	// writes, flushes or compactions. Because an open snapshot pins the
+	// underlying files, long-lived snapshots should be avoided. Note
+	// that snapshots must not be used after the original engine has
+	// been stopped.
 	NewSnapshot() Engine
 	// NewBatch returns a new instance of a batched engine which wraps
 	// this engine. Batched engines accumulate all mutations and apply
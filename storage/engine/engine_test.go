@@ -564,6 +564,97 @@ func TestEngineDeleteRange(t *testing.T) {
 	}, t)
 }
 
+// TestEngineSeekReverse verifies that SeekReverse positions the
+// iterator at the greatest key <= the seek key, for both exact and
+// in-between seek keys.
+func TestEngineSeekReverse(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	runWithAllEngines(func(engine Engine, t *testing.T) {
+		for _, k := range []string{"a", "b", "bb", "d"} {
+			if err := engine.Put(proto.EncodedKey(k), []byte(k)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		iter := engine.NewIterator()
+		defer iter.Close()
+
+		testCases := []struct {
+			key    string
+			expKey string // empty if the iterator should be invalid
+		}{
+			{"", "d"},
+			{"0", ""},
+			{"a", "a"},
+			{"a0", "a"},
+			{"b", "b"},
+			{"ba", "b"},
+			{"bb", "bb"},
+			{"c", "bb"},
+			{"d", "d"},
+			{"z", "d"},
+		}
+		for i, test := range testCases {
+			iter.SeekReverse([]byte(test.key))
+			if test.expKey == "" {
+				if iter.Valid() {
+					t.Errorf("%d: expected invalid iterator; got key %q", i, iter.Key())
+				}
+				continue
+			}
+			if !iter.Valid() {
+				t.Errorf("%d: expected key %q; got invalid iterator", i, test.expKey)
+				continue
+			}
+			if !bytes.Equal(iter.Key(), []byte(test.expKey)) {
+				t.Errorf("%d: expected key %q; got %q", i, test.expKey, iter.Key())
+			}
+		}
+		if err := iter.Error(); err != nil {
+			t.Fatal(err)
+		}
+	}, t)
+}
+
+// TestEngineSeekReverseIterate verifies that after a reverse seek into
+// the middle of a populated key range the iterator can be stepped in
+// both directions from the seeked position.
+func TestEngineSeekReverseIterate(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	runWithAllEngines(func(engine Engine, t *testing.T) {
+		for i := 0; i < 100; i += 2 {
+			k := []byte(fmt.Sprintf("%03d", i))
+			if err := engine.Put(proto.EncodedKey(k), k); err != nil {
+				t.Fatal(err)
+			}
+		}
+		iter := engine.NewIterator()
+		defer iter.Close()
+
+		iter.SeekReverse([]byte("051"))
+		for i := 50; i >= 0; i -= 2 {
+			if !iter.Valid() {
+				t.Fatalf("expected key %03d; got invalid iterator", i)
+			}
+			if exp := fmt.Sprintf("%03d", i); string(iter.Key()) != exp {
+				t.Fatalf("expected key %s; got %q", exp, iter.Key())
+			}
+			iter.Prev()
+		}
+		if iter.Valid() {
+			t.Fatalf("expected invalid iterator; got key %q", iter.Key())
+		}
+
+		iter.SeekReverse([]byte("051"))
+		iter.Next()
+		if !iter.Valid() || string(iter.Key()) != "052" {
+			t.Fatalf("expected key 052 after next")
+		}
+		if err := iter.Error(); err != nil {
+			t.Fatal(err)
+		}
+	}, t)
+}
+
 func TestSnapshot(t *testing.T) {
 	defer leaktest.AfterTest(t)
 	runWithAllEngines(func(engine Engine, t *testing.T) {
@@ -615,6 +706,37 @@ func TestSnapshot(t *testing.T) {
 	}, t)
 }
 
+// TestSnapshotRelease verifies that closing a snapshot releases it
+// and that closing it again is harmless.
+func TestSnapshotRelease(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	engine := NewInMem(inMemAttrs, testCacheSize)
+	defer engine.Close()
+
+	key := proto.EncodedKey("a")
+	if err := engine.Put(key, []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	snap := engine.NewSnapshot()
+	if n := engine.NumSnapshots(); n != 1 {
+		t.Errorf("expected 1 open snapshot; got %d", n)
+	}
+	if err := engine.Put(key, []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	if val, err := snap.Get(key); err != nil || !bytes.Equal(val, []byte("1")) {
+		t.Errorf("expected snapshot to read original value; got %q, %v", val, err)
+	}
+	snap.Close()
+	if n := engine.NumSnapshots(); n != 0 {
+		t.Errorf("expected snapshot to be released; got %d open", n)
+	}
+	snap.Close()
+	if n := engine.NumSnapshots(); n != 0 {
+		t.Errorf("expected second close to be a noop; got %d open", n)
+	}
+}
+
 // TestSnapshotMethods verifies that snapshots allow only read-only
 // engine operations.
 func TestSnapshotMethods(t *testing.T) {
@@ -739,6 +861,60 @@ func TestSnapshotMethods(t *testing.T) {
 	}, t)
 }
 
+// TestSnapshotIteratorConcurrentWrites verifies that an iterator
+// created from a snapshot sees an unchanged view of the data while the
+// underlying engine is being written to and flushed mid-iteration.
+func TestSnapshotIteratorConcurrentWrites(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	runWithAllEngines(func(engine Engine, t *testing.T) {
+		var expKeys []proto.EncodedKey
+		for i := 0; i < 10; i++ {
+			key := proto.EncodedKey(fmt.Sprintf("key-%02d", i))
+			if err := engine.Put(key, []byte("orig")); err != nil {
+				t.Fatal(err)
+			}
+			expKeys = append(expKeys, key)
+		}
+		snap := engine.NewSnapshot()
+		defer snap.Close()
+
+		iter := snap.NewIterator()
+		defer iter.Close()
+		var i int
+		for iter.Seek(proto.EncodedKey(proto.KeyMin)); iter.Valid(); iter.Next() {
+			if i >= len(expKeys) {
+				t.Fatalf("unexpected key %q", iter.Key())
+			}
+			if !bytes.Equal(iter.Key(), expKeys[i]) || !bytes.Equal(iter.Value(), []byte("orig")) {
+				t.Errorf("%d: expected %q=orig; got %q=%q", i, expKeys[i], iter.Key(), iter.Value())
+			}
+			// Overwrite the current key, clear the next key, insert a
+			// new key just after it and flush to disk.
+			if err := engine.Put(iter.Key(), []byte("new")); err != nil {
+				t.Fatal(err)
+			}
+			if i+1 < len(expKeys) {
+				if err := engine.Clear(expKeys[i+1]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := engine.Put(append(append([]byte(nil), iter.Key()...), 'x'), []byte("new")); err != nil {
+				t.Fatal(err)
+			}
+			if err := engine.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			i++
+		}
+		if err := iter.Error(); err != nil {
+			t.Fatal(err)
+		}
+		if i != len(expKeys) {
+			t.Errorf("expected %d keys; got %d", len(expKeys), i)
+		}
+	}, t)
+}
+
 // TestSnapshotNewSnapshot panics.
 func TestSnapshotNewSnapshot(t *testing.T) {
 	defer leaktest.AfterTest(t)
@@ -797,6 +973,60 @@ func TestApproximateSize(t *testing.T) {
 	}, t)
 }
 
+// TestEngineCompactRange verifies that compacting a deleted key range
+// physically reclaims the space used by the deleted data.
+func TestEngineCompactRange(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	runWithAllEngines(func(engine Engine, t *testing.T) {
+		var (
+			count    = 10000
+			keys     = make([]proto.EncodedKey, count)
+			values   = make([][]byte, count) // Random values to prevent compression
+			rand, _  = util.NewPseudoRand()
+			valueLen = 100
+		)
+		for i := 0; i < count; i++ {
+			keys[i] = []byte(fmt.Sprintf("key%8d", i))
+			values[i] = util.RandBytes(rand, valueLen)
+		}
+		insertKeysAndValues(keys, values, engine, t)
+		if err := engine.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		start, end := keys[0], keys[count-1].Next()
+		sizeBefore, err := engine.ApproximateSize(start, end)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := ClearRange(engine, start, end); err != nil {
+			t.Fatal(err)
+		}
+		if err := engine.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if err := engine.CompactRange(start, end); err != nil {
+			t.Fatal(err)
+		}
+
+		verifyScan(start, end, int64(count), nil, engine, t)
+		sizeAfter, err := engine.ApproximateSize(start, end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sizeAfter >= sizeBefore/10 {
+			t.Errorf("expected compaction to reclaim space: size before %d, after %d", sizeBefore, sizeAfter)
+		}
+
+		// Batches can't be compacted.
+		batch := engine.NewBatch()
+		defer batch.Close()
+		if err := batch.CompactRange(start, end); err == nil {
+			t.Error("expected error compacting a batch")
+		}
+	}, t)
+}
+
 func insertKeys(keys []proto.EncodedKey, engine Engine, t *testing.T) {
 	insertKeysAndValues(keys, nil, engine, t)
 }
@@ -23,6 +23,7 @@ import (
 	"fmt"
 	"math"
 	"sync"
+	"time"
 
 	"github.com/cockroachdb/cockroach/keys"
 	"github.com/cockroachdb/cockroach/proto"
@@ -36,7 +37,7 @@ const (
 	// The size of the reservoir used by FindSplitKey.
 	splitReservoirSize = 100
 	// The size of the timestamp portion of MVCC version keys (used to update stats).
-	mvccVersionTimestampSize int64 = 12
+	mvccVersionTimestampSize int64 = keys.MVCCVersionTimestampSize
 )
 
 var (
@@ -341,6 +342,63 @@ func MVCCPutProto(engine Engine, ms *proto.MVCCStats, key proto.Key, timestamp p
 	return MVCCPut(engine, ms, key, timestamp, value, txn)
 }
 
+// mvccTombstoneValue is the encoded MVCCValue of a deletion tombstone.
+var mvccTombstoneValue = func() []byte {
+	data, err := gogoproto.Marshal(&proto.MVCCValue{Deleted: true})
+	if err != nil {
+		panic(err)
+	}
+	return data
+}()
+
+// A ReadAtTimestampBelowGCError indicates that a read was attempted
+// at a timestamp below the GC threshold of the data being read.
+// Versions older than the threshold may have been garbage collected,
+// so such a read could silently return incomplete results.
+type ReadAtTimestampBelowGCError struct {
+	Timestamp proto.Timestamp
+	Threshold proto.Timestamp
+}
+
+// Error formats error.
+func (e *ReadAtTimestampBelowGCError) Error() string {
+	return fmt.Sprintf("read at timestamp %s is below the GC threshold %s", e.Timestamp, e.Threshold)
+}
+
+// checkGCThreshold returns a ReadAtTimestampBelowGCError if timestamp
+// is below gcThreshold. A zero gcThreshold allows reads at any
+// timestamp.
+func checkGCThreshold(timestamp, gcThreshold proto.Timestamp) error {
+	if timestamp.Less(gcThreshold) {
+		return &ReadAtTimestampBelowGCError{Timestamp: timestamp, Threshold: gcThreshold}
+	}
+	return nil
+}
+
+// A ClockOffsetExceededError indicates that a write was attempted at
+// a timestamp further ahead of the local clock than the maximum clock
+// offset permits. Accepting such a write would leave a value in the
+// future which reads at current timestamps cannot see.
+type ClockOffsetExceededError struct {
+	Timestamp    proto.Timestamp
+	MaxTimestamp proto.Timestamp
+}
+
+// Error formats error.
+func (e *ClockOffsetExceededError) Error() string {
+	return fmt.Sprintf("write at timestamp %s exceeds local clock plus max offset %s", e.Timestamp, e.MaxTimestamp)
+}
+
+// CheckWriteTimestamp returns a ClockOffsetExceededError if the wall
+// time of timestamp is greater than the wall time of maxTimestamp. A
+// zero maxTimestamp allows writes at any timestamp.
+func CheckWriteTimestamp(timestamp, maxTimestamp proto.Timestamp) error {
+	if maxTimestamp.WallTime != 0 && timestamp.WallTime > maxTimestamp.WallTime {
+		return &ClockOffsetExceededError{Timestamp: timestamp, MaxTimestamp: maxTimestamp}
+	}
+	return nil
+}
+
 type getBuffer struct {
 	meta  proto.MVCCMetadata
 	value proto.MVCCValue
@@ -372,6 +430,9 @@ var getBufferPool = sync.Pool{
 // The consistent parameter indicates that intents should cause
 // WriteIntentErrors. If set to false, intents are ignored; keys with
 // an intent but no earlier committed versions, will be skipped.
+//
+// If the value carries a checksum, it's verified and a
+// proto.ValueChecksumError is returned on mismatch.
 func MVCCGet(engine Engine, key proto.Key, timestamp proto.Timestamp, consistent bool, txn *proto.Transaction) (*proto.Value, error) {
 	if len(key) == 0 {
 		return nil, emptyKeyError()
@@ -402,7 +463,18 @@ func MVCCGet(engine Engine, key proto.Key, timestamp proto.Timestamp, consistent
 		return nil, err
 	}
 
-	return mvccGetInternal(engine, key, metaKey, timestamp, consistent, txn, getValue, buf)
+	return mvccGetInternal(engine, key, metaKey, timestamp, consistent, txn, getValue, false, buf)
+}
+
+// MVCCGetWithGCThreshold is like MVCCGet, but returns a
+// ReadAtTimestampBelowGCError instead of a possibly incomplete result
+// if timestamp is below gcThreshold.
+func MVCCGetWithGCThreshold(engine Engine, key proto.Key, timestamp, gcThreshold proto.Timestamp, consistent bool,
+	txn *proto.Transaction) (*proto.Value, error) {
+	if err := checkGCThreshold(timestamp, gcThreshold); err != nil {
+		return nil, err
+	}
+	return MVCCGet(engine, key, timestamp, consistent, txn)
 }
 
 // getEarlierFunc fetches an earlier version of a key starting at
@@ -422,8 +494,11 @@ type getValueFunc func(engine Engine, start, end proto.EncodedKey,
 // instead. In the event that an inconsistent read does encounter
 // intents, the intent is returned via a WriteIntentError, in addition
 // to the result.
+//
+// If keysOnly is true, all versioned values are read through getValue,
+// which may skip decoding them; see iterGetKeyOnlyFunc.
 func mvccGetInternal(engine Engine, key proto.Key, metaKey proto.EncodedKey, timestamp proto.Timestamp,
-	consistent bool, txn *proto.Transaction, getValue getValueFunc, buf *getBuffer) (*proto.Value, error) {
+	consistent bool, txn *proto.Transaction, getValue getValueFunc, keysOnly bool, buf *getBuffer) (*proto.Value, error) {
 	if !consistent && txn != nil {
 		return nil, util.Errorf("cannot allow inconsistent reads within a transaction")
 	}
@@ -431,8 +506,12 @@ func mvccGetInternal(engine Engine, key proto.Key, metaKey proto.EncodedKey, tim
 	var err error
 	meta := &buf.meta
 
-	// If value is inline, return immediately; txn & timestamp are irrelevant.
+	// If value is inline, return immediately; txn is irrelevant and the
+	// timestamp matters only if the value expires.
 	if meta.IsInline() {
+		if meta.Expiration != nil && meta.Expiration.Less(timestamp) {
+			return nil, nil
+		}
 		if err := meta.Value.Verify(key); err != nil {
 			return nil, err
 		}
@@ -453,9 +532,11 @@ func mvccGetInternal(engine Engine, key proto.Key, metaKey proto.EncodedKey, tim
 
 	// First case: Our read timestamp is ahead of the latest write, or the
 	// latest write and current read are within the same transaction.
-	if !timestamp.Less(meta.Timestamp) ||
-		(meta.Txn != nil && txn != nil && bytes.Equal(meta.Txn.ID, txn.ID)) {
-		if meta.Txn != nil && (txn == nil || !bytes.Equal(meta.Txn.ID, txn.ID)) {
+	// A transaction always reads its own intent, regardless of
+	// timestamp, so that it observes its own provisional writes.
+	ownIntent := isOwnIntent(meta, txn)
+	if !timestamp.Less(meta.Timestamp) || ownIntent {
+		if meta.Txn != nil && !ownIntent {
 			// Trying to read the last value, but it's another transaction's
 			// intent; the reader will have to act on this.
 			return nil, &proto.WriteIntentError{Intents: []proto.WriteIntentError_Intent{{Key: key, Txn: *meta.Txn}}}
@@ -465,9 +546,16 @@ func mvccGetInternal(engine Engine, key proto.Key, metaKey proto.EncodedKey, tim
 		// Check for case where we're reading our own txn's intent
 		// but it's got a different epoch. This can happen if the
 		// txn was restarted and an earlier iteration wrote the value
-		// we're now reading. In this case, we skip the intent.
-		if meta.Txn != nil && txn.Epoch != meta.Txn.Epoch {
-			valueKey, err = getValue(engine, latestKey.Next(), MVCCEncodeKey(key.Next()), value)
+		// we're now reading. In this case, we skip the intent and read
+		// the latest committed version at or below the read timestamp.
+		if ownIntent && txn.Epoch != meta.Txn.Epoch {
+			start := latestKey.Next()
+			if histKey := MVCCEncodeVersionKey(key, timestamp); bytes.Compare(histKey, start) > 0 {
+				start = histKey
+			}
+			valueKey, err = getValue(engine, start, MVCCEncodeKey(key.Next()), value)
+		} else if keysOnly {
+			valueKey, err = getValue(engine, latestKey, latestKey.Next(), value)
 		} else {
 			var ok bool
 			ok, _, _, err = engine.GetProto(latestKey, value)
@@ -549,6 +637,13 @@ func mvccGetInternal(engine Engine, key proto.Key, metaKey proto.EncodedKey, tim
 	return value.Value, wiErr
 }
 
+// isOwnIntent returns whether meta describes a write intent written
+// by txn. Reads and writes within txn treat such an intent as the
+// txn's own provisional value.
+func isOwnIntent(meta *proto.MVCCMetadata, txn *proto.Transaction) bool {
+	return meta.Txn != nil && txn != nil && proto.TxnIDEqual(meta.Txn.ID, txn.ID)
+}
+
 // putBuffer holds pointer data needed by mvccPutInternal. Bundling
 // this data into a single structure reduces memory
 // allocations. Managing this temporary buffer using a sync.Pool
@@ -558,9 +653,23 @@ type putBuffer struct {
 	newMeta proto.MVCCMetadata
 	value   proto.MVCCValue
 	pvalue  proto.Value
+	txn     proto.Transaction
 	key     [1024]byte
 }
 
+// intentTxn returns the transaction to store with an intent written by
+// txn. The intent count and resolution status are only meaningful on
+// the transaction record, so they're cleared rather than stored with
+// every intent. buf avoids an allocation when txn must be copied.
+func intentTxn(txn, buf *proto.Transaction) *proto.Transaction {
+	if txn == nil || (txn.IntentCount == nil && txn.IntentsResolved == nil) {
+		return txn
+	}
+	*buf = *txn
+	buf.IntentCount, buf.IntentsResolved = nil, nil
+	return buf
+}
+
 var putBufferPool = sync.Pool{
 	New: func() interface{} {
 		return &putBuffer{}
@@ -600,6 +709,41 @@ func MVCCPut(engine Engine, ms *proto.MVCCStats, key proto.Key, timestamp proto.
 	return err
 }
 
+// MVCCPutExpiring sets an inline value for the specified key which
+// expires at the given timestamp. Reads at timestamps after expiration
+// treat the key as absent, and the GC queue eventually reclaims it.
+// Like other inline values, expiring values cannot be mixed with
+// timestamp-versioned values at the same key. A subsequent MVCCPut at
+// proto.ZeroTimestamp replaces the value and clears the expiration.
+func MVCCPutExpiring(engine Engine, ms *proto.MVCCStats, key proto.Key, value proto.Value,
+	expiration proto.Timestamp) error {
+	if len(key) == 0 {
+		return emptyKeyError()
+	}
+
+	buf := putBufferPool.Get().(*putBuffer)
+	meta := &buf.meta
+	metaKey := mvccEncodeKey(buf.key[0:0], key)
+	ok, origMetaKeySize, origMetaValSize, err := engine.GetProto(metaKey, meta)
+	if err == nil && ok && !meta.IsInline() {
+		err = util.Errorf("%q: put is inline=true, but existing value is inline=false", metaKey)
+	}
+	if err == nil {
+		buf.pvalue = value
+		meta.Reset()
+		meta.Value = &buf.pvalue
+		meta.Expiration = &expiration
+		var metaKeySize, metaValSize int64
+		metaKeySize, metaValSize, err = PutProto(engine, metaKey, meta)
+		updateStatsForInline(ms, key, origMetaKeySize, origMetaValSize, metaKeySize, metaValSize)
+	}
+
+	// Using defer would be more convenient, but it is measurably
+	// slower.
+	putBufferPool.Put(buf)
+	return err
+}
+
 // MVCCDelete marks the key deleted so that it will not be returned in
 // future get responses.
 func MVCCDelete(engine Engine, ms *proto.MVCCStats, key proto.Key, timestamp proto.Timestamp,
@@ -616,6 +760,154 @@ func MVCCDelete(engine Engine, ms *proto.MVCCStats, key proto.Key, timestamp pro
 	return err
 }
 
+// MVCCBatchOp is a single put or delete applied by MVCCApplyBatch. A
+// nil Value indicates a deletion.
+type MVCCBatchOp struct {
+	Key   proto.Key
+	Value *proto.Value
+}
+
+// MVCCApplyBatch applies the supplied puts and deletes at timestamp
+// against a single batch of the engine and commits it once. Either
+// all operations are applied or, if any operation fails, none are.
+// The combined stats delta of all operations is added to ms, which
+// may be nil, only if the batch commits successfully.
+func MVCCApplyBatch(engine Engine, ms *proto.MVCCStats, ops []MVCCBatchOp, timestamp proto.Timestamp,
+	txn *proto.Transaction) error {
+	batch := engine.NewBatch()
+	defer batch.Close()
+
+	var batchMS proto.MVCCStats
+	for _, op := range ops {
+		var err error
+		if op.Value == nil {
+			err = MVCCDelete(batch, &batchMS, op.Key, timestamp, txn)
+		} else {
+			err = MVCCPut(batch, &batchMS, op.Key, timestamp, *op.Value, txn)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		return err
+	}
+	if ms != nil {
+		ms.Add(&batchMS)
+	}
+	return nil
+}
+
+// MVCCApplyBatchRepr applies the entries of the serialized RocksDB
+// write batch repr to engine. The batch must consist of blind writes,
+// as built by RocksDBBatchBuilder.MVCCPut: for every key, a metadata
+// entry and a single version, both at timestamp. Every key must lie
+// in the span [start, end) and must have neither an intent nor a
+// version at or above timestamp. Otherwise an error is returned before
+// anything is applied. The stats delta is computed for each key from
+// its existing metadata and added to ms, which may be nil.
+func MVCCApplyBatchRepr(engine Engine, ms *proto.MVCCStats, repr []byte, start, end proto.Key,
+	timestamp proto.Timestamp) error {
+	type batchWrite struct {
+		key               proto.Key
+		metaKey, metaVal  []byte
+		versionKey, value []byte
+		meta              proto.MVCCMetadata
+	}
+	var writes []*batchWrite
+	writesByKey := map[string]*batchWrite{}
+	if err := IterateBatchRepr(repr, func(encKey proto.EncodedKey, value []byte) error {
+		key, ts, isValue, err := mvccDecodeKey(encKey)
+		if err != nil {
+			return err
+		}
+		if key.Less(start) || !key.Less(end) {
+			return util.Errorf("batch key %q is outside of span [%q, %q)", key, start, end)
+		}
+		if value == nil {
+			return util.Errorf("batch key %q is deleted; only puts may be applied", key)
+		}
+		w, ok := writesByKey[string(key)]
+		if !ok {
+			w = &batchWrite{key: key}
+			writesByKey[string(key)] = w
+			writes = append(writes, w)
+		}
+		if !isValue {
+			if w.metaKey != nil {
+				return util.Errorf("batch key %q has more than one metadata entry", key)
+			}
+			if err := gogoproto.Unmarshal(value, &w.meta); err != nil {
+				return err
+			}
+			if w.meta.Txn != nil || w.meta.IsInline() {
+				return util.Errorf("batch key %q must be written as a committed version", key)
+			}
+			if !w.meta.Timestamp.Equal(timestamp) {
+				return util.Errorf("batch key %q is written at %s instead of %s", key, w.meta.Timestamp, timestamp)
+			}
+			w.metaKey, w.metaVal = encKey, value
+			return nil
+		}
+		if w.versionKey != nil {
+			return util.Errorf("batch key %q has more than one version", key)
+		}
+		if !ts.Equal(timestamp) {
+			return util.Errorf("batch key %q is written at %s instead of %s", key, ts, timestamp)
+		}
+		w.versionKey, w.value = encKey, value
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	// Verify each key's entries against one another and against the
+	// existing metadata, and compute the stats delta as a put would.
+	var batchMS proto.MVCCStats
+	origMeta := &proto.MVCCMetadata{}
+	for _, w := range writes {
+		if w.metaKey == nil || w.versionKey == nil {
+			return util.Errorf("batch key %q must have both a metadata entry and a version", w.key)
+		}
+		if w.meta.KeyBytes != mvccVersionTimestampSize || w.meta.ValBytes != int64(len(w.value)) {
+			return util.Errorf("batch key %q has metadata inconsistent with its version", w.key)
+		}
+		ok, origMetaKeySize, origMetaValSize, err := engine.GetProto(w.metaKey, origMeta)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			updateStatsOnPut(&batchMS, w.key, 0, 0, int64(len(w.metaKey)), int64(len(w.metaVal)), nil, &w.meta, 0)
+			continue
+		}
+		if origMeta.Txn != nil {
+			return &proto.WriteIntentError{Intents: []proto.WriteIntentError_Intent{{Key: w.key, Txn: *origMeta.Txn}}}
+		}
+		if origMeta.IsInline() {
+			return util.Errorf("batch key %q has an existing inline value", w.key)
+		}
+		if !origMeta.Timestamp.Less(timestamp) {
+			return &proto.WriteTooOldError{Timestamp: timestamp, ExistingTimestamp: origMeta.Timestamp}
+		}
+		origAgeSeconds := timestamp.WallTime/1E9 - origMeta.Timestamp.WallTime/1E9
+		updateStatsOnPut(&batchMS, w.key, origMetaKeySize, origMetaValSize, int64(len(w.metaKey)), int64(len(w.metaVal)),
+			origMeta, &w.meta, origAgeSeconds)
+	}
+
+	for _, w := range writes {
+		if err := engine.Put(w.versionKey, w.value); err != nil {
+			return err
+		}
+		if err := engine.Put(w.metaKey, w.metaVal); err != nil {
+			return err
+		}
+	}
+	if ms != nil {
+		ms.Add(&batchMS)
+	}
+	return nil
+}
+
 // mvccPutInternal adds a new timestamped value to the specified key.
 // If value is nil, creates a deletion tombstone value.
 func mvccPutInternal(engine Engine, ms *proto.MVCCStats, key proto.Key, timestamp proto.Timestamp,
@@ -647,6 +939,9 @@ func mvccPutInternal(engine Engine, ms *proto.MVCCStats, key proto.Key, timestam
 			metaKeySize, metaValSize, err = 0, 0, engine.Clear(metaKey)
 		} else {
 			meta.Value = value.Value
+			// Plain inline puts don't expire; clear any expiration left
+			// by MVCCPutExpiring.
+			meta.Expiration = nil
 			metaKeySize, metaValSize, err = PutProto(engine, metaKey, meta)
 		}
 		updateStatsForInline(ms, key, origMetaKeySize, origMetaValSize, metaKeySize, metaValSize)
@@ -660,7 +955,7 @@ func mvccPutInternal(engine Engine, ms *proto.MVCCStats, key proto.Key, timestam
 		// operation does not come from the same transaction.
 		// This should not happen since range should check the existing
 		// write intent before executing any Put action at MVCC level.
-		if meta.Txn != nil && (txn == nil || !bytes.Equal(meta.Txn.ID, txn.ID)) {
+		if meta.Txn != nil && !isOwnIntent(meta, txn) {
 			return &proto.WriteIntentError{Intents: []proto.WriteIntentError_Intent{{Key: key, Txn: *meta.Txn}}}
 		}
 
@@ -682,7 +977,7 @@ func mvccPutInternal(engine Engine, ms *proto.MVCCStats, key proto.Key, timestam
 				}
 			}
 			newMeta = &buf.newMeta
-			buf.newMeta = proto.MVCCMetadata{Txn: txn, Timestamp: timestamp}
+			buf.newMeta = proto.MVCCMetadata{Txn: intentTxn(txn, &buf.txn), Timestamp: timestamp}
 		} else if timestamp.Less(meta.Timestamp) && meta.Txn == nil {
 			// If we receive a Put request to write before an already-
 			// committed version, send write tool old error.
@@ -699,7 +994,7 @@ func mvccPutInternal(engine Engine, ms *proto.MVCCStats, key proto.Key, timestam
 		// Create key metadata.
 		meta = nil
 		newMeta = &buf.newMeta
-		buf.newMeta = proto.MVCCMetadata{Txn: txn, Timestamp: timestamp}
+		buf.newMeta = proto.MVCCMetadata{Txn: intentTxn(txn, &buf.txn), Timestamp: timestamp}
 	}
 
 	// Make sure to zero the redundant timestamp (timestamp is encoded
@@ -727,6 +1022,13 @@ func mvccPutInternal(engine Engine, ms *proto.MVCCStats, key proto.Key, timestam
 	// Update MVCC stats.
 	updateStatsOnPut(ms, key, origMetaKeySize, origMetaValSize, metaKeySize, metaValSize, meta, newMeta, origAgeSeconds)
 
+	// A transactional write creates a new intent unless it replaces
+	// one the transaction already holds on this key. Count new intents
+	// once they have been written.
+	if txn != nil && (meta == nil || meta.Txn == nil) {
+		txn.SetIntentCount(txn.GetIntentCount() + 1)
+	}
+
 	return nil
 }
 
@@ -770,7 +1072,10 @@ func MVCCIncrement(engine Engine, ms *proto.MVCCStats, key proto.Key, timestamp
 
 // MVCCConditionalPut sets the value for a specified key only if the
 // expected value matches. If not, the return a ConditionFailedError
-// containing the actual value.
+// containing the actual value. A nil expValue expects the key to have
+// no visible value; a deletion tombstone counts as no value. A
+// non-nil expValue must exactly match the bytes or integer of the
+// existing value.
 func MVCCConditionalPut(engine Engine, ms *proto.MVCCStats, key proto.Key, timestamp proto.Timestamp, value proto.Value,
 	expValue *proto.Value, txn *proto.Transaction) error {
 	// Handle check for non-existence of key. In order to detect
@@ -829,25 +1134,74 @@ func MVCCMerge(engine Engine, ms *proto.MVCCStats, key proto.Key, value proto.Va
 }
 
 // MVCCDeleteRange deletes the range of key/value pairs specified by
-// start and end keys. Specify max=0 for unbounded deletes.
-func MVCCDeleteRange(engine Engine, ms *proto.MVCCStats, key, endKey proto.Key, max int64, timestamp proto.Timestamp, txn *proto.Transaction) (int64, error) {
+// start and end keys. Specify max=0 for unbounded deletes. Returns the
+// number of keys deleted and, if the deletion stopped because max
+// keys were deleted, a resume key which is the first key not deleted.
+// Callers can paginate a large deletion by invoking MVCCDeleteRange
+// again starting at the resume key until it is nil.
+//
+// If returnKeys is true, the keys which were deleted are returned as
+// well. As the keys are held in memory, callers requesting them
+// should bound the deletion using max.
+func MVCCDeleteRange(engine Engine, ms *proto.MVCCStats, key, endKey proto.Key, max int64, timestamp proto.Timestamp,
+	txn *proto.Transaction, returnKeys bool) (int64, proto.Key, []proto.Key, error) {
+	// Scan one key beyond max to determine the resume key.
+	scanMax := max
+	if max > 0 {
+		scanMax = max + 1
+	}
 	// In order to detect the potential write intent by another
 	// concurrent transaction with a newer timestamp, we need
-	// to use the max timestamp for scan.
-	kvs, err := MVCCScan(engine, key, endKey, max, proto.MaxTimestamp, true, txn)
+	// to use the max timestamp for scan. The scan gathers intents
+	// up to the look-ahead key; those are checked once it's known
+	// which keys are actually deleted.
+	var kvs []proto.KeyValue
+	err := MVCCIterate(engine, key, endKey, proto.MaxTimestamp, true, txn, func(kv proto.KeyValue) (bool, error) {
+		kvs = append(kvs, kv)
+		return scanMax != 0 && scanMax == int64(len(kvs)), nil
+	})
+	var resumeKey proto.Key
+	if max > 0 && int64(len(kvs)) > max {
+		resumeKey = kvs[max].Key
+		kvs = kvs[:max]
+		// Intents past the last deleted key don't affect this call. The
+		// resume key is moved back to the first of them, so that the
+		// next call encounters them.
+		if wiErr, ok := err.(*proto.WriteIntentError); ok {
+			lastKey := kvs[max-1].Key
+			intents := wiErr.Intents[:0]
+			for _, intent := range wiErr.Intents {
+				if !lastKey.Less(intent.Key) {
+					intents = append(intents, intent)
+				} else if intent.Key.Less(resumeKey) {
+					resumeKey = intent.Key
+				}
+			}
+			if wiErr.Intents = intents; len(intents) == 0 {
+				err = nil
+			}
+		}
+	}
 	if err != nil {
-		return 0, err
+		return 0, nil, nil, err
 	}
 
+	var deleted []proto.Key
+	if returnKeys {
+		deleted = make([]proto.Key, 0, len(kvs))
+	}
 	num := int64(0)
 	for _, kv := range kvs {
 		err = MVCCDelete(engine, ms, kv.Key, timestamp, txn)
 		if err != nil {
-			return num, err
+			return num, nil, deleted, err
+		}
+		if returnKeys {
+			deleted = append(deleted, kv.Key)
 		}
 		num++
 	}
-	return num, nil
+	return num, resumeKey, deleted, nil
 }
 
 // MVCCScan scans the key range specified by start key through end key
@@ -855,8 +1209,131 @@ func MVCCDeleteRange(engine Engine, ms *proto.MVCCStats, key, endKey proto.Key,
 // scans.
 func MVCCScan(engine Engine, key, endKey proto.Key, max int64, timestamp proto.Timestamp,
 	consistent bool, txn *proto.Transaction) ([]proto.KeyValue, error) {
+	return mvccScanInternal(engine, key, endKey, max, timestamp, consistent, txn, MVCCIterate)
+}
+
+// MVCCScanKeysOnly is like a consistent MVCCScan, but returns only
+// the keys of the visible values. Visibility and write intent handling
+// are identical to MVCCScan, but versioned values are never decoded,
+// making this cheaper for callers such as counts and existence checks
+// which don't need the values.
+func MVCCScanKeysOnly(engine Engine, key, endKey proto.Key, max int64, timestamp proto.Timestamp,
+	txn *proto.Transaction) ([]proto.Key, error) {
+	res := []proto.Key{}
+	if err := mvccIterate(engine, key, endKey, timestamp, true, txn, true, func(kv proto.KeyValue) (bool, error) {
+		res = append(res, kv.Key)
+		if max != 0 && max == int64(len(res)) {
+			return true, nil
+		}
+		return false, nil
+	}); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// MVCCReverseScan scans the key range specified by start key through
+// end key in descending key order, up to some maximum number of
+// results. Specify max=0 for unbounded scans.
+func MVCCReverseScan(engine Engine, key, endKey proto.Key, max int64, timestamp proto.Timestamp,
+	consistent bool, txn *proto.Transaction) ([]proto.KeyValue, error) {
+	return mvccScanInternal(engine, key, endKey, max, timestamp, consistent, txn, MVCCReverseIterate)
+}
+
+// MVCCScanWithGCThreshold is like MVCCScan, but returns a
+// ReadAtTimestampBelowGCError instead of possibly incomplete results
+// if timestamp is below gcThreshold.
+func MVCCScanWithGCThreshold(engine Engine, key, endKey proto.Key, max int64, timestamp, gcThreshold proto.Timestamp,
+	consistent bool, txn *proto.Transaction) ([]proto.KeyValue, error) {
+	if err := checkGCThreshold(timestamp, gcThreshold); err != nil {
+		return nil, err
+	}
+	return MVCCScan(engine, key, endKey, max, timestamp, consistent, txn)
+}
+
+// MVCCReverseScanWithGCThreshold is like MVCCReverseScan, but returns
+// a ReadAtTimestampBelowGCError instead of possibly incomplete
+// results if timestamp is below gcThreshold.
+func MVCCReverseScanWithGCThreshold(engine Engine, key, endKey proto.Key, max int64, timestamp, gcThreshold proto.Timestamp,
+	consistent bool, txn *proto.Transaction) ([]proto.KeyValue, error) {
+	if err := checkGCThreshold(timestamp, gcThreshold); err != nil {
+		return nil, err
+	}
+	return MVCCReverseScan(engine, key, endKey, max, timestamp, consistent, txn)
+}
+
+// MVCCScanWithStaleness is like MVCCScan, but performs a
+// non-transactional, bounded-staleness read: instead of reading at now
+// and encountering any pending intents, it reads at the most recent
+// timestamp no older than now-maxStaleness which lies below every
+// intent in the span. The chosen read timestamp is returned along with
+// the results. If an intent blocks even the stalest allowed timestamp,
+// a WriteIntentError for the blocking intents is returned.
+func MVCCScanWithStaleness(engine Engine, key, endKey proto.Key, max int64, now proto.Timestamp,
+	maxStaleness time.Duration) ([]proto.KeyValue, proto.Timestamp, error) {
+	if len(endKey) == 0 {
+		return nil, proto.Timestamp{}, emptyKeyError()
+	}
+	stalest := now.Add(-maxStaleness.Nanoseconds(), 0)
+	if stalest.WallTime < 0 {
+		stalest = proto.Timestamp{}
+	}
+
+	// Find the earliest intent in the span and those intents which
+	// block reads at the stalest allowed timestamp.
+	readTS := now
+	var wiErr *proto.WriteIntentError
+	encEndKey := MVCCEncodeKey(endKey)
+	iter := engine.NewIterator()
+	defer iter.Close()
+	for iter.Seek(MVCCEncodeKey(key)); iter.Valid(); {
+		if bytes.Compare(iter.Key(), encEndKey) >= 0 {
+			break
+		}
+		metaKey, _, isValue := MVCCDecodeKey(iter.Key())
+		if isValue {
+			iter.Next()
+			continue
+		}
+		var meta proto.MVCCMetadata
+		if err := iter.ValueProto(&meta); err != nil {
+			return nil, proto.Timestamp{}, err
+		}
+		if meta.Txn != nil && !meta.IsInline() {
+			if !stalest.Less(meta.Timestamp) {
+				if wiErr == nil {
+					wiErr = &proto.WriteIntentError{}
+				}
+				wiErr.Intents = append(wiErr.Intents, proto.WriteIntentError_Intent{Key: metaKey, Txn: *meta.Txn})
+			} else if !readTS.Less(meta.Timestamp) {
+				readTS = meta.Timestamp.Prev()
+			}
+		}
+		iter.Seek(MVCCEncodeKey(metaKey.Next()))
+	}
+	if err := iter.Error(); err != nil {
+		return nil, proto.Timestamp{}, err
+	}
+	if wiErr != nil {
+		return nil, proto.Timestamp{}, wiErr
+	}
+
+	kvs, err := MVCCScan(engine, key, endKey, max, readTS, true, nil)
+	if err != nil {
+		return nil, proto.Timestamp{}, err
+	}
+	return kvs, readTS, nil
+}
+
+// mvccIterateFunc is the signature shared by MVCCIterate and
+// MVCCReverseIterate.
+type mvccIterateFunc func(engine Engine, startKey, endKey proto.Key, timestamp proto.Timestamp,
+	consistent bool, txn *proto.Transaction, f func(proto.KeyValue) (bool, error)) error
+
+func mvccScanInternal(engine Engine, key, endKey proto.Key, max int64, timestamp proto.Timestamp,
+	consistent bool, txn *proto.Transaction, iterate mvccIterateFunc) ([]proto.KeyValue, error) {
 	res := []proto.KeyValue{}
-	if err := MVCCIterate(engine, key, endKey, timestamp, consistent, txn, func(kv proto.KeyValue) (bool, error) {
+	if err := iterate(engine, key, endKey, timestamp, consistent, txn, func(kv proto.KeyValue) (bool, error) {
 		res = append(res, kv)
 		if max != 0 && max == int64(len(res)) {
 			return true, nil
@@ -879,6 +1356,14 @@ func MVCCScan(engine Engine, key, endKey proto.Key, max int64, timestamp proto.T
 // iteration stops and the error is propagated.
 func MVCCIterate(engine Engine, startKey, endKey proto.Key, timestamp proto.Timestamp,
 	consistent bool, txn *proto.Transaction, f func(proto.KeyValue) (bool, error)) error {
+	return mvccIterate(engine, startKey, endKey, timestamp, consistent, txn, false, f)
+}
+
+// mvccIterate implements MVCCIterate. If keysOnly is true, versioned
+// values are not decoded and f is passed an empty placeholder value
+// for each visible key.
+func mvccIterate(engine Engine, startKey, endKey proto.Key, timestamp proto.Timestamp,
+	consistent bool, txn *proto.Transaction, keysOnly bool, f func(proto.KeyValue) (bool, error)) error {
 	if !consistent && txn != nil {
 		return util.Errorf("cannot allow inconsistent reads within a transaction")
 	}
@@ -898,17 +1383,9 @@ func MVCCIterate(engine Engine, startKey, endKey proto.Key, timestamp proto.Time
 	// Get a new iterator and define our getEarlierFunc using iter.Seek.
 	iter := engine.NewIterator()
 	defer iter.Close()
-	getValue := func(engine Engine, start, end proto.EncodedKey,
-		msg gogoproto.Message) (proto.EncodedKey, error) {
-		iter.Seek(start)
-		if !iter.Valid() {
-			return nil, iter.Error()
-		}
-		key := iter.Key()
-		if bytes.Compare(key, end) >= 0 {
-			return nil, iter.Error()
-		}
-		return key, iter.ValueProto(msg)
+	getValue := iterGetValueFunc(iter)
+	if keysOnly {
+		getValue = iterGetKeyOnlyFunc(iter)
 	}
 
 	// A cumulative write intent error to gather all write intents.
@@ -933,34 +1410,393 @@ func MVCCIterate(engine Engine, startKey, endKey proto.Key, timestamp proto.Time
 		if isValue {
 			return util.Errorf("expected an MVCC metadata key: %q", metaKey)
 		}
-		if err := iter.ValueProto(&buf.meta); err != nil {
+		done, err := mvccIterateKey(engine, iter, key, metaKey, timestamp, consistent, txn, getValue, keysOnly, buf, &wiErr, f)
+		if done || err != nil {
+			if err != nil {
+				return err
+			}
+			return wiErr
+		}
+		encKey = mvccEncodeKey(keyBuf, key.Next())
+	}
+}
+
+// MVCCReverseIterate iterates over the key range specified by start
+// and end keys in descending key order, starting with the last key
+// before endKey. At each step of the iteration, f() is invoked with
+// the current key/value pair. If f returns true (done) or an error,
+// the iteration stops and the error is propagated. Visibility and
+// write intent handling are identical to MVCCIterate.
+func MVCCReverseIterate(engine Engine, startKey, endKey proto.Key, timestamp proto.Timestamp,
+	consistent bool, txn *proto.Transaction, f func(proto.KeyValue) (bool, error)) error {
+	if !consistent && txn != nil {
+		return util.Errorf("cannot allow inconsistent reads within a transaction")
+	}
+	if len(endKey) == 0 {
+		return emptyKeyError()
+	}
+
+	buf := getBufferPool.Get().(*getBuffer)
+	defer getBufferPool.Put(buf)
+
+	iter := engine.NewIterator()
+	defer iter.Close()
+	getValue := iterGetValueFunc(iter)
+
+	// A cumulative write intent error to gather all write intents.
+	var wiErr error
+
+	metaKey := mvccEncodeKey(buf.key[0:0], endKey)
+	for {
+		// Position the iterator at the entry immediately preceding the
+		// previous metadata key. That entry is the oldest version (or
+		// the metadata) of the next key to visit.
+		iter.SeekReverse(metaKey)
+		if iter.Valid() && bytes.Equal(iter.Key(), metaKey) {
+			iter.Prev()
+		}
+		if err := iter.Error(); err != nil {
 			return err
 		}
-		value, err := mvccGetInternal(engine, key, metaKey, timestamp, consistent, txn, getValue, buf)
-		if err != nil {
-			switch t := err.(type) {
-			case *proto.WriteIntentError:
-				// In the case of WriteIntentErrors, accumulate affected keys but continue scan.
-				if wiErr == nil {
-					wiErr = t
-				} else {
-					wiErr.(*proto.WriteIntentError).Intents = append(wiErr.(*proto.WriteIntentError).Intents, t.Intents...)
-				}
-			default:
+		if !iter.Valid() {
+			return wiErr
+		}
+		key, _, _ := MVCCDecodeKey(iter.Key())
+		if key.Less(startKey) {
+			return wiErr
+		}
+		// Seek forward to the key's metadata.
+		metaKey = mvccEncodeKey(buf.key[0:0], key)
+		iter.Seek(metaKey)
+		if !iter.Valid() || !bytes.Equal(iter.Key(), metaKey) {
+			if err := iter.Error(); err != nil {
+				return err
+			}
+			return util.Errorf("expected an MVCC metadata key: %q", metaKey)
+		}
+		done, err := mvccIterateKey(engine, iter, key, metaKey, timestamp, consistent, txn, getValue, false, buf, &wiErr, f)
+		if done || err != nil {
+			if err != nil {
 				return err
 			}
+			return wiErr
+		}
+	}
+}
+
+// iterGetValueFunc returns a getValueFunc which uses iter.Seek to
+// locate the first value in [start, end).
+func iterGetValueFunc(iter Iterator) getValueFunc {
+	return func(engine Engine, start, end proto.EncodedKey,
+		msg gogoproto.Message) (proto.EncodedKey, error) {
+		iter.Seek(start)
+		if !iter.Valid() {
+			return nil, iter.Error()
+		}
+		key := iter.Key()
+		if bytes.Compare(key, end) >= 0 {
+			return nil, iter.Error()
+		}
+		return key, iter.ValueProto(msg)
+	}
+}
+
+// iterGetKeyOnlyFunc is like iterGetValueFunc, but doesn't decode the
+// value found. Instead, msg, which must be a *proto.MVCCValue, is set
+// to a deletion tombstone or to an empty placeholder value by
+// comparing the encoded value to that of a tombstone.
+func iterGetKeyOnlyFunc(iter Iterator) getValueFunc {
+	return func(engine Engine, start, end proto.EncodedKey,
+		msg gogoproto.Message) (proto.EncodedKey, error) {
+		iter.Seek(start)
+		if !iter.Valid() {
+			return nil, iter.Error()
+		}
+		key := iter.Key()
+		if bytes.Compare(key, end) >= 0 {
+			return nil, iter.Error()
+		}
+		value := msg.(*proto.MVCCValue)
+		if bytes.Equal(iter.Value(), mvccTombstoneValue) {
+			*value = proto.MVCCValue{Deleted: true}
+		} else {
+			*value = proto.MVCCValue{Value: &proto.Value{}}
 		}
-		if value != nil {
-			done, err := f(proto.KeyValue{Key: key, Value: *value})
-			if done || err != nil {
-				if err != nil {
+		return key, nil
+	}
+}
+
+// mvccIterateKey reads the value visible at timestamp for the key
+// whose metadata the iterator is positioned at and, if there is one,
+// passes it to f. Write intents are accumulated in wiErr and do not
+// stop the iteration.
+func mvccIterateKey(engine Engine, iter Iterator, key proto.Key, metaKey proto.EncodedKey,
+	timestamp proto.Timestamp, consistent bool, txn *proto.Transaction, getValue getValueFunc,
+	keysOnly bool, buf *getBuffer, wiErr *error, f func(proto.KeyValue) (bool, error)) (bool, error) {
+	if err := iter.ValueProto(&buf.meta); err != nil {
+		return false, err
+	}
+	value, err := mvccGetInternal(engine, key, metaKey, timestamp, consistent, txn, getValue, keysOnly, buf)
+	if err != nil {
+		switch t := err.(type) {
+		case *proto.WriteIntentError:
+			// In the case of WriteIntentErrors, accumulate affected keys but continue scan.
+			if *wiErr == nil {
+				*wiErr = t
+			} else {
+				(*wiErr).(*proto.WriteIntentError).Intents = append((*wiErr).(*proto.WriteIntentError).Intents, t.Intents...)
+			}
+		default:
+			return false, err
+		}
+	}
+	if value != nil {
+		return f(proto.KeyValue{Key: key, Value: *value})
+	}
+	return false, nil
+}
+
+// MVCCIncrementalIterate iterates over the key range specified by
+// start and end keys and invokes f() with every version written in the
+// time window (startTime, endTime], in key order and, for each key,
+// from newest to oldest version. This is intended for incremental
+// backups, which need all changes since a previous backup. Deletion
+// tombstones in the window are surfaced with deleted set to true and
+// an empty value. The value's timestamp is always set to the version's
+// timestamp. Inline (unversioned) values are skipped.
+//
+// Intents in the window are not passed to f. Instead, they're returned
+// via a WriteIntentError once iteration completes so the caller can
+// resolve them and retry. If f returns true (done) or an error, the
+// iteration stops and the error is propagated.
+//
+// TODO(pmattis): the whole span is scanned. Skipping sstables which
+// lie entirely outside the time window needs a table filter on the
+// read options, which the vendored RocksDB doesn't provide yet. Once
+// it does, record each sstable's min and max MVCC timestamps as table
+// properties and filter on those.
+func MVCCIncrementalIterate(engine Engine, startKey, endKey proto.Key, startTime, endTime proto.Timestamp,
+	f func(kv proto.KeyValue, deleted bool) (bool, error)) error {
+	if len(endKey) == 0 {
+		return emptyKeyError()
+	}
+	if endTime.Less(startTime) {
+		return util.Errorf("end time %s must not precede start time %s", endTime, startTime)
+	}
+	encEndKey := MVCCEncodeKey(endKey)
+	iter := engine.NewIterator()
+	defer iter.Close()
+
+	var meta proto.MVCCMetadata
+	var wiErr *proto.WriteIntentError
+	for iter.Seek(MVCCEncodeKey(startKey)); iter.Valid(); {
+		if bytes.Compare(iter.Key(), encEndKey) >= 0 {
+			break
+		}
+		key, ts, isValue := MVCCDecodeKey(iter.Key())
+		if !isValue {
+			meta = proto.MVCCMetadata{}
+			if err := iter.ValueProto(&meta); err != nil {
+				return err
+			}
+			iter.Next()
+			continue
+		}
+		if !startTime.Less(ts) {
+			// Versions are sorted newest first, so the remaining versions
+			// of this key all precede the window.
+			iter.Seek(MVCCEncodeKey(key.Next()))
+			continue
+		}
+		if !endTime.Less(ts) {
+			if meta.Txn != nil && ts.Equal(meta.Timestamp) {
+				if wiErr == nil {
+					wiErr = &proto.WriteIntentError{}
+				}
+				wiErr.Intents = append(wiErr.Intents, proto.WriteIntentError_Intent{Key: key, Txn: *meta.Txn})
+			} else {
+				var value proto.MVCCValue
+				if err := iter.ValueProto(&value); err != nil {
+					return err
+				}
+				kv := proto.KeyValue{Key: key}
+				if value.Value != nil {
+					kv.Value = *value.Value
+				}
+				kv.Value.Timestamp = &ts
+				if done, err := f(kv, value.Deleted); done || err != nil {
 					return err
 				}
-				return wiErr
 			}
 		}
-		encKey = mvccEncodeKey(keyBuf, key.Next())
+		iter.Next()
+	}
+	if err := iter.Error(); err != nil {
+		return err
 	}
+	if wiErr != nil {
+		return wiErr
+	}
+	return nil
+}
+
+// MVCCIncrementalIterateWithGCThreshold is like MVCCIncrementalIterate,
+// but returns a ReadAtTimestampBelowGCError instead of possibly
+// incomplete results if startTime is below gcThreshold, in which case
+// versions in the time window may have been garbage collected.
+func MVCCIncrementalIterateWithGCThreshold(engine Engine, startKey, endKey proto.Key,
+	startTime, endTime, gcThreshold proto.Timestamp, f func(kv proto.KeyValue, deleted bool) (bool, error)) error {
+	if err := checkGCThreshold(startTime, gcThreshold); err != nil {
+		return err
+	}
+	return MVCCIncrementalIterate(engine, startKey, endKey, startTime, endTime, f)
+}
+
+// MVCCVersion is a single version of a key returned by
+// MVCCScanVersions. The value's timestamp is set to the version's
+// timestamp. Deletion tombstones have Deleted set and an empty value.
+type MVCCVersion struct {
+	Value   proto.Value
+	Deleted bool
+}
+
+// MVCCKeyVersions holds the versions of a key returned by
+// MVCCScanVersions.
+type MVCCKeyVersions struct {
+	Key proto.Key
+	// Versions holds the committed versions, newest first.
+	Versions []MVCCVersion
+	// Intent holds the provisional value of a write intent, if any,
+	// written by Txn. It is not included in Versions.
+	Intent *MVCCVersion
+	Txn    *proto.Transaction
+}
+
+// MVCCScanVersions scans the key range specified by start key through
+// end key and returns, for each key, up to maxVersionsPerKey of its
+// most recent versions at or below timestamp and newer than floor.
+// Specify maxVersionsPerKey=0 to return all such versions and a zero
+// floor to not bound versions by age. Up to max keys are returned;
+// specify max=0 for unbounded scans. Keys without versions in the time
+// window are omitted, as are inline (unversioned) values.
+//
+// A write intent at or below timestamp is not treated as a conflict.
+// Its provisional value is returned separately from the committed
+// versions below it, along with the intent's transaction, so the
+// caller can decide how to treat it.
+func MVCCScanVersions(engine Engine, startKey, endKey proto.Key, max int64, timestamp, floor proto.Timestamp,
+	maxVersionsPerKey int) ([]MVCCKeyVersions, error) {
+	if len(endKey) == 0 {
+		return nil, emptyKeyError()
+	}
+	encEndKey := MVCCEncodeKey(endKey)
+	iter := engine.NewIterator()
+	defer iter.Close()
+
+	var res []MVCCKeyVersions
+	var meta proto.MVCCMetadata
+	var cur *MVCCKeyVersions
+	for iter.Seek(MVCCEncodeKey(startKey)); iter.Valid(); {
+		if bytes.Compare(iter.Key(), encEndKey) >= 0 {
+			break
+		}
+		key, ts, isValue := MVCCDecodeKey(iter.Key())
+		if !isValue {
+			if cur != nil && (len(cur.Versions) > 0 || cur.Intent != nil) {
+				res = append(res, *cur)
+			}
+			cur = nil
+			if max != 0 && int64(len(res)) == max {
+				break
+			}
+			meta = proto.MVCCMetadata{}
+			if err := iter.ValueProto(&meta); err != nil {
+				return nil, err
+			}
+			cur = &MVCCKeyVersions{Key: key}
+			iter.Next()
+			continue
+		}
+		if cur == nil {
+			return nil, util.Errorf("expected an MVCC metadata key: %q", iter.Key())
+		}
+		if timestamp.Less(ts) {
+			iter.Next()
+			continue
+		}
+		if !floor.Less(ts) ||
+			(maxVersionsPerKey != 0 && len(cur.Versions) == maxVersionsPerKey) {
+			// Versions are sorted newest first, so none of the remaining
+			// versions of this key are wanted.
+			iter.Seek(MVCCEncodeKey(key.Next()))
+			continue
+		}
+		var value proto.MVCCValue
+		if err := iter.ValueProto(&value); err != nil {
+			return nil, err
+		}
+		version := MVCCVersion{Deleted: value.Deleted}
+		if value.Value != nil {
+			version.Value = *value.Value
+		}
+		version.Value.Timestamp = &ts
+		if meta.Txn != nil && ts.Equal(meta.Timestamp) {
+			cur.Intent = &version
+			cur.Txn = meta.Txn
+		} else {
+			cur.Versions = append(cur.Versions, version)
+		}
+		iter.Next()
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	if cur != nil && (len(cur.Versions) > 0 || cur.Intent != nil) {
+		res = append(res, *cur)
+	}
+	return res, nil
+}
+
+// MVCCResolveAction describes the effect of resolving a write intent.
+type MVCCResolveAction int
+
+const (
+	// MVCCResolveNoop indicates there was no intent to resolve, the
+	// intent belongs to another txn, or it can't yet be resolved.
+	MVCCResolveNoop MVCCResolveAction = iota
+	// MVCCResolveCommit indicates the intent is committed.
+	MVCCResolveCommit
+	// MVCCResolvePush indicates the intent's timestamp is moved forward
+	// and the intent is kept.
+	MVCCResolvePush
+	// MVCCResolveAbort indicates the intent is removed, restoring the
+	// previous version, if any.
+	MVCCResolveAbort
+)
+
+// String implements the fmt.Stringer interface.
+func (a MVCCResolveAction) String() string {
+	switch a {
+	case MVCCResolveNoop:
+		return "noop"
+	case MVCCResolveCommit:
+		return "commit"
+	case MVCCResolvePush:
+		return "push"
+	case MVCCResolveAbort:
+		return "abort"
+	}
+	return fmt.Sprintf("MVCCResolveAction(%d)", int(a))
+}
+
+// MVCCResolveResult describes the outcome of resolving a write intent.
+type MVCCResolveResult struct {
+	// Action is the action taken, or which would be taken on a dry run.
+	Action MVCCResolveAction
+	// Value is the latest version of the key after resolution; nil if
+	// there is none or it's a deletion tombstone. It's only populated
+	// on dry runs.
+	Value *proto.Value
 }
 
 // MVCCResolveWriteIntent either commits or aborts (rolls back) an
@@ -983,24 +1819,31 @@ func MVCCIterate(engine Engine, startKey, endKey proto.Key, timestamp proto.Time
 // committed in the event the transaction succeeds (all those with
 // epoch matching the commit epoch), and which intents get aborted,
 // even if the transaction succeeds.
-func MVCCResolveWriteIntent(engine Engine, ms *proto.MVCCStats, key proto.Key, timestamp proto.Timestamp, txn *proto.Transaction) error {
+//
+// If dryRun is true, the intent is read exactly as it would be for a
+// real resolve, but nothing is written and ms is left untouched. The
+// returned result describes the action which would be taken and the
+// value which would result.
+func MVCCResolveWriteIntent(engine Engine, ms *proto.MVCCStats, key proto.Key, timestamp proto.Timestamp,
+	txn *proto.Transaction, dryRun bool) (MVCCResolveResult, error) {
+	var result MVCCResolveResult
 	if len(key) == 0 {
-		return emptyKeyError()
+		return result, emptyKeyError()
 	}
 	if txn == nil {
-		return util.Error("no txn specified")
+		return result, util.Error("no txn specified")
 	}
 
 	metaKey := MVCCEncodeKey(key)
 	meta := &proto.MVCCMetadata{}
 	ok, origMetaKeySize, origMetaValSize, err := engine.GetProto(metaKey, meta)
 	if err != nil {
-		return err
+		return result, err
 	}
 	// For cases where there's no write intent to resolve, or one exists
 	// which we can't resolve, this is a noop.
-	if !ok || meta.Txn == nil || !bytes.Equal(meta.Txn.ID, txn.ID) {
-		return nil
+	if !ok || !isOwnIntent(meta, txn) {
+		return result, nil
 	}
 	origAgeSeconds := timestamp.WallTime/1E9 - meta.Timestamp.WallTime/1E9
 
@@ -1017,13 +1860,23 @@ func MVCCResolveWriteIntent(engine Engine, ms *proto.MVCCStats, key proto.Key, t
 		newMeta := *meta
 		newMeta.Timestamp = txn.Timestamp
 		if pushed { // keep intent if we're pushing timestamp
-			newMeta.Txn = txn
+			newMeta.Txn = intentTxn(txn, &proto.Transaction{})
+			result.Action = MVCCResolvePush
 		} else {
 			newMeta.Txn = nil
+			result.Action = MVCCResolveCommit
+		}
+		if dryRun {
+			valBytes, err := engine.Get(MVCCEncodeVersionKey(key, origTimestamp))
+			if err != nil {
+				return result, err
+			}
+			result.Value, err = mvccResolvedValue(valBytes, txn.Timestamp)
+			return result, err
 		}
 		metaKeySize, metaValSize, err := PutProto(engine, metaKey, &newMeta)
 		if err != nil {
-			return err
+			return result, err
 		}
 
 		// Update stat counters related to resolving the intent.
@@ -1038,34 +1891,37 @@ func MVCCResolveWriteIntent(engine Engine, ms *proto.MVCCStats, key proto.Key, t
 			newKey := MVCCEncodeVersionKey(key, txn.Timestamp)
 			valBytes, err := engine.Get(origKey)
 			if err != nil {
-				return err
+				return result, err
 			}
 			if err = engine.Clear(origKey); err != nil {
-				return err
+				return result, err
 			}
 			if err = engine.Put(newKey, valBytes); err != nil {
-				return err
+				return result, err
 			}
 		}
-		return nil
+		return result, nil
 	}
 
 	// This method shouldn't be called in this instance, but there's
 	// nothing to do if meta's epoch is greater than or equal txn's
 	// epoch and the state is still PENDING.
 	if txn.Status == proto.PENDING && meta.Txn.Epoch >= txn.Epoch {
-		return nil
+		return result, nil
 	}
 
 	// Otherwise, we're deleting the intent. We must find the next
 	// versioned value and reset the metadata's latest timestamp. If
 	// there are no other versioned values, we delete the metadata
 	// key.
+	result.Action = MVCCResolveAbort
 
 	// First clear the intent value.
 	latestKey := MVCCEncodeVersionKey(key, meta.Timestamp)
-	if err := engine.Clear(latestKey); err != nil {
-		return err
+	if !dryRun {
+		if err := engine.Clear(latestKey); err != nil {
+			return result, err
+		}
 	}
 
 	// Compute the next possible mvcc value for this key.
@@ -1074,26 +1930,33 @@ func MVCCResolveWriteIntent(engine Engine, ms *proto.MVCCStats, key proto.Key, t
 	endScanKey := MVCCEncodeKey(key.Next())
 	kvs, err := Scan(engine, nextKey, endScanKey, 1)
 	if err != nil {
-		return err
+		return result, err
 	}
 	// If there is no other version, we should just clean up the key entirely.
 	if len(kvs) == 0 {
+		if dryRun {
+			return result, nil
+		}
 		if err = engine.Clear(metaKey); err != nil {
-			return err
+			return result, err
 		}
 		// Clear stat counters attributable to the intent we're aborting.
 		updateStatsOnAbort(ms, key, origMetaKeySize, origMetaValSize, 0, 0, meta, nil, origAgeSeconds, 0)
 	} else {
 		_, ts, isValue := MVCCDecodeKey(kvs[0].Key)
 		if !isValue {
-			return util.Errorf("expected an MVCC value key: %s", kvs[0].Key)
+			return result, util.Errorf("expected an MVCC value key: %s", kvs[0].Key)
+		}
+		if dryRun {
+			result.Value, err = mvccResolvedValue(kvs[0].Value, ts)
+			return result, err
 		}
 		// Get the bytes for the next version so we have size for stat counts.
 		value := proto.MVCCValue{}
 		var valueSize int64
 		ok, _, valueSize, err = engine.GetProto(kvs[0].Key, &value)
 		if err != nil || !ok {
-			return util.Errorf("unable to fetch previous version for key %q (%t): %s", kvs[0].Key, ok, err)
+			return result, util.Errorf("unable to fetch previous version for key %q (%t): %s", kvs[0].Key, ok, err)
 		}
 		// Update the keyMetadata with the next version.
 		newMeta := &proto.MVCCMetadata{
@@ -1104,7 +1967,7 @@ func MVCCResolveWriteIntent(engine Engine, ms *proto.MVCCStats, key proto.Key, t
 		}
 		metaKeySize, metaValSize, err := PutProto(engine, metaKey, newMeta)
 		if err != nil {
-			return err
+			return result, err
 		}
 		restoredAgeSeconds := timestamp.WallTime/1E9 - ts.WallTime/1E9
 
@@ -1112,16 +1975,35 @@ func MVCCResolveWriteIntent(engine Engine, ms *proto.MVCCStats, key proto.Key, t
 		updateStatsOnAbort(ms, key, origMetaKeySize, origMetaValSize, metaKeySize, metaValSize, meta, newMeta, origAgeSeconds, restoredAgeSeconds)
 	}
 
-	return nil
+	return result, nil
+}
+
+// mvccResolvedValue unmarshals the encoded MVCCValue which will be the
+// latest version at timestamp ts once an intent is resolved. Returns
+// nil for a deletion tombstone.
+func mvccResolvedValue(valBytes []byte, ts proto.Timestamp) (*proto.Value, error) {
+	value := proto.MVCCValue{}
+	if err := gogoproto.Unmarshal(valBytes, &value); err != nil {
+		return nil, util.Errorf("unable to unmarshal mvcc value: %s", err)
+	}
+	if value.Deleted || value.Value == nil {
+		return nil, nil
+	}
+	value.Value.Timestamp = &ts
+	return value.Value, nil
 }
 
 // MVCCResolveWriteIntentRange commits or aborts (rolls back) the
 // range of write intents specified by start and end keys for a given
 // txn. ResolveWriteIntentRange will skip write intents of other
-// txns. Specify max=0 for unbounded resolves.
-func MVCCResolveWriteIntentRange(engine Engine, ms *proto.MVCCStats, key, endKey proto.Key, max int64, timestamp proto.Timestamp, txn *proto.Transaction) (int64, error) {
+// txns. Each intent is resolved according to the txn's status as for
+// MVCCResolveWriteIntent. Specify max=0 for unbounded resolves.
+// Returns the number of keys processed and whether processing stopped
+// at max with further keys remaining in the range.
+func MVCCResolveWriteIntentRange(engine Engine, ms *proto.MVCCStats, key, endKey proto.Key, max int64,
+	timestamp proto.Timestamp, txn *proto.Transaction) (int64, bool, error) {
 	if txn == nil {
-		return 0, util.Error("no txn specified")
+		return 0, false, util.Error("no txn specified")
 	}
 
 	encKey := MVCCEncodeKey(key)
@@ -1132,33 +2014,32 @@ func MVCCResolveWriteIntentRange(engine Engine, ms *proto.MVCCStats, key, endKey
 	for {
 		kvs, err := Scan(engine, nextKey, encEndKey, 1)
 		if err != nil {
-			return num, err
+			return num, false, err
 		}
 		// No more keys exists in the given range.
 		if len(kvs) == 0 {
-			break
+			return num, false, nil
+		}
+		if max != 0 && max == num {
+			// There are keys remaining beyond max.
+			return num, true, nil
 		}
 
 		currentKey, _, isValue := MVCCDecodeKey(kvs[0].Key)
 		if isValue {
-			return 0, util.Errorf("expected an MVCC metadata key: %s", kvs[0].Key)
+			return 0, false, util.Errorf("expected an MVCC metadata key: %s", kvs[0].Key)
 		}
-		err = MVCCResolveWriteIntent(engine, ms, currentKey, timestamp, txn)
+		_, err = MVCCResolveWriteIntent(engine, ms, currentKey, timestamp, txn, false)
 		if err != nil {
 			log.Warningf("failed to resolve intent for key %q: %v", currentKey, err)
 		} else {
 			num++
-			if max != 0 && max == num {
-				break
-			}
 		}
 
 		// In order to efficiently skip the possibly long list of
 		// old versions for this key; refer to Scan for details.
 		nextKey = MVCCEncodeKey(currentKey.Next())
 	}
-
-	return num, nil
 }
 
 // MVCCGarbageCollect creates an iterator on the engine. In parallel
@@ -1180,6 +2061,18 @@ func MVCCGarbageCollect(engine Engine, ms *proto.MVCCStats, keys []proto.Interna
 		if err := gogoproto.Unmarshal(iter.Value(), meta); err != nil {
 			return util.Errorf("unable to marshal mvcc meta: %s", err)
 		}
+		// Inline values have no versions; they're collected only once
+		// they've expired. An unexpired value may have been rewritten
+		// since the key was queued for GC, so it's skipped silently.
+		if meta.IsInline() {
+			if meta.Expiration != nil && meta.Expiration.Less(gcKey.Timestamp) {
+				updateStatsForInline(ms, gcKey.Key, int64(len(iter.Key())), int64(len(iter.Value())), 0, 0)
+				if err := engine.Clear(iter.Key()); err != nil {
+					return err
+				}
+			}
+			continue
+		}
 		if !gcKey.Timestamp.Less(meta.Timestamp) {
 			if !meta.Deleted {
 				return util.Errorf("request to GC non-deleted, latest value of %q", gcKey.Key)
@@ -1215,6 +2108,73 @@ func MVCCGarbageCollect(engine Engine, ms *proto.MVCCStats, keys []proto.Interna
 	return nil
 }
 
+// MVCCGarbageCollectKeys garbage collects, for each of the supplied
+// keys, all versions which aren't needed to serve reads at or above
+// gcTimestamp. That is every version older than the most recent
+// version at or below gcTimestamp, and that version itself if it's a
+// deletion tombstone; if the tombstone is the key's latest version,
+// the key is removed entirely. Intents are never collected. nowNanos
+// is the time at which the GC'd bytes are aged. Returns the change to
+// the MVCC stats resulting from the bytes reclaimed.
+func MVCCGarbageCollectKeys(engine Engine, keys []proto.Key, gcTimestamp proto.Timestamp, nowNanos int64) (proto.MVCCStats, error) {
+	var ms proto.MVCCStats
+	var gcKeys []proto.InternalGCRequest_GCKey
+	for _, key := range keys {
+		ts, err := mvccGCTimestamp(engine, key, gcTimestamp)
+		if err != nil {
+			return ms, err
+		}
+		if !ts.Equal(proto.ZeroTimestamp) {
+			gcKeys = append(gcKeys, proto.InternalGCRequest_GCKey{Key: key, Timestamp: ts})
+		}
+	}
+	err := MVCCGarbageCollect(engine, &ms, gcKeys, proto.Timestamp{WallTime: nowNanos})
+	return ms, err
+}
+
+// mvccGCTimestamp returns the timestamp of the most recent version of
+// key which may be garbage collected, along with all older versions,
+// without affecting reads at or above gcTimestamp. Returns
+// proto.ZeroTimestamp if no versions may be collected.
+func mvccGCTimestamp(engine Engine, key proto.Key, gcTimestamp proto.Timestamp) (proto.Timestamp, error) {
+	gcTS := proto.ZeroTimestamp
+	meta := &proto.MVCCMetadata{}
+	first, found := true, false
+	err := engine.Iterate(MVCCEncodeKey(key), MVCCEncodeKey(key.Next()), func(kv proto.RawKeyValue) (bool, error) {
+		_, ts, isValue := MVCCDecodeKey(kv.Key)
+		if !isValue {
+			if err := gogoproto.Unmarshal(kv.Value, meta); err != nil {
+				return true, util.Errorf("unable to unmarshal mvcc meta: %s", err)
+			}
+			return meta.IsInline(), nil
+		}
+		isIntent := first && meta.Txn != nil
+		first = false
+		if isIntent || gcTimestamp.Less(ts) {
+			return false, nil
+		}
+		if found {
+			// All versions older than the version visible at gcTimestamp
+			// may be collected.
+			gcTS = ts
+			return true, nil
+		}
+		// This is the version visible to reads at gcTimestamp. It may be
+		// collected only if it's a deletion tombstone.
+		found = true
+		mvccVal := proto.MVCCValue{}
+		if err := gogoproto.Unmarshal(kv.Value, &mvccVal); err != nil {
+			return true, util.Errorf("unable to unmarshal mvcc value: %s", err)
+		}
+		if mvccVal.Deleted {
+			gcTS = ts
+			return true, nil
+		}
+		return false, nil
+	})
+	return gcTS, err
+}
+
 // IsValidSplitKey returns whether the key is a valid split key.
 // Certain key ranges cannot be split; split keys chosen within
 // any of these ranges are considered invalid.
@@ -1274,18 +2234,73 @@ func isValidEncodedSplitKey(key proto.EncodedKey) bool {
 // The split key will never be chosen from the key ranges listed in
 // illegalSplitKeyRanges.
 func MVCCFindSplitKey(engine Engine, raftID int64, key, endKey proto.Key) (proto.Key, error) {
-	if key.Less(keys.LocalMax) {
-		key = keys.LocalMax
+	// Get range size from stats.
+	var ms proto.MVCCStats
+	if err := MVCCGetRangeStats(engine, raftID, &ms); err != nil {
+		return nil, err
 	}
-	encStartKey := MVCCEncodeKey(key)
-	encEndKey := MVCCEncodeKey(endKey)
+	return mvccFindSplitKey(engine, key, endKey, ms.KeyBytes+ms.ValBytes,
+		func(kv proto.RawKeyValue) (int64, error) {
+			_, _, isValue := MVCCDecodeKey(kv.Key)
+			if isValue {
+				return mvccVersionTimestampSize + int64(len(kv.Value)), nil
+			}
+			return int64(len(kv.Key) + len(kv.Value)), nil
+		})
+}
 
-	// Get range size from stats.
+// MVCCFindLiveSplitKey suggests a split key from the given user-space
+// key range that aims to roughly cut into half the number of live
+// bytes in both subranges, as accounted by MVCCStats.LiveBytes. Unlike
+// MVCCFindSplitKey, deleted and overwritten values don't count towards
+// either side, so the split key approximates the median of the live
+// data. Specify a snapshot engine to safely invoke this method in a
+// goroutine.
+//
+// The split key will never be chosen from the key ranges listed in
+// illegalSplitKeyRanges.
+func MVCCFindLiveSplitKey(engine Engine, raftID int64, key, endKey proto.Key) (proto.Key, error) {
+	// Get live bytes from stats.
 	var ms proto.MVCCStats
 	if err := MVCCGetRangeStats(engine, raftID, &ms); err != nil {
 		return nil, err
 	}
-	rangeSize := ms.KeyBytes + ms.ValBytes
+	first := false
+	meta := &proto.MVCCMetadata{}
+	return mvccFindSplitKey(engine, key, endKey, ms.LiveBytes,
+		func(kv proto.RawKeyValue) (int64, error) {
+			_, _, isValue := MVCCDecodeKey(kv.Key)
+			if isValue {
+				// Only the most recent version of a live key is live.
+				live := first && !meta.Deleted
+				first = false
+				if live {
+					return mvccVersionTimestampSize + int64(len(kv.Value)), nil
+				}
+				return 0, nil
+			}
+			if err := gogoproto.Unmarshal(kv.Value, meta); err != nil {
+				return 0, util.Errorf("unable to unmarshal MVCC metadata %b: %s", kv.Value, err)
+			}
+			first = true
+			if meta.Deleted {
+				return 0, nil
+			}
+			return int64(len(kv.Key) + len(kv.Value)), nil
+		})
+}
+
+// mvccFindSplitKey iterates over the given user-space key range and
+// returns the key which best divides rangeSize in half, where sizeFn
+// returns the number of bytes each raw key/value pair contributes to
+// rangeSize. sizeFn is invoked on the pairs in key order.
+func mvccFindSplitKey(engine Engine, key, endKey proto.Key, rangeSize int64,
+	sizeFn func(kv proto.RawKeyValue) (int64, error)) (proto.Key, error) {
+	if key.Less(keys.LocalMax) {
+		key = keys.LocalMax
+	}
+	encStartKey := MVCCEncodeKey(key)
+	encEndKey := MVCCEncodeKey(endKey)
 
 	targetSize := rangeSize / 2
 	sizeSoFar := int64(0)
@@ -1310,12 +2325,11 @@ func MVCCFindSplitKey(engine Engine, raftID int64, key, endKey proto.Key) (proto
 		done := !bestSplitKey.Equal(encStartKey) && diff > bestSplitDiff
 
 		// Add this key/value to the size scanned so far.
-		_, _, isValue := MVCCDecodeKey(kv.Key)
-		if isValue {
-			sizeSoFar += mvccVersionTimestampSize + int64(len(kv.Value))
-		} else {
-			sizeSoFar += int64(len(kv.Key) + len(kv.Value))
+		size, err := sizeFn(kv)
+		if err != nil {
+			return false, err
 		}
+		sizeSoFar += size
 
 		return done, nil
 	}); err != nil {
@@ -1409,6 +2423,36 @@ func MVCCComputeStats(iter Iterator, nowNanos int64) (proto.MVCCStats, error) {
 	return ms, nil
 }
 
+// spanIterator wraps an Iterator and reports it as invalid once the
+// underlying iterator reaches or passes the end key.
+type spanIterator struct {
+	Iterator
+	end proto.EncodedKey
+}
+
+func (si *spanIterator) Valid() bool {
+	return si.Iterator.Valid() && bytes.Compare(si.Key(), si.end) < 0
+}
+
+// ComputeStatsForRange scans the engine from start to end keys and
+// computes authoritative stats counters for the span. Unlike stored
+// range stats, which are maintained incrementally, the returned
+// values reflect exactly what is present in the engine. The nowNanos
+// arg specifies the wall time used to compute age stats.
+func ComputeStatsForRange(engine Engine, start, end proto.Key, nowNanos int64) (proto.MVCCStats, error) {
+	if !start.Less(end) {
+		return proto.MVCCStats{}, util.Errorf("start key %q must be less than end key %q", start, end)
+	}
+	iter := engine.NewIterator()
+	defer iter.Close()
+	iter.Seek(MVCCEncodeKey(start))
+	ms, err := MVCCComputeStats(&spanIterator{Iterator: iter, end: MVCCEncodeKey(end)}, nowNanos)
+	if err != nil {
+		return ms, err
+	}
+	return ms, iter.Error()
+}
+
 // MVCCEncodeKey makes an MVCC key for storing MVCC metadata or
 // for storing raw values directly. Use MVCCEncodeVersionValue for
 // storing timestamped version values.
@@ -1447,17 +2491,19 @@ func mvccEncodeTimestamp(key proto.EncodedKey, timestamp proto.Timestamp) proto.
 // for an MVCC metadata or a raw value. Otherwise, there must be
 // exactly 12 trailing bytes and they're decoded into a timestamp.
 // The decoded key, timestamp and true are returned to indicate the
-// key is for an MVCC versioned value.
+// key is for an MVCC versioned value. MVCCDecodeKey panics if
+// encodedKey is malformed; use mvccDecodeKey to decode untrusted
+// input.
 func MVCCDecodeKey(encodedKey proto.EncodedKey) (proto.Key, proto.Timestamp, bool) {
-	tsBytes, key := encoding.DecodeBytes(encodedKey, nil)
-	if len(tsBytes) == 0 {
-		return key, proto.Timestamp{}, false
-	} else if len(tsBytes) != 12 {
-		panic(fmt.Sprintf("there should be 12 bytes for encoded timestamp: %q", tsBytes))
-	}
-	var walltime uint64
-	var logical uint32
-	tsBytes, walltime = encoding.DecodeUint64Decreasing(tsBytes)
-	tsBytes, logical = encoding.DecodeUint32Decreasing(tsBytes)
-	return key, proto.Timestamp{WallTime: int64(walltime), Logical: int32(logical)}, true
+	key, ts, isValue, err := mvccDecodeKey(encodedKey)
+	if err != nil {
+		panic(err.Error())
+	}
+	return key, ts, isValue
+}
+
+// mvccDecodeKey is like MVCCDecodeKey, but returns an error instead of
+// panicking if encodedKey is malformed.
+func mvccDecodeKey(encodedKey proto.EncodedKey) (proto.Key, proto.Timestamp, bool, error) {
+	return keys.DecodeMVCCVersionKey(encodedKey)
 }
@@ -130,7 +130,7 @@ func TestMVCCEmptyKey(t *testing.T) {
 	if _, err := MVCCScan(engine, testKey1, proto.Key{}, 0, makeTS(0, 1), true, nil); err == nil {
 		t.Error("expected empty key error")
 	}
-	if err := MVCCResolveWriteIntent(engine, nil, proto.Key{}, makeTS(0, 1), txn1); err == nil {
+	if _, err := MVCCResolveWriteIntent(engine, nil, proto.Key{}, makeTS(0, 1), txn1, false); err == nil {
 		t.Error("expected empty key error")
 	}
 }
@@ -149,6 +149,172 @@ func TestMVCCGetNotExist(t *testing.T) {
 	}
 }
 
+// TestMVCCPutGetProto round-trips a range descriptor through
+// MVCCPutProto and MVCCGetProto and verifies that a read of a missing
+// or deleted key reports false without modifying the supplied message,
+// while a malformed value returns an error.
+func TestMVCCPutGetProto(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	engine := createTestEngine()
+	defer engine.Close()
+
+	desc := proto.RangeDescriptor{
+		RaftID:   1,
+		StartKey: testKey1,
+		EndKey:   testKey4,
+		Replicas: []proto.Replica{{NodeID: 1, StoreID: 1}, {NodeID: 2, StoreID: 2}},
+	}
+	if err := MVCCPutProto(engine, nil, testKey1, makeTS(1, 0), nil, &desc); err != nil {
+		t.Fatal(err)
+	}
+
+	readDesc := proto.RangeDescriptor{}
+	ok, err := MVCCGetProto(engine, testKey1, makeTS(1, 0), true, nil, &readDesc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || !reflect.DeepEqual(readDesc, desc) {
+		t.Errorf("expected %+v; got %t, %+v", desc, ok, readDesc)
+	}
+
+	// Reads of a missing key or before the key was written find nothing
+	// and leave the message untouched.
+	for _, test := range []struct {
+		key proto.Key
+		ts  proto.Timestamp
+	}{
+		{testKey2, makeTS(1, 0)},
+		{testKey1, makeTS(0, 1)},
+	} {
+		ok, err := MVCCGetProto(engine, test.key, test.ts, true, nil, &readDesc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			t.Errorf("expected no value for key %q at %s", test.key, test.ts)
+		}
+		if !reflect.DeepEqual(readDesc, desc) {
+			t.Errorf("expected message to be untouched; got %+v", readDesc)
+		}
+	}
+
+	// A deletion tombstone reads as absent.
+	if err := MVCCDelete(engine, nil, testKey1, makeTS(2, 0), nil); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := MVCCGetProto(engine, testKey1, makeTS(2, 0), true, nil, &readDesc); err != nil || ok {
+		t.Errorf("expected deleted key to be absent; got %t, %v", ok, err)
+	}
+
+	// A value which doesn't decode is found but reported as an error.
+	malformed := proto.Value{Bytes: []byte{0xff}}
+	if err := MVCCPut(engine, nil, testKey2, makeTS(1, 0), malformed, nil); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := MVCCGetProto(engine, testKey2, makeTS(1, 0), true, nil, &readDesc); err == nil || !ok {
+		t.Errorf("expected decoding error for malformed value; got %t, %v", ok, err)
+	}
+}
+
+// TestMVCCPutProtoChecksumAndStats verifies that MVCCPutProto writes a
+// checksummed value and accounts for it exactly as the equivalent
+// MVCCPut would.
+func TestMVCCPutProtoChecksumAndStats(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	engine := createTestEngine()
+	defer engine.Close()
+
+	desc := proto.RangeDescriptor{RaftID: 1, StartKey: testKey1, EndKey: testKey4}
+	protoMS := proto.MVCCStats{}
+	if err := MVCCPutProto(engine, &protoMS, testKey1, makeTS(1, 0), nil, &desc); err != nil {
+		t.Fatal(err)
+	}
+	value, err := MVCCGet(engine, testKey1, makeTS(1, 0), true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value == nil || value.Checksum == nil {
+		t.Fatalf("expected checksummed value; got %+v", value)
+	}
+	if err := value.Verify(testKey1); err != nil {
+		t.Error(err)
+	}
+
+	data, err := gogoproto.Marshal(&desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawValue := proto.Value{Bytes: data}
+	rawValue.InitChecksum(testKey1)
+	rawEngine := createTestEngine()
+	defer rawEngine.Close()
+	rawMS := proto.MVCCStats{}
+	if err := MVCCPut(rawEngine, &rawMS, testKey1, makeTS(1, 0), rawValue, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(protoMS, rawMS) {
+		t.Errorf("expected stats %+v to match those of MVCCPut %+v", protoMS, rawMS)
+	}
+}
+
+// TestMVCCReadBelowGCThreshold verifies that reads at timestamps
+// just below the GC threshold fail with ReadAtTimestampBelowGCError
+// while reads at or just above it succeed.
+func TestMVCCReadBelowGCThreshold(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	engine := createTestEngine()
+	defer engine.Close()
+
+	for i, value := range []proto.Value{value1, value2, value3} {
+		if err := MVCCPut(engine, nil, testKey1, makeTS(int64(i+1)*5, 0), value, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	threshold := makeTS(10, 0)
+	testCases := []struct {
+		ts       proto.Timestamp
+		expValue []byte
+	}{
+		{threshold.Prev(), nil},
+		{threshold, value2.Bytes},
+		{threshold.Next(), value2.Bytes},
+	}
+	for i, test := range testCases {
+		value, getErr := MVCCGetWithGCThreshold(engine, testKey1, test.ts, threshold, true, nil)
+		kvs, scanErr := MVCCScanWithGCThreshold(engine, testKey1, testKey2, 0, test.ts, threshold, true, nil)
+		revKVs, revScanErr := MVCCReverseScanWithGCThreshold(engine, testKey1, testKey2, 0, test.ts, threshold, true, nil)
+		for j, err := range []error{getErr, scanErr, revScanErr} {
+			if test.expValue == nil {
+				gcErr, ok := err.(*ReadAtTimestampBelowGCError)
+				if !ok {
+					t.Errorf("%d.%d: expected ReadAtTimestampBelowGCError; got %v", i, j, err)
+				} else if !gcErr.Timestamp.Equal(test.ts) || !gcErr.Threshold.Equal(threshold) {
+					t.Errorf("%d.%d: unexpected error contents %+v", i, j, gcErr)
+				}
+			} else if err != nil {
+				t.Errorf("%d.%d: unexpected error: %s", i, j, err)
+			}
+		}
+		if test.expValue == nil {
+			continue
+		}
+		if value == nil || !bytes.Equal(value.Bytes, test.expValue) {
+			t.Errorf("%d: expected get of %q; got %v", i, test.expValue, value)
+		}
+		for _, res := range [][]proto.KeyValue{kvs, revKVs} {
+			if len(res) != 1 || !bytes.Equal(res[0].Value.Bytes, test.expValue) {
+				t.Errorf("%d: expected scan of %q; got %v", i, test.expValue, res)
+			}
+		}
+	}
+
+	// A zero threshold allows reads at any timestamp.
+	if value, err := MVCCGetWithGCThreshold(engine, testKey1, makeTS(5, 0), proto.ZeroTimestamp, true, nil); err != nil || value == nil {
+		t.Errorf("expected read with zero threshold to succeed; got %v, %v", value, err)
+	}
+}
+
 func TestMVCCPutWithBadValue(t *testing.T) {
 	defer leaktest.AfterTest(t)
 	engine := createTestEngine()
@@ -161,6 +327,46 @@ func TestMVCCPutWithBadValue(t *testing.T) {
 	}
 }
 
+// TestMVCCGetChecksumError writes a checksummed value, corrupts its
+// bytes directly in the engine and verifies that MVCCGet returns a
+// ValueChecksumError.
+func TestMVCCGetChecksumError(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	engine := createTestEngine()
+	defer engine.Close()
+
+	value := proto.Value{Bytes: []byte("testValue")}
+	value.InitChecksum(testKey1)
+	ts := makeTS(1, 0)
+	if err := MVCCPut(engine, nil, testKey1, ts, value, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Corrupt the value bytes, leaving the checksum intact.
+	versionKey := MVCCEncodeVersionKey(testKey1, ts)
+	mvccValue := proto.MVCCValue{}
+	if ok, _, _, err := engine.GetProto(versionKey, &mvccValue); !ok || err != nil {
+		t.Fatalf("unable to read version value: %t, %v", ok, err)
+	}
+	mvccValue.Value.Bytes[0] ^= 0xff
+	data, err := gogoproto.Marshal(&mvccValue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Put(versionKey, data); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = MVCCGet(engine, testKey1, makeTS(2, 0), true, nil)
+	cErr, ok := err.(*proto.ValueChecksumError)
+	if !ok {
+		t.Fatalf("expected a ValueChecksumError; got %v", err)
+	}
+	if !cErr.Key.Equal(testKey1) || cErr.Expected != value.GetChecksum() || cErr.Expected == cErr.Actual {
+		t.Errorf("unexpected checksum error %+v", cErr)
+	}
+}
+
 func TestMVCCPutWithTxn(t *testing.T) {
 	defer leaktest.AfterTest(t)
 	engine := createTestEngine()
@@ -803,145 +1009,844 @@ func TestMVCCScanWithKeyPrefix(t *testing.T) {
 	}
 }
 
-func TestMVCCScanInTxn(t *testing.T) {
+// TestMVCCReverseScan verifies that a reverse scan over keys with
+// multiple versions returns the same key/values as a forward scan,
+// in descending order, and that max stops the iteration early.
+func TestMVCCReverseScan(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	engine := createTestEngine()
+	defer engine.Close()
+
+	for i, key := range []proto.Key{testKey1, testKey2, testKey3, testKey4} {
+		for j, value := range []proto.Value{value1, value2, value3} {
+			if err := MVCCPut(engine, nil, key, makeTS(int64(i+j+1), 0), value, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	testCases := []struct {
+		key, endKey proto.Key
+		ts          proto.Timestamp
+	}{
+		{proto.KeyMin, proto.KeyMax, makeTS(3, 0)},
+		{proto.KeyMin, proto.KeyMax, makeTS(10, 0)},
+		{testKey2, testKey4, makeTS(4, 0)},
+		{testKey2, testKey4.Next(), makeTS(1, 0)},
+		{testKey1, testKey3, makeTS(2, 0)},
+	}
+	for i, test := range testCases {
+		fwd, err := MVCCScan(engine, test.key, test.endKey, 0, test.ts, true, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j, k := 0, len(fwd)-1; j < k; j, k = j+1, k-1 {
+			fwd[j], fwd[k] = fwd[k], fwd[j]
+		}
+		rev, err := MVCCReverseScan(engine, test.key, test.endKey, 0, test.ts, true, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(fwd, rev) {
+			t.Errorf("%d: expected reversed forward scan %v; got %v", i, fwd, rev)
+		}
+		for max := int64(1); max <= int64(len(fwd)); max++ {
+			rev, err := MVCCReverseScan(engine, test.key, test.endKey, max, test.ts, true, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(fwd[:max], rev) {
+				t.Errorf("%d: expected %v with max %d; got %v", i, fwd[:max], max, rev)
+			}
+		}
+	}
+}
+
+func TestMVCCReverseScanMaxNum(t *testing.T) {
 	defer leaktest.AfterTest(t)
 	engine := createTestEngine()
 	defer engine.Close()
 
 	err := MVCCPut(engine, nil, testKey1, makeTS(1, 0), value1, nil)
 	err = MVCCPut(engine, nil, testKey2, makeTS(1, 0), value2, nil)
-	err = MVCCPut(engine, nil, testKey3, makeTS(1, 0), value3, txn1)
+	err = MVCCPut(engine, nil, testKey3, makeTS(1, 0), value3, nil)
 	err = MVCCPut(engine, nil, testKey4, makeTS(1, 0), value4, nil)
 
-	kvs, err := MVCCScan(engine, testKey2, testKey4, 0, makeTS(1, 0), true, txn1)
+	kvs, err := MVCCReverseScan(engine, testKey2, testKey4, 1, makeTS(1, 0), true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kvs) != 1 ||
+		!bytes.Equal(kvs[0].Key, testKey3) ||
+		!bytes.Equal(kvs[0].Value.Bytes, value3.Bytes) {
+		t.Fatal("the value should not be empty")
+	}
+}
+
+// TestMVCCReverseScanWithKeyPrefix verifies that stepping backward
+// from a key skips the versions of the preceding key which shares
+// its prefix.
+func TestMVCCReverseScanWithKeyPrefix(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	engine := createTestEngine()
+	defer engine.Close()
+
+	err := MVCCPut(engine, nil, proto.Key("/a"), makeTS(1, 0), value1, nil)
+	err = MVCCPut(engine, nil, proto.Key("/a"), makeTS(2, 0), value2, nil)
+	err = MVCCPut(engine, nil, proto.Key("/aa"), makeTS(2, 0), value2, nil)
+	err = MVCCPut(engine, nil, proto.Key("/aa"), makeTS(3, 0), value3, nil)
+	err = MVCCPut(engine, nil, proto.Key("/b"), makeTS(1, 0), value3, nil)
+
+	kvs, err := MVCCReverseScan(engine, proto.Key("/a"), proto.Key("/b"), 0, makeTS(2, 0), true, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 	if len(kvs) != 2 ||
-		!bytes.Equal(kvs[0].Key, testKey2) ||
-		!bytes.Equal(kvs[1].Key, testKey3) ||
+		!bytes.Equal(kvs[0].Key, proto.Key("/aa")) ||
+		!bytes.Equal(kvs[1].Key, proto.Key("/a")) ||
 		!bytes.Equal(kvs[0].Value.Bytes, value2.Bytes) ||
-		!bytes.Equal(kvs[1].Value.Bytes, value3.Bytes) {
+		!bytes.Equal(kvs[1].Value.Bytes, value2.Bytes) {
 		t.Fatal("the value should not be empty")
 	}
+}
 
-	kvs, err = MVCCScan(engine, testKey2, testKey4, 0, makeTS(1, 0), true, nil)
+func TestMVCCReverseScanInTxn(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	engine := createTestEngine()
+	defer engine.Close()
+
+	err := MVCCPut(engine, nil, testKey1, makeTS(1, 0), value1, nil)
+	err = MVCCPut(engine, nil, testKey2, makeTS(1, 0), value2, nil)
+	err = MVCCPut(engine, nil, testKey3, makeTS(1, 0), value3, txn1)
+	err = MVCCPut(engine, nil, testKey4, makeTS(1, 0), value4, nil)
+
+	kvs, err := MVCCReverseScan(engine, testKey2, testKey4, 0, makeTS(1, 0), true, txn1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kvs) != 2 ||
+		!bytes.Equal(kvs[0].Key, testKey3) ||
+		!bytes.Equal(kvs[1].Key, testKey2) ||
+		!bytes.Equal(kvs[0].Value.Bytes, value3.Bytes) ||
+		!bytes.Equal(kvs[1].Value.Bytes, value2.Bytes) {
+		t.Fatal("the value should not be empty")
+	}
+
+	kvs, err = MVCCReverseScan(engine, testKey2, testKey4, 0, makeTS(1, 0), true, nil)
 	if err == nil {
 		t.Fatal("expected error on uncommitted write intent")
 	}
+
+	// A reverse scan with consistent=false should fail in a txn.
+	if _, err := MVCCReverseScan(engine, proto.KeyMin, proto.KeyMax, 0, makeTS(1, 0), false, txn1); err == nil {
+		t.Error("expected an error scanning with consistent=false in txn")
+	}
 }
 
-// TestMVCCScanInconsistent writes several values, some as intents and
-// verifies that the scan sees only the committed versions.
-func TestMVCCScanInconsistent(t *testing.T) {
+// TestMVCCReverseScanWriteIntentError verifies that a reverse scan
+// accumulates write intents in descending key order and, when
+// inconsistent, returns the committed values alongside them.
+func TestMVCCReverseScanWriteIntentError(t *testing.T) {
 	defer leaktest.AfterTest(t)
 	engine := createTestEngine()
 	defer engine.Close()
 
-	// A scan with consistent=false should fail in a txn.
-	if _, err := MVCCScan(engine, proto.KeyMin, proto.KeyMax, 0, makeTS(1, 0), false, txn1); err == nil {
-		t.Error("expected an error scanning with consistent=false in txn")
-	}
-
 	ts1 := makeTS(1, 0)
 	ts2 := makeTS(2, 0)
-	ts3 := makeTS(3, 0)
-	ts4 := makeTS(4, 0)
-	ts5 := makeTS(5, 0)
-	ts6 := makeTS(6, 0)
 	if err := MVCCPut(engine, nil, testKey1, ts1, value1, nil); err != nil {
 		t.Fatal(err)
 	}
 	if err := MVCCPut(engine, nil, testKey1, ts2, value2, txn1); err != nil {
 		t.Fatal(err)
 	}
-	if err := MVCCPut(engine, nil, testKey2, ts3, value1, nil); err != nil {
-		t.Fatal(err)
-	}
-	if err := MVCCPut(engine, nil, testKey2, ts4, value2, nil); err != nil {
-		t.Fatal(err)
-	}
-	if err := MVCCPut(engine, nil, testKey3, ts5, value3, txn2); err != nil {
+	if err := MVCCPut(engine, nil, testKey2, ts1, value2, nil); err != nil {
 		t.Fatal(err)
 	}
-	if err := MVCCPut(engine, nil, testKey4, ts6, value4, nil); err != nil {
+	if err := MVCCPut(engine, nil, testKey3, ts2, value3, txn2); err != nil {
 		t.Fatal(err)
 	}
 
 	expIntents := []proto.WriteIntentError_Intent{
-		{Key: testKey1, Txn: *txn1},
 		{Key: testKey3, Txn: *txn2},
+		{Key: testKey1, Txn: *txn1},
 	}
-	kvs, err := MVCCScan(engine, testKey1, testKey4.Next(), 0, makeTS(7, 0), false, nil)
-	if wiErr, ok := err.(*proto.WriteIntentError); !ok || !reflect.DeepEqual(wiErr.Intents, expIntents) {
+	if _, err := MVCCReverseScan(engine, testKey1, testKey4, 0, makeTS(3, 0), true, nil); err == nil {
+		t.Fatal("expected write intent error on consistent reverse scan")
+	} else if wiErr, ok := err.(*proto.WriteIntentError); !ok || !reflect.DeepEqual(wiErr.Intents, expIntents) {
 		t.Fatal(err)
 	}
 
+	kvs, err := MVCCReverseScan(engine, testKey1, testKey4, 0, makeTS(3, 0), false, nil)
+	if wiErr, ok := err.(*proto.WriteIntentError); !ok || !reflect.DeepEqual(wiErr.Intents, expIntents) {
+		t.Fatal(err)
+	}
 	expKVs := []proto.KeyValue{
+		{Key: testKey2, Value: proto.Value{Bytes: value2.Bytes, Timestamp: &ts1}},
 		{Key: testKey1, Value: proto.Value{Bytes: value1.Bytes, Timestamp: &ts1}},
-		{Key: testKey2, Value: proto.Value{Bytes: value2.Bytes, Timestamp: &ts4}},
-		{Key: testKey4, Value: proto.Value{Bytes: value4.Bytes, Timestamp: &ts6}},
 	}
 	if !reflect.DeepEqual(kvs, expKVs) {
 		t.Errorf("expected key values equal %v != %v", kvs, expKVs)
 	}
 
-	// Now try a scan at a historical timestamp.
-	expIntents = expIntents[:1]
-	kvs, err = MVCCScan(engine, testKey1, testKey4.Next(), 0, makeTS(3, 0), false, nil)
-	if wiErr, ok := err.(*proto.WriteIntentError); !ok || !reflect.DeepEqual(wiErr.Intents, expIntents) {
+	// Within txn1, its own intent is visible.
+	kvs, err = MVCCReverseScan(engine, testKey1, testKey3, 0, makeTS(3, 0), true, txn1)
+	if err != nil {
 		t.Fatal(err)
 	}
-	expKVs = []proto.KeyValue{
-		{Key: testKey1, Value: proto.Value{Bytes: value1.Bytes, Timestamp: &ts1}},
-		{Key: testKey2, Value: proto.Value{Bytes: value1.Bytes, Timestamp: &ts3}},
+	if len(kvs) != 2 || !bytes.Equal(kvs[1].Key, testKey1) || !bytes.Equal(kvs[1].Value.Bytes, value2.Bytes) {
+		t.Errorf("expected txn1 to read its own intent; got %v", kvs)
 	}
-	if !reflect.DeepEqual(kvs, expKVs) {
-		t.Errorf("expected key values equal %v != %v", kvs, expKVs)
+}
+
+// TestDecodeMVCCKeyRoundTrip verifies that keys.DecodeMVCCKey is the
+// inverse of the MVCC key encodings used on the write path and that
+// MVCCDecodeKey distinguishes version keys from metadata keys.
+func TestDecodeMVCCKeyRoundTrip(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	testKeys := []proto.Key{
+		proto.KeyMin,
+		proto.Key("a"),
+		proto.Key("\x00\xff\x00\x01"),
+		proto.Key("\xffa"),
+		keys.RangeDescriptorKey(proto.Key("a")),
+		proto.KeyMax,
+	}
+	testTimestamps := []proto.Timestamp{
+		makeTS(0, 1),
+		makeTS(1, 0),
+		makeTS(math.MaxInt64, math.MaxInt32),
+	}
+	for _, key := range testKeys {
+		dKey, ts, err := keys.DecodeMVCCKey(MVCCEncodeKey(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !dKey.Equal(key) || !ts.Equal(proto.ZeroTimestamp) {
+			t.Errorf("expected %q with zero timestamp; got %q, %s", key, dKey, ts)
+		}
+		if _, _, isValue := MVCCDecodeKey(MVCCEncodeKey(key)); isValue {
+			t.Errorf("expected metadata key for %q not to decode as a value", key)
+		}
+		for _, expTS := range append(testTimestamps, proto.ZeroTimestamp) {
+			dKey, ts, err := keys.DecodeMVCCKey(MVCCEncodeVersionKey(key, expTS))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !dKey.Equal(key) || !ts.Equal(expTS) {
+				t.Errorf("expected %q at %s; got %q at %s", key, expTS, dKey, ts)
+			}
+			if _, _, isValue := MVCCDecodeKey(MVCCEncodeVersionKey(key, expTS)); !isValue {
+				t.Errorf("expected version key for %q at %s to decode as a value", key, expTS)
+			}
+		}
 	}
 }
 
-func TestMVCCDeleteRange(t *testing.T) {
+// TestMVCCIncrementalIterate writes versions at several timestamps
+// and verifies that only versions, including deletion tombstones,
+// within the (startTime, endTime] window are returned.
+func TestMVCCIncrementalIterate(t *testing.T) {
 	defer leaktest.AfterTest(t)
 	engine := createTestEngine()
 	defer engine.Close()
 
-	err := MVCCPut(engine, nil, testKey1, makeTS(1, 0), value1, nil)
-	err = MVCCPut(engine, nil, testKey2, makeTS(1, 0), value2, nil)
-	err = MVCCPut(engine, nil, testKey3, makeTS(1, 0), value3, nil)
-	err = MVCCPut(engine, nil, testKey4, makeTS(1, 0), value4, nil)
-
-	num, err := MVCCDeleteRange(engine, nil, testKey2, testKey4, 0, makeTS(2, 0), nil)
-	if err != nil {
+	keyA, keyB, keyC := proto.Key("a"), proto.Key("b"), proto.Key("c")
+	for _, wt := range []int64{1, 3, 5} {
+		if err := MVCCPut(engine, nil, keyA, makeTS(wt, 0), value1, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := MVCCPut(engine, nil, keyB, makeTS(2, 0), value2, nil); err != nil {
 		t.Fatal(err)
 	}
-	if num != 2 {
-		t.Fatal("the value should not be empty")
+	if err := MVCCDelete(engine, nil, keyB, makeTS(4, 0), nil); err != nil {
+		t.Fatal(err)
 	}
-	kvs, _ := MVCCScan(engine, proto.KeyMin, proto.KeyMax, 0, makeTS(2, 0), true, nil)
-	if len(kvs) != 2 ||
-		!bytes.Equal(kvs[0].Key, testKey1) ||
-		!bytes.Equal(kvs[1].Key, testKey4) ||
-		!bytes.Equal(kvs[0].Value.Bytes, value1.Bytes) ||
-		!bytes.Equal(kvs[1].Value.Bytes, value4.Bytes) {
-		t.Fatal("the value should not be empty")
+	if err := MVCCPut(engine, nil, keyC, makeTS(6, 0), value3, nil); err != nil {
+		t.Fatal(err)
 	}
 
-	num, err = MVCCDeleteRange(engine, nil, testKey4, proto.KeyMax, 0, makeTS(2, 0), nil)
-	if err != nil {
-		t.Fatal(err)
+	type version struct {
+		key     proto.Key
+		ts      proto.Timestamp
+		deleted bool
 	}
-	if num != 1 {
-		t.Fatal("the value should not be empty")
+	iterate := func(startTime, endTime proto.Timestamp) ([]version, error) {
+		var versions []version
+		err := MVCCIncrementalIterate(engine, proto.KeyMin, proto.KeyMax, startTime, endTime,
+			func(kv proto.KeyValue, deleted bool) (bool, error) {
+				versions = append(versions, version{kv.Key, *kv.Value.Timestamp, deleted})
+				return false, nil
+			})
+		return versions, err
 	}
-	kvs, _ = MVCCScan(engine, proto.KeyMin, proto.KeyMax, 0, makeTS(2, 0), true, nil)
-	if len(kvs) != 1 ||
-		!bytes.Equal(kvs[0].Key, testKey1) ||
-		!bytes.Equal(kvs[0].Value.Bytes, value1.Bytes) {
+
+	testCases := []struct {
+		startTime, endTime proto.Timestamp
+		expVersions        []version
+	}{
+		{makeTS(2, 0), makeTS(5, 0), []version{
+			{keyA, makeTS(5, 0), false},
+			{keyA, makeTS(3, 0), false},
+			{keyB, makeTS(4, 0), true},
+		}},
+		{makeTS(0, 0), makeTS(1, 0), []version{
+			{keyA, makeTS(1, 0), false},
+		}},
+		{makeTS(5, 0), makeTS(10, 0), []version{
+			{keyC, makeTS(6, 0), false},
+		}},
+		{makeTS(6, 0), makeTS(10, 0), nil},
+	}
+	for i, test := range testCases {
+		versions, err := iterate(test.startTime, test.endTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(versions, test.expVersions) {
+			t.Errorf("%d: expected versions %v; got %v", i, test.expVersions, versions)
+		}
+	}
+
+	// An intent in the window is reported via a write intent error
+	// instead of being passed to f.
+	if err := MVCCPut(engine, nil, keyC, makeTS(7, 0), value1, txn1); err != nil {
+		t.Fatal(err)
+	}
+	versions, err := iterate(makeTS(5, 0), makeTS(10, 0))
+	if wiErr, ok := err.(*proto.WriteIntentError); !ok || len(wiErr.Intents) != 1 || !wiErr.Intents[0].Key.Equal(keyC) {
+		t.Errorf("expected write intent error on %q; got %v", keyC, err)
+	}
+	if exp := []version{{keyC, makeTS(6, 0), false}}; !reflect.DeepEqual(versions, exp) {
+		t.Errorf("expected versions %v; got %v", exp, versions)
+	}
+	// Outside the window, the intent is ignored.
+	if _, err := iterate(makeTS(0, 0), makeTS(6, 0)); err != nil {
+		t.Errorf("expected no error for window preceding intent; got %v", err)
+	}
+}
+
+// TestMVCCIncrementalIterateWithGCThreshold verifies that incremental
+// iteration honors logical ticks at both window boundaries and refuses
+// windows starting below the GC threshold.
+func TestMVCCIncrementalIterateWithGCThreshold(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	engine := createTestEngine()
+	defer engine.Close()
+
+	for _, ts := range []proto.Timestamp{makeTS(1, 0), makeTS(2, 0), makeTS(2, 1), makeTS(3, 0), makeTS(3, 1)} {
+		if err := MVCCPut(engine, nil, testKey1, ts, value1, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	iterate := func(startTime, endTime, gcThreshold proto.Timestamp) ([]proto.Timestamp, error) {
+		var timestamps []proto.Timestamp
+		err := MVCCIncrementalIterateWithGCThreshold(engine, proto.KeyMin, proto.KeyMax, startTime, endTime, gcThreshold,
+			func(kv proto.KeyValue, _ bool) (bool, error) {
+				timestamps = append(timestamps, *kv.Value.Timestamp)
+				return false, nil
+			})
+		return timestamps, err
+	}
+
+	// The window (2.0, 3.0] excludes 2.0 and 3.1.
+	timestamps, err := iterate(makeTS(2, 0), makeTS(3, 0), makeTS(2, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := []proto.Timestamp{makeTS(3, 0), makeTS(2, 1)}; !reflect.DeepEqual(timestamps, exp) {
+		t.Errorf("expected versions at %v; got %v", exp, timestamps)
+	}
+
+	// Versions just above the start time may have been GC'd if it is
+	// below the threshold.
+	if _, err := iterate(makeTS(1, 0), makeTS(3, 0), makeTS(2, 0)); err == nil {
+		t.Error("expected error iterating from below the GC threshold")
+	} else if _, ok := err.(*ReadAtTimestampBelowGCError); !ok {
+		t.Errorf("expected ReadAtTimestampBelowGCError; got %v", err)
+	}
+}
+
+// TestMVCCScanVersions verifies that MVCCScanVersions returns up to the
+// requested number of versions per key within the time window and
+// reports intents separately from committed versions.
+func TestMVCCScanVersions(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	engine := createTestEngine()
+	defer engine.Close()
+
+	// testKey1 has five versions and testKey2 a single one. testKey3
+	// was deleted and has an intent above the deletion. testKey4 is
+	// inline and never returned.
+	for i := 1; i <= 5; i++ {
+		if err := MVCCPut(engine, nil, testKey1, makeTS(int64(i), 0), value1, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := MVCCPut(engine, nil, testKey2, makeTS(2, 0), value2, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := MVCCPut(engine, nil, testKey3, makeTS(1, 0), value3, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := MVCCDelete(engine, nil, testKey3, makeTS(3, 0), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := MVCCPut(engine, nil, testKey3, makeTS(4, 0), value4, txn1); err != nil {
+		t.Fatal(err)
+	}
+	if err := MVCCPut(engine, nil, testKey4, proto.ZeroTimestamp, value4, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// versions describes the result of a scan by listing the wall
+	// times of each key's versions, marking tombstones with a "d"
+	// suffix and the intent with an "i" prefix.
+	versions := func(res []MVCCKeyVersions) map[string][]string {
+		m := map[string][]string{}
+		for _, kv := range res {
+			var s []string
+			if kv.Intent != nil {
+				if kv.Txn == nil || !bytes.Equal(kv.Txn.ID, txn1.ID) {
+					t.Errorf("expected intent on %q to be written by txn1; got %+v", kv.Key, kv.Txn)
+				}
+				s = append(s, fmt.Sprintf("i%d", kv.Intent.Value.Timestamp.WallTime))
+			}
+			for _, v := range kv.Versions {
+				if v.Deleted {
+					s = append(s, fmt.Sprintf("%dd", v.Value.Timestamp.WallTime))
+				} else {
+					s = append(s, strconv.FormatInt(v.Value.Timestamp.WallTime, 10))
+				}
+			}
+			m[string(kv.Key)] = s
+		}
+		return m
+	}
+
+	k1, k2, k3 := string(testKey1), string(testKey2), string(testKey3)
+	testCases := []struct {
+		max         int64
+		ts, floor   proto.Timestamp
+		maxVersions int
+		expected    map[string][]string
+	}{
+		// Keys with fewer and more versions than the limit.
+		{0, makeTS(5, 0), proto.ZeroTimestamp, 3, map[string][]string{
+			k1: {"5", "4", "3"}, k2: {"2"}, k3: {"i4", "3d", "1"},
+		}},
+		// Versions above the read timestamp are skipped and don't count
+		// towards the limit; so is an intent above it.
+		{0, makeTS(3, 0), proto.ZeroTimestamp, 2, map[string][]string{
+			k1: {"3", "2"}, k2: {"2"}, k3: {"3d", "1"},
+		}},
+		// The floor excludes versions at or below it.
+		{0, makeTS(5, 0), makeTS(2, 0), 0, map[string][]string{
+			k1: {"5", "4", "3"}, k3: {"i4", "3d"},
+		}},
+		// The number of keys is limited by max.
+		{2, makeTS(5, 0), proto.ZeroTimestamp, 1, map[string][]string{
+			k1: {"5"}, k2: {"2"},
+		}},
+	}
+	for i, test := range testCases {
+		res, err := MVCCScanVersions(engine, testKey1, testKey4.Next(), test.max, test.ts, test.floor, test.maxVersions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := versions(res); !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("%d: expected %v; got %v", i, test.expected, actual)
+		}
+	}
+}
+
+// TestMVCCIterateRunningSum uses MVCCIterate to sum integer values
+// until a limit is reached and verifies that the keys visited, the
+// early stop and the reported write intents agree with MVCCScan.
+func TestMVCCIterateRunningSum(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	engine := createTestEngine()
+	defer engine.Close()
+
+	keyAt := func(i int) proto.Key {
+		return proto.Key(fmt.Sprintf("key%02d", i))
+	}
+	for i := 0; i < 10; i++ {
+		v := int64(i)
+		if err := MVCCPut(engine, nil, keyAt(i), makeTS(1, 0), proto.Value{Integer: &v}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Delete key 2 and write an intent on key 5; neither may be visited.
+	if err := MVCCDelete(engine, nil, keyAt(2), makeTS(2, 0), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := MVCCPut(engine, nil, keyAt(5), makeTS(2, 0), value1, txn1); err != nil {
+		t.Fatal(err)
+	}
+
+	const limit = 20
+	ts := makeTS(3, 0)
+	kvs, scanErr := MVCCScan(engine, keyAt(0), keyAt(10), 0, ts, false, nil)
+	if _, ok := scanErr.(*proto.WriteIntentError); !ok {
+		t.Fatalf("expected write intent error from scan; got %v", scanErr)
+	}
+	var expKeys []proto.Key
+	var expSum int64
+	for _, kv := range kvs {
+		expKeys = append(expKeys, kv.Key)
+		if expSum += kv.Value.GetInteger(); expSum >= limit {
+			break
+		}
+	}
+
+	var keys []proto.Key
+	var sum int64
+	err := MVCCIterate(engine, keyAt(0), keyAt(10), ts, false, nil, func(kv proto.KeyValue) (bool, error) {
+		keys = append(keys, kv.Key)
+		sum += kv.Value.GetInteger()
+		return sum >= limit, nil
+	})
+	if !reflect.DeepEqual(err, scanErr) {
+		t.Errorf("expected error %v; got %v", scanErr, err)
+	}
+	if sum != expSum || !reflect.DeepEqual(keys, expKeys) {
+		t.Errorf("expected sum %d over %s; got %d over %s", expSum, expKeys, sum, keys)
+	}
+	if len(keys) == len(kvs) {
+		t.Errorf("expected iteration to stop early; visited all %d keys", len(keys))
+	}
+
+	// An error returned from f stops the iteration and is propagated.
+	fErr := util.Errorf("stop")
+	visited := 0
+	if err := MVCCIterate(engine, keyAt(0), keyAt(10), ts, false, nil, func(kv proto.KeyValue) (bool, error) {
+		visited++
+		return false, fErr
+	}); err != fErr {
+		t.Errorf("expected error %v; got %v", fErr, err)
+	}
+	if visited != 1 {
+		t.Errorf("expected iteration to stop after 1 key; visited %d", visited)
+	}
+}
+
+func TestMVCCScanInTxn(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	engine := createTestEngine()
+	defer engine.Close()
+
+	err := MVCCPut(engine, nil, testKey1, makeTS(1, 0), value1, nil)
+	err = MVCCPut(engine, nil, testKey2, makeTS(1, 0), value2, nil)
+	err = MVCCPut(engine, nil, testKey3, makeTS(1, 0), value3, txn1)
+	err = MVCCPut(engine, nil, testKey4, makeTS(1, 0), value4, nil)
+
+	kvs, err := MVCCScan(engine, testKey2, testKey4, 0, makeTS(1, 0), true, txn1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kvs) != 2 ||
+		!bytes.Equal(kvs[0].Key, testKey2) ||
+		!bytes.Equal(kvs[1].Key, testKey3) ||
+		!bytes.Equal(kvs[0].Value.Bytes, value2.Bytes) ||
+		!bytes.Equal(kvs[1].Value.Bytes, value3.Bytes) {
+		t.Fatal("the value should not be empty")
+	}
+
+	kvs, err = MVCCScan(engine, testKey2, testKey4, 0, makeTS(1, 0), true, nil)
+	if err == nil {
+		t.Fatal("expected error on uncommitted write intent")
+	}
+}
+
+// TestMVCCScanInconsistent writes several values, some as intents and
+// verifies that the scan sees only the committed versions.
+func TestMVCCScanInconsistent(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	engine := createTestEngine()
+	defer engine.Close()
+
+	// A scan with consistent=false should fail in a txn.
+	if _, err := MVCCScan(engine, proto.KeyMin, proto.KeyMax, 0, makeTS(1, 0), false, txn1); err == nil {
+		t.Error("expected an error scanning with consistent=false in txn")
+	}
+
+	ts1 := makeTS(1, 0)
+	ts2 := makeTS(2, 0)
+	ts3 := makeTS(3, 0)
+	ts4 := makeTS(4, 0)
+	ts5 := makeTS(5, 0)
+	ts6 := makeTS(6, 0)
+	if err := MVCCPut(engine, nil, testKey1, ts1, value1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := MVCCPut(engine, nil, testKey1, ts2, value2, txn1); err != nil {
+		t.Fatal(err)
+	}
+	if err := MVCCPut(engine, nil, testKey2, ts3, value1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := MVCCPut(engine, nil, testKey2, ts4, value2, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := MVCCPut(engine, nil, testKey3, ts5, value3, txn2); err != nil {
+		t.Fatal(err)
+	}
+	if err := MVCCPut(engine, nil, testKey4, ts6, value4, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	expIntents := []proto.WriteIntentError_Intent{
+		{Key: testKey1, Txn: *txn1},
+		{Key: testKey3, Txn: *txn2},
+	}
+	kvs, err := MVCCScan(engine, testKey1, testKey4.Next(), 0, makeTS(7, 0), false, nil)
+	if wiErr, ok := err.(*proto.WriteIntentError); !ok || !reflect.DeepEqual(wiErr.Intents, expIntents) {
+		t.Fatal(err)
+	}
+
+	expKVs := []proto.KeyValue{
+		{Key: testKey1, Value: proto.Value{Bytes: value1.Bytes, Timestamp: &ts1}},
+		{Key: testKey2, Value: proto.Value{Bytes: value2.Bytes, Timestamp: &ts4}},
+		{Key: testKey4, Value: proto.Value{Bytes: value4.Bytes, Timestamp: &ts6}},
+	}
+	if !reflect.DeepEqual(kvs, expKVs) {
+		t.Errorf("expected key values equal %v != %v", kvs, expKVs)
+	}
+
+	// Now try a scan at a historical timestamp.
+	expIntents = expIntents[:1]
+	kvs, err = MVCCScan(engine, testKey1, testKey4.Next(), 0, makeTS(3, 0), false, nil)
+	if wiErr, ok := err.(*proto.WriteIntentError); !ok || !reflect.DeepEqual(wiErr.Intents, expIntents) {
+		t.Fatal(err)
+	}
+	expKVs = []proto.KeyValue{
+		{Key: testKey1, Value: proto.Value{Bytes: value1.Bytes, Timestamp: &ts1}},
+		{Key: testKey2, Value: proto.Value{Bytes: value1.Bytes, Timestamp: &ts3}},
+	}
+	if !reflect.DeepEqual(kvs, expKVs) {
+		t.Errorf("expected key values equal %v != %v", kvs, expKVs)
+	}
+}
+
+// TestMVCCScanWithStaleness verifies that a bounded-staleness scan reads
+// just below a recent intent when the staleness bound allows it and
+// fails with a WriteIntentError otherwise.
+func TestMVCCScanWithStaleness(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	engine := createTestEngine()
+	defer engine.Close()
+
+	ts1 := makeTS(1, 0)
+	ts2 := makeTS(2, 0)
+	if err := MVCCPut(engine, nil, testKey1, ts1, value1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := MVCCPut(engine, nil, testKey2, ts2, value2, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without intents, the scan reads at the current time.
+	now := makeTS(10, 0)
+	kvs, readTS, err := MVCCScanWithStaleness(engine, testKey1, testKey4, 0, now, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !readTS.Equal(now) || len(kvs) != 2 {
+		t.Errorf("expected 2 values read at %s; got %d at %s", now, len(kvs), readTS)
+	}
+
+	// A recent intent pushes the read timestamp just below it.
+	ts7 := makeTS(7, 0)
+	if err := MVCCPut(engine, nil, testKey1, ts7, value3, txn1); err != nil {
+		t.Fatal(err)
+	}
+	kvs, readTS, err = MVCCScanWithStaleness(engine, testKey1, testKey4, 0, now, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expTS := ts7.Prev(); !readTS.Equal(expTS) {
+		t.Errorf("expected read at %s; got %s", expTS, readTS)
+	}
+	expKVs := []proto.KeyValue{
+		{Key: testKey1, Value: proto.Value{Bytes: value1.Bytes, Timestamp: &ts1}},
+		{Key: testKey2, Value: proto.Value{Bytes: value2.Bytes, Timestamp: &ts2}},
+	}
+	if !reflect.DeepEqual(kvs, expKVs) {
+		t.Errorf("expected key values equal %v != %v", kvs, expKVs)
+	}
+
+	// If the intent is older than the staleness bound allows, the scan
+	// can't avoid it.
+	expIntents := []proto.WriteIntentError_Intent{{Key: testKey1, Txn: *txn1}}
+	_, _, err = MVCCScanWithStaleness(engine, testKey1, testKey4, 0, now, 2)
+	if wiErr, ok := err.(*proto.WriteIntentError); !ok || !reflect.DeepEqual(wiErr.Intents, expIntents) {
+		t.Errorf("expected write intent error for %+v; got %v", expIntents, err)
+	}
+}
+
+// TestMVCCScanKeysOnly verifies that MVCCScanKeysOnly returns the
+// same keys as MVCCScan for keys with multiple versions, tombstones
+// and intents.
+func TestMVCCScanKeysOnly(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	engine := createTestEngine()
+	defer engine.Close()
+
+	// testKey1 has two versions, testKey2 was deleted at time 3,
+	// testKey3 was written at time 2 and testKey4 has an intent at
+	// time 3.
+	if err := MVCCPut(engine, nil, testKey1, makeTS(1, 0), value1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := MVCCPut(engine, nil, testKey1, makeTS(3, 0), value2, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := MVCCPut(engine, nil, testKey2, makeTS(1, 0), value1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := MVCCDelete(engine, nil, testKey2, makeTS(3, 0), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := MVCCPut(engine, nil, testKey3, makeTS(2, 0), value3, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := MVCCPut(engine, nil, testKey4, makeTS(3, 0), value1, txn1); err != nil {
+		t.Fatal(err)
+	}
+
+	endKey := testKey4.Next()
+	testCases := []struct {
+		timestamp proto.Timestamp
+		max       int64
+		txn       *proto.Transaction
+	}{
+		{makeTS(1, 0), 0, nil},
+		{makeTS(2, 0), 0, nil},
+		{makeTS(2, 0), 1, nil},
+		{makeTS(4, 0), 0, txn1},
+		{makeTS(4, 0), 2, txn1},
+	}
+	for i, test := range testCases {
+		kvs, err := MVCCScan(engine, testKey1, endKey, test.max, test.timestamp, true, test.txn)
+		if err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+		expKeys := []proto.Key{}
+		for _, kv := range kvs {
+			expKeys = append(expKeys, kv.Key)
+		}
+		keys, err := MVCCScanKeysOnly(engine, testKey1, endKey, test.max, test.timestamp, test.txn)
+		if err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+		if !reflect.DeepEqual(keys, expKeys) {
+			t.Errorf("%d: expected keys %v; got %v", i, expKeys, keys)
+		}
+	}
+
+	// Outside of the intent's transaction, the intent is reported.
+	if _, err := MVCCScanKeysOnly(engine, testKey1, endKey, 0, makeTS(4, 0), nil); err == nil {
+		t.Fatal("expected write intent error")
+	} else if _, ok := err.(*proto.WriteIntentError); !ok {
+		t.Fatalf("expected write intent error; got %s", err)
+	}
+}
+
+// TestIteratorStats verifies that iterating over a mix of live,
+// deleted, overwritten and inline keys counts each kind of entry
+// once stats are enabled on the iterator.
+func TestIteratorStats(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	engine := createTestEngine()
+	defer engine.Close()
+
+	// testKey1 has a single live version.
+	if err := MVCCPut(engine, nil, testKey1, makeTS(1, 0), value1, nil); err != nil {
+		t.Fatal(err)
+	}
+	// testKey2 has three versions.
+	for i, v := range []proto.Value{value1, value2, value3} {
+		if err := MVCCPut(engine, nil, testKey2, makeTS(int64(i+1), 0), v, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// testKey3 was deleted.
+	if err := MVCCPut(engine, nil, testKey3, makeTS(1, 0), value1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := MVCCDelete(engine, nil, testKey3, makeTS(2, 0), nil); err != nil {
+		t.Fatal(err)
+	}
+	// testKey4 is inline.
+	if err := MVCCPut(engine, nil, testKey4, proto.ZeroTimestamp, value1, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Stats are only collected by iterators which enable them.
+	for _, enable := range []bool{false, true} {
+		iter := engine.NewIterator()
+		if enable {
+			iter.EnableStats()
+		}
+		for iter.Seek(MVCCEncodeKey(proto.KeyMin)); iter.Valid(); iter.Next() {
+		}
+		if err := iter.Error(); err != nil {
+			t.Fatal(err)
+		}
+		var expStats IteratorStats
+		if enable {
+			expStats = IteratorStats{KeysSeen: 4, TombstonesSkipped: 1, VersionsSkipped: 3}
+		}
+		if stats := iter.Stats(); stats != expStats {
+			t.Errorf("enabled=%t: expected %+v; got %+v", enable, expStats, stats)
+		}
+		iter.Close()
+	}
+}
+
+func TestMVCCDeleteRange(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	engine := createTestEngine()
+	defer engine.Close()
+
+	err := MVCCPut(engine, nil, testKey1, makeTS(1, 0), value1, nil)
+	err = MVCCPut(engine, nil, testKey2, makeTS(1, 0), value2, nil)
+	err = MVCCPut(engine, nil, testKey3, makeTS(1, 0), value3, nil)
+	err = MVCCPut(engine, nil, testKey4, makeTS(1, 0), value4, nil)
+
+	num, _, _, err := MVCCDeleteRange(engine, nil, testKey2, testKey4, 0, makeTS(2, 0), nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if num != 2 {
+		t.Fatal("the value should not be empty")
+	}
+	kvs, _ := MVCCScan(engine, proto.KeyMin, proto.KeyMax, 0, makeTS(2, 0), true, nil)
+	if len(kvs) != 2 ||
+		!bytes.Equal(kvs[0].Key, testKey1) ||
+		!bytes.Equal(kvs[1].Key, testKey4) ||
+		!bytes.Equal(kvs[0].Value.Bytes, value1.Bytes) ||
+		!bytes.Equal(kvs[1].Value.Bytes, value4.Bytes) {
+		t.Fatal("the value should not be empty")
+	}
+
+	num, _, _, err = MVCCDeleteRange(engine, nil, testKey4, proto.KeyMax, 0, makeTS(2, 0), nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if num != 1 {
+		t.Fatal("the value should not be empty")
+	}
+	kvs, _ = MVCCScan(engine, proto.KeyMin, proto.KeyMax, 0, makeTS(2, 0), true, nil)
+	if len(kvs) != 1 ||
+		!bytes.Equal(kvs[0].Key, testKey1) ||
+		!bytes.Equal(kvs[0].Value.Bytes, value1.Bytes) {
 		t.Fatal("the value should not be empty")
 	}
 
-	num, err = MVCCDeleteRange(engine, nil, proto.KeyMin, testKey2, 0, makeTS(2, 0), nil)
+	num, _, _, err = MVCCDeleteRange(engine, nil, proto.KeyMin, testKey2, 0, makeTS(2, 0), nil, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -954,6 +1859,137 @@ func TestMVCCDeleteRange(t *testing.T) {
 	}
 }
 
+// TestMVCCDeleteRangeReturnKeys verifies that MVCCDeleteRange returns
+// exactly the keys it deleted when requested, and that each of them
+// has a deletion tombstone at the delete timestamp.
+func TestMVCCDeleteRangeReturnKeys(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	engine := createTestEngine()
+	defer engine.Close()
+
+	for _, key := range []proto.Key{testKey1, testKey2, testKey3, testKey4} {
+		if err := MVCCPut(engine, nil, key, makeTS(1, 0), value1, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// testKey3 is already deleted and must not be reported again.
+	if err := MVCCDelete(engine, nil, testKey3, makeTS(1, 1), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	num, _, deleted, err := MVCCDeleteRange(engine, nil, testKey1, testKey4, 0, makeTS(2, 0), nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expKeys := []proto.Key{testKey1, testKey2}
+	if num != int64(len(expKeys)) || !reflect.DeepEqual(deleted, expKeys) {
+		t.Errorf("expected %d deleted keys %s; got %d %s", len(expKeys), expKeys, num, deleted)
+	}
+	for _, key := range expKeys {
+		val := proto.MVCCValue{}
+		ok, _, _, err := engine.GetProto(MVCCEncodeVersionKey(key, makeTS(2, 0)), &val)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok || !val.Deleted {
+			t.Errorf("expected tombstone for key %q at %s; got %+v", key, makeTS(2, 0), val)
+		}
+	}
+	if value, err := MVCCGet(engine, testKey4, makeTS(2, 0), true, nil); err != nil || value == nil {
+		t.Errorf("expected %q to be unaffected; got %v, %v", testKey4, value, err)
+	}
+
+	// Without returnKeys, no keys are returned.
+	num, _, deleted, err = MVCCDeleteRange(engine, nil, testKey4, proto.KeyMax, 0, makeTS(3, 0), nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if num != 1 || deleted != nil {
+		t.Errorf("expected 1 key deleted and no keys returned; got %d %s", num, deleted)
+	}
+}
+
+// TestMVCCDeleteRangeResume deletes a 1000-key span in batches of
+// 100 keys and verifies that it takes ten calls, each returning the
+// first key not yet deleted as the resume key.
+func TestMVCCDeleteRangeResume(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	engine := createTestEngine()
+	defer engine.Close()
+
+	const numKeys, maxKeys = 1000, 100
+	keyAt := func(i int) proto.Key {
+		return proto.Key(fmt.Sprintf("key%04d", i))
+	}
+	for i := 0; i < numKeys; i++ {
+		if err := MVCCPut(engine, nil, keyAt(i), makeTS(1, 0), value1, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	key, calls := keyAt(0), 0
+	for key != nil {
+		num, resumeKey, _, err := MVCCDeleteRange(engine, nil, key, proto.KeyMax, maxKeys, makeTS(2, 0), nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		calls++
+		if num != maxKeys {
+			t.Errorf("call %d: expected %d keys deleted; got %d", calls, maxKeys, num)
+		}
+		var expResumeKey proto.Key
+		if calls < numKeys/maxKeys {
+			expResumeKey = keyAt(calls * maxKeys)
+		}
+		if !resumeKey.Equal(expResumeKey) {
+			t.Errorf("call %d: expected resume key %q; got %q", calls, expResumeKey, resumeKey)
+		}
+		key = resumeKey
+	}
+	if calls != numKeys/maxKeys {
+		t.Errorf("expected %d calls; got %d", numKeys/maxKeys, calls)
+	}
+	kvs, err := MVCCScan(engine, proto.KeyMin, proto.KeyMax, 0, makeTS(2, 0), true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kvs) != 0 {
+		t.Errorf("expected all keys deleted; %d remain", len(kvs))
+	}
+}
+
+// TestMVCCDeleteRangeResumeIntent verifies that a write intent past
+// the last key deleted by a bounded MVCCDeleteRange doesn't fail the
+// call and that the resume key stops at the intent, so that the next
+// call encounters it.
+func TestMVCCDeleteRangeResumeIntent(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	engine := createTestEngine()
+	defer engine.Close()
+
+	for _, k := range []proto.Key{testKey1, testKey2, testKey4} {
+		if err := MVCCPut(engine, nil, k, makeTS(1, 0), value1, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := MVCCPut(engine, nil, testKey3, makeTS(1, 0), value3, txn1); err != nil {
+		t.Fatal(err)
+	}
+
+	num, resumeKey, _, err := MVCCDeleteRange(engine, nil, testKey1, proto.KeyMax, 2, makeTS(2, 0), nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if num != 2 || !resumeKey.Equal(testKey3) {
+		t.Errorf("expected 2 keys deleted and resume key %q; got %d, %q", testKey3, num, resumeKey)
+	}
+
+	_, _, _, err = MVCCDeleteRange(engine, nil, resumeKey, proto.KeyMax, 2, makeTS(2, 0), nil, false)
+	if wiErr, ok := err.(*proto.WriteIntentError); !ok || len(wiErr.Intents) != 1 || !wiErr.Intents[0].Key.Equal(testKey3) {
+		t.Errorf("expected write intent error on %q; got %v", testKey3, err)
+	}
+}
+
 func TestMVCCDeleteRangeFailed(t *testing.T) {
 	defer leaktest.AfterTest(t)
 	engine := createTestEngine()
@@ -964,12 +2000,12 @@ func TestMVCCDeleteRangeFailed(t *testing.T) {
 	err = MVCCPut(engine, nil, testKey3, makeTS(1, 0), value3, txn1)
 	err = MVCCPut(engine, nil, testKey4, makeTS(1, 0), value4, nil)
 
-	_, err = MVCCDeleteRange(engine, nil, testKey2, testKey4, 0, makeTS(1, 0), nil)
+	_, _, _, err = MVCCDeleteRange(engine, nil, testKey2, testKey4, 0, makeTS(1, 0), nil, false)
 	if err == nil {
 		t.Fatal("expected error on uncommitted write intent")
 	}
 
-	_, err = MVCCDeleteRange(engine, nil, testKey2, testKey4, 0, makeTS(1, 0), txn1)
+	_, _, _, err = MVCCDeleteRange(engine, nil, testKey2, testKey4, 0, makeTS(1, 0), txn1, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -985,7 +2021,7 @@ func TestMVCCDeleteRangeConcurrentTxn(t *testing.T) {
 	err = MVCCPut(engine, nil, testKey3, makeTS(2, 0), value3, txn2)
 	err = MVCCPut(engine, nil, testKey4, makeTS(1, 0), value4, nil)
 
-	_, err = MVCCDeleteRange(engine, nil, testKey2, testKey4, 0, makeTS(1, 0), txn1)
+	_, _, _, err = MVCCDeleteRange(engine, nil, testKey2, testKey4, 0, makeTS(1, 0), txn1, false)
 	if err == nil {
 		t.Fatal("expected error on uncommitted write intent")
 	}
@@ -1077,6 +2113,123 @@ func TestMVCCConditionalPut(t *testing.T) {
 	}
 }
 
+// TestMVCCConditionalPutExpectedValue verifies all combinations of
+// expected and actual value presence, and that a deletion tombstone
+// is treated as a missing value.
+func TestMVCCConditionalPutExpectedValue(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	engine := createTestEngine()
+	defer engine.Close()
+
+	// testKey1 has a value, testKey2 was never written and testKey3
+	// has been deleted.
+	if err := MVCCPut(engine, nil, testKey1, makeTS(1, 0), value1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := MVCCPut(engine, nil, testKey3, makeTS(1, 0), value1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := MVCCDelete(engine, nil, testKey3, makeTS(2, 0), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		key       proto.Key
+		expValue  *proto.Value
+		expErr    bool
+		expActual *proto.Value
+	}{
+		// Expect missing, actual missing.
+		{testKey2, nil, false, nil},
+		{testKey3, nil, false, nil},
+		// Expect missing, actual present.
+		{testKey1, nil, true, &value1},
+		// Expect present, actual missing.
+		{testKey2, &value1, true, nil},
+		{testKey3, &value1, true, nil},
+		// Expect present, actual present.
+		{testKey1, &value2, true, &value1},
+		{testKey1, &value1, false, nil},
+	}
+	for i, test := range testCases {
+		// Apply each conditional put to a batch which is never
+		// committed so that cases don't interfere.
+		batch := engine.NewBatch()
+		err := MVCCConditionalPut(batch, nil, test.key, makeTS(3, 0), value3, test.expValue, nil)
+		batch.Close()
+		if !test.expErr {
+			if err != nil {
+				t.Errorf("%d: unexpected error: %s", i, err)
+			}
+			continue
+		}
+		cErr, ok := err.(*proto.ConditionFailedError)
+		if !ok {
+			t.Errorf("%d: expected condition failed error; got %v", i, err)
+			continue
+		}
+		if test.expActual == nil {
+			if cErr.ActualValue != nil {
+				t.Errorf("%d: expected no actual value; got %+v", i, cErr.ActualValue)
+			}
+		} else if cErr.ActualValue == nil || !bytes.Equal(cErr.ActualValue.Bytes, test.expActual.Bytes) {
+			t.Errorf("%d: expected actual value %+v; got %+v", i, test.expActual, cErr.ActualValue)
+		}
+	}
+}
+
+// TestMVCCConditionalPutIntents verifies that a conditional put
+// within a transaction writes an intent with the same stats as a
+// plain put, that the transaction sees its own intent when checking
+// the condition, and that other writers encounter the intent.
+func TestMVCCConditionalPutIntents(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	engine := createTestEngine()
+	defer engine.Close()
+	putEngine := createTestEngine()
+	defer putEngine.Close()
+
+	ts := makeTS(1, 0)
+	txn := makeTxn(txn1, ts)
+	cpMS, putMS := proto.MVCCStats{}, proto.MVCCStats{}
+	if err := MVCCConditionalPut(engine, &cpMS, testKey1, ts, value1, nil, txn); err != nil {
+		t.Fatal(err)
+	}
+	if err := MVCCPut(putEngine, &putMS, testKey1, ts, value1, txn); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cpMS, putMS) {
+		t.Errorf("expected conditional put stats %+v to equal put stats %+v", cpMS, putMS)
+	}
+	if cpMS.IntentCount != 1 {
+		t.Errorf("expected 1 intent; got %d", cpMS.IntentCount)
+	}
+
+	// The writing transaction sees its own intent.
+	if err := MVCCConditionalPut(engine, &cpMS, testKey1, ts, value2, &value1, txn); err != nil {
+		t.Fatal(err)
+	}
+	// Others encounter the intent, regardless of their expectation.
+	for _, otherTxn := range []*proto.Transaction{nil, makeTxn(txn2, ts)} {
+		err := MVCCConditionalPut(engine, nil, testKey1, makeTS(2, 0), value3, &value2, otherTxn)
+		if _, ok := err.(*proto.WriteIntentError); !ok {
+			t.Errorf("expected write intent error for txn %v; got %v", otherTxn, err)
+		}
+	}
+
+	// Integer values are compared by value.
+	if err := MVCCConditionalPut(engine, nil, testKey2, ts, proto.Value{Integer: gogoproto.Int64(1)}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	err := MVCCConditionalPut(engine, nil, testKey2, makeTS(2, 0), value1, &proto.Value{Integer: gogoproto.Int64(2)}, nil)
+	if cErr, ok := err.(*proto.ConditionFailedError); !ok || cErr.ActualValue.GetInteger() != 1 {
+		t.Errorf("expected condition failed error with actual value 1; got %v", err)
+	}
+	if err := MVCCConditionalPut(engine, nil, testKey2, makeTS(2, 0), value1, &proto.Value{Integer: gogoproto.Int64(1)}, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestMVCCResolveTxn(t *testing.T) {
 	defer leaktest.AfterTest(t)
 	engine := createTestEngine()
@@ -1090,7 +2243,7 @@ func TestMVCCResolveTxn(t *testing.T) {
 	}
 
 	// Resolve will write with txn1's timestamp which is 0,1.
-	err = MVCCResolveWriteIntent(engine, nil, testKey1, makeTS(0, 1), txn1Commit)
+	_, err = MVCCResolveWriteIntent(engine, nil, testKey1, makeTS(0, 1), txn1Commit, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1108,7 +2261,7 @@ func TestMVCCAbortTxn(t *testing.T) {
 	defer engine.Close()
 
 	err := MVCCPut(engine, nil, testKey1, makeTS(0, 1), value1, txn1)
-	err = MVCCResolveWriteIntent(engine, nil, testKey1, makeTS(0, 1), txn1Abort)
+	_, err = MVCCResolveWriteIntent(engine, nil, testKey1, makeTS(0, 1), txn1Abort, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1137,7 +2290,7 @@ func TestMVCCAbortTxnWithPreviousVersion(t *testing.T) {
 	err := MVCCPut(engine, nil, testKey1, makeTS(0, 1), value1, nil)
 	err = MVCCPut(engine, nil, testKey1, makeTS(1, 0), value2, nil)
 	err = MVCCPut(engine, nil, testKey1, makeTS(2, 0), value3, txn1)
-	err = MVCCResolveWriteIntent(engine, nil, testKey1, makeTS(2, 0), txn1Abort)
+	_, err = MVCCResolveWriteIntent(engine, nil, testKey1, makeTS(2, 0), txn1Abort, false)
 	if err := engine.Commit(); err != nil {
 		t.Fatal(err)
 	}
@@ -1189,7 +2342,7 @@ func TestMVCCWriteWithDiffTimestampsAndEpochs(t *testing.T) {
 		t.Fatal(err)
 	}
 	// Resolve the intent.
-	if err := MVCCResolveWriteIntent(engine, nil, testKey1, makeTS(1, 0), makeTxn(txn1e2Commit, makeTS(1, 0))); err != nil {
+	if _, err := MVCCResolveWriteIntent(engine, nil, testKey1, makeTS(1, 0), makeTxn(txn1e2Commit, makeTS(1, 0)), false); err != nil {
 		t.Fatal(err)
 	}
 	// Now try writing an earlier intent--should get write too old error.
@@ -1276,7 +2429,7 @@ func TestMVCCReadWithPushedTimestamp(t *testing.T) {
 		t.Fatal(err)
 	}
 	// Resolve the intent, pushing its timestamp forward.
-	if err := MVCCResolveWriteIntent(engine, nil, testKey1, makeTS(0, 1), makeTxn(txn1, makeTS(1, 0))); err != nil {
+	if _, err := MVCCResolveWriteIntent(engine, nil, testKey1, makeTS(0, 1), makeTxn(txn1, makeTS(1, 0)), false); err != nil {
 		t.Fatal(err)
 	}
 	// Attempt to read using naive txn's previous timestamp.
@@ -1293,7 +2446,7 @@ func TestMVCCResolveWithDiffEpochs(t *testing.T) {
 
 	err := MVCCPut(engine, nil, testKey1, makeTS(0, 1), value1, txn1)
 	err = MVCCPut(engine, nil, testKey2, makeTS(0, 1), value2, txn1e2)
-	num, err := MVCCResolveWriteIntentRange(engine, nil, testKey1, testKey2.Next(), 2, makeTS(0, 1), txn1e2Commit)
+	num, _, err := MVCCResolveWriteIntentRange(engine, nil, testKey1, testKey2.Next(), 2, makeTS(0, 1), txn1e2Commit)
 	if num != 2 {
 		t.Errorf("expected 2 rows resolved; got %d", num)
 	}
@@ -1333,7 +2486,7 @@ func TestMVCCResolveWithUpdatedTimestamp(t *testing.T) {
 
 	// Resolve with a higher commit timestamp -- this should rewrite the
 	// intent when making it permanent.
-	if err = MVCCResolveWriteIntent(engine, nil, testKey1, makeTS(1, 0), makeTxn(txn1Commit, makeTS(1, 0))); err != nil {
+	if _, err = MVCCResolveWriteIntent(engine, nil, testKey1, makeTS(1, 0), makeTxn(txn1Commit, makeTS(1, 0)), false); err != nil {
 		t.Fatal(err)
 	}
 
@@ -1373,7 +2526,7 @@ func TestMVCCResolveWithPushedTimestamp(t *testing.T) {
 
 	// Resolve with a higher commit timestamp, but with still-pending transaction.
 	// This represents a straightforward push (i.e. from a read/write conflict).
-	if err = MVCCResolveWriteIntent(engine, nil, testKey1, makeTS(1, 0), makeTxn(txn1, makeTS(1, 0))); err != nil {
+	if _, err = MVCCResolveWriteIntent(engine, nil, testKey1, makeTS(1, 0), makeTxn(txn1, makeTS(1, 0)), false); err != nil {
 		t.Fatal(err)
 	}
 
@@ -1401,22 +2554,226 @@ func TestMVCCResolveTxnNoOps(t *testing.T) {
 	defer engine.Close()
 
 	// Resolve a non existent key; noop.
-	err := MVCCResolveWriteIntent(engine, nil, testKey1, makeTS(0, 1), txn1Commit)
+	_, err := MVCCResolveWriteIntent(engine, nil, testKey1, makeTS(0, 1), txn1Commit, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Add key and resolve despite there being no intent.
+	err = MVCCPut(engine, nil, testKey1, makeTS(0, 1), value1, nil)
+	_, err = MVCCResolveWriteIntent(engine, nil, testKey1, makeTS(0, 1), txn2Commit, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Write intent and resolve with different txn.
+	err = MVCCPut(engine, nil, testKey1, makeTS(1, 0), value2, txn1)
+	_, err = MVCCResolveWriteIntent(engine, nil, testKey1, makeTS(1, 0), txn2Commit, false)
 	if err != nil {
 		t.Fatal(err)
 	}
+}
+
+// TestMVCCResolveDryRun verifies that a dry-run resolve writes
+// nothing and reports the same action and resulting value as a real
+// resolve of the same intent.
+func TestMVCCResolveDryRun(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	ts1 := makeTS(1, 0)
+	ts2 := makeTS(2, 0)
+	ts3 := makeTS(3, 0)
+
+	testCases := []struct {
+		prevValue bool // write a committed value below the intent?
+		txn       *proto.Transaction
+		expAction MVCCResolveAction
+	}{
+		{false, makeTxn(txn1Commit, ts2), MVCCResolveCommit},
+		{true, makeTxn(txn1Commit, ts3), MVCCResolveCommit},
+		{false, makeTxn(txn1, ts3), MVCCResolvePush},
+		{true, makeTxn(txn1Abort, ts2), MVCCResolveAbort},
+		{false, makeTxn(txn1Abort, ts2), MVCCResolveAbort},
+		{true, makeTxn(txn2Commit, ts2), MVCCResolveNoop},
+	}
+	for i, test := range testCases {
+		engine := createTestEngine()
+		if test.prevValue {
+			if err := MVCCPut(engine, nil, testKey1, ts1, value1, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := MVCCPut(engine, nil, testKey1, ts2, value2, makeTxn(txn1, ts2)); err != nil {
+			t.Fatal(err)
+		}
+		before, err := Scan(engine, MVCCEncodeKey(proto.KeyMin), MVCCEncodeKey(proto.KeyMax), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ms := &proto.MVCCStats{}
+		dry, err := MVCCResolveWriteIntent(engine, ms, testKey1, ts3, test.txn, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		after, err := Scan(engine, MVCCEncodeKey(proto.KeyMin), MVCCEncodeKey(proto.KeyMax), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(before, after) {
+			t.Errorf("%d: dry run modified the engine", i)
+		}
+		if !reflect.DeepEqual(ms, &proto.MVCCStats{}) {
+			t.Errorf("%d: dry run modified stats: %+v", i, ms)
+		}
+		if dry.Action != test.expAction {
+			t.Errorf("%d: expected action %s; got %s", i, test.expAction, dry.Action)
+		}
+
+		res, err := MVCCResolveWriteIntent(engine, nil, testKey1, ts3, test.txn, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Action != dry.Action {
+			t.Errorf("%d: expected action %s to match dry run %s", i, res.Action, dry.Action)
+		}
+		if dry.Action == MVCCResolveNoop {
+			engine.Close()
+			continue
+		}
+		// Read back the latest version, reading the intent as its
+		// owner if it was kept.
+		readTxn := test.txn
+		if test.txn.Status != proto.PENDING {
+			readTxn = nil
+		}
+		value, err := MVCCGet(engine, testKey1, makeTS(4, 0), true, readTxn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(value, dry.Value) {
+			t.Errorf("%d: expected dry run value %+v to match %+v", i, dry.Value, value)
+		}
+		engine.Close()
+	}
+}
+
+// TestMVCCReadOwnIntents verifies that a transaction's gets and scans
+// both observe its own provisional writes, even when reading below the
+// intents' timestamps, while intents of earlier epochs are skipped in
+// favor of committed values visible at the read timestamp.
+func TestMVCCReadOwnIntents(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	engine := createTestEngine()
+	defer engine.Close()
+
+	ts1, ts2, ts3 := makeTS(1, 0), makeTS(2, 0), makeTS(3, 0)
+	if err := MVCCPut(engine, nil, testKey1, ts1, value1, nil); err != nil {
+		t.Fatal(err)
+	}
+	txn := makeTxn(txn1, ts3)
+	if err := MVCCPut(engine, nil, testKey1, ts3, value2, txn); err != nil {
+		t.Fatal(err)
+	}
+	if err := MVCCPut(engine, nil, testKey2, ts3, value3, txn); err != nil {
+		t.Fatal(err)
+	}
+	if err := MVCCPut(engine, nil, testKey3, ts3, value4, makeTxn(txn2, ts3)); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		txn       *proto.Transaction
+		timestamp proto.Timestamp
+		expValues []*proto.Value // for testKey1 and testKey2
+	}{
+		// The txn sees its own writes at and below their timestamp.
+		{txn, ts3, []*proto.Value{&value2, &value3}},
+		{txn, ts2, []*proto.Value{&value2, &value3}},
+		// After a restart, the earlier epoch's intents are skipped.
+		{makeTxn(txn1e2, ts2), ts2, []*proto.Value{&value1, nil}},
+		// ...and committed values above the read timestamp aren't visible.
+		{makeTxn(txn1e2, makeTS(0, 1)), makeTS(0, 1), []*proto.Value{nil, nil}},
+	}
+	for i, test := range testCases {
+		kvs, err := MVCCScan(engine, testKey1, testKey3, 0, test.timestamp, true, test.txn)
+		if err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+		var expKVs []proto.KeyValue
+		for j, key := range []proto.Key{testKey1, testKey2} {
+			value, err := MVCCGet(engine, key, test.timestamp, true, test.txn)
+			if err != nil {
+				t.Fatalf("%d: %s", i, err)
+			}
+			expValue := test.expValues[j]
+			if (value == nil) != (expValue == nil) ||
+				(value != nil && !bytes.Equal(value.Bytes, expValue.Bytes)) {
+				t.Errorf("%d: expected get of %q to return %+v; got %+v", i, key, expValue, value)
+			}
+			if value != nil {
+				expKVs = append(expKVs, proto.KeyValue{Key: key, Value: *value})
+			}
+		}
+		// Scan results must match the individual gets.
+		if len(kvs) != len(expKVs) {
+			t.Errorf("%d: expected scan results %+v; got %+v", i, expKVs, kvs)
+			continue
+		}
+		for j := range kvs {
+			if !kvs[j].Key.Equal(expKVs[j].Key) || !bytes.Equal(kvs[j].Value.Bytes, expKVs[j].Value.Bytes) {
+				t.Errorf("%d: expected scan result %+v; got %+v", i, expKVs[j], kvs[j])
+			}
+		}
+	}
+
+	// Another txn's intent is still reported.
+	if _, err := MVCCScan(engine, testKey1, testKey4, 0, ts3, true, txn); err == nil {
+		t.Error("expected write intent error scanning another txn's intent")
+	} else if _, ok := err.(*proto.WriteIntentError); !ok {
+		t.Errorf("expected write intent error; got %s", err)
+	}
+}
+
+// TestMVCCPutIntentCount verifies that a transaction's intent count
+// is advanced for each intent it lays down, but not when rewriting its
+// own intents or when the write fails.
+func TestMVCCPutIntentCount(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	engine := createTestEngine()
+	defer engine.Close()
+
+	ts := makeTS(1, 0)
+	txn := makeTxn(txn1, ts)
+	for _, key := range []proto.Key{testKey1, testKey2, testKey1} {
+		if err := MVCCPut(engine, nil, key, ts, value1, txn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if txn.GetIntentCount() != 2 {
+		t.Fatalf("expected intent count 2; got %d", txn.GetIntentCount())
+	}
 
-	// Add key and resolve despite there being no intent.
-	err = MVCCPut(engine, nil, testKey1, makeTS(0, 1), value1, nil)
-	err = MVCCResolveWriteIntent(engine, nil, testKey1, makeTS(0, 1), txn2Commit)
-	if err != nil {
-		t.Fatal(err)
+	// The count isn't stored with the intents.
+	meta := &proto.MVCCMetadata{}
+	if ok, _, _, err := engine.GetProto(MVCCEncodeKey(testKey1), meta); !ok || err != nil {
+		t.Fatalf("expected intent metadata for %q; got %t, %v", testKey1, ok, err)
+	}
+	if meta.Txn == nil || meta.Txn.IntentCount != nil {
+		t.Errorf("expected intent without an intent count; got %+v", meta.Txn)
 	}
 
-	// Write intent and resolve with different txn.
-	err = MVCCPut(engine, nil, testKey1, makeTS(1, 0), value2, txn1)
-	err = MVCCResolveWriteIntent(engine, nil, testKey1, makeTS(1, 0), txn2Commit)
-	if err != nil {
+	// A write which fails on another transaction's intent doesn't
+	// count.
+	otherTxn := makeTxn(txn2, ts)
+	if err := MVCCPut(engine, nil, testKey1, ts, value1, otherTxn); err == nil {
+		t.Fatal("expected write intent error")
+	}
+	if otherTxn.GetIntentCount() != 0 {
+		t.Errorf("expected intent count 0; got %d", otherTxn.GetIntentCount())
+	}
+
+	// Non-transactional writes are unaffected.
+	if err := MVCCPut(engine, nil, testKey4, ts, value1, nil); err != nil {
 		t.Fatal(err)
 	}
 }
@@ -1431,10 +2788,13 @@ func TestMVCCResolveTxnRange(t *testing.T) {
 	err = MVCCPut(engine, nil, testKey3, makeTS(0, 1), value3, txn2)
 	err = MVCCPut(engine, nil, testKey4, makeTS(0, 1), value4, txn1)
 
-	num, err := MVCCResolveWriteIntentRange(engine, nil, testKey1, testKey4.Next(), 0, makeTS(0, 1), txn1Commit)
+	num, truncated, err := MVCCResolveWriteIntentRange(engine, nil, testKey1, testKey4.Next(), 0, makeTS(0, 1), txn1Commit)
 	if err != nil {
 		t.Fatal(err)
 	}
+	if truncated {
+		t.Error("expected unbounded resolve to not be truncated")
+	}
 	if num != 4 {
 		t.Fatalf("expected all keys to process for resolution, even though 2 are noops; got %d", num)
 	}
@@ -1464,6 +2824,78 @@ func TestMVCCResolveTxnRange(t *testing.T) {
 	}
 }
 
+// TestMVCCResolveTxnRangeMany verifies that many intents of a txn,
+// interleaved with intents of another txn, are resolved in a single
+// call according to the txn's status, and that a bounded resolve
+// reports truncation.
+func TestMVCCResolveTxnRangeMany(t *testing.T) {
+	defer leaktest.AfterTest(t)
+
+	const numKeys = 200
+	writeIntents := func(engine Engine) {
+		for i := 0; i < numKeys; i++ {
+			key := proto.Key(fmt.Sprintf("key-%03d", i))
+			txn := txn1
+			if i%4 == 0 {
+				txn = txn2
+			}
+			if err := MVCCPut(engine, nil, key, makeTS(0, 1), value1, txn); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for _, resolveTxn := range []*proto.Transaction{txn1Commit, txn1Abort} {
+		engine := createTestEngine()
+		writeIntents(engine)
+		num, truncated, err := MVCCResolveWriteIntentRange(engine, nil, proto.KeyMin, proto.KeyMax, 0, makeTS(0, 1), resolveTxn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if num != numKeys || truncated {
+			t.Errorf("%s: expected %d keys processed without truncation; got %d, %t", resolveTxn.Status, numKeys, num, truncated)
+		}
+		for i := 0; i < numKeys; i++ {
+			key := proto.Key(fmt.Sprintf("key-%03d", i))
+			value, err := MVCCGet(engine, key, makeTS(0, 1), true, nil)
+			if i%4 == 0 {
+				// The other txn's intents must remain.
+				if _, ok := err.(*proto.WriteIntentError); !ok {
+					t.Errorf("%s: expected intent at %q; got %v, %v", resolveTxn.Status, key, value, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if committed := value != nil; committed != (resolveTxn.Status == proto.COMMITTED) {
+				t.Errorf("%s: expected committed %t at %q; got value %v", resolveTxn.Status,
+					resolveTxn.Status == proto.COMMITTED, key, value)
+			}
+		}
+		engine.Close()
+	}
+
+	// A bounded resolve stops at max and reports truncation.
+	engine := createTestEngine()
+	defer engine.Close()
+	writeIntents(engine)
+	num, truncated, err := MVCCResolveWriteIntentRange(engine, nil, proto.KeyMin, proto.KeyMax, 10, makeTS(0, 1), txn1Commit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if num != 10 || !truncated {
+		t.Errorf("expected 10 keys processed with truncation; got %d, %t", num, truncated)
+	}
+	num, truncated, err = MVCCResolveWriteIntentRange(engine, nil, proto.KeyMin, proto.KeyMax, numKeys, makeTS(0, 1), txn1Commit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if num != numKeys || truncated {
+		t.Errorf("expected %d keys processed without truncation; got %d, %t", numKeys, num, truncated)
+	}
+}
+
 func TestValidSplitKeys(t *testing.T) {
 	defer leaktest.AfterTest(t)
 	testCases := []struct {
@@ -1545,6 +2977,45 @@ func TestFindSplitKey(t *testing.T) {
 	}
 }
 
+// TestFindLiveSplitKey verifies that the live split key is chosen at
+// the median of the live data, ignoring deleted values.
+func TestFindLiveSplitKey(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	raftID := int64(1)
+	engine := NewInMem(proto.Attributes{}, 1<<20)
+	defer engine.Close()
+
+	// Write a series of same-sized values and delete the first half of
+	// them. The live split key should be the median of the second half.
+	const numKeys = 200
+	ms := &proto.MVCCStats{}
+	for i := 0; i < numKeys; i++ {
+		k := proto.Key(fmt.Sprintf("%09d", i))
+		val := proto.Value{Bytes: []byte(strings.Repeat("X", 10))}
+		if err := MVCCPut(engine, ms, k, makeTS(0, 1), val, nil); err != nil {
+			t.Fatal(err)
+		}
+		if i < numKeys/2 {
+			if err := MVCCDelete(engine, ms, k, makeTS(0, 2), nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := MVCCSetRangeStats(engine, raftID, ms); err != nil {
+		t.Fatal(err)
+	}
+	snap := engine.NewSnapshot()
+	defer snap.Close()
+	humanSplitKey, err := MVCCFindLiveSplitKey(snap, raftID, proto.KeyMin, proto.KeyMax)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ind, _ := strconv.Atoi(string(humanSplitKey))
+	if exp := numKeys * 3 / 4; ind < exp-1 || ind > exp+1 {
+		t.Errorf("wanted key #%d+-1, but got %d", exp, ind)
+	}
+}
+
 // TestFindValidSplitKeys verifies split keys are located such that
 // they avoid splits through invalid key ranges.
 func TestFindValidSplitKeys(t *testing.T) {
@@ -1850,7 +3321,7 @@ func TestMVCCStatsBasic(t *testing.T) {
 
 	// Resolve the deletion by aborting it.
 	txn.Status = proto.ABORTED
-	if err := MVCCResolveWriteIntent(engine, ms, key, ts2, txn); err != nil {
+	if _, err := MVCCResolveWriteIntent(engine, ms, key, ts2, txn, false); err != nil {
 		t.Fatal(err)
 	}
 	// Stats should equal same as before the deletion after aborting the intent.
@@ -1893,10 +3364,10 @@ func TestMVCCStatsBasic(t *testing.T) {
 
 	// Now commit both values.
 	txn.Status = proto.COMMITTED
-	if err := MVCCResolveWriteIntent(engine, ms, key, ts4, txn); err != nil {
+	if _, err := MVCCResolveWriteIntent(engine, ms, key, ts4, txn, false); err != nil {
 		t.Fatal(err)
 	}
-	if err := MVCCResolveWriteIntent(engine, ms, key2, ts4, txn); err != nil {
+	if _, err := MVCCResolveWriteIntent(engine, ms, key2, ts4, txn, false); err != nil {
 		t.Fatal(err)
 	}
 	m3ValSize := encodedSize(&proto.MVCCMetadata{Timestamp: ts4, Deleted: true}, t)
@@ -1985,7 +3456,7 @@ func TestMVCCStatsWithRandomRuns(t *testing.T) {
 					if log.V(1) {
 						log.Infof("*** ABORT index %d", idx)
 					}
-					if err := MVCCResolveWriteIntent(engine, ms, keys[idx], makeTS(int64(i+1)*1E9, 0), &wiErr.Intents[0].Txn); err != nil {
+					if _, err := MVCCResolveWriteIntent(engine, ms, keys[idx], makeTS(int64(i+1)*1E9, 0), &wiErr.Intents[0].Txn, false); err != nil {
 						t.Fatal(err)
 					}
 					// Now, re-delete.
@@ -2016,7 +3487,7 @@ func TestMVCCStatsWithRandomRuns(t *testing.T) {
 			if log.V(1) {
 				log.Infof("*** RESOLVE index %d; COMMIT=%t", i, txn.Status == proto.COMMITTED)
 			}
-			if err := MVCCResolveWriteIntent(engine, ms, key, makeTS(int64(i+1)*1E9, 0), txn); err != nil {
+			if _, err := MVCCResolveWriteIntent(engine, ms, key, makeTS(int64(i+1)*1E9, 0), txn, false); err != nil {
 				t.Fatal(err)
 			}
 		}
@@ -2036,6 +3507,200 @@ func TestMVCCStatsWithRandomRuns(t *testing.T) {
 	}
 }
 
+// TestComputeStatsForRangeHandCalculated writes multiple versions, a
+// deletion tombstone and an intent and verifies the recomputed stats
+// against values calculated from the sizes of the raw engine entries.
+func TestComputeStatsForRangeHandCalculated(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	engine := createTestEngine()
+	defer engine.Close()
+
+	keyA, keyB, keyC, keyD := proto.Key("a"), proto.Key("b"), proto.Key("c"), proto.Key("d")
+	ts1, ts2, ts3 := makeTS(1*1E9, 0), makeTS(2*1E9, 0), makeTS(3*1E9, 0)
+	// Two versions of "a".
+	if err := MVCCPut(engine, nil, keyA, ts1, value1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := MVCCPut(engine, nil, keyA, ts2, value2, nil); err != nil {
+		t.Fatal(err)
+	}
+	// An intent on "b".
+	if err := MVCCPut(engine, nil, keyB, ts3, value1, makeTxn(txn1, ts3)); err != nil {
+		t.Fatal(err)
+	}
+	// A deleted "c".
+	if err := MVCCPut(engine, nil, keyC, ts1, value1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := MVCCDelete(engine, nil, keyC, ts2, nil); err != nil {
+		t.Fatal(err)
+	}
+	// "d" lies outside of the span and must not be counted.
+	if err := MVCCPut(engine, nil, keyD, ts1, value1, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	valSize := func(key proto.EncodedKey) int64 {
+		val, err := engine.Get(key)
+		if err != nil || len(val) == 0 {
+			t.Fatalf("unable to read %q: %v", key, err)
+		}
+		return int64(len(val))
+	}
+	vKey := mvccVersionTimestampSize
+	mA, mAv := int64(len(MVCCEncodeKey(keyA))), valSize(MVCCEncodeKey(keyA))
+	a1v, a2v := valSize(MVCCEncodeVersionKey(keyA, ts1)), valSize(MVCCEncodeVersionKey(keyA, ts2))
+	mB, mBv := int64(len(MVCCEncodeKey(keyB))), valSize(MVCCEncodeKey(keyB))
+	b3v := valSize(MVCCEncodeVersionKey(keyB, ts3))
+	mC, mCv := int64(len(MVCCEncodeKey(keyC))), valSize(MVCCEncodeKey(keyC))
+	c1v, c2v := valSize(MVCCEncodeVersionKey(keyC, ts1)), valSize(MVCCEncodeVersionKey(keyC, ts2))
+
+	const nowSeconds = 5
+	expMS := proto.MVCCStats{
+		LiveBytes:   (mA + mAv + vKey + a2v) + (mB + mBv + vKey + b3v),
+		KeyBytes:    (mA + 2*vKey) + (mB + vKey) + (mC + 2*vKey),
+		ValBytes:    (mAv + a1v + a2v) + (mBv + b3v) + (mCv + c1v + c2v),
+		IntentBytes: vKey + b3v,
+		LiveCount:   2,
+		KeyCount:    3,
+		ValCount:    5,
+		IntentCount: 1,
+		IntentAge:   nowSeconds - 3,
+		// The overwritten version of "a" and the deleted "c" (meta,
+		// tombstone and overwritten version) are GC'able, aged from
+		// their own timestamps.
+		GCBytesAge: (vKey+a1v)*(nowSeconds-1) +
+			(mC+mCv)*(nowSeconds-2) + (vKey+c2v)*(nowSeconds-2) + (vKey+c1v)*(nowSeconds-1),
+	}
+	ms, err := ComputeStatsForRange(engine, keyA, keyD, nowSeconds*1E9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyStats("hand calculated", &ms, &expMS, t)
+}
+
+// TestMVCCApplyBatch verifies that batched puts and deletes are
+// applied and that the combined stats match those of applying the
+// same operations individually.
+func TestMVCCApplyBatch(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	engine := createTestEngine()
+	defer engine.Close()
+	expEngine := createTestEngine()
+	defer expEngine.Close()
+
+	ops := []MVCCBatchOp{
+		{Key: testKey1, Value: &value1},
+		{Key: testKey2, Value: &value2},
+		{Key: testKey3, Value: &value3},
+		{Key: testKey2},
+	}
+	ms := &proto.MVCCStats{}
+	if err := MVCCApplyBatch(engine, ms, ops, makeTS(1, 0), nil); err != nil {
+		t.Fatal(err)
+	}
+	expMS := &proto.MVCCStats{}
+	for _, op := range ops {
+		var err error
+		if op.Value == nil {
+			err = MVCCDelete(expEngine, expMS, op.Key, makeTS(1, 0), nil)
+		} else {
+			err = MVCCPut(expEngine, expMS, op.Key, makeTS(1, 0), *op.Value, nil)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	verifyStats("batch", ms, expMS, t)
+
+	kvs, err := MVCCScan(engine, proto.KeyMin, proto.KeyMax, 0, makeTS(2, 0), true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kvs) != 2 ||
+		!bytes.Equal(kvs[0].Key, testKey1) || !bytes.Equal(kvs[0].Value.Bytes, value1.Bytes) ||
+		!bytes.Equal(kvs[1].Key, testKey3) || !bytes.Equal(kvs[1].Value.Bytes, value3.Bytes) {
+		t.Errorf("unexpected scan results: %v", kvs)
+	}
+}
+
+// TestMVCCApplyBatchAtomicity verifies that an error part way through
+// a batch leaves neither the engine nor the stats modified.
+func TestMVCCApplyBatchAtomicity(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	engine := createTestEngine()
+	defer engine.Close()
+
+	ops := []MVCCBatchOp{
+		{Key: testKey1, Value: &value1},
+		{Key: testKey2, Value: &value2},
+		{Key: proto.Key{}, Value: &value3}, // empty key fails
+		{Key: testKey3, Value: &value3},
+	}
+	ms := &proto.MVCCStats{}
+	if err := MVCCApplyBatch(engine, ms, ops, makeTS(1, 0), nil); err == nil {
+		t.Fatal("expected error applying batch with empty key")
+	}
+	if !reflect.DeepEqual(ms, &proto.MVCCStats{}) {
+		t.Errorf("expected stats to be unmodified; got %+v", ms)
+	}
+	kvs, err := MVCCScan(engine, proto.KeyMin, proto.KeyMax, 0, makeTS(2, 0), true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kvs) != 0 {
+		t.Errorf("expected no keys to be written; got %v", kvs)
+	}
+}
+
+// TestComputeStatsForRange writes keys to two adjacent spans,
+// accumulating stats separately for each, and verifies that stats
+// computed for each span match.
+func TestComputeStatsForRange(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	engine := createTestEngine()
+	defer engine.Close()
+
+	ms1 := &proto.MVCCStats{}
+	ms2 := &proto.MVCCStats{}
+	ts := makeTS(1*1E9, 0)
+	for _, k := range []string{"a", "b", "bb"} {
+		if err := MVCCPut(engine, ms1, proto.Key(k), ts, value1, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, k := range []string{"c", "d"} {
+		if err := MVCCPut(engine, ms2, proto.Key(k), ts, value2, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Write an intent in the second span.
+	if err := MVCCPut(engine, ms2, proto.Key("e"), ts, value3, txn1); err != nil {
+		t.Fatal(err)
+	}
+
+	nowNanos := int64(2 * 1E9)
+	ms2.IntentAge = 1
+	for i, test := range []struct {
+		start, end proto.Key
+		expMS      *proto.MVCCStats
+	}{
+		{proto.Key("a"), proto.Key("c"), ms1},
+		{proto.Key("c"), proto.KeyMax, ms2},
+	} {
+		computed, err := ComputeStatsForRange(engine, test.start, test.end, nowNanos)
+		if err != nil {
+			t.Fatal(err)
+		}
+		verifyStats(fmt.Sprintf("%d", i), &computed, test.expMS, t)
+	}
+
+	// A span with start >= end is an error.
+	if _, err := ComputeStatsForRange(engine, proto.Key("c"), proto.Key("a"), nowNanos); err == nil {
+		t.Error("expected error for inverted span")
+	}
+}
+
 // TestMVCCGarbageCollect writes a series of gc'able bytes and then
 // sends an MVCC GC request and verifies cleared values and updated
 // stats.
@@ -2142,6 +3807,89 @@ func TestMVCCGarbageCollect(t *testing.T) {
 	verifyStats("verification", ms, &expMS, t)
 }
 
+// TestMVCCPutExpiring verifies that an expiring inline value is visible
+// to reads up to its expiration, absent afterwards, and reclaimed by
+// garbage collection.
+func TestMVCCPutExpiring(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	engine := createTestEngine()
+	defer engine.Close()
+
+	ms := &proto.MVCCStats{}
+	expiration := makeTS(10, 0)
+	if err := MVCCPutExpiring(engine, ms, testKey1, value1, expiration); err != nil {
+		t.Fatal(err)
+	}
+	if err := MVCCPut(engine, ms, testKey2, proto.ZeroTimestamp, value2, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Present before and at expiration, absent afterwards.
+	for _, test := range []struct {
+		ts     proto.Timestamp
+		expVal *proto.Value
+	}{
+		{makeTS(5, 0), &value1},
+		{expiration, &value1},
+		{makeTS(10, 1), nil},
+		{makeTS(20, 0), nil},
+	} {
+		value, err := MVCCGet(engine, testKey1, test.ts, true, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (value == nil) != (test.expVal == nil) ||
+			(value != nil && !bytes.Equal(value.Bytes, test.expVal.Bytes)) {
+			t.Errorf("%s: expected value %+v; got %+v", test.ts, test.expVal, value)
+		}
+	}
+	// Scans skip the expired value.
+	kvs, err := MVCCScan(engine, testKey1, testKey2.Next(), 0, makeTS(20, 0), true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kvs) != 1 || !kvs[0].Key.Equal(testKey2) {
+		t.Errorf("expected only %q in scan; got %+v", testKey2, kvs)
+	}
+
+	// GC at a timestamp no later than the expiration leaves the value.
+	gcKeys := []proto.InternalGCRequest_GCKey{{Key: testKey1, Timestamp: expiration}}
+	if err := MVCCGarbageCollect(engine, ms, gcKeys, expiration); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := MVCCGet(engine, testKey1, makeTS(5, 0), true, nil); err != nil || value == nil {
+		t.Fatalf("expected unexpired value to survive GC; got %+v, %v", value, err)
+	}
+	// Once expired, GC removes the value and its stats.
+	gcKeys[0].Timestamp = makeTS(20, 0)
+	if err := MVCCGarbageCollect(engine, ms, gcKeys, makeTS(20, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := MVCCGet(engine, testKey1, makeTS(5, 0), true, nil); err != nil || value != nil {
+		t.Fatalf("expected expired value to be collected; got %+v, %v", value, err)
+	}
+	iter := engine.NewIterator()
+	iter.Seek(proto.KeyMin)
+	expMS, err := MVCCComputeStats(iter, 20)
+	iter.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyStats("after GC", ms, &expMS, t)
+
+	// A plain inline put clears the expiration.
+	if err := MVCCPutExpiring(engine, ms, testKey1, value1, expiration); err != nil {
+		t.Fatal(err)
+	}
+	if err := MVCCPut(engine, ms, testKey1, proto.ZeroTimestamp, value3, nil); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := MVCCGet(engine, testKey1, makeTS(20, 0), true, nil); err != nil || value == nil ||
+		!bytes.Equal(value.Bytes, value3.Bytes) {
+		t.Errorf("expected non-expiring value %+v; got %+v, %v", value3, value, err)
+	}
+}
+
 // TestMVCCGarbageCollectNonDeleted verifies that the first value for
 // a key cannot be GC'd if it's not deleted.
 func TestMVCCGarbageCollectNonDeleted(t *testing.T) {
@@ -2195,6 +3943,119 @@ func TestMVCCGarbageCollectIntent(t *testing.T) {
 	}
 }
 
+// TestMVCCGarbageCollectKeys verifies that only versions which can't
+// be read at or above the GC timestamp are removed, that keys with
+// only a collectable tombstone are removed entirely, and that intents
+// are left alone.
+func TestMVCCGarbageCollectKeys(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	engine := createTestEngine()
+	defer engine.Close()
+
+	bytes := []byte("value")
+	var ts []proto.Timestamp
+	for i := 1; i <= 5; i++ {
+		ts = append(ts, makeTS(int64(i)*1E9, 0))
+	}
+	// Key "a" has many versions.
+	for _, t1 := range ts {
+		val := proto.Value{Bytes: bytes, Timestamp: &t1}
+		if err := MVCCPut(engine, nil, proto.Key("a"), t1, val, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Key "b" is deleted below the GC threshold.
+	val := proto.Value{Bytes: bytes, Timestamp: &ts[0]}
+	if err := MVCCPut(engine, nil, proto.Key("b"), ts[0], val, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := MVCCDelete(engine, nil, proto.Key("b"), ts[1], nil); err != nil {
+		t.Fatal(err)
+	}
+	// Key "c" has a single live version.
+	if err := MVCCPut(engine, nil, proto.Key("c"), ts[0], val, nil); err != nil {
+		t.Fatal(err)
+	}
+	// Key "d" has an intent above a committed version.
+	if err := MVCCPut(engine, nil, proto.Key("d"), ts[0], val, nil); err != nil {
+		t.Fatal(err)
+	}
+	txn := &proto.Transaction{ID: []byte("txn"), Timestamp: ts[1]}
+	if err := MVCCDelete(engine, nil, proto.Key("d"), ts[1], txn); err != nil {
+		t.Fatal(err)
+	}
+
+	nowNanos := ts[4].WallTime
+	computeStats := func() proto.MVCCStats {
+		iter := engine.NewIterator()
+		defer iter.Close()
+		iter.Seek(proto.KeyMin)
+		ms, err := MVCCComputeStats(iter, nowNanos)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ms
+	}
+	before := computeStats()
+
+	keys := []proto.Key{proto.Key("a"), proto.Key("b"), proto.Key("c"), proto.Key("d"), proto.Key("e")}
+	ms, err := MVCCGarbageCollectKeys(engine, keys, ts[2], nowNanos)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expEncKeys := []proto.EncodedKey{
+		MVCCEncodeKey(proto.Key("a")),
+		MVCCEncodeVersionKey(proto.Key("a"), ts[4]),
+		MVCCEncodeVersionKey(proto.Key("a"), ts[3]),
+		MVCCEncodeVersionKey(proto.Key("a"), ts[2]),
+		MVCCEncodeKey(proto.Key("c")),
+		MVCCEncodeVersionKey(proto.Key("c"), ts[0]),
+		MVCCEncodeKey(proto.Key("d")),
+		MVCCEncodeVersionKey(proto.Key("d"), ts[1]),
+		MVCCEncodeVersionKey(proto.Key("d"), ts[0]),
+	}
+	kvs, err := Scan(engine, MVCCEncodeKey(proto.KeyMin), MVCCEncodeKey(proto.KeyMax), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kvs) != len(expEncKeys) {
+		t.Fatalf("number of kvs %d != expected %d", len(kvs), len(expEncKeys))
+	}
+	for i, kv := range kvs {
+		if !kv.Key.Equal(expEncKeys[i]) {
+			t.Errorf("%d: expected key %q; got %q", i, expEncKeys[i], kv.Key)
+		}
+	}
+
+	// Reads at the GC threshold must be unaffected.
+	value, err := MVCCGet(engine, proto.Key("a"), ts[2], true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value == nil || !value.Timestamp.Equal(ts[2]) {
+		t.Errorf("expected value at %s; got %+v", ts[2], value)
+	}
+
+	// Verify the returned stats delta accounts for the removed bytes.
+	after := computeStats()
+	if ms.KeyBytes != after.KeyBytes-before.KeyBytes {
+		t.Errorf("expected key bytes delta %d; got %d", after.KeyBytes-before.KeyBytes, ms.KeyBytes)
+	}
+	if ms.ValBytes != after.ValBytes-before.ValBytes {
+		t.Errorf("expected val bytes delta %d; got %d", after.ValBytes-before.ValBytes, ms.ValBytes)
+	}
+	if ms.KeyCount != after.KeyCount-before.KeyCount {
+		t.Errorf("expected key count delta %d; got %d", after.KeyCount-before.KeyCount, ms.KeyCount)
+	}
+	if ms.ValCount != after.ValCount-before.ValCount {
+		t.Errorf("expected val count delta %d; got %d", after.ValCount-before.ValCount, ms.ValCount)
+	}
+	if ms.LiveBytes != 0 {
+		t.Errorf("expected no change to live bytes; got %d", ms.LiveBytes)
+	}
+}
+
 // TestResovleIntentWithLowerEpoch verifies that trying to resolve
 // an intent at an epoch that is lower than the epoch of the intent
 // leaves the intent untouched.
@@ -2208,7 +4069,7 @@ func TestResovleIntentWithLowerEpoch(t *testing.T) {
 		t.Fatal(err)
 	}
 	// Resolve the intent with a low epoch.
-	if err := MVCCResolveWriteIntent(engine, nil, testKey1, makeTS(0, 1), txn1); err != nil {
+	if _, err := MVCCResolveWriteIntent(engine, nil, testKey1, makeTS(0, 1), txn1, false); err != nil {
 		t.Fatal(err)
 	}
 
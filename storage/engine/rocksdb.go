@@ -41,6 +41,7 @@ import (
 type RocksDB struct {
 	rdb       *C.DBEngine
 	refcount  int32
+	snapshots int32            // Number of open snapshots
 	attrs     proto.Attributes // Attributes for this engine
 	dir       string           // The data directory
 	cacheSize int64            // Memory to use to cache values.
@@ -254,19 +255,42 @@ func (r *RocksDB) iterateInternal(start, end proto.EncodedKey, f func(proto.RawK
 	return it.Error()
 }
 
-// Capacity queries the underlying file system for disk capacity information.
+// Capacity queries the underlying file system for disk capacity
+// information. An in-memory instance has no file system of its own and
+// reports synthetic numbers instead: its capacity is the configured
+// cache size and its usage the total size of the keys and values it
+// holds.
 func (r *RocksDB) Capacity() (proto.StoreCapacity, error) {
+	if r.dir == "" {
+		return r.memCapacity()
+	}
 	var fs syscall.Statfs_t
 	var capacity proto.StoreCapacity
-	dir := r.dir
-	if dir == "" {
-		dir = "/tmp"
-	}
-	if err := syscall.Statfs(dir, &fs); err != nil {
+	if err := syscall.Statfs(r.dir, &fs); err != nil {
 		return capacity, err
 	}
 	capacity.Capacity = int64(fs.Bsize) * int64(fs.Blocks)
 	capacity.Available = int64(fs.Bsize) * int64(fs.Bavail)
+	capacity.Used = int64(fs.Bsize) * int64(fs.Blocks-fs.Bfree)
+	return capacity, nil
+}
+
+// memCapacity returns the synthetic capacity of an in-memory instance.
+// Usage is computed by iterating over all data, which is acceptable
+// for the small data sets held in memory.
+func (r *RocksDB) memCapacity() (proto.StoreCapacity, error) {
+	var capacity proto.StoreCapacity
+	if err := r.Iterate(proto.EncodedKey(proto.KeyMin), MVCCKeyMax, func(kv proto.RawKeyValue) (bool, error) {
+		capacity.Used += int64(len(kv.Key) + len(kv.Value))
+		return false, nil
+	}); err != nil {
+		return capacity, err
+	}
+	capacity.Capacity = r.cacheSize
+	if capacity.Capacity < capacity.Used {
+		capacity.Capacity = capacity.Used
+	}
+	capacity.Available = capacity.Capacity - capacity.Used
 	return capacity, nil
 }
 
@@ -280,7 +304,7 @@ func (r *RocksDB) SetGCTimeouts(minTxnTS, minRCacheTS int64) {
 // Similarly, specifying nil for the end key will compact through the
 // last key. Note that the use of the word "Range" here does not refer
 // to Cockroach ranges, just to a generalized key range.
-func (r *RocksDB) CompactRange(start, end proto.EncodedKey) {
+func (r *RocksDB) CompactRange(start, end proto.EncodedKey) error {
 	var (
 		s, e       C.DBSlice
 		sPtr, ePtr *C.DBSlice
@@ -293,10 +317,7 @@ func (r *RocksDB) CompactRange(start, end proto.EncodedKey) {
 		ePtr = &e
 		e = goToCSlice(end)
 	}
-	err := statusToError(C.DBCompactRange(r.rdb, sPtr, ePtr))
-	if err != nil {
-		log.Warningf("compact range: %s", err)
-	}
+	return statusToError(C.DBCompactRange(r.rdb, sPtr, ePtr))
 }
 
 // Destroy destroys the underlying filesystem data associated with the database.
@@ -310,6 +331,17 @@ func (r *RocksDB) ApproximateSize(start, end proto.EncodedKey) (uint64, error) {
 	return uint64(C.DBApproximateSize(r.rdb, goToCSlice(start), goToCSlice(end))), nil
 }
 
+// BlockCacheStats returns the capacity of RocksDB's block cache and
+// the number of hits and misses it has seen.
+func (r *RocksDB) BlockCacheStats() BlockCacheStats {
+	stats := C.DBGetCacheStats(r.rdb)
+	return BlockCacheStats{
+		Capacity: int64(stats.capacity),
+		Hits:     int64(stats.hits),
+		Misses:   int64(stats.misses),
+	}
+}
+
 // Flush causes RocksDB to write all in-memory data to disk immediately.
 func (r *RocksDB) Flush() error {
 	return statusToError(C.DBFlush(r.rdb))
@@ -401,12 +433,20 @@ func (r *RocksDB) NewSnapshot() Engine {
 	if r.rdb == nil {
 		panic("RocksDB is not initialized yet")
 	}
+	atomic.AddInt32(&r.snapshots, 1)
 	return &rocksDBSnapshot{
 		parent: r,
 		handle: C.DBNewSnapshot(r.rdb),
 	}
 }
 
+// NumSnapshots returns the number of snapshots which have been
+// created and not yet released. Open snapshots pin the underlying
+// files, so a non-zero count long after a scan indicates a leak.
+func (r *RocksDB) NumSnapshots() int {
+	return int(atomic.LoadInt32(&r.snapshots))
+}
+
 // NewBatch returns a new batch wrapping this rocksdb engine.
 func (r *RocksDB) NewBatch() Engine {
 	return newRocksDBBatch(r)
@@ -427,9 +467,14 @@ func (r *rocksDBSnapshot) Open() error {
 	return nil
 }
 
-// Close releases the snapshot handle.
+// Close releases the snapshot handle. Subsequent calls are noops.
 func (r *rocksDBSnapshot) Close() {
+	if r.handle == nil {
+		return
+	}
 	C.DBSnapshotRelease(r.handle)
+	r.handle = nil
+	atomic.AddInt32(&r.parent.snapshots, -1)
 }
 
 // Attrs returns the engine/store attributes.
@@ -485,11 +530,23 @@ func (r *rocksDBSnapshot) ApproximateSize(start, end proto.EncodedKey) (uint64,
 	return r.parent.ApproximateSize(start, end)
 }
 
+// BlockCacheStats returns the block cache stats of the underlying
+// engine.
+func (r *rocksDBSnapshot) BlockCacheStats() BlockCacheStats {
+	return r.parent.BlockCacheStats()
+}
+
 // Flush is a no-op for snapshots.
 func (r *rocksDBSnapshot) Flush() error {
 	return nil
 }
 
+// CompactRange compacts the specified key range of the underlying
+// engine. Compaction doesn't alter the data visible to the snapshot.
+func (r *rocksDBSnapshot) CompactRange(start, end proto.EncodedKey) error {
+	return r.parent.CompactRange(start, end)
+}
+
 // NewIterator returns a new instance of an Iterator over the
 // engine using the snapshot handle.
 func (r *rocksDBSnapshot) NewIterator() Iterator {
@@ -636,10 +693,18 @@ func (r *rocksDBBatch) ApproximateSize(start, end proto.EncodedKey) (uint64, err
 	return r.parent.ApproximateSize(start, end)
 }
 
+func (r *rocksDBBatch) BlockCacheStats() BlockCacheStats {
+	return r.parent.BlockCacheStats()
+}
+
 func (r *rocksDBBatch) Flush() error {
 	return util.Errorf("cannot flush a batch")
 }
 
+func (r *rocksDBBatch) CompactRange(start, end proto.EncodedKey) error {
+	return util.Errorf("cannot compact a batch")
+}
+
 func (r *rocksDBBatch) NewIterator() Iterator {
 	return &rocksDBIterator{
 		iter: C.DBBatchNewIter(r.parent.rdb, r.batch),
@@ -667,7 +732,12 @@ func (r *rocksDBBatch) Commit() error {
 }
 
 type rocksDBIterator struct {
-	iter *C.DBIterator
+	iter         *C.DBIterator
+	collectStats bool
+	stats        IteratorStats
+	// lastVersionKey is the encoded metadata key of the most recently
+	// visited version, used to detect versions shadowed by newer ones.
+	lastVersionKey []byte
 }
 
 // newRocksDBIterator returns a new iterator over the supplied RocksDB
@@ -697,6 +767,14 @@ func (r *rocksDBIterator) Seek(key []byte) {
 	} else {
 		C.DBIterSeek(r.iter, goToCSlice(key))
 	}
+	r.updateStats()
+}
+
+func (r *rocksDBIterator) SeekReverse(key []byte) {
+	// The seek and any step back are performed in a single call to
+	// avoid copying the key at the intermediate position.
+	C.DBIterSeekReverse(r.iter, goToCSlice(key))
+	r.updateStats()
 }
 
 func (r *rocksDBIterator) Valid() bool {
@@ -705,6 +783,12 @@ func (r *rocksDBIterator) Valid() bool {
 
 func (r *rocksDBIterator) Next() {
 	C.DBIterNext(r.iter)
+	r.updateStats()
+}
+
+func (r *rocksDBIterator) Prev() {
+	C.DBIterPrev(r.iter)
+	r.updateStats()
 }
 
 func (r *rocksDBIterator) Key() proto.EncodedKey {
@@ -736,6 +820,41 @@ func (r *rocksDBIterator) Error() error {
 	return statusToError(C.DBIterError(r.iter))
 }
 
+func (r *rocksDBIterator) EnableStats() {
+	r.collectStats = true
+}
+
+func (r *rocksDBIterator) Stats() IteratorStats {
+	return r.stats
+}
+
+// updateStats accounts for the entry the iterator is positioned at.
+// Entries are classified by the shape of their keys rather than by
+// decoding them: an encoded metadata key ends with the two byte
+// terminator of the bytes encoding and a version key appends the
+// encoded timestamp to it. Deletion tombstones are recognized by their
+// encoded value, which holds nothing but the set deleted flag. Nothing
+// is done unless stats were enabled, sparing the extra cgo calls.
+func (r *rocksDBIterator) updateStats() {
+	if !r.collectStats || !r.Valid() {
+		return
+	}
+	key := cSliceToUnsafeGoBytes(C.DBIterKey(r.iter))
+	if n := len(key) - int(mvccVersionTimestampSize); n >= 2 && key[n-2] == 0x00 && key[n-1] == 0x01 {
+		if bytes.Equal(key[:n], r.lastVersionKey) {
+			r.stats.VersionsSkipped++
+		} else {
+			r.lastVersionKey = append(r.lastVersionKey[:0], key[:n]...)
+		}
+		if bytes.Equal(cSliceToUnsafeGoBytes(C.DBIterValue(r.iter)), mvccTombstoneValue) {
+			r.stats.TombstonesSkipped++
+		}
+	} else if n := len(key); n >= 2 && key[n-2] == 0x00 && key[n-1] == 0x01 {
+		r.stats.KeysSeen++
+		r.lastVersionKey = r.lastVersionKey[:0]
+	}
+}
+
 //export rocksDBLog
 func rocksDBLog(s *C.char, n C.int) {
 	// Note that rocksdb logging is only enabled if log.V(1) is true
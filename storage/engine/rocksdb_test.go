@@ -20,6 +20,7 @@ package engine
 import (
 	"encoding/gob"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
 	"os"
 	"reflect"
@@ -110,7 +111,9 @@ func TestRocksDBCompaction(t *testing.T) {
 	}
 
 	// Compact range and scan remaining values to compare.
-	rocksdb.CompactRange(nil, nil)
+	if err := rocksdb.CompactRange(nil, nil); err != nil {
+		t.Fatal(err)
+	}
 	actualKVs, err := MVCCScan(rocksdb, proto.KeyMin, proto.KeyMax,
 		0, proto.ZeroTimestamp, true, nil)
 	if err != nil {
@@ -129,6 +132,86 @@ func TestRocksDBCompaction(t *testing.T) {
 	}
 }
 
+// TestRocksDBCapacity verifies that both on-disk and in-memory
+// instances report their capacity, and that the synthetic numbers of
+// the in-memory instance reflect its configured size and contents.
+func TestRocksDBCapacity(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	dir, err := ioutil.TempDir("", "rocksdb_capacity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	onDisk := NewRocksDB(proto.Attributes{Attrs: []string{"ssd"}}, dir, testCacheSize)
+	if err := onDisk.Open(); err != nil {
+		t.Fatalf("could not create new rocksdb db instance at %s: %v", dir, err)
+	}
+	defer onDisk.Close()
+	inMem := NewInMem(inMemAttrs, testCacheSize)
+	defer inMem.Close()
+
+	key, value := proto.EncodedKey("a"), []byte("value")
+	for i, e := range []Engine{onDisk, inMem} {
+		if err := e.Put(key, value); err != nil {
+			t.Fatal(err)
+		}
+		capacity, err := e.Capacity()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if capacity.Capacity <= 0 || capacity.Available <= 0 || capacity.Used <= 0 ||
+			capacity.Used > capacity.Capacity || capacity.Available > capacity.Capacity {
+			t.Errorf("%d: unexpected capacity %+v", i, capacity)
+		}
+	}
+
+	capacity, err := inMem.Capacity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expUsed := int64(len(key) + len(value))
+	if capacity.Capacity != testCacheSize || capacity.Used != expUsed ||
+		capacity.Available != testCacheSize-expUsed {
+		t.Errorf("expected in-memory capacity %d with %d bytes used; got %+v", testCacheSize, expUsed, capacity)
+	}
+}
+
+// TestRocksDBBlockCacheStats verifies that the block cache is sized
+// as configured and that reads of flushed data are counted as block
+// cache hits and misses.
+func TestRocksDBBlockCacheStats(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	for _, cacheSize := range []int64{1 << 20, 8 << 20} {
+		e := NewInMem(proto.Attributes{}, cacheSize)
+		if stats := e.BlockCacheStats(); stats.Capacity != cacheSize {
+			t.Errorf("expected block cache capacity %d; got %d", cacheSize, stats.Capacity)
+		}
+		e.Close()
+	}
+
+	e := NewInMem(proto.Attributes{}, testCacheSize)
+	defer e.Close()
+	key := proto.EncodedKey("a")
+	if err := e.Put(key, []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := e.Get(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats := e.BlockCacheStats(); stats.Hits == 0 || stats.Hits+stats.Misses < 2 {
+		t.Errorf("expected block cache accesses to be counted; got %+v", stats)
+	}
+}
+
 // setupMVCCData writes up to numVersions values at each of numKeys
 // keys. The number of versions written for each key is chosen
 // randomly according to a uniform distribution. Each successive
@@ -190,7 +273,9 @@ func setupMVCCScanData(numVersions, numKeys int, b *testing.B) *RocksDB {
 		}
 		batch.Close()
 	}
-	rocksdb.CompactRange(nil, nil)
+	if err := rocksdb.CompactRange(nil, nil); err != nil {
+		b.Fatal(err)
+	}
 
 	return rocksdb
 }
@@ -436,6 +521,49 @@ func BenchmarkMVCCBatch100000Put10(b *testing.B) {
 	runMVCCBatchPut(10, 100000, b)
 }
 
+func runMVCCApplyBatch(valueSize, batchSize int, b *testing.B) {
+	rng, _ := util.NewPseudoRand()
+	value := proto.Value{Bytes: util.RandBytes(rng, valueSize)}
+
+	rocksdb := NewInMem(proto.Attributes{Attrs: []string{"ssd"}}, testCacheSize)
+	defer rocksdb.Close()
+
+	ops := make([]MVCCBatchOp, 0, batchSize)
+	b.SetBytes(int64(valueSize))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i += batchSize {
+		end := i + batchSize
+		if end > b.N {
+			end = b.N
+		}
+
+		ops = ops[:0]
+		for j := i; j < end; j++ {
+			key := proto.Key(encoding.EncodeUvarint([]byte("key-"), uint64(j)))
+			ops = append(ops, MVCCBatchOp{Key: key, Value: &value})
+		}
+		ts := makeTS(time.Now().UnixNano(), 0)
+		if err := MVCCApplyBatch(rocksdb, nil, ops, ts, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.StopTimer()
+}
+
+func BenchmarkMVCCApplyBatch1Put10(b *testing.B) {
+	runMVCCApplyBatch(10, 1, b)
+}
+
+func BenchmarkMVCCApplyBatch100Put10(b *testing.B) {
+	runMVCCApplyBatch(10, 100, b)
+}
+
+func BenchmarkMVCCApplyBatch10000Put10(b *testing.B) {
+	runMVCCApplyBatch(10, 10000, b)
+}
+
 // runMVCCMerge merges value into numKeys separate keys.
 func runMVCCMerge(value *proto.Value, numKeys int, b *testing.B) {
 	rocksdb := NewInMem(proto.Attributes{Attrs: []string{"ssd"}}, testCacheSize)
@@ -19,6 +19,7 @@ package storage
 
 import (
 	"github.com/cockroachdb/cockroach/proto"
+	"github.com/cockroachdb/cockroach/storage/engine"
 	"github.com/cockroachdb/cockroach/util"
 )
 
@@ -91,6 +92,27 @@ type EndScanRangesEvent struct {
 	StoreID proto.StoreID
 }
 
+// IDAllocatorMetricsEvent occurs periodically and carries a snapshot of the
+// counters of the store's Raft ID allocator.
+type IDAllocatorMetricsEvent struct {
+	StoreID proto.StoreID
+	Metrics IDAllocatorMetrics
+}
+
+// RangeSizeHistogramEvent occurs periodically and carries the
+// distribution of the sizes of the store's ranges.
+type RangeSizeHistogramEvent struct {
+	StoreID   proto.StoreID
+	Histogram RangeSizeHistogram
+}
+
+// BlockCacheStatsEvent occurs periodically and carries the capacity
+// and hit/miss counters of the store engine's block cache.
+type BlockCacheStatsEvent struct {
+	StoreID proto.StoreID
+	Stats   engine.BlockCacheStats
+}
+
 // StoreEventFeed is a helper structure which publishes store-specific events to
 // a util.Feed. The target feed may be shared by multiple StoreEventFeeds. If
 // the target feed is nil, event methods become no-ops.
@@ -177,6 +199,30 @@ func (sef StoreEventFeed) endScanRanges() {
 	sef.f.Publish(&EndScanRangesEvent{sef.id})
 }
 
+// idAllocatorMetrics publishes an IDAllocatorMetricsEvent to this feed.
+func (sef StoreEventFeed) idAllocatorMetrics(m IDAllocatorMetrics) {
+	if sef.f == nil {
+		return
+	}
+	sef.f.Publish(&IDAllocatorMetricsEvent{sef.id, m})
+}
+
+// rangeSizeHistogram publishes a RangeSizeHistogramEvent to this feed.
+func (sef StoreEventFeed) rangeSizeHistogram(h RangeSizeHistogram) {
+	if sef.f == nil {
+		return
+	}
+	sef.f.Publish(&RangeSizeHistogramEvent{sef.id, h})
+}
+
+// blockCacheStats publishes a BlockCacheStatsEvent to this feed.
+func (sef StoreEventFeed) blockCacheStats(stats engine.BlockCacheStats) {
+	if sef.f == nil {
+		return
+	}
+	sef.f.Publish(&BlockCacheStatsEvent{sef.id, stats})
+}
+
 // StoreEventListener is an interface that can be implemented by objects which
 // listen for events published by stores.
 type StoreEventListener interface {
@@ -188,6 +234,9 @@ type StoreEventListener interface {
 	OnStartStore(event *StartStoreEvent)
 	OnBeginScanRanges(event *BeginScanRangesEvent)
 	OnEndScanRanges(event *EndScanRangesEvent)
+	OnIDAllocatorMetrics(event *IDAllocatorMetricsEvent)
+	OnRangeSizeHistogram(event *RangeSizeHistogramEvent)
+	OnBlockCacheStats(event *BlockCacheStatsEvent)
 }
 
 // ProcessStoreEvents reads store events from the supplied channel and passes
@@ -213,6 +262,12 @@ func ProcessStoreEvents(l StoreEventListener, sub *util.Subscription) {
 			l.OnBeginScanRanges(specificEvent)
 		case *EndScanRangesEvent:
 			l.OnEndScanRanges(specificEvent)
+		case *IDAllocatorMetricsEvent:
+			l.OnIDAllocatorMetrics(specificEvent)
+		case *RangeSizeHistogramEvent:
+			l.OnRangeSizeHistogram(specificEvent)
+		case *BlockCacheStatsEvent:
+			l.OnBlockCacheStats(specificEvent)
 		}
 	}
 }
@@ -24,6 +24,7 @@ import (
 	"time"
 
 	"github.com/cockroachdb/cockroach/proto"
+	"github.com/cockroachdb/cockroach/storage/engine"
 	"github.com/cockroachdb/cockroach/util"
 	"github.com/cockroachdb/cockroach/util/leaktest"
 )
@@ -289,6 +290,36 @@ func TestStoreEventFeed(t *testing.T) {
 				StoreID: proto.StoreID(1),
 			},
 		},
+		{
+			"IDAllocatorMetrics",
+			func(feed StoreEventFeed) {
+				feed.idAllocatorMetrics(IDAllocatorMetrics{BlocksFetched: 1, IDsAllocated: 10, Waits: 2})
+			},
+			&IDAllocatorMetricsEvent{
+				StoreID: proto.StoreID(1),
+				Metrics: IDAllocatorMetrics{BlocksFetched: 1, IDsAllocated: 10, Waits: 2},
+			},
+		},
+		{
+			"RangeSizeHistogram",
+			func(feed StoreEventFeed) {
+				feed.rangeSizeHistogram(RangeSizeHistogram{RangeCount: 3, Counts: []int64{2, 0, 1}})
+			},
+			&RangeSizeHistogramEvent{
+				StoreID:   proto.StoreID(1),
+				Histogram: RangeSizeHistogram{RangeCount: 3, Counts: []int64{2, 0, 1}},
+			},
+		},
+		{
+			"BlockCacheStats",
+			func(feed StoreEventFeed) {
+				feed.blockCacheStats(engine.BlockCacheStats{Capacity: 1 << 20, Hits: 5, Misses: 2})
+			},
+			&BlockCacheStatsEvent{
+				StoreID: proto.StoreID(1),
+				Stats:   engine.BlockCacheStats{Capacity: 1 << 20, Hits: 5, Misses: 2},
+			},
+		},
 	}
 
 	// Compile expected events into a single slice.
@@ -55,6 +55,8 @@ const (
 //    as implemented going forward).
 //  - Resolve extant write intents and determine oldest non-resolvable
 //    intent.
+//  - GC of committed and aborted transaction records via TTL
+//    expiration.
 //
 // The shouldQueue function combines the need for both tasks into a
 // single priority. If any task is overdue, shouldQueue returns true.
@@ -106,7 +108,10 @@ func (gcq *gcQueue) shouldQueue(now proto.Timestamp, rng *Range) (shouldQ bool,
 // process iterates through all keys in a range, calling the garbage
 // collector for each key and associated set of values. GC'd keys are
 // batched into InternalGC calls. Extant intents are resolved if
-// intents are older than intentAgeThreshold.
+// intents are older than intentAgeThreshold. Aborted transaction
+// records, and committed ones whose intents are known to be resolved,
+// are removed once they've seen no activity within the GC TTL, unless
+// the transaction still has intents in this range.
 func (gcq *gcQueue) process(now proto.Timestamp, rng *Range) error {
 	snap := rng.rm.Engine().NewSnapshot()
 	iter := newRangeDataIterator(rng.Desc(), snap)
@@ -119,13 +124,27 @@ func (gcq *gcQueue) process(now proto.Timestamp, rng *Range) error {
 		return err
 	}
 
+	// Carry over any range-specific GC TTL to the new GC metadata.
+	prevGCMeta, err := rng.GetGCMetadata()
+	if err != nil {
+		return err
+	}
 	gcMeta := proto.NewGCMetadata(now.WallTime)
+	gcMeta.TTLSeconds = prevGCMeta.TTLSeconds
 	gc := engine.NewGarbageCollector(now, policy)
+	// Reads below the GC expiration may return incomplete results once
+	// the GC has been applied; see InternalGC.
+	threshold := gc.Expiration()
+	gcMeta.Threshold = &threshold
 
 	// Compute intent expiration (intent age at which we attempt to resolve).
 	intentExp := now
 	intentExp.WallTime -= intentAgeThreshold.Nanoseconds()
 
+	// Compute transaction record expiration.
+	txnExp := now
+	txnExp.WallTime -= int64(policy.TTLSeconds) * 1E9
+
 	gcArgs := &proto.InternalGCRequest{
 		RequestHeader: proto.RequestHeader{
 			Timestamp: now,
@@ -138,6 +157,9 @@ func (gcq *gcQueue) process(now proto.Timestamp, rng *Range) error {
 	var expBaseKey proto.Key
 	var keys []proto.EncodedKey
 	var vals [][]byte
+	var txnRecords []*proto.Transaction
+	var txnKeys []proto.Key
+	intentTxnIDs := map[string]struct{}{}
 
 	// updateOldestIntent atomically updates the oldest intent.
 	updateOldestIntent := func(intentNanos int64) {
@@ -153,6 +175,38 @@ func (gcq *gcQueue) process(now proto.Timestamp, rng *Range) error {
 	// resolution and values after the MVCC metadata, and possible
 	// intent, are sent for garbage collection.
 	processKeysAndValues := func() {
+		// A transaction record is a single inline value; note it as a GC
+		// candidate if it's eligible and expired.
+		if len(keys) == 1 && isTransactionKey(expBaseKey) {
+			meta := &proto.MVCCMetadata{}
+			txn := &proto.Transaction{}
+			if err := gogoproto.Unmarshal(vals[0], meta); err != nil || meta.Value == nil {
+				log.Errorf("unable to unmarshal MVCC metadata for transaction record %q: %v", expBaseKey, err)
+			} else if err := gogoproto.Unmarshal(meta.Value.Bytes, txn); err != nil {
+				log.Errorf("unable to unmarshal transaction record %q: %s", expBaseKey, err)
+			} else if isTransactionGCable(txn) {
+				lastActive := txn.Timestamp
+				if txn.LastHeartbeat != nil && lastActive.Less(*txn.LastHeartbeat) {
+					lastActive = *txn.LastHeartbeat
+				}
+				if lastActive.Less(txnExp) {
+					txnRecords = append(txnRecords, txn)
+					txnKeys = append(txnKeys, expBaseKey)
+				}
+			}
+			return
+		}
+		// Any other single row is an inline value, which is removed
+		// outright once it has expired.
+		if len(keys) == 1 {
+			meta := &proto.MVCCMetadata{}
+			if err := gogoproto.Unmarshal(vals[0], meta); err != nil {
+				log.Errorf("unable to unmarshal MVCC metadata for key %q: %s", keys[0], err)
+			} else if meta.Expiration != nil && meta.Expiration.Less(now) {
+				gcArgs.Keys = append(gcArgs.Keys, proto.InternalGCRequest_GCKey{Key: expBaseKey, Timestamp: now})
+			}
+			return
+		}
 		// If there's more than a single value for the key, possibly send for GC.
 		if len(keys) > 1 {
 			meta := &proto.MVCCMetadata{}
@@ -163,6 +217,7 @@ func (gcq *gcQueue) process(now proto.Timestamp, rng *Range) error {
 				// intent resolution if older than the threshold.
 				startIdx := 1
 				if meta.Txn != nil {
+					intentTxnIDs[string(meta.Txn.ID)] = struct{}{}
 					// Resolve intent asynchronously in a goroutine if the intent
 					// is older than the intent expiration threshold.
 					if meta.Timestamp.Less(intentExp) {
@@ -209,11 +264,28 @@ func (gcq *gcQueue) process(now proto.Timestamp, rng *Range) error {
 	// Handle last collected set of keys/vals.
 	processKeysAndValues()
 
+	// Transaction records are only removed once the range holds no
+	// intents of the transaction. Records are additionally kept until
+	// the coordinator has marked all intents resolved; see
+	// isTransactionGCable.
+	var txnGCKeys []proto.InternalGCRequest_GCKey
+	for i, txn := range txnRecords {
+		if _, ok := intentTxnIDs[string(txn.ID)]; !ok {
+			txnGCKeys = append(txnGCKeys, proto.InternalGCRequest_GCKey{Key: txnKeys[i]})
+		}
+	}
+	gcArgs.Keys = append(txnGCKeys, gcArgs.Keys...)
+
 	// Set start and end keys.
-	switch len(gcArgs.Keys) {
-	case 0:
+	switch {
+	case len(gcArgs.Keys) == 0:
 		return nil
-	case 1:
+	case len(txnGCKeys) > 0:
+		// Transaction records are addressed by their anchor keys, which
+		// may lie anywhere in the range.
+		gcArgs.Key = rng.Desc().StartKey
+		gcArgs.EndKey = rng.Desc().EndKey
+	case len(gcArgs.Keys) == 1:
 		gcArgs.Key = gcArgs.Keys[0].Key
 		gcArgs.EndKey = gcArgs.Key.Next()
 	default:
@@ -298,7 +370,8 @@ func (gcq *gcQueue) resolveIntent(rng *Range, key proto.Key, meta *proto.MVCCMet
 // lookupGCPolicy queries the gossip prefix config map based on the
 // supplied range's start key. It queries all matching config prefixes
 // and then iterates from most specific to least, returning the first
-// non-nil GC policy.
+// non-nil GC policy. The TTL of the returned policy is overridden by
+// the range's GC TTL, if one is set in its GC metadata.
 func (gcq *gcQueue) lookupGCPolicy(rng *Range) (proto.GCPolicy, error) {
 	info, err := rng.rm.Gossip().GetInfo(gossip.KeyConfigZone)
 	if err != nil {
@@ -337,5 +410,15 @@ func (gcq *gcQueue) lookupGCPolicy(rng *Range) (proto.GCPolicy, error) {
 	if gc == nil {
 		return proto.GCPolicy{}, util.Errorf("no zone for range with start key %q", rng.Desc().StartKey)
 	}
-	return *gc, nil
+	policy := *gc
+
+	// A GC TTL set on the range itself overrides the zone's TTL.
+	gcMeta, err := rng.GetGCMetadata()
+	if err != nil {
+		return proto.GCPolicy{}, err
+	}
+	if gcMeta.TTLSeconds != nil {
+		policy.TTLSeconds = *gcMeta.TTLSeconds
+	}
+	return policy, nil
 }
@@ -19,6 +19,7 @@ package storage
 
 import (
 	"math"
+	"reflect"
 	"testing"
 	"time"
 
@@ -290,6 +291,187 @@ func TestGCQueueProcess(t *testing.T) {
 	}
 }
 
+// TestGCQueueRangeTTL verifies that a GC TTL set on a range overrides
+// the zone's TTL for that range only: versions older than the short
+// TTL are collected on the range it's set on, while an identical set
+// of versions on a range with the default TTL is retained.
+func TestGCQueueRangeTTL(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	tc := testContext{}
+	tc.Start(t)
+	defer tc.Stop()
+
+	const now int64 = 48 * 60 * 60 * 1E9 // 2d past the epoch
+	tc.manualClock.Set(now)
+
+	ts1 := makeTS(now-3*60*60*1E9, 0) // 3h old
+	ts2 := makeTS(now-2*60*60*1E9, 0) // 2h old
+	ts3 := makeTS(now-1E9, 0)         // 1s old
+
+	rng1 := tc.rng
+	rng2 := splitTestRange(tc.store, proto.KeyMin, proto.Key("m"), t)
+	key1 := proto.Key("a")
+	key2 := proto.Key("n")
+	for _, rk := range []struct {
+		rng *Range
+		key proto.Key
+	}{{rng1, key1}, {rng2, key2}} {
+		for _, ts := range []proto.Timestamp{ts1, ts2, ts3} {
+			pArgs, pReply := putArgs(rk.key, []byte("value"), rk.rng.Desc().RaftID, tc.store.StoreID())
+			pArgs.Timestamp = ts
+			if err := rk.rng.AddCmd(rk.rng.context(), client.Call{Args: pArgs, Reply: pReply}, true); err != nil {
+				t.Fatalf("could not put data: %s", err)
+			}
+		}
+	}
+
+	// Set a one hour TTL on the second range only.
+	const ttl = 60 * 60
+	if err := tc.store.SetRangeGCTTL(rng2.Desc().RaftID, ttl); err != nil {
+		t.Fatal(err)
+	}
+
+	gcQ := newGCQueue()
+	for _, rng := range []*Range{rng1, rng2} {
+		if err := gcQ.process(tc.clock.Now(), rng); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The first range keeps all versions under the default TTL; the
+	// second retains only its most recent version.
+	testCases := []struct {
+		rng    *Range
+		key    proto.Key
+		expTS  []proto.Timestamp
+		expTTL int32
+	}{
+		{rng1, key1, []proto.Timestamp{ts3, ts2, ts1}, 0},
+		{rng2, key2, []proto.Timestamp{ts3}, ttl},
+	}
+	for i, test := range testCases {
+		kvs, err := engine.Scan(tc.store.Engine(), engine.MVCCEncodeKey(test.key), engine.MVCCEncodeKey(test.key.Next()), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var tss []proto.Timestamp
+		for _, kv := range kvs {
+			if _, ts, isValue := engine.MVCCDecodeKey(kv.Key); isValue {
+				tss = append(tss, ts)
+			}
+		}
+		if !reflect.DeepEqual(tss, test.expTS) {
+			t.Errorf("%d: expected versions %s; got %s", i, test.expTS, tss)
+		}
+		// The range's TTL must survive the GC metadata update.
+		gcMeta, err := test.rng.GetGCMetadata()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ttl := gcMeta.GetTTLSeconds(); ttl != test.expTTL {
+			t.Errorf("%d: expected GC TTL %d; got %d", i, test.expTTL, ttl)
+		}
+	}
+
+	// Only the range on which versions were collected rejects reads
+	// below its GC threshold.
+	if threshold := rng1.getGCThreshold(); !threshold.Equal(proto.ZeroTimestamp) {
+		t.Errorf("expected no GC threshold on range 1; got %s", threshold)
+	}
+	expThreshold := makeTS(now-ttl*1E9, 0)
+	if threshold := rng2.getGCThreshold(); !threshold.Equal(expThreshold) {
+		t.Errorf("expected GC threshold %s on range 2; got %s", expThreshold, threshold)
+	}
+	gArgs, gReply := getArgs(key2, rng2.Desc().RaftID, tc.store.StoreID())
+	gArgs.Timestamp = ts2
+	err := rng2.AddCmd(rng2.context(), client.Call{Args: gArgs, Reply: gReply}, true)
+	if err == nil {
+		t.Errorf("expected read below GC threshold to fail")
+	}
+}
+
+// TestGCQueueTransactionRecords verifies that aborted and committed
+// transaction records with resolved intents are removed once older
+// than the GC TTL, while pending, recently active, unresolved and
+// still intent-holding transaction records are retained.
+func TestGCQueueTransactionRecords(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	tc := testContext{}
+	tc.Start(t)
+	defer tc.Stop()
+
+	const now int64 = 48 * 60 * 60 * 1E9 // 2d past the epoch
+	tc.manualClock.Set(now)
+
+	ts1 := makeTS(now-25*60*60*1E9, 0) // 25h old
+	ts2 := makeTS(now-60*60*1E9, 0)    // 1h old
+	ts3 := makeTS(now-1E9, 0)          // 1s old
+
+	testCases := []struct {
+		key       proto.Key
+		status    proto.TransactionStatus
+		ts        proto.Timestamp
+		heartbeat *proto.Timestamp
+		resolved  bool
+		intent    bool
+		expGC     bool
+	}{
+		// Expired records with resolved intents are removed.
+		{proto.Key("a"), proto.COMMITTED, ts1, nil, true, false, true},
+		{proto.Key("b"), proto.ABORTED, ts1, nil, true, false, true},
+		// Pending records are never removed.
+		{proto.Key("c"), proto.PENDING, ts1, nil, true, false, false},
+		// Records which haven't expired are retained.
+		{proto.Key("d"), proto.COMMITTED, ts2, nil, true, false, false},
+		{proto.Key("e"), proto.ABORTED, ts1, &ts2, true, false, false},
+		// Records not known to be resolved are retained, even if the
+		// unresolved intents live on other ranges.
+		{proto.Key("f"), proto.COMMITTED, ts1, nil, false, false, false},
+		{proto.Key("h"), proto.ABORTED, ts1, nil, false, false, false},
+		// Records of transactions with unresolved intents are retained.
+		{proto.Key("g"), proto.ABORTED, ts1, nil, false, true, false},
+	}
+
+	txnKeys := make([]proto.Key, len(testCases))
+	for i, test := range testCases {
+		txn := newTransaction("test", test.key, 1, proto.SERIALIZABLE, tc.clock)
+		if test.intent {
+			pArgs, pReply := putArgs(test.key, []byte("value"), tc.rng.Desc().RaftID, tc.store.StoreID())
+			pArgs.Timestamp = ts3
+			pArgs.Txn = txn
+			pArgs.Txn.Timestamp = ts3
+			if err := tc.rng.AddCmd(tc.rng.context(), client.Call{Args: pArgs, Reply: pReply}, true); err != nil {
+				t.Fatalf("%d: could not put data: %s", i, err)
+			}
+		}
+		txn.Status = test.status
+		txn.Timestamp = test.ts
+		txn.LastHeartbeat = test.heartbeat
+		if test.resolved {
+			txn.IntentsResolved = gogoproto.Bool(true)
+		}
+		txnKeys[i] = keys.TransactionKey(txn.Key, txn.ID)
+		if err := engine.MVCCPutProto(tc.store.Engine(), nil, txnKeys[i], proto.ZeroTimestamp, nil, txn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gcQ := newGCQueue()
+	if err := gcQ.process(tc.clock.Now(), tc.rng); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, test := range testCases {
+		ok, err := engine.MVCCGetProto(tc.store.Engine(), txnKeys[i], proto.ZeroTimestamp, true, nil, &proto.Transaction{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok == test.expGC {
+			t.Errorf("%d: expected GC of %s transaction record at %q to be %t", i, test.status, test.key, test.expGC)
+		}
+	}
+}
+
 // TestGCQueueLookupGCPolicy verifies the hierarchical lookup of GC
 // policy in the event that the longest matching key prefix does not
 // have a zone configured.
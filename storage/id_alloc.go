@@ -18,12 +18,17 @@
 package storage
 
 import (
-	"fmt"
+	"sync"
 	"sync/atomic"
 	"time"
 
+	gogoproto "github.com/gogo/protobuf/proto"
+	"golang.org/x/net/context"
+
 	"github.com/cockroachdb/cockroach/client"
+	"github.com/cockroachdb/cockroach/keys"
 	"github.com/cockroachdb/cockroach/proto"
+	"github.com/cockroachdb/cockroach/storage/engine"
 	"github.com/cockroachdb/cockroach/util"
 	"github.com/cockroachdb/cockroach/util/log"
 	"github.com/cockroachdb/cockroach/util/retry"
@@ -36,22 +41,145 @@ const allocationTrigger = 0
 // idAllocationRetryOpts sets the retry options for handling RaftID
 // allocation errors.
 var idAllocationRetryOpts = retry.Options{
+	Tag:         "id allocation",
 	Backoff:     50 * time.Millisecond,
 	MaxBackoff:  5 * time.Second,
 	Constant:    2,
 	MaxAttempts: 0,
 }
 
+// idAllocationRetryDeadline is the default time after which a block
+// fetch which keeps failing is abandoned and the error is returned
+// to waiting callers. A zero deadline retries until the stopper
+// drains.
+const idAllocationRetryDeadline = 1 * time.Minute
+
+// IDAllocatorMetrics is a snapshot of an idAllocator's counters.
+type IDAllocatorMetrics struct {
+	BlocksFetched int64 // Increments of the generator key
+	IDsAllocated  int64 // IDs handed out via Allocate
+	Waits         int64 // Allocate calls which blocked waiting for a refill
+	BlockedNanos  int64 // Cumulative time callers spent blocked in Allocate
+	BlockSize     int64 // Current effective block size
+}
+
+// adaptiveBlockOptions configures an idAllocator whose effective
+// block size grows under sustained demand. Each time Allocate finds
+// the channel empty is a starvation event; when more than Threshold
+// such events occur within Window, the block size doubles, up to
+// MaxBlockSize. If FastInterval is set, the block size also doubles
+// whenever two consecutive blocks are exhausted less than
+// FastInterval apart. When a full Window passes without starvation
+// or growth, the block size is halved on the next block fetch, down
+// to the configured minimum.
+type adaptiveBlockOptions struct {
+	MaxBlockSize int64         // Upper bound on the effective block size
+	Window       time.Duration // Sliding window for starvation events
+	Threshold    int           // Starvation events tolerated within Window
+	FastInterval time.Duration // Grow when blocks exhaust faster than this (0 disables)
+}
+
+// idAllocatorOptions holds optional settings for an idAllocator.
+type idAllocatorOptions struct {
+	// Adaptive, if non-nil, enables adaptive block sizing.
+	Adaptive *adaptiveBlockOptions
+	// ExpectedMin, if positive, is the minimum value the generator key
+	// is expected to hold. Construction fails if the key is found below
+	// it, e.g. because it was manually reset or restored from an old
+	// backup, since handing out IDs from it could produce duplicates.
+	ExpectedMin int64
+	// PrefetchWatermark, if positive, is the fraction of the ids
+	// channel's capacity below which Allocate prefetches the next block
+	// in the background, keeping IDs warm at block boundaries. Zero
+	// preserves the default behavior of fetching only at the midpoint
+	// allocationTrigger.
+	PrefetchWatermark float64
+	// Persistent, if true, records the highest generator value fetched
+	// in a store-local key in Engine. On startup the cached value is
+	// compared against the live generator key and the larger of the two
+	// is used, so IDs are not reused even if the generator key has
+	// regressed (e.g. after a restore).
+	Persistent bool
+	Engine     engine.Engine
+	// LocalCache, if true, enables a fast path for a single active
+	// caller: IDs immediately available on the ids channel are moved
+	// into a locally cached block in bulk and handed out from there
+	// without channel synchronization. Once a concurrent caller is
+	// detected, allocation falls back to the channel and the cached IDs
+	// are moved to the free list.
+	LocalCache bool
+}
+
 // An idAllocator is used to increment a key in allocation blocks
 // of arbitrary size starting at a minimum ID.
 type idAllocator struct {
 	idKey     atomic.Value
 	db        *client.DB
-	minID     int64      // Minimum ID to return
+	minID     int64      // Minimum ID to return; atomically updated
 	blockSize int64      // Block allocation size
 	ids       chan int64 // Channel of available IDs
-	closed    int32      // Atomically updated closed "bool"
 	stopper   *util.Stopper
+	waiters   int32 // Atomically updated count of callers blocked in AllocateCtx
+
+	// Failed generator key increments are retried with exponential
+	// backoff according to retryOpts. A block fetch is abandoned after
+	// retryOpts.MaxAttempts attempts or after retryDeadline, whichever
+	// comes first (zero values disable the respective limit).
+	retryOpts     retry.Options
+	retryDeadline time.Duration
+
+	adaptive     *adaptiveBlockOptions // nil for a fixed block size
+	curBlockSize int64                 // Effective block size; atomically updated
+
+	prefetchWatermark float64 // Channel fill fraction triggering a prefetch (0 to disable)
+	prefetched        int32   // Atomically updated "bool"; true if a prefetch stands in for the next trigger's fetch
+
+	localCache bool    // Enables the single-caller fast path
+	active     int32   // Atomically updated count of callers in AllocateCtx (localCache only)
+	contended  int32   // Atomically updated "bool"; set when concurrent callers are detected
+	cache      []int64 // Cached IDs; only accessed by a sole active caller
+
+	engine    engine.Engine // Store-local engine for the high-water mark; nil if not persistent
+	hwMu      sync.Mutex    // Serializes high-water mark updates
+	highWater int64         // Highest persisted generator value; protected by hwMu
+
+	maxAllocated int64 // Highest ID handed out so far; atomically updated
+	numReleased  int32 // Atomically updated size of released
+
+	mu          sync.Mutex         // Protects the fields below
+	freeList    []int64            // Released IDs available for reuse
+	released    map[int64]struct{} // Released IDs not yet handed out again
+	failC       chan struct{}      // Closed when a block fetch is abandoned
+	fetchErr    error              // Error which caused the last abandoned fetch
+	starvations []time.Time        // Recent starvation events (adaptive only)
+	lastResize  time.Time          // Last change to curBlockSize (adaptive only)
+	lastTrigger time.Time          // Last block exhaustion (adaptive only)
+
+	metrics IDAllocatorMetrics // Atomically updated counters
+}
+
+// An InvalidIDAllocatorArgsError indicates that an ID allocator was
+// created with an invalid argument. Param names the offending
+// parameter and Value holds the value which was supplied for it.
+type InvalidIDAllocatorArgsError struct {
+	Param string
+	Value interface{}
+	err   error
+}
+
+// newInvalidIDAllocatorArgsError returns an InvalidIDAllocatorArgsError
+// for param and value, formatted like util.Errorf at the caller.
+func newInvalidIDAllocatorArgsError(param string, value interface{}, format string, a ...interface{}) error {
+	return &InvalidIDAllocatorArgsError{
+		Param: param,
+		Value: value,
+		err:   util.ErrorfSkipFrames(1, format, a...),
+	}
+}
+
+// Error formats error.
+func (e *InvalidIDAllocatorArgsError) Error() string {
+	return e.err.Error()
 }
 
 // newIDAllocator creates a new ID allocator which increments the
@@ -60,84 +188,956 @@ type idAllocator struct {
 // integers.
 func newIDAllocator(idKey proto.Key, db *client.DB, minID int64, blockSize int64,
 	stopper *util.Stopper) (*idAllocator, error) {
+	return newIDAllocatorWithOptions(idKey, db, minID, blockSize, idAllocatorOptions{}, stopper)
+}
+
+// newAdaptiveIDAllocator creates a new ID allocator like
+// newIDAllocator, except that the block size starts at blockSize and
+// adapts to the allocation rate as configured by opts.
+func newAdaptiveIDAllocator(idKey proto.Key, db *client.DB, minID int64, blockSize int64,
+	opts adaptiveBlockOptions, stopper *util.Stopper) (*idAllocator, error) {
+	return newIDAllocatorWithOptions(idKey, db, minID, blockSize, idAllocatorOptions{Adaptive: &opts}, stopper)
+}
+
+// newIDAllocatorWithOptions creates a new ID allocator like
+// newIDAllocator, configured by the supplied options.
+func newIDAllocatorWithOptions(idKey proto.Key, db *client.DB, minID int64, blockSize int64,
+	opts idAllocatorOptions, stopper *util.Stopper) (*idAllocator, error) {
 	if minID <= allocationTrigger {
-		return nil, util.Errorf("minID must be > %d", allocationTrigger)
+		return nil, newInvalidIDAllocatorArgsError("minID", minID, "minID must be > %d", allocationTrigger)
 	}
 	if blockSize < 1 {
-		return nil, util.Errorf("blockSize must be a positive integer: %d", blockSize)
+		return nil, newInvalidIDAllocatorArgsError("blockSize", blockSize, "blockSize must be a positive integer: %d", blockSize)
+	}
+	adaptive := opts.Adaptive
+	maxBlockSize := blockSize
+	if adaptive != nil {
+		if adaptive.MaxBlockSize < blockSize {
+			return nil, newInvalidIDAllocatorArgsError("MaxBlockSize", adaptive.MaxBlockSize,
+				"MaxBlockSize %d must be >= blockSize %d", adaptive.MaxBlockSize, blockSize)
+		}
+		if adaptive.Window <= 0 {
+			return nil, newInvalidIDAllocatorArgsError("Window", adaptive.Window, "Window must be positive: %s", adaptive.Window)
+		}
+		if adaptive.Threshold < 1 {
+			return nil, newInvalidIDAllocatorArgsError("Threshold", adaptive.Threshold,
+				"Threshold must be a positive integer: %d", adaptive.Threshold)
+		}
+		maxBlockSize = adaptive.MaxBlockSize
+	}
+	if opts.PrefetchWatermark < 0 || opts.PrefetchWatermark >= 1 {
+		return nil, newInvalidIDAllocatorArgsError("PrefetchWatermark", opts.PrefetchWatermark,
+			"PrefetchWatermark must be in [0, 1): %f", opts.PrefetchWatermark)
+	}
+	chanSize := maxBlockSize + maxBlockSize/2 + 1
+	if opts.PrefetchWatermark > 0 {
+		// Leave room for a prefetched block in addition to the block
+		// fetched at the allocationTrigger.
+		chanSize += maxBlockSize
+	}
+	if opts.Persistent && opts.Engine == nil {
+		return nil, newInvalidIDAllocatorArgsError("Engine", opts.Engine, "Engine must be specified for a persistent allocator")
+	}
+	if opts.ExpectedMin > 0 {
+		r, err := db.Get(idKey)
+		if err != nil {
+			return nil, err
+		}
+		var value int64
+		if r.Exists() {
+			value = r.ValueInt()
+		}
+		if value < opts.ExpectedMin {
+			return nil, util.Errorf("allocator key %s is set at %d, below the expected minimum %d; refusing to start",
+				idKey, value, opts.ExpectedMin)
+		}
 	}
 	ia := &idAllocator{
-		db:        db,
-		minID:     minID,
-		blockSize: blockSize,
-		ids:       make(chan int64, blockSize+blockSize/2+1),
-		stopper:   stopper,
+		db:                db,
+		minID:             minID,
+		blockSize:         blockSize,
+		ids:               make(chan int64, chanSize),
+		stopper:           stopper,
+		retryOpts:         idAllocationRetryOpts,
+		retryDeadline:     idAllocationRetryDeadline,
+		failC:             make(chan struct{}),
+		released:          map[int64]struct{}{},
+		adaptive:          adaptive,
+		prefetchWatermark: opts.PrefetchWatermark,
+		localCache:        opts.LocalCache,
+		curBlockSize:      blockSize,
+		lastResize:        time.Now(),
 	}
 	ia.idKey.Store(idKey)
+	if opts.Persistent {
+		ia.engine = opts.Engine
+		if err := ia.loadHighWater(); err != nil {
+			return nil, err
+		}
+	}
 	ia.ids <- allocationTrigger
 	return ia, nil
 }
 
-// Allocate allocates a new ID from the global KV DB.
+// loadHighWater reads the cached high-water mark from the store-local
+// engine and, if the live generator key has fallen below it, advances
+// the generator key past it via EnsureFloor.
+func (ia *idAllocator) loadHighWater() error {
+	idKey := ia.idKey.Load().(proto.Key)
+	value, err := engine.MVCCGet(ia.engine, keys.StoreIDAllocHighWaterKey(idKey), proto.ZeroTimestamp, true, nil)
+	if err != nil {
+		return err
+	}
+	if value == nil {
+		return nil
+	}
+	ia.highWater = value.GetInteger()
+	return ia.EnsureFloor(ia.highWater + 1)
+}
+
+// persistHighWater records newValue as the high-water mark in the
+// store-local engine if it exceeds the current mark. Failures are
+// logged but otherwise ignored, as the high-water mark is only a
+// safeguard.
+func (ia *idAllocator) persistHighWater(newValue int64) {
+	if ia.engine == nil {
+		return
+	}
+	ia.hwMu.Lock()
+	defer ia.hwMu.Unlock()
+	if newValue <= ia.highWater {
+		return
+	}
+	idKey := ia.idKey.Load().(proto.Key)
+	value := proto.Value{Integer: gogoproto.Int64(newValue)}
+	if err := engine.MVCCPut(ia.engine, nil, keys.StoreIDAllocHighWaterKey(idKey), proto.ZeroTimestamp, value, nil); err != nil {
+		log.Warningf("unable to persist id allocator high-water mark %d: %s", newValue, err)
+		return
+	}
+	ia.highWater = newValue
+}
+
+// Allocate allocates a new ID from the global KV DB. IDs which
+// have been returned via Release are handed out first.
 func (ia *idAllocator) Allocate() (int64, error) {
+	return ia.AllocateCtx(context.Background())
+}
+
+// AllocateCtx is like Allocate, but returns ctx.Err() if the context
+// is cancelled or its deadline expires while waiting for an ID.
+func (ia *idAllocator) AllocateCtx(ctx context.Context) (int64, error) {
+	if ia.localCache {
+		defer atomic.AddInt32(&ia.active, -1)
+		if atomic.AddInt32(&ia.active, 1) == 1 {
+			if id, ok, err := ia.allocateCached(); ok || err != nil {
+				return id, err
+			}
+		} else {
+			atomic.StoreInt32(&ia.contended, 1)
+		}
+	}
+	if id, ok := ia.popFree(); ok {
+		atomic.AddInt64(&ia.metrics.IDsAllocated, 1)
+		ia.noteAllocated(id)
+		return id, nil
+	}
 	for {
-		id := <-ia.ids
+		var id int64
+		select {
+		case id = <-ia.ids:
+		default:
+			// No ID is immediately available; account for the time
+			// spent waiting on a block to be fetched.
+			start := time.Now()
+			atomic.AddInt64(&ia.metrics.Waits, 1)
+			ia.noteStarvation(start)
+			failC := ia.failChan()
+			atomic.AddInt32(&ia.waiters, 1)
+			var err error
+			select {
+			case id = <-ia.ids:
+			case <-failC:
+				err = ia.fetchError()
+			case <-ctx.Done():
+				err = ctx.Err()
+			case <-ia.stopper.ShouldDrain():
+				err = util.Errorf("could not allocate ID; system is draining")
+			}
+			atomic.AddInt32(&ia.waiters, -1)
+			atomic.AddInt64(&ia.metrics.BlockedNanos, time.Since(start).Nanoseconds())
+			if err != nil {
+				return 0, err
+			}
+		}
 		if id == allocationTrigger {
-			if !ia.stopper.StartTask() {
-				if atomic.CompareAndSwapInt32(&ia.closed, 0, 1) {
-					close(ia.ids)
-				}
-				return 0, util.Errorf("could not allocate ID; system is draining")
+			if err := ia.triggerBlock(); err != nil {
+				return 0, err
 			}
-			go func() {
-				ia.allocateBlock(ia.blockSize)
-				ia.stopper.FinishTask()
-			}()
-		} else {
+		} else if id >= ia.getMinID() {
+			atomic.AddInt64(&ia.metrics.IDsAllocated, 1)
+			ia.noteAllocated(id)
+			ia.maybePrefetch()
 			return id, nil
 		}
+		// IDs buffered before the floor was raised are discarded.
+	}
+}
+
+// allocateCached hands out an ID from the locally cached block,
+// refilling the cache with whatever IDs are immediately available on
+// the ids channel. It must only be called by the sole active caller
+// of AllocateCtx, which guarantees exclusive access to the cache.
+// Returns false if no ID is available without blocking, in which case
+// the caller falls back to waiting on the channel.
+func (ia *idAllocator) allocateCached() (int64, bool, error) {
+	if atomic.CompareAndSwapInt32(&ia.contended, 1, 0) && len(ia.cache) > 0 {
+		// Other callers have been active since the cache was filled;
+		// don't hoard IDs they may otherwise be waiting for.
+		ia.releaseAll(ia.cache)
+		ia.cache = ia.cache[:0]
+	}
+	if id, ok := ia.popFree(); ok {
+		atomic.AddInt64(&ia.metrics.IDsAllocated, 1)
+		ia.noteAllocated(id)
+		return id, true, nil
+	}
+	minID := ia.getMinID()
+	for {
+		for len(ia.cache) > 0 {
+			id := ia.cache[0]
+			ia.cache = ia.cache[1:]
+			if id >= minID {
+				atomic.AddInt64(&ia.metrics.IDsAllocated, 1)
+				ia.noteAllocated(id)
+				ia.maybePrefetch()
+				return id, true, nil
+			}
+		}
+		// The cache is empty; move everything buffered on the channel
+		// into it, triggering the next block fetch on the way.
+		ia.cache = ia.cache[:0]
+	refill:
+		for n := len(ia.ids); n > 0; n-- {
+			select {
+			case id := <-ia.ids:
+				if id == allocationTrigger {
+					if err := ia.triggerBlock(); err != nil {
+						return 0, false, err
+					}
+					continue
+				}
+				ia.cache = append(ia.cache, id)
+			default:
+				break refill
+			}
+		}
+		if len(ia.cache) == 0 {
+			return 0, false, nil
+		}
+	}
+}
+
+// NumWaiters returns the number of callers currently blocked in
+// Allocate waiting for a block of IDs to be fetched.
+func (ia *idAllocator) NumWaiters() int {
+	return int(atomic.LoadInt32(&ia.waiters))
+}
+
+// AllocateN allocates n IDs in a single call. Released IDs are used
+// first, followed by whatever IDs are immediately available on the
+// channel. Any shortfall is covered by incrementing the generator key
+// by the shortfall, plus however many IDs below minID the increment
+// would otherwise yield. If the allocation trigger is encountered
+// while draining the channel, the next background block fetch is only
+// started once the shortfall has been covered, so that the two don't
+// interleave on the generator key.
+//
+// NOTE: the returned IDs are NOT guaranteed to be contiguous or
+// sorted. IDs taken from the free list or the channel may be
+// interleaved with IDs handed out to concurrent callers; only the
+// portion fetched directly from the generator key is contiguous.
+//
+// AllocateN never returns a partial result: if the system is
+// draining, an error is returned and any IDs gathered so far are
+// released for later reuse.
+func (ia *idAllocator) AllocateN(n int) ([]int64, error) {
+	if n < 0 {
+		return nil, util.Errorf("cannot allocate a negative number of IDs: %d", n)
+	}
+	ids := make([]int64, 0, n)
+	for len(ids) < n {
+		id, ok := ia.popFree()
+		if !ok {
+			break
+		}
+		ids = append(ids, id)
+	}
+
+	// Drain whatever is immediately available on the channel.
+	triggered := false
+drain:
+	for len(ids) < n {
+		select {
+		case id := <-ia.ids:
+			if id == allocationTrigger {
+				triggered = true
+				continue
+			}
+			if id >= ia.getMinID() {
+				ids = append(ids, id)
+			}
+		default:
+			break drain
+		}
+	}
+
+	// Cover the shortfall directly from the generator key.
+	if len(ids) < n {
+		if err := ia.allocateShortfall(&ids, n); err != nil {
+			ia.releaseAll(ids)
+			if triggered {
+				// Let the next caller start the block fetch.
+				select {
+				case ia.ids <- allocationTrigger:
+				default:
+					// The channel is full of IDs, so no caller is waiting.
+				}
+			}
+			return nil, err
+		}
+	}
+	if triggered {
+		if err := ia.triggerBlock(); err != nil {
+			ia.releaseAll(ids)
+			return nil, err
+		}
+	}
+	atomic.AddInt64(&ia.metrics.IDsAllocated, int64(len(ids)))
+	for _, id := range ids {
+		ia.noteAllocated(id)
+	}
+	return ids, nil
+}
+
+// allocateShortfall appends IDs fetched directly from the generator
+// key to *ids until it holds n IDs. The first increment is sized to
+// the shortfall; if the generator key turns out to lie below minID,
+// the next increment also skips the IDs up to minID, as in
+// allocateBlock.
+func (ia *idAllocator) allocateShortfall(ids *[]int64, n int) error {
+	if !ia.stopper.StartTask() {
+		return util.Errorf("could not allocate IDs; system is draining")
+	}
+	defer ia.stopper.FinishTask()
+	var skip int64
+	for len(*ids) < n {
+		incr := int64(n-len(*ids)) + skip
+		newValue, err := ia.increment(incr)
+		if err != nil {
+			return err
+		}
+		start := newValue - incr + 1
+		minID := ia.getMinID()
+		if start < minID {
+			start = minID
+		}
+		for i := start; i <= newValue; i++ {
+			*ids = append(*ids, i)
+		}
+		skip = 0
+		if newValue < minID-1 {
+			skip = minID - 1 - newValue
+		}
+	}
+	return nil
+}
+
+// triggerBlock starts an asynchronous allocation of the next block
+// of IDs. If a prefetched block already stands in for this fetch, no
+// block is allocated; the allocationTrigger is instead sent again so
+// that the block after the prefetched one is still fetched. Returns an
+// error if the system is draining; callers waiting for IDs are woken
+// by the stopper's drain channel.
+func (ia *idAllocator) triggerBlock() error {
+	if !ia.stopper.StartTask() {
+		return util.Errorf("could not allocate ID; system is draining")
+	}
+	if atomic.CompareAndSwapInt32(&ia.prefetched, 1, 0) {
+		go func() {
+			ia.sendID(allocationTrigger)
+			ia.stopper.FinishTask()
+		}()
+		return nil
+	}
+	ia.noteBlockExhausted(time.Now())
+	blockSize := ia.BlockSize()
+	go func() {
+		ia.allocateBlock(blockSize, false)
+		ia.stopper.FinishTask()
+	}()
+	return nil
+}
+
+// maybePrefetch starts a background fetch of the next block if
+// prefetching is enabled, the ids channel has dropped below the
+// watermark and no prefetched block is pending. The prefetched block
+// takes the place of the fetch at the next allocationTrigger, so it
+// carries no allocationTrigger of its own; this keeps a single chain
+// of block fetches going regardless of how often prefetching kicks in.
+func (ia *idAllocator) maybePrefetch() {
+	if ia.prefetchWatermark <= 0 ||
+		float64(len(ia.ids)) >= ia.prefetchWatermark*float64(cap(ia.ids)) {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&ia.prefetched, 0, 1) {
+		return
+	}
+	if !ia.stopper.StartTask() {
+		atomic.StoreInt32(&ia.prefetched, 0)
+		return
+	}
+	blockSize := ia.BlockSize()
+	go func() {
+		ia.allocateBlock(blockSize, true)
+		ia.stopper.FinishTask()
+	}()
+}
+
+// noteStarvation records that a caller found the ids channel empty
+// at time now. For an adaptive allocator, the block size is doubled
+// once more than Threshold such events fall within Window.
+func (ia *idAllocator) noteStarvation(now time.Time) {
+	if ia.adaptive == nil {
+		return
+	}
+	ia.mu.Lock()
+	defer ia.mu.Unlock()
+	ia.pruneStarvationsLocked(now)
+	ia.starvations = append(ia.starvations, now)
+	if len(ia.starvations) <= ia.adaptive.Threshold {
+		return
+	}
+	ia.growBlockSizeLocked(now)
+	ia.starvations = ia.starvations[:0]
+}
+
+// noteBlockExhausted records that the allocation trigger was reached
+// at time now, meaning the next block must be fetched. For an
+// adaptive allocator, the block size is grown if the previous block
+// was exhausted within FastInterval, or shrunk if demand has been
+// low for a full Window.
+func (ia *idAllocator) noteBlockExhausted(now time.Time) {
+	if ia.adaptive == nil {
+		return
+	}
+	ia.mu.Lock()
+	defer ia.mu.Unlock()
+	last := ia.lastTrigger
+	ia.lastTrigger = now
+	if ia.adaptive.FastInterval > 0 && !last.IsZero() && now.Sub(last) < ia.adaptive.FastInterval {
+		ia.growBlockSizeLocked(now)
+		return
+	}
+	ia.maybeShrinkBlockSizeLocked(now)
+}
+
+// growBlockSizeLocked doubles the block size of an adaptive
+// allocator, up to MaxBlockSize. ia.mu must be held.
+func (ia *idAllocator) growBlockSizeLocked(now time.Time) {
+	cur := atomic.LoadInt64(&ia.curBlockSize)
+	if next := cur * 2; cur < ia.adaptive.MaxBlockSize {
+		if next > ia.adaptive.MaxBlockSize {
+			next = ia.adaptive.MaxBlockSize
+		}
+		atomic.StoreInt64(&ia.curBlockSize, next)
+		ia.lastResize = now
+		if log.V(1) {
+			log.Infof("id allocator block size grown from %d to %d", cur, next)
+		}
+	}
+}
+
+// maybeShrinkBlockSizeLocked halves the block size of an adaptive
+// allocator, down to the configured minimum, if neither a starvation
+// event nor a resize has occurred within the last Window. ia.mu must
+// be held.
+func (ia *idAllocator) maybeShrinkBlockSizeLocked(now time.Time) {
+	ia.pruneStarvationsLocked(now)
+	if len(ia.starvations) > 0 || now.Sub(ia.lastResize) < ia.adaptive.Window {
+		return
+	}
+	cur := atomic.LoadInt64(&ia.curBlockSize)
+	if next := cur / 2; cur > ia.blockSize {
+		if next < ia.blockSize {
+			next = ia.blockSize
+		}
+		atomic.StoreInt64(&ia.curBlockSize, next)
+		ia.lastResize = now
+		if log.V(1) {
+			log.Infof("id allocator block size shrunk from %d to %d", cur, next)
+		}
+	}
+}
+
+// pruneStarvationsLocked drops starvation events which fall outside
+// the sliding window ending at now. ia.mu must be held.
+func (ia *idAllocator) pruneStarvationsLocked(now time.Time) {
+	cutoff := now.Add(-ia.adaptive.Window)
+	i := 0
+	for ; i < len(ia.starvations); i++ {
+		if ia.starvations[i].After(cutoff) {
+			break
+		}
+	}
+	ia.starvations = ia.starvations[i:]
+}
+
+// Metrics returns a snapshot of the allocator's counters.
+func (ia *idAllocator) Metrics() IDAllocatorMetrics {
+	return IDAllocatorMetrics{
+		BlocksFetched: atomic.LoadInt64(&ia.metrics.BlocksFetched),
+		IDsAllocated:  atomic.LoadInt64(&ia.metrics.IDsAllocated),
+		Waits:         atomic.LoadInt64(&ia.metrics.Waits),
+		BlockedNanos:  atomic.LoadInt64(&ia.metrics.BlockedNanos),
+		BlockSize:     ia.BlockSize(),
+	}
+}
+
+// BlockSize returns the current effective block size. This is the
+// configured block size unless the allocator is adaptive.
+func (ia *idAllocator) BlockSize() int64 {
+	return atomic.LoadInt64(&ia.curBlockSize)
+}
+
+// Release returns an ID obtained from Allocate which the caller
+// ended up not using (e.g. because a split aborted). The ID is kept
+// in a free list which Allocate prefers over the ids channel, so it is
+// handed out again by the next call to Allocate.
+//
+// An error is returned if id is below minID, was already released
+// and not handed out since, or lies above the highest ID handed out
+// so far. Callers must not release an ID which is still in use.
+func (ia *idAllocator) Release(id int64) error {
+	if minID := ia.getMinID(); id < minID {
+		return util.Errorf("cannot release id %d below minID %d", id, minID)
+	}
+	if max := atomic.LoadInt64(&ia.maxAllocated); id > max {
+		return util.Errorf("cannot release id %d which was never allocated; highest allocated id is %d", id, max)
+	}
+	ia.mu.Lock()
+	defer ia.mu.Unlock()
+	if _, ok := ia.released[id]; ok {
+		return util.Errorf("id %d released more than once", id)
+	}
+	ia.released[id] = struct{}{}
+	atomic.StoreInt32(&ia.numReleased, int32(len(ia.released)))
+	ia.freeList = append(ia.freeList, id)
+	return nil
+}
+
+// releaseAll returns all of the supplied IDs to the free list. Unlike
+// Release, the IDs are not validated; this is used to put back IDs
+// gathered internally but not handed out.
+func (ia *idAllocator) releaseAll(ids []int64) {
+	ia.mu.Lock()
+	defer ia.mu.Unlock()
+	for _, id := range ids {
+		ia.released[id] = struct{}{}
+	}
+	atomic.StoreInt32(&ia.numReleased, int32(len(ia.released)))
+	ia.freeList = append(ia.freeList, ids...)
+}
+
+// noteAllocated records that id has been handed out, so that it may
+// be released again.
+func (ia *idAllocator) noteAllocated(id int64) {
+	for {
+		max := atomic.LoadInt64(&ia.maxAllocated)
+		if id <= max || atomic.CompareAndSwapInt64(&ia.maxAllocated, max, id) {
+			break
+		}
+	}
+	if atomic.LoadInt32(&ia.numReleased) == 0 {
+		return
+	}
+	ia.mu.Lock()
+	defer ia.mu.Unlock()
+	delete(ia.released, id)
+	atomic.StoreInt32(&ia.numReleased, int32(len(ia.released)))
+}
+
+// popFree removes and returns the most recently released ID from the
+// free list, discarding any IDs below the current minimum. Returns
+// false if the free list is empty.
+func (ia *idAllocator) popFree() (int64, bool) {
+	ia.mu.Lock()
+	defer ia.mu.Unlock()
+	minID := ia.getMinID()
+	for n := len(ia.freeList); n > 0; n = len(ia.freeList) {
+		id := ia.freeList[n-1]
+		ia.freeList = ia.freeList[:n-1]
+		delete(ia.released, id)
+		atomic.StoreInt32(&ia.numReleased, int32(len(ia.released)))
+		if id >= minID {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// getMinID returns the minimum ID which may currently be handed out.
+func (ia *idAllocator) getMinID() int64 {
+	return atomic.LoadInt64(&ia.minID)
+}
+
+// EnsureFloor guarantees that no ID below min is handed out from now
+// on. The allocator's minimum ID is raised to min, discarding any
+// buffered or released IDs below it, and the generator key is
+// advanced so that its value is at least min-1. As with the recovery
+// from a negative generator value in allocateBlock, the key is only
+// ever incremented, so EnsureFloor is safe to call concurrently with
+// ongoing allocations (which may at worst skip some IDs).
+func (ia *idAllocator) EnsureFloor(min int64) error {
+	if min <= allocationTrigger {
+		return util.Errorf("floor must be > %d: %d", allocationTrigger, min)
+	}
+	for {
+		cur := ia.getMinID()
+		if cur >= min || atomic.CompareAndSwapInt64(&ia.minID, cur, min) {
+			break
+		}
+	}
+
+	idKey := ia.idKey.Load().(proto.Key)
+	r, err := ia.db.Inc(idKey, 0)
+	if err != nil {
+		return err
+	}
+	if value := r.ValueInt(); value < min-1 {
+		log.Warningf("allocator key is currently set at %d; floor is %d; incrementing to skip %d IDs",
+			value, min, min-1-value)
+		if _, err := ia.db.Inc(idKey, min-1-value); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
-// allocateBlock allocates a block of IDs using db.Increment and
-// sends all IDs on the ids channel. Midway through the block, a
-// special allocationTrigger ID is inserted which causes allocation
-// to occur before IDs run out to hide Increment latency.
-func (ia *idAllocator) allocateBlock(incr int64) {
+// allocateBlock allocates a block of blockSize IDs using
+// db.Increment and sends all IDs on the ids channel. Midway through
+// the block, a special allocationTrigger ID is inserted which causes
+// allocation to occur before IDs run out to hide Increment latency.
+//
+// Failed increments are retried with backoff. If the retry budget is
+// exhausted or the stopper starts draining, the fetch is abandoned:
+// all callers currently waiting in Allocate receive the error, and
+// the allocationTrigger is reinserted so that the next caller of
+// Allocate starts a fresh fetch (or fails, if the system is
+// draining).
+//
+// A prefetched block (see maybePrefetch) carries no allocationTrigger.
+// If its fetch is abandoned, the next allocationTrigger is made to
+// fetch a block after all; waiting callers are left to that fetch.
+func (ia *idAllocator) allocateBlock(blockSize int64, prefetch bool) {
+	incr := blockSize
 	var newValue int64
-	retryOpts := idAllocationRetryOpts
-	err := retry.WithBackoff(retryOpts, func() (retry.Status, error) {
+	for {
+		var err error
+		newValue, err = ia.increment(incr)
+		if err != nil {
+			log.Warningf("abandoning allocation of %d ids: %s", incr, err)
+			if prefetch {
+				// If the next allocationTrigger was already reached, it
+				// has been sent again and will fetch the block itself.
+				atomic.CompareAndSwapInt32(&ia.prefetched, 1, 0)
+				return
+			}
+			ia.failWaiters(err)
+			select {
+			case ia.ids <- allocationTrigger:
+			default:
+				// The channel is full of IDs, so no caller is waiting.
+			}
+			return
+		}
+		minID := ia.getMinID()
+		if newValue > minID {
+			break
+		}
+		log.Warningf("allocator key is currently set at %d; minID is %d; allocating again to skip %d IDs",
+			newValue, minID, minID-newValue)
+		incr = minID - newValue + blockSize - 1
+	}
+
+	// Add all new ids to the channel for consumption.
+	start := newValue - blockSize + 1
+	end := newValue + 1
+	if minID := ia.getMinID(); start < minID {
+		start = minID
+	}
+
+	for i := start; i < end; i++ {
+		if !ia.sendID(i) {
+			return
+		}
+		if !prefetch && i == (start+end)/2 {
+			if !ia.sendID(allocationTrigger) {
+				return
+			}
+		}
+	}
+}
+
+// sendID sends id on the ids channel, blocking until there is room
+// for it. Returns false without sending if the stopper starts draining
+// first, as nobody may be left to drain the channel.
+func (ia *idAllocator) sendID(id int64) bool {
+	select {
+	case ia.ids <- id:
+		return true
+	case <-ia.stopper.ShouldDrain():
+		return false
+	}
+}
+
+// failChan returns the channel which is closed when the next block
+// fetch is abandoned.
+func (ia *idAllocator) failChan() <-chan struct{} {
+	ia.mu.Lock()
+	defer ia.mu.Unlock()
+	return ia.failC
+}
+
+// fetchError returns the error which caused the last abandoned block
+// fetch.
+func (ia *idAllocator) fetchError() error {
+	ia.mu.Lock()
+	defer ia.mu.Unlock()
+	return ia.fetchErr
+}
+
+// failWaiters records err as the cause of an abandoned block fetch and
+// wakes all callers waiting on the current fail channel.
+func (ia *idAllocator) failWaiters(err error) {
+	ia.mu.Lock()
+	defer ia.mu.Unlock()
+	ia.fetchErr = err
+	close(ia.failC)
+	ia.failC = make(chan struct{})
+}
+
+// increment increments the generator key by incr and returns the new
+// value of the key. Errors are retried according to ia.retryOpts
+// until the retry budget is exhausted or the stopper starts draining,
+// at which point the underlying error is returned.
+func (ia *idAllocator) increment(incr int64) (int64, error) {
+	var newValue int64
+	start := time.Now()
+	attempts := 0
+	err := retry.WithBackoff(ia.retryOpts, func() (retry.Status, error) {
+		attempts++
 		idKey := ia.idKey.Load().(proto.Key)
 		r, err := ia.db.Inc(idKey, incr)
 		if err != nil {
 			log.Warningf("unable to allocate %d ids from %s: %s", incr, idKey, err)
+			select {
+			case <-ia.stopper.ShouldDrain():
+				return retry.Break, util.Errorf("system is draining: %s", err)
+			default:
+			}
+			if max := ia.retryOpts.MaxAttempts; max > 0 && attempts >= max {
+				return retry.Break, util.Errorf("giving up after %d attempts: %s", attempts, err)
+			}
+			if ia.retryDeadline > 0 && time.Since(start) >= ia.retryDeadline {
+				return retry.Break, util.Errorf("retry deadline %s exceeded: %s", ia.retryDeadline, err)
+			}
 			return retry.Continue, err
 		}
 		newValue = r.ValueInt()
 		return retry.Break, nil
 	})
 	if err != nil {
-		panic(fmt.Sprintf("unexpectedly exited id allocation retry loop: %s", err))
+		return 0, err
 	}
+	atomic.AddInt64(&ia.metrics.BlocksFetched, 1)
+	ia.persistHighWater(newValue)
+	return newValue, nil
+}
 
-	if newValue <= ia.minID {
-		log.Warningf("allocator key is currently set at %d; minID is %d; allocating again to skip %d IDs",
-			newValue, ia.minID, ia.minID-newValue)
-		ia.allocateBlock(ia.minID - newValue + ia.blockSize - 1)
-		return
+// A raftIDAllocator allocates Raft consensus group IDs. It is a typed
+// wrapper around an idAllocator on keys.RaftIDGenerator; subsystems
+// needing their own monotonic ID stream should wrap an idAllocator on
+// their own generator key in the same way rather than incrementing
+// the key by hand.
+type raftIDAllocator struct {
+	ia *idAllocator
+}
+
+// newRaftIDAllocator creates a new Raft ID allocator which allocates
+// blocks of raftIDAllocCount IDs, starting at 2.
+func newRaftIDAllocator(db *client.DB, stopper *util.Stopper) (*raftIDAllocator, error) {
+	ia, err := newIDAllocator(keys.RaftIDGenerator, db, 2 /* min ID */, raftIDAllocCount, stopper)
+	if err != nil {
+		return nil, err
 	}
+	return &raftIDAllocator{ia: ia}, nil
+}
 
-	// Add all new ids to the channel for consumption.
-	start := newValue - ia.blockSize + 1
-	end := newValue + 1
-	if start < ia.minID {
-		start = ia.minID
+// Allocate allocates a new Raft ID.
+func (a *raftIDAllocator) Allocate() (int64, error) {
+	return a.ia.Allocate()
+}
+
+// Metrics returns a snapshot of the underlying allocator's counters.
+func (a *raftIDAllocator) Metrics() IDAllocatorMetrics {
+	return a.ia.Metrics()
+}
+
+// A multiIDAllocator allocates IDs from several independent ID
+// spaces, each identified by its generator key, using a single
+// background worker to fetch blocks for all of them. Each space has
+// its own buffered channel of IDs, and a block is fetched for a space
+// when its allocationTrigger is encountered, just as for idAllocator.
+type multiIDAllocator struct {
+	db        *client.DB
+	minID     int64 // Minimum ID to return
+	blockSize int64 // Block allocation size
+	stopper   *util.Stopper
+	refill    chan *idSpace // Spaces awaiting a block fetch
+
+	mu     sync.Mutex          // Protects spaces
+	spaces map[string]*idSpace // ID spaces keyed by generator key
+}
+
+// An idSpace is the per-key state of a multiIDAllocator.
+type idSpace struct {
+	key proto.Key
+	ids chan int64 // Channel of available IDs
+}
+
+// newMultiIDAllocator creates a new multiplexed ID allocator which
+// increments each generator key in allocation blocks of size
+// blockSize, with allocated IDs starting at minID, and starts its
+// background worker on the stopper.
+func newMultiIDAllocator(db *client.DB, minID int64, blockSize int64,
+	stopper *util.Stopper) (*multiIDAllocator, error) {
+	if minID <= allocationTrigger {
+		return nil, newInvalidIDAllocatorArgsError("minID", minID, "minID must be > %d", allocationTrigger)
+	}
+	if blockSize < 1 {
+		return nil, newInvalidIDAllocatorArgsError("blockSize", blockSize, "blockSize must be a positive integer: %d", blockSize)
 	}
+	ma := &multiIDAllocator{
+		db:        db,
+		minID:     minID,
+		blockSize: blockSize,
+		stopper:   stopper,
+		refill:    make(chan *idSpace, 16),
+		spaces:    map[string]*idSpace{},
+	}
+	stopper.RunWorker(ma.worker)
+	return ma, nil
+}
+
+// Allocate allocates a new ID from the ID space of the given
+// generator key, creating the space on first use.
+func (ma *multiIDAllocator) Allocate(idKey proto.Key) (int64, error) {
+	sp := ma.getSpace(idKey)
+	for {
+		var id int64
+		select {
+		case id = <-sp.ids:
+		case <-ma.stopper.ShouldStop():
+			return 0, util.Errorf("could not allocate ID from %s; system is stopping", idKey)
+		}
+		if id != allocationTrigger {
+			return id, nil
+		}
+		select {
+		case ma.refill <- sp:
+		case <-ma.stopper.ShouldStop():
+			return 0, util.Errorf("could not allocate ID from %s; system is stopping", idKey)
+		}
+	}
+}
 
+// getSpace returns the ID space for the given generator key, creating
+// it if necessary.
+func (ma *multiIDAllocator) getSpace(idKey proto.Key) *idSpace {
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+	sp, ok := ma.spaces[string(idKey)]
+	if !ok {
+		sp = &idSpace{
+			key: idKey,
+			ids: make(chan int64, ma.blockSize+ma.blockSize/2+1),
+		}
+		sp.ids <- allocationTrigger
+		ma.spaces[string(idKey)] = sp
+	}
+	return sp
+}
+
+// worker fetches blocks for ID spaces as they are requested until the
+// stopper stops.
+func (ma *multiIDAllocator) worker() {
+	for {
+		select {
+		case sp := <-ma.refill:
+			ma.allocateBlock(sp)
+		case <-ma.stopper.ShouldStop():
+			return
+		}
+	}
+}
+
+// allocateBlock allocates a block of IDs for the given space and sends
+// them on its channel, inserting an allocationTrigger midway through
+// the block as in idAllocator.allocateBlock.
+func (ma *multiIDAllocator) allocateBlock(sp *idSpace) {
+	retryOpts := idAllocationRetryOpts
+	retryOpts.Stopper = ma.stopper
+	incr := ma.blockSize
+	var newValue int64
+	for {
+		err := retry.WithBackoff(retryOpts, func() (retry.Status, error) {
+			r, err := ma.db.Inc(sp.key, incr)
+			if err != nil {
+				log.Warningf("unable to allocate %d ids from %s: %s", incr, sp.key, err)
+				return retry.Continue, err
+			}
+			newValue = r.ValueInt()
+			return retry.Break, nil
+		})
+		if err != nil {
+			// The stopper is stopping.
+			return
+		}
+		if newValue > ma.minID {
+			break
+		}
+		log.Warningf("allocator key %s is currently set at %d; minID is %d; allocating again to skip %d IDs",
+			sp.key, newValue, ma.minID, ma.minID-newValue)
+		incr = ma.minID - newValue + ma.blockSize - 1
+	}
+
+	start := newValue - ma.blockSize + 1
+	end := newValue + 1
+	if start < ma.minID {
+		start = ma.minID
+	}
 	for i := start; i < end; i++ {
-		ia.ids <- i
+		select {
+		case sp.ids <- i:
+		case <-ma.stopper.ShouldStop():
+			return
+		}
 		if i == (start+end)/2 {
-			ia.ids <- allocationTrigger
+			select {
+			case sp.ids <- allocationTrigger:
+			case <-ma.stopper.ShouldStop():
+				return
+			}
 		}
 	}
 }
@@ -24,9 +24,12 @@ import (
 	"testing"
 	"time"
 
+	"golang.org/x/net/context"
+
 	"github.com/cockroachdb/cockroach/keys"
 	"github.com/cockroachdb/cockroach/proto"
 	"github.com/cockroachdb/cockroach/storage/engine"
+	"github.com/cockroachdb/cockroach/util"
 	"github.com/cockroachdb/cockroach/util/leaktest"
 )
 
@@ -79,6 +82,339 @@ func TestIDAllocator(t *testing.T) {
 	}
 }
 
+// TestIDAllocatorRelease allocates IDs concurrently, releases half
+// of them and verifies that subsequent allocations reuse exactly the
+// released IDs before any new IDs are handed out.
+func TestIDAllocatorRelease(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	store, _, stopper := createTestStore(t)
+	defer stopper.Stop()
+	idAlloc, err := newIDAllocator(keys.RaftIDGenerator, store.ctx.DB, 2, 10, stopper)
+	if err != nil {
+		t.Fatalf("failed to create idAllocator: %v", err)
+	}
+
+	allocd := make(chan int64, 20)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 2; j++ {
+				id, err := idAlloc.Allocate()
+				if err != nil {
+					t.Fatal(err)
+				}
+				allocd <- id
+			}
+		}()
+	}
+	wg.Wait()
+	close(allocd)
+
+	// Release every even ID concurrently.
+	released := map[int64]struct{}{}
+	for id := range allocd {
+		if id%2 == 0 {
+			released[id] = struct{}{}
+			wg.Add(1)
+			go func(id int64) {
+				defer wg.Done()
+				if err := idAlloc.Release(id); err != nil {
+					t.Error(err)
+				}
+			}(id)
+		}
+	}
+	wg.Wait()
+	if len(released) != 10 {
+		t.Fatalf("expected 10 released IDs; got %d", len(released))
+	}
+
+	// The next allocations must hand back exactly the released IDs.
+	for i := 0; i < len(released); i++ {
+		id, err := idAlloc.Allocate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := released[id]; !ok {
+			t.Errorf("expected a released ID; got %d", id)
+		}
+		delete(released, id)
+	}
+
+	// Once the free list is exhausted, allocation continues with new IDs.
+	id, err := idAlloc.Allocate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 22 {
+		t.Errorf("expected ID 22 after free list exhausted; got %d", id)
+	}
+}
+
+// TestIDAllocatorReleaseValidation verifies that a released ID is
+// handed out again by the next allocation and that duplicate releases
+// and releases of IDs which were never allocated are rejected.
+func TestIDAllocatorReleaseValidation(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	store, _, stopper := createTestStore(t)
+	defer stopper.Stop()
+	idAlloc, err := newIDAllocator(keys.RaftIDGenerator, store.ctx.DB, 2, 10, stopper)
+	if err != nil {
+		t.Fatalf("failed to create idAllocator: %v", err)
+	}
+
+	id, err := idAlloc.Allocate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := idAlloc.Release(id); err != nil {
+		t.Fatal(err)
+	}
+	if err := idAlloc.Release(id); err == nil {
+		t.Errorf("expected error releasing id %d twice", id)
+	}
+	if err := idAlloc.Release(id + 1); err == nil {
+		t.Errorf("expected error releasing id %d which was never allocated", id+1)
+	}
+	if err := idAlloc.Release(1); err == nil {
+		t.Error("expected error releasing id below minID")
+	}
+
+	// The released ID is handed out again ahead of the IDs buffered on
+	// the channel.
+	next, err := idAlloc.Allocate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != id {
+		t.Fatalf("expected released id %d to be reallocated; got %d", id, next)
+	}
+	// Once reallocated, the ID may be released again.
+	if err := idAlloc.Release(id); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestIDAllocatorMetrics verifies that the allocator's counters
+// reflect the number of IDs handed out and blocks fetched.
+func TestIDAllocatorMetrics(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	store, _, stopper := createTestStore(t)
+	defer stopper.Stop()
+	idAlloc, err := newIDAllocator(keys.RaftIDGenerator, store.ctx.DB, 2, 10, stopper)
+	if err != nil {
+		t.Fatalf("failed to create idAllocator: %v", err)
+	}
+
+	for i := 0; i < 15; i++ {
+		if _, err := idAlloc.Allocate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := idAlloc.Metrics()
+	if m.IDsAllocated != 15 {
+		t.Errorf("expected 15 IDs allocated; got %d", m.IDsAllocated)
+	}
+	// Exhausting the first block requires at least a second fetch.
+	if m.BlocksFetched < 2 {
+		t.Errorf("expected at least 2 blocks fetched; got %d", m.BlocksFetched)
+	}
+	// The very first Allocate must wait on the initial block.
+	if m.Waits < 1 {
+		t.Errorf("expected at least 1 wait; got %d", m.Waits)
+	}
+	if m.BlockedNanos <= 0 {
+		t.Errorf("expected non-zero blocked time; got %d", m.BlockedNanos)
+	}
+
+	// Drain the remaining buffered IDs and verify that a further
+	// allocation triggers another refill.
+	for i := 0; i < 20; i++ {
+		if _, err := idAlloc.Allocate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m2 := idAlloc.Metrics()
+	if m2.IDsAllocated != 35 {
+		t.Errorf("expected 35 IDs allocated; got %d", m2.IDsAllocated)
+	}
+	if m2.BlocksFetched <= m.BlocksFetched {
+		t.Errorf("expected blocks fetched to increase from %d; got %d", m.BlocksFetched, m2.BlocksFetched)
+	}
+}
+
+// TestIDAllocateN allocates 250 IDs in a single call from a fresh
+// allocator and verifies that they are contiguous.
+func TestIDAllocateN(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	store, _, stopper := createTestStore(t)
+	defer stopper.Stop()
+	idAlloc, err := newIDAllocator(keys.RaftIDGenerator, store.ctx.DB, 2, 10, stopper)
+	if err != nil {
+		t.Fatalf("failed to create idAllocator: %v", err)
+	}
+
+	ids, err := idAlloc.AllocateN(250)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 250 {
+		t.Fatalf("expected 250 IDs; got %d", len(ids))
+	}
+	for i := 1; i < len(ids); i++ {
+		if ids[i] != ids[i-1]+1 {
+			t.Fatalf("expected contiguous IDs; got %d followed by %d", ids[i-1], ids[i])
+		}
+	}
+	if ids[0] < 2 {
+		t.Errorf("expected IDs to start at or above minID 2; got %d", ids[0])
+	}
+}
+
+// TestIDAllocateNMinID verifies that AllocateN skips past minID when
+// the generator key lies below it, without handing out IDs below it.
+func TestIDAllocateNMinID(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	store, _, stopper := createTestStore(t)
+	defer stopper.Stop()
+	idAlloc, err := newIDAllocator(keys.RaftIDGenerator, store.ctx.DB, 100, 10, stopper)
+	if err != nil {
+		t.Fatalf("failed to create idAllocator: %v", err)
+	}
+
+	ids, err := idAlloc.AllocateN(50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 50 {
+		t.Fatalf("expected 50 IDs; got %d", len(ids))
+	}
+	for i, id := range ids {
+		if exp := int64(100 + i); id != exp {
+			t.Fatalf("%d: expected ID %d; got %d", i, exp, id)
+		}
+	}
+}
+
+// TestIDAllocatorAdaptiveBlockSize drives heavy concurrent allocation
+// through an adaptive allocator with a tiny initial block size and
+// verifies that the effective block size grows while every ID is
+// still handed out exactly once.
+func TestIDAllocatorAdaptiveBlockSize(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	store, _, stopper := createTestStore(t)
+	defer stopper.Stop()
+	opts := adaptiveBlockOptions{
+		MaxBlockSize: 64,
+		Window:       time.Minute,
+		Threshold:    2,
+	}
+	idAlloc, err := newAdaptiveIDAllocator(keys.RaftIDGenerator, store.ctx.DB, 2, 2, opts, stopper)
+	if err != nil {
+		t.Fatalf("failed to create idAllocator: %v", err)
+	}
+
+	const goroutines, perGoroutine = 10, 50
+	allocd := make(chan int64, goroutines*perGoroutine)
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perGoroutine; j++ {
+				id, err := idAlloc.Allocate()
+				if err != nil {
+					t.Fatal(err)
+				}
+				allocd <- id
+			}
+		}()
+	}
+	wg.Wait()
+	close(allocd)
+
+	seen := map[int64]struct{}{}
+	for id := range allocd {
+		if _, ok := seen[id]; ok {
+			t.Errorf("ID %d allocated more than once", id)
+		}
+		seen[id] = struct{}{}
+	}
+	if blockSize := idAlloc.BlockSize(); blockSize <= 2 {
+		t.Errorf("expected block size to grow beyond 2; got %d", blockSize)
+	}
+}
+
+// TestIDAllocatorAdaptiveBlockInterval allocates sequentially from an
+// adaptive allocator configured so that every block exhaustion counts
+// as fast, and verifies that the effective block size grows.
+func TestIDAllocatorAdaptiveBlockInterval(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	store, _, stopper := createTestStore(t)
+	defer stopper.Stop()
+	opts := adaptiveBlockOptions{
+		MaxBlockSize: 32,
+		Window:       time.Minute,
+		Threshold:    1000, // effectively disable starvation-based growth
+		FastInterval: time.Minute,
+	}
+	idAlloc, err := newAdaptiveIDAllocator(keys.RaftIDGenerator, store.ctx.DB, 2, 2, opts, stopper)
+	if err != nil {
+		t.Fatalf("failed to create idAllocator: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		id, err := idAlloc.Allocate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != int64(i+2) {
+			t.Errorf("expected ID %d; got %d", i+2, id)
+		}
+	}
+	if blockSize := idAlloc.Metrics().BlockSize; blockSize <= 2 {
+		t.Errorf("expected block size to grow beyond 2; got %d", blockSize)
+	}
+}
+
+// TestMultiIDAllocator allocates interleaved IDs from two generator
+// keys through a single multiplexed allocator and verifies that each
+// ID space is handed out independently and without duplicates.
+func TestMultiIDAllocator(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	store, _, stopper := createTestStore(t)
+	defer stopper.Stop()
+	ma, err := newMultiIDAllocator(store.ctx.DB, 2, 10, stopper)
+	if err != nil {
+		t.Fatalf("failed to create multiIDAllocator: %v", err)
+	}
+
+	keyA, keyB := proto.Key("a-idgen"), proto.Key("b-idgen")
+	for i := 0; i < 50; i++ {
+		for _, key := range []proto.Key{keyA, keyB} {
+			id, err := ma.Allocate(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id != int64(i+2) {
+				t.Errorf("expected ID %d from %s; got %d", i+2, key, id)
+			}
+		}
+	}
+
+	// Each generator key must have advanced independently.
+	for _, key := range []proto.Key{keyA, keyB} {
+		r, err := store.ctx.DB.Get(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := r.ValueInt(); v < 51 || v > 70 {
+			t.Errorf("expected %s to be set between 51 and 70; got %d", key, v)
+		}
+	}
+}
+
 // TestIDAllocatorNegativeValue creates an ID allocator against an
 // increment key which is preset to a negative value. We verify that
 // the id allocator makes a double-alloc to make up the difference
@@ -109,16 +445,154 @@ func TestIDAllocatorNegativeValue(t *testing.T) {
 	}
 }
 
+// TestIDAllocatorEnsureFloor presets the generator key below a floor,
+// buffers some IDs below it, and verifies that after EnsureFloor all
+// subsequent allocations skip the gap.
+func TestIDAllocatorEnsureFloor(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	store, _, stopper := createTestStore(t)
+	defer stopper.Stop()
+
+	// Preset our key to a value well below the floor.
+	if _, err := engine.MVCCIncrement(store.Engine(), nil, keys.RaftIDGenerator, store.ctx.Clock.Now(), nil, 5); err != nil {
+		t.Fatal(err)
+	}
+	idAlloc, err := newIDAllocator(keys.RaftIDGenerator, store.ctx.DB, 2, 10, stopper)
+	if err != nil {
+		t.Fatalf("failed to create IDAllocator: %v", err)
+	}
+	// Buffer a block of IDs below the floor and release one.
+	id, err := idAlloc.Allocate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 6 {
+		t.Errorf("expected first ID 6; got %d", id)
+	}
+	if err := idAlloc.Release(id); err != nil {
+		t.Fatal(err)
+	}
+
+	const floor = 100
+	if err := idAlloc.EnsureFloor(floor); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 30; i++ {
+		id, err := idAlloc.Allocate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id < floor {
+			t.Fatalf("allocated ID %d below floor %d", id, floor)
+		}
+	}
+	// The generator key must not regress below the floor.
+	r, err := store.ctx.DB.Inc(keys.RaftIDGenerator, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := r.ValueInt(); v < floor {
+		t.Errorf("expected generator key >= %d; got %d", floor, v)
+	}
+}
+
+// TestIDAllocatorExpectedMin presets the generator key below an
+// expected minimum and verifies that construction fails, while an
+// expected minimum at or below the key's value succeeds.
+func TestIDAllocatorExpectedMin(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	store, _, stopper := createTestStore(t)
+	defer stopper.Stop()
+
+	if _, err := engine.MVCCIncrement(store.Engine(), nil, keys.RaftIDGenerator, store.ctx.Clock.Now(), nil, 50); err != nil {
+		t.Fatal(err)
+	}
+	opts := idAllocatorOptions{ExpectedMin: 100}
+	if _, err := newIDAllocatorWithOptions(keys.RaftIDGenerator, store.ctx.DB, 2, 10, opts, stopper); err == nil {
+		t.Error("expected error creating IDAllocator with generator key below expected minimum")
+	}
+	opts.ExpectedMin = 50
+	idAlloc, err := newIDAllocatorWithOptions(keys.RaftIDGenerator, store.ctx.DB, 2, 10, opts, stopper)
+	if err != nil {
+		t.Fatalf("failed to create IDAllocator: %v", err)
+	}
+	if id, err := idAlloc.Allocate(); err != nil {
+		t.Fatal(err)
+	} else if id != 51 {
+		t.Errorf("expected ID 51; got %d", id)
+	}
+}
+
+// TestIDAllocatorPersistentRestart allocates IDs from a persistent
+// allocator, then simulates a restart after the generator key was
+// reset to zero and verifies that the new allocator does not reuse
+// any of the previously allocated IDs.
+func TestIDAllocatorPersistentRestart(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	store, _, stopper := createTestStore(t)
+	defer stopper.Stop()
+	opts := idAllocatorOptions{Persistent: true, Engine: store.Engine()}
+
+	idAlloc, err := newIDAllocatorWithOptions(keys.RaftIDGenerator, store.ctx.DB, 2, 10, opts, stopper)
+	if err != nil {
+		t.Fatalf("failed to create IDAllocator: %v", err)
+	}
+	allocd := map[int64]struct{}{}
+	for i := 0; i < 25; i++ {
+		id, err := idAlloc.Allocate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		allocd[id] = struct{}{}
+	}
+
+	// Simulate the generator key regressing to zero across a restart.
+	r, err := store.ctx.DB.Inc(keys.RaftIDGenerator, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.ctx.DB.Inc(keys.RaftIDGenerator, -r.ValueInt()); err != nil {
+		t.Fatal(err)
+	}
+	idAlloc, err = newIDAllocatorWithOptions(keys.RaftIDGenerator, store.ctx.DB, 2, 10, opts, stopper)
+	if err != nil {
+		t.Fatalf("failed to recreate IDAllocator: %v", err)
+	}
+	for i := 0; i < 25; i++ {
+		id, err := idAlloc.Allocate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := allocd[id]; ok {
+			t.Fatalf("ID %d was reused after restart", id)
+		}
+	}
+}
+
 // TestNewIDAllocatorInvalidArgs checks validation logic of newIDAllocator.
 func TestNewIDAllocatorInvalidArgs(t *testing.T) {
 	defer leaktest.AfterTest(t)
-	args := [][]int64{
-		{0, 10}, // minID <= 0
-		{2, 0},  // blockSize < 1
+	args := []struct {
+		minID, blockSize int64
+		param            string
+		value            int64
+	}{
+		{0, 10, "minID", 0},    // minID <= 0
+		{2, 0, "blockSize", 0}, // blockSize < 1
 	}
-	for i := range args {
-		if _, err := newIDAllocator(nil, nil, args[i][0], args[i][1], nil); err == nil {
-			t.Errorf("expect to have error return, but got nil")
+	for i, a := range args {
+		_, err := newIDAllocator(nil, nil, a.minID, a.blockSize, nil)
+		if err == nil {
+			t.Errorf("%d: expect to have error return, but got nil", i)
+			continue
+		}
+		argsErr, ok := err.(*InvalidIDAllocatorArgsError)
+		if !ok {
+			t.Errorf("%d: expected an InvalidIDAllocatorArgsError; got %T: %s", i, err, err)
+			continue
+		}
+		if argsErr.Param != a.param || argsErr.Value != a.value {
+			t.Errorf("%d: expected invalid %s=%d; got %s=%v", i, a.param, a.value, argsErr.Param, argsErr.Value)
 		}
 	}
 }
@@ -129,6 +603,9 @@ func TestNewIDAllocatorInvalidArgs(t *testing.T) {
 // 3) After channel becomes empty, allocation will be blocked.
 // 4) Make IDAllocator valid again, the blocked allocations return correct ID.
 // 5) Check if the following allocations return correctly.
+// The retry backoff is set very low so that the failing block fetch
+// is retried many times while the IDAllocator is invalid; callers
+// must not observe any of these transient errors.
 func TestAllocateErrorAndRecovery(t *testing.T) {
 	defer leaktest.AfterTest(t)
 	store, _, stopper := createTestStore(t)
@@ -140,6 +617,9 @@ func TestAllocateErrorAndRecovery(t *testing.T) {
 	if err != nil {
 		t.Errorf("failed to create IDAllocator: %v", err)
 	}
+	idAlloc.retryOpts.Backoff = time.Millisecond
+	idAlloc.retryOpts.MaxBackoff = time.Millisecond
+	idAlloc.retryDeadline = 0
 
 	firstID, err := idAlloc.Allocate()
 	if err != nil {
@@ -175,8 +655,8 @@ func TestAllocateErrorAndRecovery(t *testing.T) {
 			allocd <- int(id)
 		}()
 	}
-	// Make sure no allocation returns.
-	time.Sleep(10 * time.Millisecond)
+	// Make sure no allocation returns, even after several retries.
+	time.Sleep(20 * time.Millisecond)
 	if len(allocd) != 0 {
 		t.Errorf("Allocate() should be blocked until allocateBlock return ID")
 	}
@@ -207,6 +687,156 @@ func TestAllocateErrorAndRecovery(t *testing.T) {
 	}
 }
 
+// TestIDAllocatorNumWaiters blocks several allocations while the
+// generator key is invalid and verifies that NumWaiters reflects
+// them until the allocator recovers.
+func TestIDAllocatorNumWaiters(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	store, _, stopper := createTestStore(t)
+	defer stopper.Stop()
+	idAlloc, err := newIDAllocator(keys.RaftIDGenerator, store.ctx.DB, 2, 10, stopper)
+	if err != nil {
+		t.Fatalf("failed to create IDAllocator: %v", err)
+	}
+	idAlloc.retryOpts.Backoff = time.Millisecond
+	idAlloc.retryOpts.MaxBackoff = time.Millisecond
+	idAlloc.retryDeadline = 0
+	if n := idAlloc.NumWaiters(); n != 0 {
+		t.Fatalf("expected no waiters; got %d", n)
+	}
+
+	// Make the allocator invalid and drain the first block (IDs 2
+	// through 10).
+	idAlloc.idKey.Store(proto.Key([]byte{}))
+	for i := 0; i < 9; i++ {
+		if _, err := idAlloc.Allocate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	const numWaiters = 5
+	errs := make(chan error, numWaiters)
+	for i := 0; i < numWaiters; i++ {
+		go func() {
+			_, err := idAlloc.Allocate()
+			errs <- err
+		}()
+	}
+	util.SucceedsWithin(t, time.Second, func() error {
+		if n := idAlloc.NumWaiters(); n != numWaiters {
+			return util.Errorf("expected %d waiters; got %d", numWaiters, n)
+		}
+		return nil
+	})
+
+	// Once the allocator recovers, all waiters return.
+	idAlloc.idKey.Store(keys.RaftIDGenerator)
+	for i := 0; i < numWaiters; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := idAlloc.NumWaiters(); n != 0 {
+		t.Errorf("expected no waiters; got %d", n)
+	}
+}
+
+// TestAllocateCtxCancel drains the allocator while the generator key
+// is invalid so that the next allocation blocks, then cancels the
+// caller's context and verifies that AllocateCtx returns its error.
+func TestAllocateCtxCancel(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	store, _, stopper := createTestStore(t)
+	defer stopper.Stop()
+	idAlloc, err := newIDAllocator(keys.RaftIDGenerator, store.ctx.DB, 2, 10, stopper)
+	if err != nil {
+		t.Fatalf("failed to create IDAllocator: %v", err)
+	}
+	if _, err := idAlloc.Allocate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Make the allocator invalid and drain the remainder of the first
+	// block (IDs 3 through 10).
+	idAlloc.idKey.Store(proto.Key([]byte{}))
+	// Restore the key before the stopper drains the background fetch.
+	defer idAlloc.idKey.Store(keys.RaftIDGenerator)
+	for i := 0; i < 8; i++ {
+		if _, err := idAlloc.Allocate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := idAlloc.AllocateCtx(ctx)
+		errCh <- err
+	}()
+	select {
+	case err := <-errCh:
+		t.Fatalf("AllocateCtx returned early: %v", err)
+	case <-time.After(10 * time.Millisecond):
+		// Expected; the allocation is blocked.
+	}
+
+	cancel()
+	select {
+	case err := <-errCh:
+		if err != context.Canceled {
+			t.Errorf("expected %v; got %v", context.Canceled, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("AllocateCtx did not return after context cancellation")
+	}
+}
+
+// TestAllocatePermanentError makes the generator key permanently
+// invalid and verifies that callers waiting for a refill receive an
+// error once the retry budget is exhausted, rather than hanging.
+func TestAllocatePermanentError(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	store, _, stopper := createTestStore(t)
+	defer stopper.Stop()
+	idAlloc, err := newIDAllocator(keys.RaftIDGenerator, store.ctx.DB, 2, 10, stopper)
+	if err != nil {
+		t.Fatalf("failed to create IDAllocator: %v", err)
+	}
+	idAlloc.retryOpts.Backoff = time.Millisecond
+	idAlloc.retryOpts.MaxBackoff = time.Millisecond
+	idAlloc.retryOpts.MaxAttempts = 3
+	if _, err := idAlloc.Allocate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Inject a permanent error and drain the rest of the first block.
+	idAlloc.idKey.Store(proto.Key([]byte{}))
+	for i := 0; i < 8; i++ {
+		if _, err := idAlloc.Allocate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	const waiters = 5
+	errCh := make(chan error, waiters)
+	for i := 0; i < waiters; i++ {
+		go func() {
+			_, err := idAlloc.Allocate()
+			errCh <- err
+		}()
+	}
+	for i := 0; i < waiters; i++ {
+		select {
+		case err := <-errCh:
+			if err == nil {
+				t.Error("expected allocation to fail")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Allocate did not return after the retry budget was exhausted")
+		}
+	}
+}
+
 func TestAllocateWithStopper(t *testing.T) {
 	defer leaktest.AfterTest(t)
 	store, _, stopper := createTestStore(t)
@@ -239,3 +869,203 @@ func TestAllocateWithStopper(t *testing.T) {
 	close(ch)
 	wg.Wait()
 }
+
+// TestAllocateNWithStopper verifies that AllocateN returns an error
+// rather than a partial slice once the stopper is draining.
+func TestAllocateNWithStopper(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	store, _, stopper := createTestStore(t)
+	idAlloc, err := newIDAllocator(keys.RaftIDGenerator, store.ctx.DB, 2, 10, stopper)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Pull the first block so that some IDs are buffered.
+	if _, err := idAlloc.Allocate(); err != nil {
+		t.Fatal(err)
+	}
+
+	stopper.Stop()
+	ids, err := idAlloc.AllocateN(100)
+	if err == nil {
+		t.Fatal("expected AllocateN to fail on a stopped stopper")
+	}
+	if ids != nil {
+		t.Errorf("expected no IDs on failure; got %v", ids)
+	}
+}
+
+// TestIDAllocatorIndependentKeys verifies that allocators on different
+// generator keys hand out independent ID sequences.
+func TestIDAllocatorIndependentKeys(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	store, _, stopper := createTestStore(t)
+	defer stopper.Stop()
+
+	idKeys := []proto.Key{keys.RaftIDGenerator, proto.Key("test-idgen")}
+	var allocs []*idAllocator
+	for _, idKey := range idKeys {
+		idAlloc, err := newIDAllocator(idKey, store.ctx.DB, 2, 10, stopper)
+		if err != nil {
+			t.Fatal(err)
+		}
+		allocs = append(allocs, idAlloc)
+	}
+
+	// Interleave allocations; each allocator must see a contiguous
+	// sequence starting at the minimum ID.
+	for i := 0; i < 25; i++ {
+		for j, idAlloc := range allocs {
+			id, err := idAlloc.Allocate()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expID := int64(i + 2); id != expID {
+				t.Fatalf("%s: expected ID %d; got %d", idKeys[j], expID, id)
+			}
+		}
+	}
+}
+
+// TestIDAllocatorLocalCache alternates between a single caller, which
+// is served from the local cache, and concurrent callers, which fall
+// back to the channel, and verifies that no ID is handed out twice.
+func TestIDAllocatorLocalCache(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	store, _, stopper := createTestStore(t)
+	defer stopper.Stop()
+	opts := idAllocatorOptions{LocalCache: true}
+	idAlloc, err := newIDAllocatorWithOptions(keys.RaftIDGenerator, store.ctx.DB, 2, 10, opts, stopper)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[int64]struct{}{}
+	record := func(id int64) {
+		if _, ok := seen[id]; ok {
+			t.Fatalf("ID %d allocated twice", id)
+		}
+		seen[id] = struct{}{}
+	}
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 25; i++ {
+			id, err := idAlloc.Allocate()
+			if err != nil {
+				t.Fatal(err)
+			}
+			record(id)
+		}
+
+		allocd := make(chan int64, 100)
+		errC := make(chan error, 10)
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 10; j++ {
+					id, err := idAlloc.Allocate()
+					if err != nil {
+						errC <- err
+						return
+					}
+					allocd <- id
+				}
+			}()
+		}
+		wg.Wait()
+		close(allocd)
+		close(errC)
+		for err := range errC {
+			t.Fatal(err)
+		}
+		for id := range allocd {
+			record(id)
+		}
+	}
+}
+
+// TestIDAllocatorPrefetch allocates many IDs with prefetching enabled
+// and verifies that prefetches don't start additional chains of block
+// fetches: the number of blocks fetched must stay within what has been
+// handed out plus what the ids channel can buffer. The deferred Stop
+// verifies that no block fetch is left blocked on a full channel.
+func TestIDAllocatorPrefetch(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	store, _, stopper := createTestStore(t)
+	defer stopper.Stop()
+	opts := idAllocatorOptions{PrefetchWatermark: 0.5}
+	idAlloc, err := newIDAllocatorWithOptions(keys.RaftIDGenerator, store.ctx.DB, 2, 10, opts, stopper)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const numIDs = 500
+	seen := map[int64]struct{}{}
+	for i := 0; i < numIDs; i++ {
+		id, err := idAlloc.Allocate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := seen[id]; ok {
+			t.Fatalf("ID %d allocated twice", id)
+		}
+		seen[id] = struct{}{}
+	}
+
+	// Give any runaway fetches a chance to show up.
+	time.Sleep(20 * time.Millisecond)
+	maxBlocks := int64((numIDs+cap(idAlloc.ids))/10 + 2)
+	if blocks := idAlloc.Metrics().BlocksFetched; blocks > maxBlocks {
+		t.Errorf("expected at most %d blocks fetched; got %d", maxBlocks, blocks)
+	}
+}
+
+// benchmarkIDAllocator measures Allocate latency and logs the tail
+// latencies for an allocator configured by opts.
+func benchmarkIDAllocator(b *testing.B, opts idAllocatorOptions) {
+	tc := testContext{}
+	tc.Start(b)
+	defer tc.Stop()
+	idAlloc, err := newIDAllocatorWithOptions(keys.RaftIDGenerator, tc.store.ctx.DB, 2, 10, opts, tc.stopper)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	latencies := make([]time.Duration, b.N)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		start := time.Now()
+		if _, err := idAlloc.Allocate(); err != nil {
+			b.Fatal(err)
+		}
+		latencies[i] = time.Since(start)
+	}
+	b.StopTimer()
+
+	sort.Sort(durationSlice(latencies))
+	b.Logf("N=%d p99=%s max=%s", b.N, latencies[b.N*99/100], latencies[b.N-1])
+}
+
+type durationSlice []time.Duration
+
+func (s durationSlice) Len() int           { return len(s) }
+func (s durationSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s durationSlice) Less(i, j int) bool { return s[i] < s[j] }
+
+// BenchmarkIDAllocator benchmarks allocation with fetches only at the
+// midpoint allocationTrigger.
+func BenchmarkIDAllocator(b *testing.B) {
+	benchmarkIDAllocator(b, idAllocatorOptions{})
+}
+
+// BenchmarkIDAllocatorPrefetch benchmarks allocation with a 25% low
+// watermark prefetch.
+func BenchmarkIDAllocatorPrefetch(b *testing.B) {
+	benchmarkIDAllocator(b, idAllocatorOptions{PrefetchWatermark: 0.25})
+}
+
+// BenchmarkIDAllocatorLocalCache benchmarks single-threaded allocation
+// through the locally cached fast path.
+func BenchmarkIDAllocatorLocalCache(b *testing.B) {
+	benchmarkIDAllocator(b, idAllocatorOptions{LocalCache: true})
+}
@@ -0,0 +1,93 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package storage
+
+import (
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// A quotaPool bounds the number of bytes of Raft proposals a range may
+// have in flight. Quota is acquired before a command is proposed and
+// released once the command has been committed and applied, so that a
+// leader cannot outpace its followers indefinitely.
+type quotaPool struct {
+	sync.Mutex
+	max       int64
+	available int64
+	// released is closed and replaced each time quota is returned to
+	// the pool, waking up any blocked acquirers.
+	released chan struct{}
+}
+
+// newQuotaPool returns a quotaPool holding max bytes of quota.
+func newQuotaPool(max int64) *quotaPool {
+	return &quotaPool{
+		max:       max,
+		available: max,
+		released:  make(chan struct{}),
+	}
+}
+
+// acquire blocks until n bytes of quota are available or the context
+// is done. Requests exceeding the pool's capacity are clamped to it so
+// that a single large proposal can proceed once the pool is drained.
+// Returns the amount of quota acquired, which must later be passed to
+// release.
+func (qp *quotaPool) acquire(ctx context.Context, n int64) (int64, error) {
+	if n > qp.max {
+		n = qp.max
+	}
+	for {
+		qp.Lock()
+		if qp.available >= n {
+			qp.available -= n
+			qp.Unlock()
+			return n, nil
+		}
+		released := qp.released
+		qp.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
+
+// release returns n bytes of quota to the pool.
+func (qp *quotaPool) release(n int64) {
+	if n == 0 {
+		return
+	}
+	qp.Lock()
+	defer qp.Unlock()
+	qp.available += n
+	if qp.available > qp.max {
+		qp.available = qp.max
+	}
+	close(qp.released)
+	qp.released = make(chan struct{})
+}
+
+// approximateQuota returns the number of bytes currently available.
+func (qp *quotaPool) approximateQuota() int64 {
+	qp.Lock()
+	defer qp.Unlock()
+	return qp.available
+}
@@ -0,0 +1,86 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/util/leaktest"
+)
+
+// TestQuotaPool verifies that acquisitions block while the pool is
+// exhausted and proceed once quota is released.
+func TestQuotaPool(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	qp := newQuotaPool(100)
+
+	if n, err := qp.acquire(context.Background(), 60); err != nil || n != 60 {
+		t.Fatalf("expected to acquire 60; got %d, %v", n, err)
+	}
+	// Requests larger than the pool are clamped to its capacity.
+	acquired := make(chan int64)
+	go func() {
+		n, err := qp.acquire(context.Background(), 1000)
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- n
+	}()
+	select {
+	case n := <-acquired:
+		t.Fatalf("unexpected acquisition of %d with %d available", n, qp.approximateQuota())
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	qp.release(60)
+	if n := <-acquired; n != 100 {
+		t.Errorf("expected clamped acquisition of 100; got %d", n)
+	}
+	if a := qp.approximateQuota(); a != 0 {
+		t.Errorf("expected exhausted pool; got %d available", a)
+	}
+	qp.release(100)
+	if a := qp.approximateQuota(); a != 100 {
+		t.Errorf("expected 100 available; got %d", a)
+	}
+}
+
+// TestQuotaPoolContextCancellation verifies that a blocked acquisition
+// returns once its context is done.
+func TestQuotaPoolContextCancellation(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	qp := newQuotaPool(10)
+	if _, err := qp.acquire(context.Background(), 10); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errChan := make(chan error)
+	go func() {
+		_, err := qp.acquire(ctx, 1)
+		errChan <- err
+	}()
+	cancel()
+	if err := <-errChan; err != context.Canceled {
+		t.Errorf("expected %s; got %v", context.Canceled, err)
+	}
+	if a := qp.approximateQuota(); a != 0 {
+		t.Errorf("expected no quota returned by canceled acquisition; got %d", a)
+	}
+}
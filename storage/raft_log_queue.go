@@ -0,0 +1,175 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package storage
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/cockroachdb/cockroach/client"
+	"github.com/cockroachdb/cockroach/keys"
+	"github.com/cockroachdb/cockroach/proto"
+	"github.com/cockroachdb/cockroach/storage/engine"
+	"github.com/cockroachdb/cockroach/util/log"
+)
+
+const (
+	// raftLogQueueMaxSize is the max size of the raft log queue.
+	raftLogQueueMaxSize = 100
+
+	// raftLogQueueTimerDuration is the duration between truncations of
+	// queued ranges.
+	raftLogQueueTimerDuration = 0 * time.Second // zero duration to truncate greedily
+
+	// raftLogMinTruncation is the minimum number of entries which must
+	// be truncatable before a range is queued for truncation.
+	raftLogMinTruncation = 100
+)
+
+// raftLogQueue manages a queue of ranges whose raft logs can be
+// truncated. The log is truncated up to the oldest index which has
+// been both acknowledged by every replica and applied locally (and is
+// thus covered by any snapshot generated from now on), less a
+// retention margin for slow followers. A follower lagging so far
+// behind that the entries it is missing exceed maxLagBytes no longer
+// holds back truncation and must catch up via a snapshot instead.
+// Truncation is proposed through raft so that all replicas discard
+// the same prefix.
+type raftLogQueue struct {
+	*baseQueue
+	// retention is the number of already applied entries kept at the
+	// tail of a truncated log.
+	retention uint64
+	// maxLagBytes is the size of the log lagging followers may force
+	// the range to retain.
+	maxLagBytes int64
+}
+
+// newRaftLogQueue returns a new instance of raftLogQueue which keeps
+// retention applied entries and at most maxLagBytes of entries for
+// lagging followers.
+func newRaftLogQueue(retention uint64, maxLagBytes int64) *raftLogQueue {
+	rlq := &raftLogQueue{
+		retention:   retention,
+		maxLagBytes: maxLagBytes,
+	}
+	rlq.baseQueue = newBaseQueue("raftlog", rlq, raftLogQueueMaxSize)
+	return rlq
+}
+
+func (rlq *raftLogQueue) needsLeaderLease() bool {
+	return true
+}
+
+// getTruncatableIndexes returns the first index of the range's raft
+// log and the first index which must be kept after truncation. The
+// log may be truncated only if the latter exceeds the former. Only the
+// raft leader knows how far each follower has progressed, so other
+// replicas report nothing to truncate.
+func (rlq *raftLogQueue) getTruncatableIndexes(rng *Range) (firstIndex, truncateIndex uint64, err error) {
+	firstIndex, err = rng.FirstIndex()
+	if err != nil {
+		return 0, 0, err
+	}
+	status := rng.rm.RaftStatus(rng.Desc().RaftID)
+	if status == nil || len(status.Progress) == 0 {
+		return firstIndex, firstIndex, nil
+	}
+
+	// Snapshots are generated from the applied state, so the applied
+	// index bounds what a snapshot can stand in for.
+	appliedIndex := atomic.LoadUint64(&rng.appliedIndex)
+	oldestIndex := appliedIndex
+	for _, progress := range status.Progress {
+		if progress.Match < oldestIndex {
+			oldestIndex = progress.Match
+		}
+	}
+	// Retaining the entries a lagging follower is missing must not
+	// grow the log beyond the size budget.
+	if oldestIndex < appliedIndex {
+		lagBytes, err := raftLogSize(rng, oldestIndex, appliedIndex, rlq.maxLagBytes)
+		if err != nil {
+			return 0, 0, err
+		}
+		if lagBytes > rlq.maxLagBytes {
+			oldestIndex = appliedIndex
+		}
+	}
+	if oldestIndex <= firstIndex+rlq.retention {
+		return firstIndex, firstIndex, nil
+	}
+	return firstIndex, oldestIndex - rlq.retention, nil
+}
+
+// raftLogSize returns the size in bytes of the range's raft log
+// entries in [lo, hi). The scan stops as soon as the size exceeds
+// maxBytes.
+func raftLogSize(rng *Range, lo, hi uint64, maxBytes int64) (int64, error) {
+	var size int64
+	raftID := rng.Desc().RaftID
+	err := engine.MVCCIterate(rng.rm.Engine(), keys.RaftLogKey(raftID, lo), keys.RaftLogKey(raftID, hi),
+		proto.ZeroTimestamp, true /* consistent */, nil /* txn */, func(kv proto.KeyValue) (bool, error) {
+			size += int64(len(kv.Value.GetBytes()))
+			return size > maxBytes, nil
+		})
+	return size, err
+}
+
+// shouldQueue determines whether a range should be queued for raft log
+// truncation, and if so at what priority. Ranges with more truncatable
+// entries are truncated first.
+func (rlq *raftLogQueue) shouldQueue(now proto.Timestamp, rng *Range) (
+	shouldQ bool, priority float64) {
+	firstIndex, truncateIndex, err := rlq.getTruncatableIndexes(rng)
+	if err != nil {
+		log.Warning(err)
+		return
+	}
+	if truncatable := truncateIndex - firstIndex; truncatable >= raftLogMinTruncation {
+		return true, float64(truncatable)
+	}
+	return
+}
+
+// process proposes an InternalTruncateLog command discarding the
+// truncatable prefix of the range's raft log.
+func (rlq *raftLogQueue) process(now proto.Timestamp, rng *Range) error {
+	firstIndex, truncateIndex, err := rlq.getTruncatableIndexes(rng)
+	if err != nil {
+		return err
+	}
+	if truncateIndex <= firstIndex {
+		return nil
+	}
+	if log.V(1) {
+		log.Infof("%s: truncating raft log entries [%d, %d)", rng, firstIndex, truncateIndex)
+	}
+	desc := rng.Desc()
+	truncArgs := &proto.InternalTruncateLogRequest{
+		RequestHeader: proto.RequestHeader{
+			Key:       desc.StartKey,
+			Timestamp: now,
+			RaftID:    desc.RaftID,
+		},
+		Index: truncateIndex,
+	}
+	return rng.AddCmd(rng.context(), client.Call{Args: truncArgs, Reply: &proto.InternalTruncateLogResponse{}}, true)
+}
+
+func (rlq *raftLogQueue) timer() time.Duration {
+	return raftLogQueueTimerDuration
+}
@@ -0,0 +1,95 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package storage
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/client"
+	"github.com/cockroachdb/cockroach/keys"
+	"github.com/cockroachdb/cockroach/proto"
+	"github.com/cockroachdb/cockroach/storage/engine"
+	"github.com/cockroachdb/cockroach/util/leaktest"
+)
+
+// TestRaftLogQueueTruncation verifies that the raft log is truncated
+// up to the applied index, less the configured retention, and that
+// the truncated state is updated accordingly.
+func TestRaftLogQueueTruncation(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	tc := testContext{}
+	tc.Start(t)
+	defer tc.Stop()
+
+	const retention = 10
+	rlq := newRaftLogQueue(retention, 1<<20)
+
+	// Append enough entries for the log to be queued for truncation.
+	for i := 0; i < raftLogMinTruncation+retention; i++ {
+		key := proto.Key(fmt.Sprintf("key%03d", i))
+		pArgs, pReply := putArgs(key, []byte("value"), tc.rng.Desc().RaftID, tc.store.StoreID())
+		if err := tc.rng.AddCmd(tc.rng.context(), client.Call{Args: pArgs, Reply: pReply}, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	oldFirstIndex, err := tc.rng.FirstIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shouldQ, _ := rlq.shouldQueue(tc.clock.Now(), tc.rng); !shouldQ {
+		t.Fatal("expected range to be queued for raft log truncation")
+	}
+	// With a single replica, the applied index alone bounds truncation.
+	appliedIndex := atomic.LoadUint64(&tc.rng.appliedIndex)
+	if err := rlq.process(tc.clock.Now(), tc.rng); err != nil {
+		t.Fatal(err)
+	}
+
+	expFirstIndex := appliedIndex - retention
+	firstIndex, err := tc.rng.FirstIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if firstIndex != expFirstIndex {
+		t.Fatalf("expected first index %d; got %d", expFirstIndex, firstIndex)
+	}
+	var ts proto.RaftTruncatedState
+	if _, err := engine.MVCCGetProto(tc.engine, keys.RaftTruncatedStateKey(tc.rng.Desc().RaftID),
+		proto.ZeroTimestamp, true, nil, &ts); err != nil {
+		t.Fatal(err)
+	}
+	if ts.Index != expFirstIndex-1 {
+		t.Errorf("expected truncated state index %d; got %d", expFirstIndex-1, ts.Index)
+	}
+
+	// The discarded entries are gone; the retained ones are not.
+	if _, err := tc.rng.Entries(oldFirstIndex, firstIndex, 0); err == nil {
+		t.Error("expected truncated entries to be unavailable")
+	}
+	if ents, err := tc.rng.Entries(firstIndex, appliedIndex+1, 0); err != nil {
+		t.Fatal(err)
+	} else if len(ents) != retention+1 {
+		t.Errorf("expected %d retained entries; got %d", retention+1, len(ents))
+	}
+
+	// Nothing further is truncatable.
+	if shouldQ, _ := rlq.shouldQueue(tc.clock.Now(), tc.rng); shouldQ {
+		t.Error("expected truncated range not to be queued")
+	}
+}
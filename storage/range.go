@@ -41,6 +41,7 @@ import (
 	"github.com/cockroachdb/cockroach/util"
 	"github.com/cockroachdb/cockroach/util/hlc"
 	"github.com/cockroachdb/cockroach/util/log"
+	"github.com/coreos/etcd/raft"
 	gogoproto "github.com/gogo/protobuf/proto"
 	"golang.org/x/net/context"
 )
@@ -104,6 +105,11 @@ const (
 
 	// DefaultLeaderLeaseDuration is the default duration of the leader lease.
 	DefaultLeaderLeaseDuration = time.Second
+
+	// maxWriteBatchReprSize is the maximum size of the serialized batch
+	// carried by an InternalWriteBatch command, which is proposed to
+	// Raft as a single command.
+	maxWriteBatchReprSize = 8 << 20 // 8M
 )
 
 // configDescriptor describes administrative configuration maps
@@ -135,6 +141,7 @@ var tsCacheMethods = [...]bool{
 	proto.DeleteRange:                true,
 	proto.InternalResolveIntent:      true,
 	proto.InternalResolveIntentRange: true,
+	proto.InternalWriteBatch:         true,
 }
 
 // usesTimestampCache returns true if the request affects or is
@@ -147,6 +154,15 @@ func usesTimestampCache(r proto.Request) bool {
 	return tsCacheMethods[m]
 }
 
+// isSizeLimited returns true if the request is a client write subject
+// to the store's MaxCommandBytes limit.
+func isSizeLimited(args proto.Request) bool {
+	if _, ok := args.(*proto.InternalWriteBatchRequest); ok {
+		return true
+	}
+	return proto.IsTransactionWrite(args)
+}
+
 // A pendingCmd holds the reply buffer and a done channel for a command
 // sent to Raft. Once committed to the Raft log, the command is
 // executed and the result returned via the done channel.
@@ -168,9 +184,16 @@ type rangeManager interface {
 	allocator() *allocator
 	Gossip() *gossip.Gossip
 	splitQueue() *splitQueue
+	rangeGCQueue() *rangeGCQueue
+	raftProposalQuota() int64
+	rangeWriteRate() int64
+	maxIntentsPerTxn() int64
+	maxCommandBytes() int64
 	Stopper() *util.Stopper
 	EventFeed() StoreEventFeed
 	Context(context.Context) context.Context
+	RaftStatus(raftID int64) *raft.Status
+	IsDraining() bool
 
 	// Range manipulation methods.
 	LookupRange(start, end proto.Key) *Range
@@ -178,6 +201,7 @@ type rangeManager interface {
 	NewRangeDescriptor(start, end proto.Key, replicas []proto.Replica) (*proto.RangeDescriptor, error)
 	NewSnapshot() engine.Engine
 	ProposeRaftCommand(cmdIDKey, proto.InternalRaftCommand) <-chan error
+	ReadIndex(raftID int64) (uint64, error)
 	RemoveRange(rng *Range) error
 	SplitRange(origRng, newRng *Range) error
 	processRangeDescriptorUpdate(rng *Range) error
@@ -201,15 +225,39 @@ type Range struct {
 	lastIndex uint64
 	// Last index applied to the state machine. Updated atomically.
 	appliedIndex uint64
-	configHashes map[int][]byte // Config map sha256 hashes @ last gossip
-	lease        unsafe.Pointer // Information for leader lease, updated atomically
-	llMu         sync.Mutex     // Synchronizes readers' requests for leader lease
+	// Channels of consensus reads waiting for the range to apply an
+	// index, keyed by that index; see appliedIndexChan.
+	appliedMu      sync.Mutex
+	appliedWaiters map[uint64]chan struct{}
+	configHashes   map[int][]byte // Config map sha256 hashes @ last gossip
+	lease          unsafe.Pointer // Information for leader lease, updated atomically
+	llMu           sync.Mutex     // Synchronizes readers' requests for leader lease
+	// Bounds the bytes of write commands proposed but not yet applied.
+	proposalQuota *quotaPool
+	// Bounds the rate, in bytes per second, of write commands proposed.
+	writeLimiter *rateLimiter
 
 	sync.RWMutex                 // Protects the following fields:
 	cmdQ         *CommandQueue   // Enforce at most one command is running per key(s)
 	tsCache      *TimestampCache // Most recent timestamps for keys / key ranges
 	respCache    *ResponseCache  // Provides idempotence for retries
 	pendingCmds  map[cmdIDKey]*pendingCmd
+	gcThreshold  proto.Timestamp // Reads below this timestamp are rejected
+	checksums    []rangeChecksum // Recent checksums computed by InternalComputeChecksum
+}
+
+// maxRangeChecksums is the number of checksums computed by
+// InternalComputeChecksum which a replica remembers. Older checksums
+// are discarded, which bounds the memory used when consistency checks
+// are issued concurrently.
+const maxRangeChecksums = 8
+
+// rangeChecksum is a checksum of the range's data computed by
+// InternalComputeChecksum, identified by the timestamp of the command
+// which computed it.
+type rangeChecksum struct {
+	timestamp proto.Timestamp
+	checksum  []byte
 }
 
 // NewRange initializes the range using the given metadata.
@@ -221,6 +269,8 @@ func NewRange(desc *proto.RangeDescriptor, rm rangeManager) (*Range, error) {
 		respCache:   NewResponseCache(desc.RaftID, rm.Engine()),
 		pendingCmds: map[cmdIDKey]*pendingCmd{},
 	}
+	r.proposalQuota = newQuotaPool(rm.raftProposalQuota())
+	r.writeLimiter = newRateLimiter(rm.rangeWriteRate())
 	// Do not call setDesc to avoid calling processRangeDescriptorUpdate().
 	atomic.StorePointer(&r.desc, unsafe.Pointer(desc))
 
@@ -242,6 +292,10 @@ func NewRange(desc *proto.RangeDescriptor, rm rangeManager) (*Range, error) {
 	}
 	atomic.StorePointer(&r.lease, unsafe.Pointer(lease))
 
+	if r.gcThreshold, err = loadGCThreshold(r.rm.Engine(), desc.RaftID); err != nil {
+		return nil, err
+	}
+
 	if r.stats, err = newRangeStats(desc.RaftID, rm.Engine()); err != nil {
 		return nil, err
 	}
@@ -298,6 +352,20 @@ func loadLeaderLease(eng engine.Engine, raftID int64) (*proto.Lease, error) {
 	return lease, nil
 }
 
+// loadGCThreshold returns the GC threshold stored in the GC metadata
+// of the range with the given Raft ID, or the zero timestamp if the
+// range has never been garbage collected.
+func loadGCThreshold(eng engine.Engine, raftID int64) (proto.Timestamp, error) {
+	gcMeta := &proto.GCMetadata{}
+	if _, err := engine.MVCCGetProto(eng, keys.RangeGCMetadataKey(raftID), proto.ZeroTimestamp, true, nil, gcMeta); err != nil {
+		return proto.ZeroTimestamp, err
+	}
+	if gcMeta.Threshold == nil {
+		return proto.ZeroTimestamp, nil
+	}
+	return *gcMeta.Threshold, nil
+}
+
 // getLease returns the current leader lease.
 func (r *Range) getLease() *proto.Lease {
 	return (*proto.Lease)(atomic.LoadPointer(&r.lease))
@@ -324,6 +392,16 @@ func (r *Range) requestLeaderLease(timestamp proto.Timestamp) error {
 	duration := int64(DefaultLeaderLeaseDuration)
 	// Prepare a Raft command to get a leader lease for this replica.
 	expiration := timestamp.Add(duration, 0)
+	return r.proposeLeaderLease(timestamp, proto.Lease{
+		Start:      timestamp,
+		Expiration: expiration,
+		RaftNodeID: uint64(r.rm.RaftNodeID()),
+	})
+}
+
+// proposeLeaderLease proposes the given leader lease and waits for
+// the range to apply it.
+func (r *Range) proposeLeaderLease(timestamp proto.Timestamp, lease proto.Lease) error {
 	args := &proto.InternalLeaderLeaseRequest{
 		RequestHeader: proto.RequestHeader{
 			Key:       r.Desc().StartKey,
@@ -333,11 +411,7 @@ func (r *Range) requestLeaderLease(timestamp proto.Timestamp) error {
 				Random:   rand.Int63(),
 			},
 		},
-		Lease: proto.Lease{
-			Start:      timestamp,
-			Expiration: expiration,
-			RaftNodeID: uint64(r.rm.RaftNodeID()),
-		},
+		Lease: lease,
 	}
 	// Send lease request directly to raft in order to skip unnecessary
 	// checks from normal request machinery, (e.g. the command queue).
@@ -373,6 +447,12 @@ func (r *Range) redirectOnOrAcquireLeaderLease(timestamp proto.Timestamp) error
 	if held, expired := r.HasLeaderLease(timestamp); !held && !expired {
 		return r.newNotLeaderError()
 	} else if !held || expired {
+		// A draining store doesn't acquire or renew leases; redirect
+		// without naming a leader so that another replica is tried.
+		if r.rm.IsDraining() {
+			_, replica := r.Desc().FindReplica(r.rm.StoreID())
+			return &proto.NotLeaderError{Replica: replica}
+		}
 		// Otherwise, if not held by this replica or expired, request renewal.
 		err := r.requestLeaderLease(timestamp)
 		// Getting a LeaseRejectedError back means someone else got there
@@ -387,6 +467,36 @@ func (r *Range) redirectOnOrAcquireLeaderLease(timestamp proto.Timestamp) error
 	return nil
 }
 
+// transferLeaderLease hands the leader lease held by this replica to
+// the replica with the given raft node ID. The lease is first shortened
+// to expire immediately and a lease starting at its expiration is then
+// proposed on behalf of the target, whose timestamp cache low water
+// mark is raised past the shortened lease when it applies the command.
+// If the second step fails, the lease simply lapses and is acquired by
+// whichever replica next serves a request.
+func (r *Range) transferLeaderLease(target proto.RaftNodeID) error {
+	r.llMu.Lock()
+	defer r.llMu.Unlock()
+	now := r.rm.Clock().Now()
+	if held, expired := r.HasLeaderLease(now); !held || expired {
+		return util.Errorf("range %d: leader lease not held", r.Desc().RaftID)
+	}
+	prevLease := r.getLease()
+	expiration := now.Next()
+	if err := r.proposeLeaderLease(now, proto.Lease{
+		Start:      prevLease.Start,
+		Expiration: expiration,
+		RaftNodeID: prevLease.RaftNodeID,
+	}); err != nil {
+		return err
+	}
+	return r.proposeLeaderLease(now, proto.Lease{
+		Start:      expiration,
+		Expiration: expiration.Add(int64(DefaultLeaderLeaseDuration), 0),
+		RaftNodeID: uint64(target),
+	})
+}
+
 // verifyLeaderLease checks whether the requesting replica (by raft
 // node ID) holds the leader lease covering the specified timestamp.
 func (r *Range) verifyLeaderLease(originRaftNodeID proto.RaftNodeID, timestamp proto.Timestamp) bool {
@@ -448,6 +558,13 @@ func (r *Range) GetReplica() *proto.Replica {
 	return replica
 }
 
+// SetWriteRate limits the rate at which the range accepts writes to
+// bytesPerSec bytes per second. Writes in excess of the limit block
+// until the rate allows them. Zero disables the limit.
+func (r *Range) SetWriteRate(bytesPerSec int64) {
+	r.writeLimiter.setRate(bytesPerSec)
+}
+
 // GetMVCCStats returns a copy of the MVCC stats object for this range.
 func (r *Range) GetMVCCStats() proto.MVCCStats {
 	return r.stats.GetMVCC()
@@ -475,6 +592,49 @@ func (r *Range) GetGCMetadata() (*proto.GCMetadata, error) {
 	return gcMeta, nil
 }
 
+// getGCThreshold returns the timestamp below which versions may have
+// been garbage collected, as stored in the range's GC metadata. Zero
+// if the range has never been garbage collected.
+func (r *Range) getGCThreshold() proto.Timestamp {
+	r.RLock()
+	defer r.RUnlock()
+	return r.gcThreshold
+}
+
+// setGCThreshold forwards the range's GC threshold to threshold.
+func (r *Range) setGCThreshold(threshold proto.Timestamp) {
+	r.Lock()
+	defer r.Unlock()
+	r.gcThreshold.Forward(threshold)
+}
+
+// GetChecksum returns the checksum of the range's data computed by
+// the InternalComputeChecksum command with the given timestamp. The
+// second return value is false if this replica has not (yet) applied
+// that command.
+func (r *Range) GetChecksum(timestamp proto.Timestamp) ([]byte, bool) {
+	r.RLock()
+	defer r.RUnlock()
+	for _, c := range r.checksums {
+		if c.timestamp.Equal(timestamp) {
+			return c.checksum, true
+		}
+	}
+	return nil, false
+}
+
+// addChecksum remembers the checksum computed by the
+// InternalComputeChecksum command with the given timestamp, discarding
+// the oldest checksum if more than maxRangeChecksums are held.
+func (r *Range) addChecksum(timestamp proto.Timestamp, checksum []byte) {
+	r.Lock()
+	defer r.Unlock()
+	if len(r.checksums) >= maxRangeChecksums {
+		r.checksums = append(r.checksums[:0], r.checksums[1:]...)
+	}
+	r.checksums = append(r.checksums, rangeChecksum{timestamp: timestamp, checksum: checksum})
+}
+
 // GetLastVerificationTimestamp reads the timestamp at which the range's
 // data was last verified.
 func (r *Range) GetLastVerificationTimestamp() (proto.Timestamp, error) {
@@ -591,9 +751,6 @@ func (r *Range) addReadOnlyCmd(ctx context.Context, args proto.Request, reply pr
 			header.Timestamp = r.rm.Clock().Now()
 		}
 		return r.executeCmd(r.rm.Engine(), nil, args, reply)
-	} else if header.ReadConsistency == proto.CONSENSUS {
-		reply.Header().SetGoError(util.Error("consensus reads not implemented"))
-		return reply.Header().GoError()
 	}
 
 	// Add the read to the command queue to gate subsequent
@@ -607,6 +764,17 @@ func (r *Range) addReadOnlyCmd(ctx context.Context, args proto.Request, reply pr
 		return err
 	}
 
+	// A consensus read additionally requires confirmation of raft
+	// leadership, after which the range must catch up to every command
+	// committed before the read.
+	if header.ReadConsistency == proto.CONSENSUS {
+		if err := r.waitForReadIndex(ctx); err != nil {
+			r.endCmd(cmdKey, args, err, true /* readOnly */)
+			reply.Header().SetGoError(err)
+			return err
+		}
+	}
+
 	// Execute read-only command.
 	err := r.executeCmd(r.rm.Engine(), nil, args, reply)
 
@@ -616,6 +784,63 @@ func (r *Range) addReadOnlyCmd(ctx context.Context, args proto.Request, reply pr
 	return err
 }
 
+// waitForReadIndex obtains a read index from raft and blocks until the
+// range has applied it. Unlike proposing a command, this doesn't append
+// to the raft log. If raft leadership can't be confirmed, a retryable
+// error is returned. Returns ctx.Err() if the context is cancelled or
+// its deadline expires while waiting.
+func (r *Range) waitForReadIndex(ctx context.Context) error {
+	index, err := r.rm.ReadIndex(r.Desc().RaftID)
+	if err != nil {
+		return err
+	}
+	appliedC := r.appliedIndexChan(index)
+	if appliedC == nil {
+		return nil
+	}
+	select {
+	case <-appliedC:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-r.rm.Stopper().ShouldStop():
+		return multiraft.ErrStopped
+	}
+}
+
+// appliedIndexChan returns a channel which is closed once the range has
+// applied index, or nil if it already has.
+func (r *Range) appliedIndexChan(index uint64) <-chan struct{} {
+	r.appliedMu.Lock()
+	defer r.appliedMu.Unlock()
+	if atomic.LoadUint64(&r.appliedIndex) >= index {
+		return nil
+	}
+	if r.appliedWaiters == nil {
+		r.appliedWaiters = map[uint64]chan struct{}{}
+	}
+	ch, ok := r.appliedWaiters[index]
+	if !ok {
+		ch = make(chan struct{})
+		r.appliedWaiters[index] = ch
+	}
+	return ch
+}
+
+// advanceAppliedIndex sets the range's applied index and wakes up the
+// callers waiting for it or an earlier index to be applied.
+func (r *Range) advanceAppliedIndex(index uint64) {
+	r.appliedMu.Lock()
+	defer r.appliedMu.Unlock()
+	atomic.StoreUint64(&r.appliedIndex, index)
+	for waitIndex, ch := range r.appliedWaiters {
+		if waitIndex <= index {
+			close(ch)
+			delete(r.appliedWaiters, waitIndex)
+		}
+	}
+}
+
 // addWriteCmd first consults the response cache to determine whether
 // this command has already been sent to the range. If a response is
 // found, it's returned immediately and not submitted to raft. Next,
@@ -645,6 +870,55 @@ func (r *Range) addWriteCmd(ctx context.Context, args proto.Request, reply proto
 		return err
 	}
 
+	// Refuse writes too far ahead of the local clock. A node with a
+	// badly skewed clock would otherwise write values in the future,
+	// invisible to reads until the rest of the cluster catches up.
+	if maxOffset := r.rm.Clock().MaxOffset(); maxOffset > 0 {
+		maxTS := proto.Timestamp{WallTime: r.rm.Clock().PhysicalNow() + maxOffset.Nanoseconds()}
+		if err := engine.CheckWriteTimestamp(header.Timestamp, maxTS); err != nil {
+			r.endCmd(cmdKey, args, err, false /* !readOnly */)
+			reply.Header().SetGoError(err)
+			return err
+		}
+	}
+
+	// Refuse client writes too large to be proposed as a single Raft
+	// command. Internal commands, such as GC and intent resolution, are
+	// exempt so as not to stall the range's upkeep. Write batches are
+	// bounded by maxWriteBatchReprSize even if the store doesn't limit
+	// the size of commands.
+	size := int64(gogoproto.Size(args))
+	if limit := r.rm.maxCommandBytes(); limit > 0 && size > limit && isSizeLimited(args) {
+		err := util.Errorf("%s command of %d bytes exceeds the limit of %d bytes; retry in smaller pieces",
+			args.Method(), size, limit)
+		r.endCmd(cmdKey, args, err, false /* !readOnly */)
+		reply.Header().SetGoError(err)
+		return err
+	}
+	if wb, ok := args.(*proto.InternalWriteBatchRequest); ok && len(wb.Repr) > maxWriteBatchReprSize {
+		err := util.Errorf("write batch of %d bytes exceeds the maximum of %d bytes", len(wb.Repr), maxWriteBatchReprSize)
+		r.endCmd(cmdKey, args, err, false /* !readOnly */)
+		reply.Header().SetGoError(err)
+		return err
+	}
+
+	// Refuse transactional writes once the transaction has laid down
+	// as many intents as allowed. The limit is decided here and carried
+	// in the request so that all replicas agree on the outcome
+	// regardless of their configured limit. Writes which take the
+	// transaction past the limit are refused when executed; see
+	// executeCmd.
+	header.MaxIntents = 0
+	if limit := r.rm.maxIntentsPerTxn(); limit > 0 && header.Txn != nil && proto.IsTransactionWrite(args) {
+		if header.Txn.GetIntentCount() >= limit {
+			err := proto.NewTxnIntentLimitExceededError(header.Txn, limit)
+			r.endCmd(cmdKey, args, err, false /* !readOnly */)
+			reply.Header().SetGoError(err)
+			return err
+		}
+		header.MaxIntents = limit
+	}
+
 	// Two important invariants of Cockroach: 1) encountering a more
 	// recently written value means transaction restart. 2) values must
 	// be written with a greater timestamp than the most recent read to
@@ -658,6 +932,20 @@ func (r *Range) addWriteCmd(ctx context.Context, args proto.Request, reply proto
 		rTS, wTS := r.tsCache.GetMax(header.Key, header.EndKey, header.Txn.GetID())
 		r.Unlock()
 
+		// The versions written by a write batch are serialized at the
+		// request timestamp and can't be pushed, so the batch is
+		// refused if its span has been read or written since.
+		if _, ok := args.(*proto.InternalWriteBatchRequest); ok {
+			existingTS := rTS
+			existingTS.Forward(wTS)
+			if !existingTS.Less(header.Timestamp) {
+				err := &proto.WriteTooOldError{Timestamp: header.Timestamp, ExistingTimestamp: existingTS}
+				r.endCmd(cmdKey, args, err, false /* !readOnly */)
+				reply.Header().SetGoError(err)
+				return err
+			}
+		}
+
 		// Always push the timestamp forward if there's been a read which
 		// occurred after our txn timestamp.
 		if !rTS.Less(header.Timestamp) {
@@ -679,6 +967,24 @@ func (r *Range) addWriteCmd(ctx context.Context, args proto.Request, reply proto
 		}
 	}
 
+	// Throttle writes to a hot range so that it can't saturate the
+	// store's disk at the expense of other ranges. Then acquire quota
+	// for the proposal so that a range cannot flood Raft with commands
+	// faster than they can be committed. The quota is returned once a
+	// quorum has accepted the command and this replica has applied it,
+	// or once the command has failed.
+	if err := r.writeLimiter.wait(ctx, size); err != nil {
+		r.endCmd(cmdKey, args, err, false /* !readOnly */)
+		reply.Header().SetGoError(err)
+		return err
+	}
+	quota, err := r.proposalQuota.acquire(ctx, size)
+	if err != nil {
+		r.endCmd(cmdKey, args, err, false /* !readOnly */)
+		reply.Header().SetGoError(err)
+		return err
+	}
+
 	errChan, pendingCmd := r.proposeRaftCommand(args, reply)
 
 	// Create a completion func for mandatory cleanups which we either
@@ -694,6 +1000,7 @@ func (r *Range) addWriteCmd(ctx context.Context, args proto.Request, reply proto
 			// clients will retry.
 			err = proto.NewRangeNotFoundError(r.Desc().RaftID)
 		}
+		r.proposalQuota.release(quota)
 		// As for reads, update timestamp cache with the timestamp
 		// of this write on success. This ensures a strictly higher
 		// timestamp for successive writes to the same key or key range.
@@ -800,7 +1107,7 @@ func (r *Range) applyRaftCommand(index uint64, originNodeID proto.RaftNodeID, ar
 			if err := setAppliedIndex(r.rm.Engine(), r.Desc().RaftID, index); err != nil {
 				log.Fatalf("could not advance applied index: %s", err)
 			}
-			atomic.StoreUint64(&r.appliedIndex, index)
+			r.advanceAppliedIndex(index)
 		}
 	}()
 
@@ -864,9 +1171,18 @@ func (r *Range) applyRaftCommand(index uint64, originNodeID proto.RaftNodeID, ar
 		// Publish update to event feed.
 		r.rm.EventFeed().updateRange(r, args.Method(), &ms)
 		// After successful commit, update cached stats and appliedIndex value.
-		atomic.StoreUint64(&r.appliedIndex, index)
+		r.advanceAppliedIndex(index)
 		// If the commit succeeded, potentially add range to split queue.
 		r.maybeAddToSplitQueue()
+		// If a replica change removed this replica, queue it for GC.
+		if etr, ok := args.(*proto.EndTransactionRequest); ok &&
+			etr.InternalCommitTrigger.GetChangeReplicasTrigger() != nil {
+			r.maybeAddToRangeGCQueue()
+		}
+		// Reads below a new GC threshold are refused from now on.
+		if gcArgs, ok := args.(*proto.InternalGCRequest); ok && gcArgs.GCMeta.Threshold != nil {
+			r.setGCThreshold(*gcArgs.GCMeta.Threshold)
+		}
 		// Maybe update gossip configs on a put.
 		switch args.(type) {
 		case *proto.PutRequest, *proto.DeleteRequest, *proto.DeleteRangeRequest:
@@ -1033,3 +1349,12 @@ func (r *Range) maybeAddToSplitQueue() {
 		r.rm.splitQueue().MaybeAdd(r, r.rm.Clock().Now())
 	}
 }
+
+// maybeAddToRangeGCQueue checks whether this replica has been removed
+// from the range's descriptor. If yes, the range is added to the range
+// GC queue so that its data is cleared promptly.
+func (r *Range) maybeAddToRangeGCQueue() {
+	if r.GetReplica() == nil {
+		r.rm.rangeGCQueue().MaybeAdd(r, r.rm.Clock().Now())
+	}
+}
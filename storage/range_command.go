@@ -22,6 +22,7 @@ package storage
 
 import (
 	"bytes"
+	"crypto/sha512"
 	"fmt"
 	"math/rand"
 	"sync/atomic"
@@ -32,6 +33,7 @@ import (
 	"github.com/cockroachdb/cockroach/proto"
 	"github.com/cockroachdb/cockroach/storage/engine"
 	"github.com/cockroachdb/cockroach/util"
+	"github.com/cockroachdb/cockroach/util/encoding"
 	"github.com/cockroachdb/cockroach/util/log"
 	gogoproto "github.com/gogo/protobuf/proto"
 )
@@ -53,6 +55,10 @@ func (r *Range) executeCmd(batch engine.Engine, ms *proto.MVCCStats, args proto.
 		return reply.Header().GoError()
 	}
 
+	// Writes may lay down intents, advancing the transaction's intent
+	// count in place; remember where it started.
+	origIntentCount := header.Txn.GetIntentCount()
+
 	switch args.(type) {
 	case *proto.GetRequest:
 		r.Get(batch, args.(*proto.GetRequest), reply.(*proto.GetResponse))
@@ -86,10 +92,26 @@ func (r *Range) executeCmd(batch engine.Engine, ms *proto.MVCCStats, args proto.
 		r.InternalTruncateLog(batch, ms, args.(*proto.InternalTruncateLogRequest), reply.(*proto.InternalTruncateLogResponse))
 	case *proto.InternalLeaderLeaseRequest:
 		r.InternalLeaderLease(batch, ms, args.(*proto.InternalLeaderLeaseRequest), reply.(*proto.InternalLeaderLeaseResponse))
+	case *proto.InternalComputeChecksumRequest:
+		r.InternalComputeChecksum(batch, args.(*proto.InternalComputeChecksumRequest), reply.(*proto.InternalComputeChecksumResponse))
+	case *proto.InternalWriteBatchRequest:
+		r.InternalWriteBatch(batch, ms, args.(*proto.InternalWriteBatchRequest), reply.(*proto.InternalWriteBatchResponse))
 	default:
 		return util.Errorf("unrecognized command %s", args.Method())
 	}
 
+	// Refuse a transactional write which took its transaction past the
+	// intent limit set by the leader. A single write, such as a
+	// DeleteRange, may lay down many intents; returning an error
+	// discards the command's batch, so none of them are applied.
+	if limit := header.MaxIntents; limit > 0 && proto.IsTransactionWrite(args) &&
+		header.Txn.GetIntentCount() > limit {
+		header.Txn.SetIntentCount(origIntentCount)
+		err := proto.NewTxnIntentLimitExceededError(header.Txn, limit)
+		reply.Header().SetGoError(err)
+		return err
+	}
+
 	if log.V(2) {
 		log.Infof("executed %s command %+v: %+v", args.Method(), args, reply)
 	}
@@ -106,6 +128,13 @@ func (r *Range) executeCmd(batch engine.Engine, ms *proto.MVCCStats, args proto.
 	// Propagate the request timestamp (which may have changed).
 	reply.Header().Timestamp = header.Timestamp
 
+	// Report the intents laid down so that the coordinator carries
+	// them forward into the transaction's subsequent requests.
+	reply.Header().IntentsWritten = header.Txn.GetIntentCount() - origIntentCount
+	if reply.Header().IntentsWritten != 0 && reply.Header().Txn == nil {
+		reply.Header().Txn = gogoproto.Clone(header.Txn).(*proto.Transaction)
+	}
+
 	// A ReadWithinUncertaintyIntervalError contains the timestamp of the value
 	// that provoked the conflict. However, we forward the timestamp to the
 	// node's time here. The reason is that the caller (which is always
@@ -128,7 +157,8 @@ func (r *Range) executeCmd(batch engine.Engine, ms *proto.MVCCStats, args proto.
 
 // Get returns the value for a specified key.
 func (r *Range) Get(batch engine.Engine, args *proto.GetRequest, reply *proto.GetResponse) {
-	val, err := engine.MVCCGet(batch, args.Key, args.Timestamp, args.ReadConsistency == proto.CONSISTENT, args.Txn)
+	val, err := engine.MVCCGetWithGCThreshold(batch, args.Key, args.Timestamp, r.getGCThreshold(),
+		args.ReadConsistency == proto.CONSISTENT, args.Txn)
 	reply.Value = val
 	reply.SetGoError(err)
 }
@@ -164,7 +194,7 @@ func (r *Range) Delete(batch engine.Engine, ms *proto.MVCCStats, args *proto.Del
 // DeleteRange deletes the range of key/value pairs specified by
 // start and end keys.
 func (r *Range) DeleteRange(batch engine.Engine, ms *proto.MVCCStats, args *proto.DeleteRangeRequest, reply *proto.DeleteRangeResponse) {
-	num, err := engine.MVCCDeleteRange(batch, ms, args.Key, args.EndKey, args.MaxEntriesToDelete, args.Timestamp, args.Txn)
+	num, _, _, err := engine.MVCCDeleteRange(batch, ms, args.Key, args.EndKey, args.MaxEntriesToDelete, args.Timestamp, args.Txn, false)
 	reply.NumDeleted = num
 	reply.SetGoError(err)
 }
@@ -173,7 +203,8 @@ func (r *Range) DeleteRange(batch engine.Engine, ms *proto.MVCCStats, args *prot
 // to some maximum number of results. The last key of the iteration is
 // returned with the reply.
 func (r *Range) Scan(batch engine.Engine, args *proto.ScanRequest, reply *proto.ScanResponse) {
-	kvs, err := engine.MVCCScan(batch, args.Key, args.EndKey, args.MaxResults, args.Timestamp, args.ReadConsistency == proto.CONSISTENT, args.Txn)
+	kvs, err := engine.MVCCScanWithGCThreshold(batch, args.Key, args.EndKey, args.MaxResults, args.Timestamp,
+		r.getGCThreshold(), args.ReadConsistency == proto.CONSISTENT, args.Txn)
 	reply.Rows = kvs
 	reply.SetGoError(err)
 }
@@ -227,6 +258,9 @@ func (r *Range) EndTransaction(batch engine.Engine, ms *proto.MVCCStats, args *p
 		if reply.Txn.Priority < args.Txn.Priority {
 			reply.Txn.Priority = args.Txn.Priority
 		}
+		// The coordinator's intent count sums the intents written on
+		// all ranges; the record only holds a stale copy of it.
+		reply.Txn.SetIntentCount(args.Txn.GetIntentCount())
 	} else {
 		// The transaction doesn't exist yet on disk; use the supplied version.
 		reply.Txn = gogoproto.Clone(args.Txn).(*proto.Transaction)
@@ -267,7 +301,7 @@ func (r *Range) EndTransaction(batch engine.Engine, ms *proto.MVCCStats, args *p
 			if log.V(1) {
 				log.Infof("resolving intent at %s on end transaction [%s]", key, reply.Txn.Status)
 			}
-			if err := engine.MVCCResolveWriteIntent(batch, ms, key, reply.Txn.Timestamp, reply.Txn); err != nil {
+			if _, err := engine.MVCCResolveWriteIntent(batch, ms, key, reply.Txn.Timestamp, reply.Txn, false); err != nil {
 				reply.SetGoError(err)
 				return
 			}
@@ -398,7 +432,9 @@ func (r *Range) InternalRangeLookup(batch engine.Engine, args *proto.InternalRan
 
 // InternalHeartbeatTxn updates the transaction status and heartbeat
 // timestamp after receiving transaction heartbeat messages from
-// coordinator. Returns the updated transaction.
+// coordinator. A heartbeat to a committed or aborted transaction
+// which carries IntentsResolved marks the record as eligible for GC.
+// Returns the updated transaction.
 func (r *Range) InternalHeartbeatTxn(batch engine.Engine, ms *proto.MVCCStats,
 	args *proto.InternalHeartbeatTxnRequest, reply *proto.InternalHeartbeatTxnResponse) {
 	key := keys.TransactionKey(args.Txn.Key, args.Txn.ID)
@@ -425,6 +461,12 @@ func (r *Range) InternalHeartbeatTxn(batch engine.Engine, ms *proto.MVCCStats,
 			reply.SetGoError(err)
 			return
 		}
+	} else if ok && args.Txn.GetIntentsResolved() && !txn.GetIntentsResolved() {
+		txn.IntentsResolved = gogoproto.Bool(true)
+		if err := engine.MVCCPutProto(batch, ms, key, proto.ZeroTimestamp, nil, &txn); err != nil {
+			reply.SetGoError(err)
+			return
+		}
 	}
 	reply.Txn = &txn
 }
@@ -434,16 +476,81 @@ func (r *Range) InternalHeartbeatTxn(batch engine.Engine, ms *proto.MVCCStats,
 // listed key along with the expiration timestamp. The GC metadata
 // specified in the args is persisted after GC.
 func (r *Range) InternalGC(batch engine.Engine, ms *proto.MVCCStats, args *proto.InternalGCRequest, reply *proto.InternalGCResponse) {
+	// Forward the GC threshold persisted with the GC metadata. The
+	// threshold never moves backwards, even if the GC TTL has been
+	// raised since the last GC.
+	key := keys.RangeGCMetadataKey(r.Desc().RaftID)
+	threshold, err := loadGCThreshold(batch, r.Desc().RaftID)
+	if err != nil {
+		reply.SetGoError(err)
+		return
+	}
+	if args.GCMeta.Threshold != nil {
+		threshold.Forward(*args.GCMeta.Threshold)
+	}
+	// The range's in-memory threshold, which makes reads below it fail,
+	// is only forwarded once the batch has committed; see
+	// applyRaftCommand.
+	if !threshold.Equal(proto.ZeroTimestamp) {
+		args.GCMeta.Threshold = &threshold
+	}
+
+	// Transaction records are inline values and are removed outright,
+	// provided they're still eligible for GC.
+	gcKeys := make([]proto.InternalGCRequest_GCKey, 0, len(args.Keys))
+	for _, gcKey := range args.Keys {
+		if !isTransactionKey(gcKey.Key) {
+			gcKeys = append(gcKeys, gcKey)
+			continue
+		}
+		txn := &proto.Transaction{}
+		ok, err := engine.MVCCGetProto(batch, gcKey.Key, proto.ZeroTimestamp, true, nil, txn)
+		if err != nil {
+			reply.SetGoError(err)
+			return
+		}
+		if !ok || !isTransactionGCable(txn) {
+			continue
+		}
+		if err := engine.MVCCDelete(batch, ms, gcKey.Key, proto.ZeroTimestamp, nil); err != nil {
+			reply.SetGoError(err)
+			return
+		}
+	}
+
 	// Garbage collect the specified keys by expiration timestamps.
-	if err := engine.MVCCGarbageCollect(batch, ms, args.Keys, args.Timestamp); err != nil {
+	if err := engine.MVCCGarbageCollect(batch, ms, gcKeys, args.Timestamp); err != nil {
 		reply.SetGoError(err)
 		return
 	}
 
 	// Store the GC metadata for this range.
-	key := keys.RangeGCMetadataKey(r.Desc().RaftID)
-	err := engine.MVCCPutProto(batch, ms, key, proto.ZeroTimestamp, nil, &args.GCMeta)
-	reply.SetGoError(err)
+	reply.SetGoError(engine.MVCCPutProto(batch, ms, key, proto.ZeroTimestamp, nil, &args.GCMeta))
+}
+
+// isTransactionGCable returns whether the transaction record may be
+// removed. Both committed and aborted records are kept until all of
+// the transaction's intents, on any range, are known to be resolved.
+// An intent of a committed transaction found without its record would
+// otherwise be aborted, and InternalHeartbeatTxn recreates a missing
+// record as PENDING, so the coordinator of an aborted transaction
+// could revive it and commit its remaining intents.
+func isTransactionGCable(txn *proto.Transaction) bool {
+	switch txn.Status {
+	case proto.ABORTED, proto.COMMITTED:
+		return txn.GetIntentsResolved()
+	}
+	return false
+}
+
+// isTransactionKey returns whether key is the key of a transaction
+// record.
+func isTransactionKey(key proto.Key) bool {
+	if !bytes.HasPrefix(key, keys.LocalRangePrefix) {
+		return false
+	}
+	_, suffix, _ := keys.DecodeRangeKey(key)
+	return suffix.Equal(keys.LocalTransactionSuffix)
 }
 
 // InternalPushTxn resolves conflicts between concurrent txns (or
@@ -480,6 +587,9 @@ func (r *Range) InternalGC(batch engine.Engine, ms *proto.MVCCStats, args *proto
 // Higher Txn Priority: If pushee txn has a higher priority than
 // pusher, return TransactionPushError. Transaction will be retried
 // with priority one less than the pushee's higher priority.
+//
+// Equal Txn Priority: The txn with the lower timestamp wins; if the
+// timestamps are equal as well, the txn with the lower ID wins.
 func (r *Range) InternalPushTxn(batch engine.Engine, ms *proto.MVCCStats, args *proto.InternalPushTxnRequest, reply *proto.InternalPushTxnResponse) {
 	if !bytes.Equal(args.Key, args.PusheeTxn.Key) {
 		reply.SetGoError(util.Errorf("request key %s should match pushee's txn key %s", args.Key, args.PusheeTxn.Key))
@@ -578,9 +688,12 @@ func (r *Range) InternalPushTxn(batch engine.Engine, ms *proto.MVCCStats, args *
 		pusherWins = false
 	} else if reply.PusheeTxn.Priority < priority ||
 		(reply.PusheeTxn.Priority == priority && args.Txn != nil &&
-			args.Txn.Timestamp.Less(reply.PusheeTxn.Timestamp)) {
+			(args.Txn.Timestamp.Less(reply.PusheeTxn.Timestamp) ||
+				(args.Txn.Timestamp.Equal(reply.PusheeTxn.Timestamp) &&
+					bytes.Compare(args.Txn.ID, reply.PusheeTxn.ID) < 0))) {
 		// Pusher wins based on priority; if priorities are equal, order
-		// by lower txn timestamp.
+		// by lower txn timestamp and then by lower txn ID, so that the
+		// outcome of a conflict is always deterministic.
 		if log.V(1) {
 			log.Infof("pushing intent from txn with lower priority %s vs %d", reply.PusheeTxn, priority)
 		}
@@ -622,7 +735,8 @@ func (r *Range) InternalResolveIntent(batch engine.Engine, ms *proto.MVCCStats,
 		reply.SetGoError(util.Errorf("no transaction specified to InternalResolveIntent"))
 		return
 	}
-	reply.SetGoError(engine.MVCCResolveWriteIntent(batch, ms, args.Key, args.Timestamp, args.Txn))
+	_, err := engine.MVCCResolveWriteIntent(batch, ms, args.Key, args.Timestamp, args.Txn, false)
+	reply.SetGoError(err)
 }
 
 // InternalResolveIntentRange resolves write intents in the specified
@@ -633,7 +747,7 @@ func (r *Range) InternalResolveIntentRange(batch engine.Engine, ms *proto.MVCCSt
 		reply.SetGoError(util.Errorf("no transaction specified to InternalResolveIntentRange"))
 		return
 	}
-	_, err := engine.MVCCResolveWriteIntentRange(batch, ms, args.Key, args.EndKey, 0, args.Timestamp, args.Txn)
+	_, _, err := engine.MVCCResolveWriteIntentRange(batch, ms, args.Key, args.EndKey, 0, args.Timestamp, args.Txn)
 	reply.SetGoError(err)
 }
 
@@ -763,6 +877,54 @@ func (r *Range) InternalLeaderLease(batch engine.Engine, ms *proto.MVCCStats, ar
 	})
 }
 
+// InternalComputeChecksum computes a SHA-512 checksum over the MVCC
+// key-value pairs of the range's user key span. Because the command is
+// executed by every replica at the same position in the raft log, the
+// checksums of consistent replicas are identical. The checksum is
+// remembered by the replica and may be retrieved via GetChecksum()
+// using the command's timestamp.
+func (r *Range) InternalComputeChecksum(batch engine.Engine, args *proto.InternalComputeChecksumRequest, reply *proto.InternalComputeChecksumResponse) {
+	desc := r.Desc()
+	start := desc.StartKey
+	if start.Less(keys.LocalMax) {
+		start = keys.LocalMax
+	}
+	sha := sha512.New()
+	var lenBuf []byte
+	err := batch.Iterate(engine.MVCCEncodeKey(start), engine.MVCCEncodeKey(desc.EndKey),
+		func(kv proto.RawKeyValue) (bool, error) {
+			// Prefix the value with its length so that adjacent pairs
+			// can't be confused for one another.
+			lenBuf = encoding.EncodeUvarint(lenBuf[:0], uint64(len(kv.Value)))
+			sha.Write(kv.Key)
+			sha.Write(lenBuf)
+			sha.Write(kv.Value)
+			return false, nil
+		})
+	if err != nil {
+		reply.SetGoError(err)
+		return
+	}
+	reply.Checksum = sha.Sum(nil)
+	r.addChecksum(args.Timestamp, reply.Checksum)
+}
+
+// InternalWriteBatch applies the serialized RocksDB write batch in
+// args.Repr to the range's data. The batch's entries are written
+// directly, bypassing the MVCC write path, as during bulk ingestion.
+// They must be blind writes of new versions at the request timestamp;
+// see engine.MVCCApplyBatchRepr. All keys must lie within the
+// request's key span, which may not include local keys; otherwise
+// nothing is applied. Batches larger than maxWriteBatchReprSize are
+// refused before being proposed; see addWriteCmd.
+func (r *Range) InternalWriteBatch(batch engine.Engine, ms *proto.MVCCStats, args *proto.InternalWriteBatchRequest, reply *proto.InternalWriteBatchResponse) {
+	if args.Key.Less(keys.LocalMax) {
+		reply.SetGoError(util.Errorf("write batch span [%q, %q) must not include local keys", args.Key, args.EndKey))
+		return
+	}
+	reply.SetGoError(engine.MVCCApplyBatchRepr(batch, ms, args.Repr, args.Key, args.EndKey, args.Timestamp))
+}
+
 // AdminSplit divides the range into into two ranges, using either
 // args.SplitKey (if provided) or an internally computed key that aims to
 // roughly equipartition the range by size. The split is done inside of
@@ -921,6 +1083,8 @@ func (r *Range) splitTrigger(batch engine.Engine, split *proto.SplitTrigger) err
 	if err != nil {
 		return err
 	}
+	// The new range's GC metadata, copied above, isn't committed yet.
+	newRng.setGCThreshold(r.getGCThreshold())
 
 	// Compute stats for new range.
 	iter = newRangeDataIterator(&split.NewDesc, batch)
@@ -950,7 +1114,8 @@ func (r *Range) splitTrigger(batch engine.Engine, split *proto.SplitTrigger) err
 // range addressing metadata. The handover of responsibility for
 // the reassigned key range is carried out seamlessly through a merge trigger
 // carried out as part of the commit of that transaction.
-// A merge requires that the two ranges are collocate on the same set of replicas.
+// A merge requires that the two ranges are collocate on the same set of replicas
+// and that their combined size doesn't exceed the range's max bytes.
 func (r *Range) AdminMerge(args *proto.AdminMergeRequest, reply *proto.AdminMergeResponse) {
 	// Only allow a single split/merge per range at a time.
 	r.metaLock.Lock()
@@ -983,6 +1148,13 @@ func (r *Range) AdminMerge(args *proto.AdminMergeRequest, reply *proto.AdminMerg
 		return
 	}
 
+	// Don't create a range which is large enough to be split again.
+	if size, maxBytes := r.stats.GetSize()+subsumedRng.stats.GetSize(), r.GetMaxBytes(); maxBytes > 0 && size > maxBytes {
+		reply.SetGoError(util.Errorf("combined size %d of ranges %d and %d exceeds range max bytes %d",
+			size, desc.RaftID, subsumedDesc.RaftID, maxBytes))
+		return
+	}
+
 	// Init updated version of existing range descriptor.
 	updatedDesc := *desc
 	updatedDesc.EndKey = subsumedDesc.EndKey
@@ -1051,6 +1223,25 @@ func (r *Range) mergeTrigger(batch engine.Engine, merge *proto.MergeTrigger) err
 		return util.Errorf("unable to copy response cache to new split range: %s", err)
 	}
 
+	// Adopt the subsumed range's GC threshold if it is later, as its
+	// data may have been garbage collected up to it.
+	subsumedThreshold, err := loadGCThreshold(batch, merge.SubsumedRaftID)
+	if err != nil {
+		return util.Errorf("unable to fetch subsumed range's GC threshold: %s", err)
+	}
+	if r.getGCThreshold().Less(subsumedThreshold) {
+		gcMetaKey := keys.RangeGCMetadataKey(r.Desc().RaftID)
+		gcMeta := &proto.GCMetadata{}
+		if _, err := engine.MVCCGetProto(batch, gcMetaKey, proto.ZeroTimestamp, true, nil, gcMeta); err != nil {
+			return util.Errorf("unable to fetch GC metadata: %s", err)
+		}
+		gcMeta.Threshold = &subsumedThreshold
+		if err := engine.MVCCPutProto(batch, nil, gcMetaKey, proto.ZeroTimestamp, nil, gcMeta); err != nil {
+			return util.Errorf("unable to write GC metadata: %s", err)
+		}
+		r.setGCThreshold(subsumedThreshold)
+	}
+
 	// Compute stats for updated range.
 	now := r.rm.Clock().Timestamp()
 	iter := newRangeDataIterator(&merge.UpdatedDesc, batch)
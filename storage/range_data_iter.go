@@ -21,6 +21,7 @@ import (
 	"github.com/cockroachdb/cockroach/keys"
 	"github.com/cockroachdb/cockroach/proto"
 	"github.com/cockroachdb/cockroach/storage/engine"
+	"github.com/cockroachdb/cockroach/util"
 	"github.com/cockroachdb/cockroach/util/encoding"
 	gogoproto "github.com/gogo/protobuf/proto"
 )
@@ -36,11 +37,14 @@ type keyRange struct {
 // all of the range's data.
 //
 // A rangeDataIterator provides the same API as an Engine iterator
-// with the exception of the Seek() method.
+// with the exception of the Seek() method. Reverse iteration is not
+// supported; calling SeekReverse() or Prev() invalidates the iterator
+// and reports an error via Error().
 type rangeDataIterator struct {
 	curIndex int
 	ranges   []keyRange
 	iter     engine.Iterator
+	err      error
 }
 
 func newRangeDataIterator(d *proto.RangeDescriptor, e engine.Engine) *rangeDataIterator {
@@ -51,11 +55,12 @@ func newRangeDataIterator(d *proto.RangeDescriptor, e engine.Engine) *rangeDataI
 	if d.StartKey.Equal(proto.KeyMin) {
 		dataStartKey = keys.LocalMax
 	}
+	localStart, localEnd := keys.RangeLocalKeys(d.RaftID)
 	ri := &rangeDataIterator{
 		ranges: []keyRange{
 			{
-				start: engine.MVCCEncodeKey(keys.MakeKey(keys.LocalRangeIDPrefix, encoding.EncodeUvarint(nil, uint64(d.RaftID)))),
-				end:   engine.MVCCEncodeKey(keys.MakeKey(keys.LocalRangeIDPrefix, encoding.EncodeUvarint(nil, uint64(d.RaftID+1)))),
+				start: engine.MVCCEncodeKey(localStart),
+				end:   engine.MVCCEncodeKey(localEnd),
 			},
 			{
 				start: engine.MVCCEncodeKey(keys.MakeKey(keys.LocalRangePrefix, encoding.EncodeBytes(nil, d.StartKey))),
@@ -85,9 +90,14 @@ func (ri *rangeDataIterator) Seek(key []byte) {
 	ri.advance()
 }
 
+// SeekReverse is not supported by rangeDataIterator.
+func (ri *rangeDataIterator) SeekReverse(key []byte) {
+	ri.err = util.Errorf("rangeDataIterator does not support reverse iteration")
+}
+
 // Valid returns whether the underlying iterator is valid.
 func (ri *rangeDataIterator) Valid() bool {
-	return ri.iter.Valid()
+	return ri.err == nil && ri.iter.Valid()
 }
 
 // Next returns the next raw key value in the iteration, or nil if
@@ -97,6 +107,11 @@ func (ri *rangeDataIterator) Next() {
 	ri.advance()
 }
 
+// Prev is not supported by rangeDataIterator.
+func (ri *rangeDataIterator) Prev() {
+	ri.err = util.Errorf("rangeDataIterator does not support reverse iteration")
+}
+
 // Key returns the current Key for the iteration if valid.
 func (ri *rangeDataIterator) Key() proto.EncodedKey {
 	return ri.iter.Key()
@@ -115,9 +130,22 @@ func (ri *rangeDataIterator) ValueProto(msg gogoproto.Message) error {
 
 // Error returns the Error for the iteration if applicable.
 func (ri *rangeDataIterator) Error() error {
+	if ri.err != nil {
+		return ri.err
+	}
 	return ri.iter.Error()
 }
 
+// EnableStats enables stats collection on the underlying iterator.
+func (ri *rangeDataIterator) EnableStats() {
+	ri.iter.EnableStats()
+}
+
+// Stats returns the stats of the underlying iterator.
+func (ri *rangeDataIterator) Stats() engine.IteratorStats {
+	return ri.iter.Stats()
+}
+
 // advance moves the iterator forward through the ranges until a valid
 // key is found or the iteration is done and the iterator becomes
 // invalid.
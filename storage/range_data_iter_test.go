@@ -121,6 +121,33 @@ func TestRangeDataIteratorEmptyRange(t *testing.T) {
 	}
 }
 
+// TestRangeDataIteratorReverse verifies that reverse iteration
+// invalidates the iterator with an error rather than panicking.
+func TestRangeDataIteratorReverse(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	tc := testContext{}
+	tc.Start(t)
+	defer tc.Stop()
+
+	for i, reverse := range []func(*rangeDataIterator){
+		func(iter *rangeDataIterator) { iter.SeekReverse(engine.MVCCKeyMax) },
+		func(iter *rangeDataIterator) { iter.Prev() },
+	} {
+		iter := newRangeDataIterator(tc.rng.Desc(), tc.rng.rm.Engine())
+		if !iter.Valid() {
+			t.Fatalf("%d: expected a valid iterator", i)
+		}
+		reverse(iter)
+		if iter.Valid() {
+			t.Errorf("%d: expected iterator to be invalid after reverse iteration", i)
+		}
+		if iter.Error() == nil {
+			t.Errorf("%d: expected error after reverse iteration", i)
+		}
+		iter.Close()
+	}
+}
+
 // TestRangeDataIterator creates three ranges {"a"-"b" (pre), "b"-"c"
 // (main test range), "c"-"d" (post)} and fills each with data. It
 // first verifies the contents of the "b"-"c" range, then deletes it
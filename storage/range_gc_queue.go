@@ -57,9 +57,17 @@ func (q *rangeGCQueue) needsLeaderLease() bool {
 }
 
 // shouldQueue determins whether a range should be queued for GC,
-// and if so at what priority. Currently all inactive ranges are
-// considered for possible GC at equal priority.
+// and if so at what priority. A replica which has applied its own
+// removal from the range is queued at a higher priority; all other
+// inactive ranges are considered for possible GC at equal priority.
 func (q *rangeGCQueue) shouldQueue(now proto.Timestamp, rng *Range) (bool, float64) {
+	// A replica which is merely behind on its log still finds itself
+	// in its descriptor. An uninitialized replica has no descriptor yet
+	// and is waiting for a snapshot.
+	if rng.isInitialized() && rng.GetReplica() == nil {
+		return true, 1
+	}
+
 	if _, expired := rng.HasLeaderLease(now); !expired {
 		// If anyone holds a non-expired lease and we know about it, we
 		// have recently been an active member of the range.  This is not
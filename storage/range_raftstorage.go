@@ -137,8 +137,13 @@ func (r *Range) LastIndex() (uint64, error) {
 // current entry. This includes both entries that have been compacted away
 // and the dummy entries that make up the starting point of an empty log.
 func (r *Range) raftTruncatedState() (proto.RaftTruncatedState, error) {
+	return r.loadTruncatedState(r.rm.Engine())
+}
+
+// loadTruncatedState retrieves the truncated state from the supplied engine.
+func (r *Range) loadTruncatedState(eng engine.Engine) (proto.RaftTruncatedState, error) {
 	ts := proto.RaftTruncatedState{}
-	ok, err := engine.MVCCGetProto(r.rm.Engine(), keys.RaftTruncatedStateKey(r.Desc().RaftID),
+	ok, err := engine.MVCCGetProto(eng, keys.RaftTruncatedStateKey(r.Desc().RaftID),
 		proto.ZeroTimestamp, true, nil, &ts)
 	if err != nil {
 		return ts, err
@@ -222,36 +227,88 @@ func setLastIndex(eng engine.Engine, raftID int64, lastIndex uint64) error {
 		}, nil)
 }
 
-// Snapshot implements the raft.Storage interface.
-func (r *Range) Snapshot() (raftpb.Snapshot, error) {
-	// Copy all the data from a consistent RocksDB snapshot into a RaftSnapshotData.
-	snap := r.rm.NewSnapshot()
-	defer snap.Close()
-	var snapData proto.RaftSnapshotData
+// A rangeSnapshot is a consistent view of a range's data, captured
+// along with the metadata required to initialize a replica from it.
+// The data is streamed from an engine snapshot rather than held in
+// memory, so it must be closed when no longer needed.
+type rangeSnapshot struct {
+	snap           engine.Engine
+	appliedIndex   uint64
+	term           uint64
+	desc           proto.RangeDescriptor
+	truncatedState proto.RaftTruncatedState
+}
+
+// newRangeSnapshot captures a snapshot of the range's data together
+// with its applied index, range descriptor and truncated state.
+func (r *Range) newRangeSnapshot() (*rangeSnapshot, error) {
+	s := &rangeSnapshot{snap: r.rm.NewSnapshot()}
 
 	// Read the range metadata from the snapshot instead of the members
 	// of the Range struct because they might be changed concurrently.
-	appliedIndex, err := r.loadAppliedIndex(snap)
-	if err != nil {
-		return raftpb.Snapshot{}, err
+	var err error
+	if s.appliedIndex, err = r.loadAppliedIndex(s.snap); err != nil {
+		s.Close()
+		return nil, err
 	}
-	var desc proto.RangeDescriptor
 	// We ignore intents on the range descriptor (consistent=false) because we
 	// know they cannot be committed yet; operations that modify range
 	// descriptors resolve their own intents when they commit.
-	ok, err := engine.MVCCGetProto(snap, keys.RangeDescriptorKey(r.Desc().StartKey),
-		r.rm.Clock().Now(), false, nil, &desc)
+	ok, err := engine.MVCCGetProto(s.snap, keys.RangeDescriptorKey(r.Desc().StartKey),
+		r.rm.Clock().Now(), false, nil, &s.desc)
 	if err != nil {
-		return raftpb.Snapshot{}, util.Errorf("failed to get desc: %s", err)
+		s.Close()
+		return nil, util.Errorf("failed to get desc: %s", err)
 	} else if !ok {
-		return raftpb.Snapshot{}, util.Errorf("couldn't find range descriptor")
+		s.Close()
+		return nil, util.Errorf("couldn't find range descriptor")
+	}
+	if s.truncatedState, err = r.loadTruncatedState(s.snap); err != nil {
+		s.Close()
+		return nil, err
+	}
+	if s.term, err = r.Term(s.appliedIndex); err != nil {
+		s.Close()
+		return nil, err
 	}
+	return s, nil
+}
 
-	// Iterate over all the data in the range, including local-only data like
-	// the response cache.
-	for iter := newRangeDataIterator(r.Desc(), snap); iter.Valid(); iter.Next() {
+// Iterate streams all the data in the snapshotted range, including
+// local-only data like the response cache, to f in key order. If f
+// returns done=true or an error, iteration stops.
+func (s *rangeSnapshot) Iterate(f func(proto.RawKeyValue) (bool, error)) error {
+	iter := newRangeDataIterator(&s.desc, s.snap)
+	defer iter.Close()
+	for ; iter.Valid(); iter.Next() {
+		if done, err := f(proto.RawKeyValue{Key: iter.Key(), Value: iter.Value()}); done || err != nil {
+			return err
+		}
+	}
+	return iter.Error()
+}
+
+// Close releases the underlying engine snapshot.
+func (s *rangeSnapshot) Close() {
+	s.snap.Close()
+}
+
+// Snapshot implements the raft.Storage interface.
+func (r *Range) Snapshot() (raftpb.Snapshot, error) {
+	// Copy all the data from a consistent RocksDB snapshot into a RaftSnapshotData.
+	s, err := r.newRangeSnapshot()
+	if err != nil {
+		return raftpb.Snapshot{}, err
+	}
+	defer s.Close()
+
+	var snapData proto.RaftSnapshotData
+	if err := s.Iterate(func(kv proto.RawKeyValue) (bool, error) {
 		snapData.KV = append(snapData.KV,
-			&proto.RaftSnapshotData_KeyValue{Key: iter.Key(), Value: iter.Value()})
+			&proto.RaftSnapshotData_KeyValue{Key: kv.Key, Value: kv.Value})
+		return false, nil
+	}); err != nil {
+		return raftpb.Snapshot{}, err
 	}
 
 	data, err := gogoproto.Marshal(&snapData)
@@ -261,20 +318,15 @@ func (r *Range) Snapshot() (raftpb.Snapshot, error) {
 
 	// Synthesize our raftpb.ConfState from desc.
 	var cs raftpb.ConfState
-	for _, rep := range desc.Replicas {
+	for _, rep := range s.desc.Replicas {
 		cs.Nodes = append(cs.Nodes, uint64(proto.MakeRaftNodeID(rep.NodeID, rep.StoreID)))
 	}
 
-	term, err := r.Term(appliedIndex)
-	if err != nil {
-		return raftpb.Snapshot{}, err
-	}
-
 	return raftpb.Snapshot{
 		Data: data,
 		Metadata: raftpb.SnapshotMetadata{
-			Index:     appliedIndex,
-			Term:      term,
+			Index:     s.appliedIndex,
+			Term:      s.term,
 			ConfState: cs,
 		},
 	}, nil
@@ -377,6 +429,12 @@ func (r *Range) ApplySnapshot(snap raftpb.Snapshot) error {
 		return err
 	}
 
+	// Read the GC threshold.
+	gcThreshold, err := loadGCThreshold(batch, desc.RaftID)
+	if err != nil {
+		return err
+	}
+
 	// Copy range stats to new range.
 	oldStats := r.stats
 	r.stats, err = newRangeStats(desc.RaftID, batch)
@@ -404,13 +462,14 @@ func (r *Range) ApplySnapshot(snap raftpb.Snapshot) error {
 	// As outlined above, last and applied index are the same after applying
 	// the snapshot.
 	atomic.StoreUint64(&r.lastIndex, snap.Metadata.Index)
-	atomic.StoreUint64(&r.appliedIndex, snap.Metadata.Index)
+	r.advanceAppliedIndex(snap.Metadata.Index)
 
 	// Atomically update the descriptor and lease.
 	if err := r.setDesc(&desc); err != nil {
 		return err
 	}
 	atomic.StorePointer(&r.lease, unsafe.Pointer(lease))
+	r.setGCThreshold(gcThreshold)
 	return nil
 }
 
@@ -304,12 +304,12 @@ func TestRangeReadConsistency(t *testing.T) {
 		t.Errorf("expected success on consistent read: %s", err)
 	}
 
-	// Try a consensus read and verify error.
+	// Try a consensus read and verify success.
 	gArgs.ReadConsistency = proto.CONSENSUS
 
-	if err := tc.rng.AddCmd(tc.rng.context(), client.Call{Args: gArgs, Reply: gReply}, true); err == nil {
+	if err := tc.rng.AddCmd(tc.rng.context(), client.Call{Args: gArgs, Reply: gReply}, true); err != nil {
 
-		t.Errorf("expected error on consensus read")
+		t.Errorf("expected success on consensus read: %s", err)
 	}
 
 	// Try an inconsistent read within a transaction.
@@ -347,6 +347,54 @@ func TestRangeReadConsistency(t *testing.T) {
 	}
 }
 
+// TestRangeAppliedIndexChan verifies that the channel returned for an
+// index is closed once the range applies that index, and not before.
+func TestRangeAppliedIndexChan(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	r := &Range{}
+	r.advanceAppliedIndex(5)
+
+	if ch := r.appliedIndexChan(5); ch != nil {
+		t.Error("expected no channel for an applied index")
+	}
+	ch7 := r.appliedIndexChan(7)
+	ch8 := r.appliedIndexChan(8)
+	if ch7 == nil || ch8 == nil {
+		t.Fatal("expected channels for indexes not yet applied")
+	}
+	if ch := r.appliedIndexChan(7); ch != ch7 {
+		t.Error("expected waiters on the same index to share a channel")
+	}
+
+	isClosed := func(ch <-chan struct{}) bool {
+		select {
+		case <-ch:
+			return true
+		default:
+			return false
+		}
+	}
+	r.advanceAppliedIndex(6)
+	if isClosed(ch7) || isClosed(ch8) {
+		t.Fatal("channel closed before its index was applied")
+	}
+	r.advanceAppliedIndex(7)
+	if !isClosed(ch7) {
+		t.Error("expected channel of index 7 to be closed")
+	}
+	if isClosed(ch8) {
+		t.Error("channel of index 8 closed before it was applied")
+	}
+	// Skipping past an index also wakes its waiters.
+	r.advanceAppliedIndex(10)
+	if !isClosed(ch8) {
+		t.Error("expected channel of index 8 to be closed")
+	}
+	if n := len(r.appliedWaiters); n != 0 {
+		t.Errorf("expected no remaining waiters, got %d", n)
+	}
+}
+
 func TestRangeRangeBoundsChecking(t *testing.T) {
 	defer leaktest.AfterTest(t)
 	tc := testContext{}
@@ -944,6 +992,55 @@ func TestAcquireLeaderLease(t *testing.T) {
 	}
 }
 
+// TestRangeLeaderLeaseLocalReads verifies that consistent reads are
+// served locally without a raft command while the leader lease is
+// held, and that a read after the lease expires first reacquires the
+// lease through raft.
+func TestRangeLeaderLeaseLocalReads(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	tc := testContext{}
+	tc.Start(t)
+	defer tc.Stop()
+
+	read := func() {
+		gArgs, gReply := getArgs([]byte("a"), 1, tc.store.StoreID())
+		gArgs.Timestamp = tc.clock.Now()
+		if err := tc.rng.AddCmd(tc.rng.context(), client.Call{Args: gArgs, Reply: gReply}, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The range starts out with the lease; reading doesn't touch raft.
+	if held, expired := tc.rng.HasLeaderLease(tc.clock.Now()); !held || expired {
+		t.Fatalf("expected lease on range start")
+	}
+	appliedIndex := atomic.LoadUint64(&tc.rng.appliedIndex)
+	read()
+	if idx := atomic.LoadUint64(&tc.rng.appliedIndex); idx != appliedIndex {
+		t.Errorf("expected local read not to apply raft commands; applied index %d -> %d", appliedIndex, idx)
+	}
+
+	// Let the lease expire. The next read must reacquire it via raft.
+	tc.manualClock.Set(int64(DefaultLeaderLeaseDuration + 1000))
+	if held, expired := tc.rng.HasLeaderLease(tc.clock.Now()); !held || !expired {
+		t.Fatalf("expected expired lease")
+	}
+	read()
+	if idx := atomic.LoadUint64(&tc.rng.appliedIndex); idx <= appliedIndex {
+		t.Errorf("expected lease reacquisition to apply a raft command; applied index %d -> %d", appliedIndex, idx)
+	}
+	if held, expired := tc.rng.HasLeaderLease(tc.clock.Now()); !held || expired {
+		t.Errorf("expected lease to be reacquired")
+	}
+
+	// Reads within the renewed lease are local again.
+	appliedIndex = atomic.LoadUint64(&tc.rng.appliedIndex)
+	read()
+	if idx := atomic.LoadUint64(&tc.rng.appliedIndex); idx != appliedIndex {
+		t.Errorf("expected local read not to apply raft commands; applied index %d -> %d", appliedIndex, idx)
+	}
+}
+
 // TestRangeUpdateTSCache verifies that reads and writes update the
 // timestamp cache.
 func TestRangeUpdateTSCache(t *testing.T) {
@@ -1191,6 +1288,161 @@ func TestRangeUseTSCache(t *testing.T) {
 	}
 }
 
+// TestRangeWriteClockOffsetExceeded verifies that a write with a
+// timestamp further ahead of the local clock than the max clock
+// offset is rejected, while one within the offset is accepted.
+func TestRangeWriteClockOffsetExceeded(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	tc := testContext{}
+	tc.Start(t)
+	defer tc.Stop()
+	tc.manualClock.Set((1 * time.Second).Nanoseconds())
+	maxOffset := 250 * time.Millisecond
+	tc.clock.SetMaxOffset(maxOffset)
+
+	pArgs, pReply := putArgs([]byte("a"), []byte("value"), 1, tc.store.StoreID())
+	pArgs.Timestamp = tc.clock.Now()
+	pArgs.Timestamp.WallTime += maxOffset.Nanoseconds() + 1
+	err := tc.rng.AddCmd(tc.rng.context(), client.Call{Args: pArgs, Reply: pReply}, true)
+	if _, ok := err.(*engine.ClockOffsetExceededError); !ok {
+		t.Fatalf("expected clock offset exceeded error; got %v", err)
+	}
+
+	pArgs, pReply = putArgs([]byte("a"), []byte("value"), 1, tc.store.StoreID())
+	pArgs.Timestamp = tc.clock.Now()
+	pArgs.Timestamp.WallTime += maxOffset.Nanoseconds()
+	if err := tc.rng.AddCmd(tc.rng.context(), client.Call{Args: pArgs, Reply: pReply}, true); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRangeTxnIntentLimit verifies that transactional writes are
+// refused once the transaction has laid down as many intents as the
+// store allows, and that a write which would overshoot the limit is
+// refused without laying down any intents.
+func TestRangeTxnIntentLimit(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	tc := testContext{}
+	tc.Start(t)
+	defer tc.Stop()
+	tc.store.ctx.MaxIntentsPerTxn = 2
+
+	txn := newTransaction("test", proto.Key("a"), 1, proto.SERIALIZABLE, tc.clock)
+	for _, key := range []string{"a", "b"} {
+		pArgs, pReply := putArgs(proto.Key(key), []byte("value"), 1, tc.store.StoreID())
+		pArgs.Timestamp = txn.Timestamp
+		pArgs.Txn = txn
+		if err := tc.rng.AddCmd(tc.rng.context(), client.Call{Args: pArgs, Reply: pReply}, true); err != nil {
+			t.Fatal(err)
+		}
+		if pReply.IntentsWritten != 1 {
+			t.Errorf("expected 1 intent written for %q; got %d", key, pReply.IntentsWritten)
+		}
+		txn.Update(pReply.Txn)
+	}
+	if txn.GetIntentCount() != 2 {
+		t.Fatalf("expected intent count 2; got %d", txn.GetIntentCount())
+	}
+
+	pArgs, pReply := putArgs(proto.Key("c"), []byte("value"), 1, tc.store.StoreID())
+	pArgs.Timestamp = txn.Timestamp
+	pArgs.Txn = txn
+	err := tc.rng.AddCmd(tc.rng.context(), client.Call{Args: pArgs, Reply: pReply}, true)
+	if lErr, ok := err.(*proto.TxnIntentLimitExceededError); !ok {
+		t.Fatalf("expected intent limit error; got %v", err)
+	} else if lErr.Limit != 2 {
+		t.Errorf("expected limit 2; got %d", lErr.Limit)
+	}
+
+	// Other transactions are unaffected.
+	pArgs, pReply = putArgs(proto.Key("c"), []byte("value"), 1, tc.store.StoreID())
+	pArgs.Txn = newTransaction("other", proto.Key("c"), 1, proto.SERIALIZABLE, tc.clock)
+	pArgs.Timestamp = pArgs.Txn.Timestamp
+	if err := tc.rng.AddCmd(tc.rng.context(), client.Call{Args: pArgs, Reply: pReply}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// A single write which would lay down more intents than allowed is
+	// refused as a whole.
+	for _, key := range []string{"x1", "x2", "x3"} {
+		pArgs, pReply := putArgs(proto.Key(key), []byte("value"), 1, tc.store.StoreID())
+		pArgs.Timestamp = tc.clock.Now()
+		if err := tc.rng.AddCmd(tc.rng.context(), client.Call{Args: pArgs, Reply: pReply}, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	drTxn := newTransaction("delete", proto.Key("x1"), 1, proto.SERIALIZABLE, tc.clock)
+	drArgs := &proto.DeleteRangeRequest{
+		RequestHeader: proto.RequestHeader{
+			Key:       proto.Key("x"),
+			EndKey:    proto.Key("y"),
+			Timestamp: drTxn.Timestamp,
+			RaftID:    1,
+			Replica:   proto.Replica{StoreID: tc.store.StoreID()},
+			Txn:       drTxn,
+		},
+	}
+	drReply := &proto.DeleteRangeResponse{}
+	err = tc.rng.AddCmd(tc.rng.context(), client.Call{Args: drArgs, Reply: drReply}, true)
+	if _, ok := err.(*proto.TxnIntentLimitExceededError); !ok {
+		t.Fatalf("expected intent limit error; got %v", err)
+	}
+	if drTxn.GetIntentCount() != 0 {
+		t.Errorf("expected intent count 0; got %d", drTxn.GetIntentCount())
+	}
+	sArgs, sReply := scanArgs(proto.Key("x"), proto.Key("y"), 1, tc.store.StoreID())
+	sArgs.Timestamp = tc.clock.Now()
+	if err := tc.rng.AddCmd(tc.rng.context(), client.Call{Args: sArgs, Reply: sReply}, true); err != nil {
+		t.Fatal(err)
+	}
+	if len(sReply.Rows) != 3 {
+		t.Errorf("expected the refused deletion to leave 3 rows; got %d", len(sReply.Rows))
+	}
+}
+
+// TestRangeWriteRateLimit verifies that a burst of writes to a range
+// with a write rate limit is throttled to the configured rate.
+func TestRangeWriteRateLimit(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	tc := testContext{}
+	tc.Start(t)
+	defer tc.Stop()
+
+	const rate = 40000 // bytes/sec
+	tc.rng.SetWriteRate(rate)
+	value := bytes.Repeat([]byte("v"), 1000)
+	var total int64
+	start := time.Now()
+	for i := 0; i < 40; i++ {
+		pArgs, pReply := putArgs([]byte(fmt.Sprintf("key-%02d", i)), value, 1, tc.store.StoreID())
+		pArgs.Timestamp = tc.clock.Now()
+		total += int64(gogoproto.Size(pArgs))
+		if err := tc.rng.AddCmd(tc.rng.context(), client.Call{Args: pArgs, Reply: pReply}, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	elapsed := time.Since(start)
+
+	// The bucket starts out empty, so the writes can't complete faster
+	// than the rate allows.
+	expected := time.Duration(float64(total) / rate * float64(time.Second))
+	if elapsed < expected*9/10 || elapsed > expected*2 {
+		t.Errorf("expected %d bytes to be written in about %s; took %s", total, expected, elapsed)
+	}
+
+	// Lifting the limit lets writes proceed immediately.
+	tc.rng.SetWriteRate(0)
+	pArgs, pReply := putArgs([]byte("key-unlimited"), value, 1, tc.store.StoreID())
+	pArgs.Timestamp = tc.clock.Now()
+	start = time.Now()
+	if err := tc.rng.AddCmd(tc.rng.context(), client.Call{Args: pArgs, Reply: pReply}, true); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > expected/2 {
+		t.Errorf("expected unthrottled write; took %s", elapsed)
+	}
+}
+
 // TestRangeNoTSCacheInconsistent verifies that the timestamp cache
 // is no affected by inconsistent reads.
 func TestRangeNoTSCacheInconsistent(t *testing.T) {
@@ -1837,7 +2089,8 @@ func TestInternalPushTxnHeartbeatTimeout(t *testing.T) {
 // TestInternalPushTxnPriorities verifies that txns with lower
 // priority are pushed; if priorities are equal, then the txns
 // are ordered by txn timestamp, with the more recent timestamp
-// being pushable.
+// being pushable, and then by txn ID, with the higher ID being
+// pushable.
 func TestInternalPushTxnPriorities(t *testing.T) {
 	defer leaktest.AfterTest(t)
 	tc := testContext{}
@@ -1863,7 +2116,7 @@ func TestInternalPushTxnPriorities(t *testing.T) {
 		{1, 2, ts1, ts2, proto.PUSH_TIMESTAMP, true},
 		// With same priorities, older txn timestamp succeeds.
 		{1, 1, ts1, ts2, proto.ABORT_TXN, true},
-		// With same priorities, same txn timestamp fails.
+		// With same priorities and txn timestamps, higher txn ID fails.
 		{1, 1, ts1, ts1, proto.ABORT_TXN, false},
 		{1, 1, ts1, ts1, proto.PUSH_TIMESTAMP, false},
 		// With same priorities, newer txn timestamp fails.
@@ -1882,6 +2135,8 @@ func TestInternalPushTxnPriorities(t *testing.T) {
 		pushee.Priority = test.pusheePriority
 		pusher.Timestamp = test.pusherTS
 		pushee.Timestamp = test.pusheeTS
+		// Give the pusher the higher ID so that ties are lost.
+		pusher.ID, pushee.ID = []byte("txn-2"), []byte("txn-1")
 
 		// Now, attempt to push the transaction with intent epoch set appropriately.
 		args, reply := pushTxnArgs(pusher, pushee, test.pushType, 1, tc.store.StoreID())
@@ -1897,6 +2152,21 @@ func TestInternalPushTxnPriorities(t *testing.T) {
 			}
 		}
 	}
+
+	// With same priorities and txn timestamps, lower txn ID succeeds.
+	for i, pushType := range []proto.PushTxnType{proto.ABORT_TXN, proto.PUSH_TIMESTAMP} {
+		key := proto.Key(fmt.Sprintf("key-id-%d", i))
+		pusher := newTransaction("test", key, 1, proto.SERIALIZABLE, tc.clock)
+		pushee := newTransaction("test", key, 1, proto.SERIALIZABLE, tc.clock)
+		pusher.Priority, pushee.Priority = 1, 1
+		pusher.Timestamp, pushee.Timestamp = ts1, ts1
+		pusher.ID, pushee.ID = []byte("txn-1"), []byte("txn-2")
+
+		args, reply := pushTxnArgs(pusher, pushee, pushType, 1, tc.store.StoreID())
+		if err := tc.rng.AddCmd(tc.rng.context(), client.Call{Args: args, Reply: reply}, true); err != nil {
+			t.Errorf("%s: expected push by lower txn ID to succeed; got %s", pushType, err)
+		}
+	}
 }
 
 // TestInternalPushTxnPushTimestamp verifies that with args.Abort is
@@ -2043,6 +2313,201 @@ func TestRangeStatsComputation(t *testing.T) {
 	verifyRangeStats(tc.engine, tc.rng.Desc().RaftID, expMS, t)
 }
 
+// TestInternalWriteBatch verifies that a serialized batch of MVCC
+// writes is applied by InternalWriteBatch with the same stats as the
+// equivalent individual puts, both for new keys and for keys with
+// existing versions, and that batches with keys outside of the
+// request's span are rejected.
+func TestInternalWriteBatch(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	tc := testContext{
+		bootstrapMode: bootstrapRangeOnly,
+	}
+	tc.Start(t)
+	defer tc.Stop()
+
+	start, end := proto.Key("key"), proto.Key("key").PrefixEnd()
+	writeBatchArgs := func(repr []byte, ts proto.Timestamp) (*proto.InternalWriteBatchRequest, *proto.InternalWriteBatchResponse) {
+		args := &proto.InternalWriteBatchRequest{
+			RequestHeader: proto.RequestHeader{
+				Key:       start,
+				EndKey:    end,
+				Timestamp: ts,
+				RaftID:    tc.rng.Desc().RaftID,
+				Replica:   proto.Replica{StoreID: tc.store.StoreID()},
+			},
+			Repr: repr,
+		}
+		return args, &proto.InternalWriteBatchResponse{}
+	}
+
+	expEngine := engine.NewInMem(proto.Attributes{}, 1<<20)
+	defer expEngine.Close()
+
+	// Write existing versions of the first ten keys, which the batch
+	// overwrites.
+	oldTS := tc.clock.Now()
+	for i := 0; i < 10; i++ {
+		key := proto.Key(fmt.Sprintf("key%03d", i))
+		pArgs, pReply := putArgs(key, []byte("old"), tc.rng.Desc().RaftID, tc.store.StoreID())
+		pArgs.Timestamp = oldTS
+		if err := tc.rng.AddCmd(tc.rng.context(), client.Call{Args: pArgs, Reply: pReply}, true); err != nil {
+			t.Fatal(err)
+		}
+		if err := engine.MVCCPut(expEngine, nil, key, oldTS, pArgs.Value, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Compute the expected stats by performing the puts individually.
+	var origMS proto.MVCCStats
+	if err := engine.MVCCGetRangeStats(tc.engine, tc.rng.Desc().RaftID, &origMS); err != nil {
+		t.Fatal(err)
+	}
+	expMS := origMS
+
+	ts := tc.clock.Now()
+	var b engine.RocksDBBatchBuilder
+	for i := 0; i < 100; i++ {
+		key := proto.Key(fmt.Sprintf("key%03d", i))
+		value := proto.Value{Bytes: []byte(fmt.Sprintf("value%d", i))}
+		if err := b.MVCCPut(key, ts, value); err != nil {
+			t.Fatal(err)
+		}
+		if err := engine.MVCCPut(expEngine, &expMS, key, ts, value, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	args, reply := writeBatchArgs(b.Finish(), ts)
+	if err := tc.rng.AddCmd(tc.rng.context(), client.Call{Args: args, Reply: reply}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	kvs, err := engine.MVCCScan(tc.engine, start, end, 0, ts, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kvs) != 100 {
+		t.Fatalf("expected 100 keys; got %d", len(kvs))
+	}
+	for i, kv := range kvs {
+		if expKey := proto.Key(fmt.Sprintf("key%03d", i)); !kv.Key.Equal(expKey) {
+			t.Errorf("%d: expected key %q; got %q", i, expKey, kv.Key)
+		}
+		if expValue := fmt.Sprintf("value%d", i); string(kv.Value.Bytes) != expValue {
+			t.Errorf("%d: expected value %q; got %q", i, expValue, kv.Value.Bytes)
+		}
+	}
+	verifyRangeStats(tc.engine, tc.rng.Desc().RaftID, expMS, t)
+
+	// A batch escaping the request's span is rejected as a whole.
+	ts = tc.clock.Now()
+	for _, key := range []proto.Key{proto.Key("key100"), proto.Key("other")} {
+		if err := b.MVCCPut(key, ts, proto.Value{Bytes: []byte("value")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	args, reply = writeBatchArgs(b.Finish(), ts)
+	if err := tc.rng.AddCmd(tc.rng.context(), client.Call{Args: args, Reply: reply}, true); err == nil {
+		t.Fatal("expected error for batch with key outside of the request span")
+	}
+	if v, err := engine.MVCCGet(tc.engine, proto.Key("key100"), ts, true, nil); err != nil || v != nil {
+		t.Errorf("expected rejected batch not to be applied; got %v, %v", v, err)
+	}
+	verifyRangeStats(tc.engine, tc.rng.Desc().RaftID, expMS, t)
+}
+
+// TestInternalWriteBatchRejected verifies that InternalWriteBatch
+// refuses batches which would not be blind writes of new versions,
+// and batches too large to be proposed, without applying any part of
+// them.
+func TestInternalWriteBatchRejected(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	tc := testContext{
+		bootstrapMode: bootstrapRangeOnly,
+	}
+	tc.Start(t)
+	defer tc.Stop()
+
+	start, end := proto.Key("a"), proto.Key("z")
+	intentKey, readKey := proto.Key("b"), proto.Key("c")
+
+	// Lay down an intent on one key and read another.
+	txn := newTransaction("test", intentKey, 1, proto.SERIALIZABLE, tc.clock)
+	pArgs, pReply := putArgs(intentKey, []byte("intent"), tc.rng.Desc().RaftID, tc.store.StoreID())
+	pArgs.Timestamp = txn.Timestamp
+	pArgs.Txn = txn
+	if err := tc.rng.AddCmd(tc.rng.context(), client.Call{Args: pArgs, Reply: pReply}, true); err != nil {
+		t.Fatal(err)
+	}
+	staleTS := tc.clock.Now()
+	gArgs, gReply := getArgs(readKey, tc.rng.Desc().RaftID, tc.store.StoreID())
+	gArgs.Timestamp = tc.clock.Now()
+	if err := tc.rng.AddCmd(tc.rng.context(), client.Call{Args: gArgs, Reply: gReply}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	var origMS proto.MVCCStats
+	if err := engine.MVCCGetRangeStats(tc.engine, tc.rng.Desc().RaftID, &origMS); err != nil {
+		t.Fatal(err)
+	}
+
+	batchRepr := func(ts proto.Timestamp, batchKeys ...proto.Key) []byte {
+		var b engine.RocksDBBatchBuilder
+		for _, key := range batchKeys {
+			if err := b.MVCCPut(key, ts, proto.Value{Bytes: []byte("value")}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return b.Finish()
+	}
+	var b engine.RocksDBBatchBuilder
+	b.Clear(engine.MVCCEncodeKey(proto.Key("d")))
+	deletion := b.Finish()
+	ts := tc.clock.Now()
+
+	testCases := []struct {
+		repr []byte
+		ts   proto.Timestamp
+	}{
+		// A key with an intent.
+		{batchRepr(ts, proto.Key("a1"), intentKey), ts},
+		// A key read more recently than the batch's versions.
+		{batchRepr(staleTS, proto.Key("a1"), readKey), staleTS},
+		// Versions at a timestamp other than the request's.
+		{batchRepr(staleTS, proto.Key("a1")), ts},
+		// A deletion.
+		{deletion, ts},
+		// A version without metadata.
+		{func() []byte {
+			var b engine.RocksDBBatchBuilder
+			b.Put(engine.MVCCEncodeVersionKey(proto.Key("a1"), ts), []byte("value"))
+			return b.Finish()
+		}(), ts},
+		// A batch too large for a single command.
+		{make([]byte, maxWriteBatchReprSize+1), ts},
+	}
+	for i, test := range testCases {
+		args := &proto.InternalWriteBatchRequest{
+			RequestHeader: proto.RequestHeader{
+				Key:       start,
+				EndKey:    end,
+				Timestamp: test.ts,
+				RaftID:    tc.rng.Desc().RaftID,
+				Replica:   proto.Replica{StoreID: tc.store.StoreID()},
+			},
+			Repr: test.repr,
+		}
+		if err := tc.rng.AddCmd(tc.rng.context(), client.Call{Args: args, Reply: &proto.InternalWriteBatchResponse{}}, true); err == nil {
+			t.Errorf("%d: expected batch to be rejected", i)
+		}
+		if v, err := engine.MVCCGet(tc.engine, proto.Key("a1"), proto.MaxTimestamp, false, nil); err != nil || v != nil {
+			t.Errorf("%d: expected rejected batch not to be applied; got %v, %v", i, v, err)
+		}
+	}
+	verifyRangeStats(tc.engine, tc.rng.Desc().RaftID, origMS, t)
+}
+
 // TestInternalMerge verifies that the InternalMerge command is behaving as
 // expected. Merge semantics for different data types are tested more robustly
 // at the engine level; this test is intended only to show that values passed to
@@ -2284,6 +2749,85 @@ func TestAppliedIndex(t *testing.T) {
 	}
 }
 
+// TestRangeSnapshot verifies that a range snapshot captures a consistent
+// view of the range's data and metadata, and that streaming it into a
+// fresh engine reconstructs the range.
+func TestRangeSnapshot(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	tc := testContext{}
+	tc.Start(t)
+	defer tc.Stop()
+
+	for i := 0; i < 10; i++ {
+		key := proto.Key(fmt.Sprintf("key%02d", i))
+		pArgs, pReply := putArgs(key, []byte("value"), 1, tc.store.StoreID())
+		if err := tc.rng.AddCmd(tc.rng.context(), client.Call{Args: pArgs, Reply: pReply}, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snap, err := tc.rng.newRangeSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+
+	// Writes after the snapshot was taken must not be visible in it.
+	lateKey := proto.Key("late")
+	pArgs, pReply := putArgs(lateKey, []byte("value"), 1, tc.store.StoreID())
+	if err := tc.rng.AddCmd(tc.rng.context(), client.Call{Args: pArgs, Reply: pReply}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if appliedIndex := atomic.LoadUint64(&tc.rng.appliedIndex); snap.appliedIndex >= appliedIndex {
+		t.Errorf("expected snapshot applied index below %d; got %d", appliedIndex, snap.appliedIndex)
+	}
+	if desc := tc.rng.Desc(); snap.desc.RaftID != desc.RaftID || !snap.desc.EndKey.Equal(desc.EndKey) {
+		t.Errorf("expected snapshot descriptor %+v; got %+v", desc, snap.desc)
+	}
+	if ts, err := tc.rng.raftTruncatedState(); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(snap.truncatedState, ts) {
+		t.Errorf("expected snapshot truncated state %+v; got %+v", ts, snap.truncatedState)
+	}
+
+	// Stream the snapshot into a fresh engine.
+	eng := engine.NewInMem(proto.Attributes{Attrs: []string{"dc1", "mem"}}, 1<<20)
+	defer eng.Close()
+	var kvs []proto.RawKeyValue
+	if err := snap.Iterate(func(kv proto.RawKeyValue) (bool, error) {
+		kvs = append(kvs, kv)
+		return false, eng.Put(kv.Key, kv.Value)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The reconstructed range holds exactly the snapshotted data.
+	var copied []proto.RawKeyValue
+	iter := newRangeDataIterator(&snap.desc, eng)
+	defer iter.Close()
+	for ; iter.Valid(); iter.Next() {
+		copied = append(copied, proto.RawKeyValue{Key: iter.Key(), Value: iter.Value()})
+	}
+	if len(kvs) == 0 || !reflect.DeepEqual(kvs, copied) {
+		t.Errorf("expected reconstructed range to equal snapshot:\n%+v\n%+v", kvs, copied)
+	}
+	if appliedIndex, err := tc.rng.loadAppliedIndex(eng); err != nil {
+		t.Fatal(err)
+	} else if appliedIndex != snap.appliedIndex {
+		t.Errorf("expected reconstructed applied index %d; got %d", snap.appliedIndex, appliedIndex)
+	}
+	for _, key := range []proto.Key{proto.Key("key00"), proto.Key("key09"), lateKey} {
+		val, err := engine.MVCCGet(eng, key, tc.clock.Now(), true, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists := val != nil; exists != !key.Equal(lateKey) {
+			t.Errorf("unexpected existence of %q in reconstructed range: %t", key, exists)
+		}
+	}
+}
+
 // TestChangeReplicasDuplicateError tests that a replica change that would
 // use a NodeID twice in the replica configuration fails.
 func TestChangeReplicasDuplicateError(t *testing.T) {
@@ -2302,6 +2846,32 @@ func TestChangeReplicasDuplicateError(t *testing.T) {
 	}
 }
 
+// TestRangeChecksums verifies that a replica remembers the checksums
+// of the most recent InternalComputeChecksum commands, keyed by the
+// command timestamp, and discards the oldest beyond maxRangeChecksums.
+func TestRangeChecksums(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	tc := testContext{}
+	tc.Start(t)
+	defer tc.Stop()
+
+	for i := 1; i <= maxRangeChecksums+1; i++ {
+		tc.rng.addChecksum(makeTS(int64(i), 0), []byte{byte(i)})
+	}
+	if _, ok := tc.rng.GetChecksum(makeTS(1, 0)); ok {
+		t.Errorf("expected oldest checksum to be discarded")
+	}
+	for i := 2; i <= maxRangeChecksums+1; i++ {
+		checksum, ok := tc.rng.GetChecksum(makeTS(int64(i), 0))
+		if !ok || !bytes.Equal(checksum, []byte{byte(i)}) {
+			t.Errorf("%d: expected checksum %v; got %v (found=%t)", i, []byte{byte(i)}, checksum, ok)
+		}
+	}
+	if _, ok := tc.rng.GetChecksum(makeTS(int64(maxRangeChecksums+2), 0)); ok {
+		t.Errorf("expected no checksum for an unknown timestamp")
+	}
+}
+
 // TestRangeDanglingMetaIntent creates a dangling intent on a
 // meta2 record and verifies that InternalRangeLookup requests
 // behave appropriately. Normally, the old value and a write intent
@@ -0,0 +1,107 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package storage
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// A rateLimiter is a token bucket limiting the rate, in bytes per
+// second, at which a range accepts writes. The bucket holds at most
+// one second's worth of tokens, so a range which has been idle may
+// absorb a burst of that size. A rate of zero disables limiting.
+type rateLimiter struct {
+	sync.Mutex
+	rate   float64 // Bytes per second
+	tokens float64
+	last   time.Time
+	// changed is closed and replaced each time the rate is changed,
+	// waking up any blocked waiters to re-evaluate their delay.
+	changed chan struct{}
+}
+
+// newRateLimiter returns a rateLimiter admitting bytesPerSec bytes per
+// second, starting with a full bucket.
+func newRateLimiter(bytesPerSec int64) *rateLimiter {
+	return &rateLimiter{
+		rate:    float64(bytesPerSec),
+		tokens:  float64(bytesPerSec),
+		last:    time.Now(),
+		changed: make(chan struct{}),
+	}
+}
+
+// setRate changes the rate to bytesPerSec. Tokens accumulated so far
+// are kept, up to the new bucket size. Zero disables limiting.
+func (rl *rateLimiter) setRate(bytesPerSec int64) {
+	rl.Lock()
+	defer rl.Unlock()
+	rl.refillLocked(time.Now())
+	rl.rate = float64(bytesPerSec)
+	if rl.tokens > rl.rate {
+		rl.tokens = rl.rate
+	}
+	close(rl.changed)
+	rl.changed = make(chan struct{})
+}
+
+// refillLocked adds the tokens accrued since the last refill.
+func (rl *rateLimiter) refillLocked(now time.Time) {
+	rl.tokens += now.Sub(rl.last).Seconds() * rl.rate
+	if rl.tokens > rl.rate {
+		rl.tokens = rl.rate
+	}
+	rl.last = now
+}
+
+// wait blocks until n bytes may be written or the context is done.
+// Requests exceeding the bucket size are clamped to it so that a
+// single large write can proceed once the bucket is full.
+func (rl *rateLimiter) wait(ctx context.Context, n int64) error {
+	for {
+		rl.Lock()
+		if rl.rate == 0 {
+			rl.Unlock()
+			return nil
+		}
+		rl.refillLocked(time.Now())
+		need := float64(n)
+		if need > rl.rate {
+			need = rl.rate
+		}
+		if rl.tokens >= need {
+			rl.tokens -= need
+			rl.Unlock()
+			return nil
+		}
+		delay := time.Duration((need - rl.tokens) / rl.rate * float64(time.Second))
+		changed := rl.changed
+		rl.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-changed:
+			timer.Stop()
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
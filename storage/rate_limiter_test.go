@@ -0,0 +1,70 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/util/leaktest"
+)
+
+// TestRateLimiterSetRate verifies that a waiter blocked on a very low
+// rate proceeds once the limit is lifted.
+func TestRateLimiterSetRate(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	rl := newRateLimiter(10)
+	if err := rl.wait(context.Background(), 10); err != nil {
+		t.Fatal(err)
+	}
+
+	errChan := make(chan error)
+	go func() {
+		errChan <- rl.wait(context.Background(), 10)
+	}()
+	select {
+	case err := <-errChan:
+		t.Fatalf("unexpected completion of wait on an empty bucket: %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	rl.setRate(0)
+	if err := <-errChan; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRateLimiterContextCancellation verifies that a blocked wait
+// returns once its context is done.
+func TestRateLimiterContextCancellation(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	rl := newRateLimiter(10)
+	if err := rl.wait(context.Background(), 10); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errChan := make(chan error)
+	go func() {
+		errChan <- rl.wait(ctx, 10)
+	}()
+	cancel()
+	if err := <-errChan; err != context.Canceled {
+		t.Errorf("expected %s; got %v", context.Canceled, err)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package storage
+
+import (
+	"time"
+
+	"github.com/cockroachdb/cockroach/gossip"
+	"github.com/cockroachdb/cockroach/proto"
+	"github.com/cockroachdb/cockroach/util/hlc"
+	"github.com/cockroachdb/cockroach/util/log"
+)
+
+const (
+	// rebalanceQueueMaxSize is the max size of the rebalance queue.
+	rebalanceQueueMaxSize = 100
+
+	// rebalanceQueueTimerDuration is the duration between rebalancing
+	// of queued ranges.
+	rebalanceQueueTimerDuration = 1 * time.Second
+)
+
+// rebalanceQueue manages a queue of ranges which have a replica on an
+// overweight store, according to gossiped store capacities. Each
+// processed range has a replica moved from the overweight store to an
+// underweight one, by adding a replica on the target store and then
+// removing the replica on the source store.
+type rebalanceQueue struct {
+	*baseQueue
+	gossip    *gossip.Gossip
+	allocator *allocator
+	clock     *hlc.Clock
+}
+
+// newRebalanceQueue returns a new instance of rebalanceQueue.
+func newRebalanceQueue(gossip *gossip.Gossip, allocator *allocator,
+	clock *hlc.Clock) *rebalanceQueue {
+	rq := &rebalanceQueue{
+		gossip:    gossip,
+		allocator: allocator,
+		clock:     clock,
+	}
+	rq.baseQueue = newBaseQueue("rebalance", rq, rebalanceQueueMaxSize)
+	return rq
+}
+
+func (rq *rebalanceQueue) needsLeaderLease() bool {
+	return true
+}
+
+func (rq *rebalanceQueue) shouldQueue(now proto.Timestamp, rng *Range) (
+	shouldQ bool, priority float64) {
+	// If the range spans multiple zones, ignore it until the split queue has processed it.
+	if len(computeSplitKeys(rq.gossip, rng)) > 0 {
+		return
+	}
+
+	zone, err := lookupZoneConfig(rq.gossip, rng)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	if rq.rebalanceSource(zone, rng) == nil {
+		return
+	}
+	return true, 1
+}
+
+// rebalanceSource returns the store from which a replica of the range
+// should be moved, or nil if the range should not be rebalanced. Under
+// replicated ranges are left to the replicate queue. The local store's
+// replica is never chosen, as the range leader can't remove itself.
+func (rq *rebalanceQueue) rebalanceSource(zone proto.ZoneConfig, rng *Range) *proto.StoreDescriptor {
+	desc := rng.Desc()
+	if len(zone.ReplicaAttrs) == 0 || len(desc.Replicas) < len(zone.ReplicaAttrs) {
+		return nil
+	}
+	var candidates []proto.Replica
+	for _, replica := range desc.Replicas {
+		if replica.StoreID != rng.rm.StoreID() {
+			candidates = append(candidates, replica)
+		}
+	}
+	// TODO(bdarnell): handle non-homogenous ReplicaAttrs.
+	return rq.allocator.RebalanceSource(zone.ReplicaAttrs[0], candidates)
+}
+
+// rebalanceTargets returns the source store from which a replica of
+// the range should be moved and the target store to which it should be
+// moved. Returns nils if the range should not be rebalanced.
+func (rq *rebalanceQueue) rebalanceTargets(zone proto.ZoneConfig, rng *Range) (
+	source, target *proto.StoreDescriptor) {
+	source = rq.rebalanceSource(zone, rng)
+	if source == nil {
+		return nil, nil
+	}
+	target = rq.allocator.RebalanceTarget(zone.ReplicaAttrs[0], rng.Desc().Replicas)
+	if target == nil {
+		return nil, nil
+	}
+	return source, target
+}
+
+func (rq *rebalanceQueue) process(now proto.Timestamp, rng *Range) error {
+	zone, err := lookupZoneConfig(rq.gossip, rng)
+	if err != nil {
+		return err
+	}
+
+	source, target := rq.rebalanceTargets(zone, rng)
+	if source == nil {
+		// Something changed between shouldQueue and process, or there's
+		// no suitable target to rebalance to.
+		return nil
+	}
+	if log.V(1) {
+		log.Infof("%s: rebalancing replica from store %d to store %d", rng, source.StoreID, target.StoreID)
+	}
+
+	// Add the new replica before removing the old one so the range
+	// never drops below its replication factor.
+	if err := rng.ChangeReplicas(proto.ADD_REPLICA, proto.Replica{
+		NodeID:  target.Node.NodeID,
+		StoreID: target.StoreID,
+	}); err != nil {
+		return err
+	}
+	return rng.ChangeReplicas(proto.REMOVE_REPLICA, proto.Replica{
+		NodeID:  source.Node.NodeID,
+		StoreID: source.StoreID,
+	})
+}
+
+func (rq *rebalanceQueue) timer() time.Duration {
+	return rebalanceQueueTimerDuration
+}
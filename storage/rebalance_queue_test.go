@@ -0,0 +1,115 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package storage
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/cockroach/gossip"
+	"github.com/cockroachdb/cockroach/proto"
+	"github.com/cockroachdb/cockroach/util/leaktest"
+)
+
+// TestRebalanceQueueShouldRebalance verifies that a range with a
+// replica on an overfull store is queued for rebalancing and that the
+// replica is moved off the overfull store onto the least full store,
+// while ranges on nearly balanced stores are left alone.
+func TestRebalanceQueueShouldRebalance(t *testing.T) {
+	defer leaktest.AfterTest(t)
+
+	makeStores := func(available ...int64) []*proto.StoreDescriptor {
+		var stores []*proto.StoreDescriptor
+		for i, avail := range available {
+			stores = append(stores, &proto.StoreDescriptor{
+				StoreID:  proto.StoreID(i + 1),
+				Node:     proto.NodeDescriptor{NodeID: proto.NodeID(i + 1)},
+				Capacity: proto.StoreCapacity{Capacity: 100, Available: avail},
+			})
+		}
+		return stores
+	}
+
+	testCases := []struct {
+		stores    []*proto.StoreDescriptor
+		expSource proto.StoreID // 0 if no rebalance is expected
+		expTarget proto.StoreID
+	}{
+		// Store 2 is 90% full; its replica should move to store 4.
+		{makeStores(50, 10, 50, 70), 2, 4},
+		// Store 2 is fullest, but within the imbalance threshold.
+		{makeStores(50, 45, 50, 70), 0, 0},
+		// The local store is overfull, but can't remove itself.
+		{makeStores(10, 50, 50, 70), 0, 0},
+	}
+
+	for i, test := range testCases {
+		func() {
+			s, _, stopper := createTestStore(t)
+			defer stopper.Stop()
+
+			zoneMap, err := NewPrefixConfigMap([]*PrefixConfig{
+				{proto.KeyMin, nil, &proto.ZoneConfig{
+					ReplicaAttrs:  []proto.Attributes{{}, {}, {}},
+					RangeMaxBytes: 64 << 20,
+				}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Gossip().AddInfo(gossip.KeyConfigZone, zoneMap, 0); err != nil {
+				t.Fatal(err)
+			}
+			gossipStores(s.Gossip(), test.stores, t)
+
+			// Place replicas of the range on stores 1 through 3.
+			rng, err := s.GetRange(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			desc := *rng.Desc()
+			desc.Replicas = append(desc.Replicas,
+				proto.Replica{NodeID: 2, StoreID: 2},
+				proto.Replica{NodeID: 3, StoreID: 3})
+			if err := rng.setDesc(&desc); err != nil {
+				t.Fatal(err)
+			}
+
+			rq := s.rebalanceQueue
+			shouldQ, _ := rq.shouldQueue(s.Clock().Now(), rng)
+			if expShouldQ := test.expSource != 0; shouldQ != expShouldQ {
+				t.Errorf("%d: expected should queue %t; got %t", i, expShouldQ, shouldQ)
+			}
+			zone, err := lookupZoneConfig(s.Gossip(), rng)
+			if err != nil {
+				t.Fatal(err)
+			}
+			source, target := rq.rebalanceTargets(zone, rng)
+			if test.expSource == 0 {
+				if source != nil {
+					t.Errorf("%d: expected no rebalance; got move from store %d", i, source.StoreID)
+				}
+				return
+			}
+			if source == nil || target == nil {
+				t.Fatalf("%d: expected move from store %d to %d; got none", i, test.expSource, test.expTarget)
+			}
+			if source.StoreID != test.expSource || target.StoreID != test.expTarget {
+				t.Errorf("%d: expected move from store %d to %d; got %d to %d",
+					i, test.expSource, test.expTarget, source.StoreID, target.StoreID)
+			}
+		}()
+	}
+}
@@ -34,6 +34,50 @@ const (
 	replicateQueueTimerDuration = 0 * time.Second // zero duration to process replication greedily
 )
 
+// ReplicationStatus classifies the number of replicas of a range
+// relative to the target replication factor of its zone.
+type ReplicationStatus int
+
+const (
+	// ReplicationSatisfied indicates the range has exactly as many
+	// replicas as its zone requires.
+	ReplicationSatisfied ReplicationStatus = iota
+	// UnderReplicated indicates the range has fewer replicas than its
+	// zone requires.
+	UnderReplicated
+	// OverReplicated indicates the range has more replicas than its
+	// zone requires.
+	OverReplicated
+	// ReplicationUnsatisfiable indicates the range is under-replicated
+	// but already has a replica on every available store, so the
+	// zone's target can't be met until more stores join the cluster.
+	ReplicationUnsatisfiable
+)
+
+// ComputeReplicationStatus returns the replication status of the
+// range described by desc with respect to zone, along with the number
+// of replicas which must be added (positive) or removed (negative) to
+// reach the zone's target. The target is the number of entries in the
+// zone's ReplicaAttrs. availableStores is the number of stores which
+// could hold a replica; specify zero if unknown, in which case a range
+// is never reported as ReplicationUnsatisfiable.
+func ComputeReplicationStatus(desc *proto.RangeDescriptor, zone proto.ZoneConfig,
+	availableStores int) (ReplicationStatus, int) {
+	need := len(zone.ReplicaAttrs)
+	have := len(desc.Replicas)
+	delta := need - have
+	switch {
+	case delta > 0:
+		if availableStores > 0 && have >= availableStores {
+			return ReplicationUnsatisfiable, delta
+		}
+		return UnderReplicated, delta
+	case delta < 0:
+		return OverReplicated, delta
+	}
+	return ReplicationSatisfied, 0
+}
+
 // replicateQueue manages a queue of ranges to have their replicas
 // change to match the zone config.
 type replicateQueue struct {
@@ -78,13 +122,12 @@ func (rq *replicateQueue) shouldQueue(now proto.Timestamp, rng *Range) (
 
 func (rq *replicateQueue) needsReplication(zone proto.ZoneConfig, rng *Range) (bool, float64) {
 	// TODO(bdarnell): handle non-empty ReplicaAttrs.
-	need := len(zone.ReplicaAttrs)
-	have := len(rng.Desc().Replicas)
-	if need > have {
+	desc := rng.Desc()
+	if status, delta := ComputeReplicationStatus(desc, zone, 0); status == UnderReplicated {
 		if log.V(1) {
-			log.Infof("%s needs %d nodes; has %d", rng, need, have)
+			log.Infof("%s needs %d nodes; has %d", rng, len(zone.ReplicaAttrs), len(desc.Replicas))
 		}
-		return true, float64(need - have)
+		return true, float64(delta)
 	}
 
 	return false, 0
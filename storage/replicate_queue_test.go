@@ -0,0 +1,62 @@
+// Copyright 2015 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License. See the AUTHORS file
+// for names of contributors.
+
+package storage
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/cockroach/proto"
+	"github.com/cockroachdb/cockroach/util/leaktest"
+)
+
+// TestComputeReplicationStatus verifies the classification of ranges
+// as satisfied, under-, over-replicated or unsatisfiable.
+func TestComputeReplicationStatus(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	makeDesc := func(replicas int) *proto.RangeDescriptor {
+		desc := &proto.RangeDescriptor{RaftID: 1}
+		for i := 1; i <= replicas; i++ {
+			desc.Replicas = append(desc.Replicas, proto.Replica{NodeID: proto.NodeID(i), StoreID: proto.StoreID(i)})
+		}
+		return desc
+	}
+	makeZone := func(target int) proto.ZoneConfig {
+		return proto.ZoneConfig{ReplicaAttrs: make([]proto.Attributes, target)}
+	}
+
+	testCases := []struct {
+		replicas, target, availableStores int
+		expStatus                         ReplicationStatus
+		expDelta                          int
+	}{
+		{3, 3, 5, ReplicationSatisfied, 0},
+		{3, 3, 0, ReplicationSatisfied, 0},
+		{1, 3, 5, UnderReplicated, 2},
+		{1, 3, 0, UnderReplicated, 2},
+		{2, 3, 3, UnderReplicated, 1},
+		{5, 3, 5, OverReplicated, -2},
+		{4, 3, 0, OverReplicated, -1},
+		{2, 3, 2, ReplicationUnsatisfiable, 1},
+		{1, 5, 1, ReplicationUnsatisfiable, 4},
+	}
+	for i, test := range testCases {
+		status, delta := ComputeReplicationStatus(makeDesc(test.replicas), makeZone(test.target), test.availableStores)
+		if status != test.expStatus || delta != test.expDelta {
+			t.Errorf("%d: expected status %d with delta %d; got %d with delta %d",
+				i, test.expStatus, test.expDelta, status, delta)
+		}
+	}
+}
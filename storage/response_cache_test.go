@@ -222,7 +222,9 @@ func TestResponseCacheGC(t *testing.T) {
 		t.Fatalf("unexpected error putting responpse: %v", err)
 	}
 	eng.SetGCTimeouts(0, 0) // avoids GC
-	eng.CompactRange(nil, nil)
+	if err := eng.CompactRange(nil, nil); err != nil {
+		t.Fatal(err)
+	}
 	val := proto.IncrementResponse{}
 	if ok, err := rc.GetResponse(cmdID, &val); !ok || err != nil || val.NewValue != 1 {
 		t.Fatalf("unexpected response or error: %t, %v, %+v", ok, err, val)
@@ -230,7 +232,9 @@ func TestResponseCacheGC(t *testing.T) {
 
 	// Now set minRCacheTS to 1, which will GC.
 	eng.SetGCTimeouts(0, 1)
-	eng.CompactRange(nil, nil)
+	if err := eng.CompactRange(nil, nil); err != nil {
+		t.Fatal(err)
+	}
 	if ok, err := rc.GetResponse(cmdID, &val); ok || err != nil {
 		t.Errorf("unexpected response or error: %t, %v", ok, err)
 	}
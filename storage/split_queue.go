@@ -24,6 +24,7 @@ import (
 	"github.com/cockroachdb/cockroach/client"
 	"github.com/cockroachdb/cockroach/gossip"
 	"github.com/cockroachdb/cockroach/proto"
+	"github.com/cockroachdb/cockroach/storage/engine"
 	"github.com/cockroachdb/cockroach/util"
 	"github.com/cockroachdb/cockroach/util/log"
 )
@@ -60,7 +61,7 @@ func (sq *splitQueue) needsLeaderLease() bool {
 // shouldQueue determines whether a range should be queued for
 // splitting. This is true if the range is intersected by any
 // accounting or zone config prefix or if the range's size in
-// bytes exceeds the limit for the zone.
+// bytes or live bytes exceeds the limits for the zone.
 func (sq *splitQueue) shouldQueue(now proto.Timestamp, rng *Range) (shouldQ bool, priority float64) {
 	// Set priority to 1 in the event the range is split by acct or zone configs.
 	if len(computeSplitKeys(sq.gossip, rng)) > 0 {
@@ -79,6 +80,13 @@ func (sq *splitQueue) shouldQueue(now proto.Timestamp, rng *Range) (shouldQ bool
 		priority += ratio
 		shouldQ = true
 	}
+	// Likewise for live bytes, if the zone limits them.
+	if zone.RangeMaxLiveBytes > 0 {
+		if ratio := float64(rng.stats.GetMVCC().LiveBytes) / float64(zone.RangeMaxLiveBytes); ratio > 1 {
+			priority += ratio
+			shouldQ = true
+		}
+	}
 	return
 }
 
@@ -112,6 +120,27 @@ func (sq *splitQueue) process(now proto.Timestamp, rng *Range) error {
 			}, true); err != nil {
 			return err
 		}
+		return nil
+	}
+	// Finally handle case of splitting due to live bytes. The split key
+	// is chosen at the approximate median of the range's live data.
+	if liveBytes := rng.stats.GetMVCC().LiveBytes; zone.RangeMaxLiveBytes > 0 && liveBytes > zone.RangeMaxLiveBytes {
+		desc := rng.Desc()
+		snap := rng.rm.NewSnapshot()
+		splitKey, err := engine.MVCCFindLiveSplitKey(snap, desc.RaftID, desc.StartKey, desc.EndKey)
+		snap.Close()
+		if err != nil {
+			return util.Errorf("unable to determine split key for %s: %s", rng, err)
+		}
+		log.Infof("splitting %s at key %q live bytes=%d max=%d", rng, splitKey, liveBytes, zone.RangeMaxLiveBytes)
+		return rng.AddCmd(rng.context(),
+			client.Call{
+				Args: &proto.AdminSplitRequest{
+					RequestHeader: proto.RequestHeader{Key: desc.StartKey},
+					SplitKey:      splitKey,
+				},
+				Reply: &proto.AdminSplitResponse{},
+			}, true)
 	}
 	return nil
 }
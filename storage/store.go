@@ -53,8 +53,20 @@ const (
 	defaultRaftTickInterval         = 100 * time.Millisecond
 	defaultHeartbeatIntervalTicks   = 3
 	defaultRaftElectionTimeoutTicks = 15
+	// defaultRaftLogRetention is the default number of applied entries
+	// kept at the tail of a truncated raft log.
+	defaultRaftLogRetention = 20
+	// defaultRaftLogMaxLagBytes is the default size of the raft log
+	// retained for lagging followers.
+	defaultRaftLogMaxLagBytes = 4 << 20
+	// defaultRaftProposalQuota is the default number of bytes of Raft
+	// proposals a range may have in flight.
+	defaultRaftProposalQuota = 1 << 20
 	// ttlCapacityGossip is time-to-live for capacity-related info.
 	ttlCapacityGossip = 2 * time.Minute
+	// drainPollInterval is the interval at which Drain rechecks leader
+	// leases and in-flight commands.
+	drainPollInterval = 10 * time.Millisecond
 )
 
 var (
@@ -68,6 +80,16 @@ var (
 		UseV1Info:   true,
 	}
 
+	// checksumRetryOptions govern how long CheckConsistency waits for
+	// the replicas of a range to apply a checksum command.
+	checksumRetryOptions = retry.Options{
+		Backoff:     10 * time.Millisecond,
+		MaxBackoff:  1 * time.Second,
+		Constant:    2,
+		MaxAttempts: 10,
+		UseV1Info:   true,
+	}
+
 	// TestStoreContext has some fields initialized with values relevant
 	// in tests.
 	TestStoreContext = StoreContext{
@@ -219,18 +241,22 @@ type Store struct {
 	Ident          proto.StoreIdent
 	ctx            StoreContext
 	db             *client.DB
-	engine         engine.Engine   // The underlying key-value store
-	_allocator     *allocator      // Makes allocation decisions
-	raftIDAlloc    *idAllocator    // Raft ID allocator
-	gcQueue        *gcQueue        // Garbage collection queue
-	_splitQueue    *splitQueue     // Range splitting queue
-	verifyQueue    *verifyQueue    // Checksum verification queue
-	replicateQueue *replicateQueue // Replication queue
-	rangeGCQueue   *rangeGCQueue   // Range GC queue
-	scanner        *rangeScanner   // Range scanner
-	feed           StoreEventFeed  // Event Feed
+	engine         engine.Engine    // The underlying key-value store
+	_allocator     *allocator       // Makes allocation decisions
+	raftIDAlloc    *raftIDAllocator // Raft ID allocator
+	gcQueue        *gcQueue         // Garbage collection queue
+	_splitQueue    *splitQueue      // Range splitting queue
+	verifyQueue    *verifyQueue     // Checksum verification queue
+	replicateQueue *replicateQueue  // Replication queue
+	rebalanceQueue *rebalanceQueue  // Replica rebalancing queue
+	_rangeGCQueue  *rangeGCQueue    // Range GC queue
+	raftLogQueue   *raftLogQueue    // Raft log truncation queue
+	scanner        *rangeScanner    // Range scanner
+	feed           StoreEventFeed   // Event Feed
 	multiraft      *multiraft.MultiRaft
 	started        int32
+	draining       int32 // Set while the store is draining
+	inFlight       int32 // Number of commands being executed
 	stopper        *util.Stopper
 	startedAt      int64
 	nodeDesc       *proto.NodeDescriptor
@@ -271,6 +297,45 @@ type StoreContext struct {
 	// for local networks.
 	RaftElectionTimeoutTicks int
 
+	// RaftLogRetention is the number of already applied entries kept at
+	// the tail of a truncated raft log, so that slightly lagging
+	// followers can catch up without requiring a snapshot.
+	RaftLogRetention uint64
+
+	// RaftLogMaxLagBytes bounds the size of the raft log retained for
+	// lagging followers. Followers further behind are caught up with a
+	// snapshot instead.
+	RaftLogMaxLagBytes int64
+
+	// RaftProposalQuota is the number of bytes of Raft proposals each
+	// range may have in flight before new proposals block.
+	RaftProposalQuota int64
+
+	// RangeWriteRate is the number of bytes per second of writes each
+	// range accepts before new writes block. Zero, the default, means
+	// writes are not throttled. The limit of an individual range can be
+	// changed at runtime via Range.SetWriteRate.
+	RangeWriteRate int64
+
+	// MaxIntentsPerTxn is the maximum number of write intents a single
+	// transaction may lay down. Transactional writes on a range of this
+	// store are refused once the transaction has reached the limit.
+	// Zero, the default, disables the limit.
+	MaxIntentsPerTxn int64
+
+	// MaxCommandBytes is the maximum size in bytes of a single client
+	// write, including InternalWriteBatch commands, proposed to Raft by
+	// a range of this store. Larger commands are refused, unless they
+	// can be split; see SplitLargeCommands. Zero, the default, disables
+	// the limit.
+	MaxCommandBytes int64
+
+	// SplitLargeCommands causes InternalWriteBatch commands exceeding
+	// MaxCommandBytes to be split into several commands, each under the
+	// limit, rather than refused. The pieces are applied one after
+	// another, so the batch as a whole is no longer atomic.
+	SplitLargeCommands bool
+
 	// ScanInterval is the default value for the scan interval
 	ScanInterval time.Duration
 
@@ -292,6 +357,26 @@ func (sc *StoreContext) Valid() bool {
 		sc.RaftElectionTimeoutTicks > 0 && sc.ScanInterval > 0
 }
 
+// IsNodeLive returns whether the node with the given ID is live, that
+// is whether its most recently gossiped liveness expiration is later
+// than the current time of the clock. Nodes without a liveness record
+// are considered dead.
+func (sc *StoreContext) IsNodeLive(nodeID proto.NodeID) bool {
+	if sc.Gossip == nil {
+		return false
+	}
+	val, err := sc.Gossip.GetInfo(gossip.MakeNodeLivenessKey(nodeID))
+	if err != nil {
+		return false
+	}
+	expiration, ok := val.(proto.Timestamp)
+	if !ok {
+		log.Errorf("gossiped liveness for node %d is not a timestamp: %+v", nodeID, val)
+		return false
+	}
+	return sc.Clock.Now().Less(expiration)
+}
+
 // setDefaults initializes unset fields in StoreConfig to values
 // suitable for use on a local network.
 // TODO(tschottdorf) see if this ought to be configurable via flags.
@@ -308,6 +393,15 @@ func (sc *StoreContext) setDefaults() {
 	if sc.RaftElectionTimeoutTicks == 0 {
 		sc.RaftElectionTimeoutTicks = defaultRaftElectionTimeoutTicks
 	}
+	if sc.RaftLogRetention == 0 {
+		sc.RaftLogRetention = defaultRaftLogRetention
+	}
+	if sc.RaftLogMaxLagBytes == 0 {
+		sc.RaftLogMaxLagBytes = defaultRaftLogMaxLagBytes
+	}
+	if sc.RaftProposalQuota == 0 {
+		sc.RaftProposalQuota = defaultRaftProposalQuota
+	}
 }
 
 // NewStore returns a new instance of a store.
@@ -336,8 +430,10 @@ func NewStore(ctx StoreContext, eng engine.Engine, nodeDesc *proto.NodeDescripto
 	s._splitQueue = newSplitQueue(s.db, s.ctx.Gossip)
 	s.verifyQueue = newVerifyQueue(s.scanner.Stats)
 	s.replicateQueue = newReplicateQueue(s.ctx.Gossip, s.allocator(), s.ctx.Clock)
-	s.rangeGCQueue = newRangeGCQueue(s.db)
-	s.scanner.AddQueues(s.gcQueue, s.splitQueue(), s.verifyQueue, s.replicateQueue, s.rangeGCQueue)
+	s.rebalanceQueue = newRebalanceQueue(s.ctx.Gossip, s.allocator(), s.ctx.Clock)
+	s._rangeGCQueue = newRangeGCQueue(s.db)
+	s.raftLogQueue = newRaftLogQueue(s.ctx.RaftLogRetention, s.ctx.RaftLogMaxLagBytes)
+	s.scanner.AddQueues(s.gcQueue, s.splitQueue(), s.verifyQueue, s.replicateQueue, s.rebalanceQueue, s._rangeGCQueue, s.raftLogQueue)
 
 	return s
 }
@@ -363,6 +459,67 @@ func (s *Store) IsStarted() bool {
 	return atomic.LoadInt32(&s.started) == 1
 }
 
+// IsDraining returns true if the store is draining, in which case it
+// rejects new commands and its replicas don't acquire leader leases.
+func (s *Store) IsDraining() bool {
+	return atomic.LoadInt32(&s.draining) == 1
+}
+
+// Drain prepares the store for a graceful shutdown. The store rejects
+// new commands, its replicas stop acquiring leader leases, the leases
+// they hold are transferred to replicas on live nodes and the commands
+// already in flight are waited for. If ctx is done first, Drain gives
+// up, returns an error and the store resumes normal operation.
+func (s *Store) Drain(ctx context.Context) error {
+	atomic.StoreInt32(&s.draining, 1)
+	for {
+		s.mu.RLock()
+		ranges := make([]*Range, 0, len(s.ranges))
+		for _, rng := range s.ranges {
+			ranges = append(ranges, rng)
+		}
+		s.mu.RUnlock()
+
+		var held int
+		for _, rng := range ranges {
+			if h, expired := rng.HasLeaderLease(s.ctx.Clock.Now()); !h || expired {
+				continue
+			}
+			if err := s.transferLeaderLease(rng); err != nil {
+				log.Warningf("range %d: unable to transfer leader lease: %s", rng.Desc().RaftID, err)
+			}
+			if h, expired := rng.HasLeaderLease(s.ctx.Clock.Now()); h && !expired {
+				held++
+			}
+		}
+		inFlight := atomic.LoadInt32(&s.inFlight)
+		if held == 0 && inFlight == 0 {
+			return nil
+		}
+
+		select {
+		case <-time.After(drainPollInterval):
+		case <-ctx.Done():
+			atomic.StoreInt32(&s.draining, 0)
+			return util.Errorf("store %d: drain incomplete with %d leader leases held and %d commands in flight: %s",
+				s.StoreID(), held, inFlight, ctx.Err())
+		}
+	}
+}
+
+// transferLeaderLease transfers the leader lease held by the given
+// range's replica to the first replica on another store whose node is
+// live according to its gossiped liveness record.
+func (s *Store) transferLeaderLease(rng *Range) error {
+	for _, replica := range rng.Desc().Replicas {
+		if replica.StoreID == s.StoreID() || !s.ctx.IsNodeLive(replica.NodeID) {
+			continue
+		}
+		return rng.transferLeaderLease(proto.MakeRaftNodeID(replica.NodeID, replica.StoreID))
+	}
+	return util.Errorf("no live replica to transfer to")
+}
+
 // Start the engine, set the GC and read the StoreIdent.
 func (s *Store) Start(stopper *util.Stopper) error {
 	s.stopper = stopper
@@ -396,11 +553,11 @@ func (s *Store) Start(stopper *util.Stopper) error {
 	s.feed.startStore()
 
 	// Create ID allocators.
-	idAlloc, err := newIDAllocator(keys.RaftIDGenerator, s.db, 2 /* min ID */, raftIDAllocCount, s.stopper)
+	raftIDAlloc, err := newRaftIDAllocator(s.db, s.stopper)
 	if err != nil {
 		return err
 	}
-	s.raftIDAlloc = idAlloc
+	s.raftIDAlloc = raftIDAlloc
 
 	now := s.ctx.Clock.Now()
 	s.startedAt = now.WallTime
@@ -698,10 +855,222 @@ func (s *Store) ForceRangeGCScan(t util.Tester) {
 	defer s.mu.Unlock()
 
 	for _, r := range s.ranges {
-		s.rangeGCQueue.MaybeAdd(r, s.ctx.Clock.Now())
+		s._rangeGCQueue.MaybeAdd(r, s.ctx.Clock.Now())
+	}
+}
+
+// ForceRaftLogScan iterates over all ranges and enqueues any whose
+// raft log may be truncated. Exposed only for testing.
+func (s *Store) ForceRaftLogScan(t util.Tester) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range s.ranges {
+		s.raftLogQueue.MaybeAdd(r, s.ctx.Clock.Now())
 	}
 }
 
+// SetRangeGCTTL sets a GC TTL for the specified range which overrides
+// the TTL of the zone config's GC policy. The TTL is persisted in the
+// range's GC metadata and is inherited by both sides of a split. A
+// ttlSeconds of zero clears the override. The range is offered to the
+// GC queue so that it's re-evaluated with the new TTL.
+func (s *Store) SetRangeGCTTL(raftID int64, ttlSeconds int32) error {
+	if ttlSeconds < 0 {
+		return util.Errorf("GC TTL must be non-negative: %d", ttlSeconds)
+	}
+	rng, err := s.GetRange(raftID)
+	if err != nil {
+		return err
+	}
+	gcMeta, err := rng.GetGCMetadata()
+	if err != nil {
+		return err
+	}
+	gcMeta.TTLSeconds = nil
+	if ttlSeconds > 0 {
+		gcMeta.TTLSeconds = gogoproto.Int32(ttlSeconds)
+	}
+
+	// The GC metadata is replicated, so it's updated via an InternalGC
+	// command which doesn't garbage collect any keys.
+	now := s.ctx.Clock.Now()
+	gcArgs := &proto.InternalGCRequest{
+		RequestHeader: proto.RequestHeader{
+			Key:       rng.Desc().StartKey,
+			Timestamp: now,
+			RaftID:    raftID,
+		},
+		GCMeta: *gcMeta,
+	}
+	if err := rng.AddCmd(rng.context(), client.Call{Args: gcArgs, Reply: &proto.InternalGCResponse{}}, true); err != nil {
+		return err
+	}
+	s.gcQueue.MaybeAdd(rng, now)
+	return nil
+}
+
+// VerifyRangeStats recomputes the MVCC stats for the specified range
+// from the underlying engine and compares them to the range's stored
+// stats. Returns the delta of computed minus stored stats; a non-zero
+// delta indicates the stored stats have diverged and is logged. Both
+// sets of stats are read from the same engine snapshot.
+func (s *Store) VerifyRangeStats(raftID int64) (proto.MVCCStats, error) {
+	rng, err := s.GetRange(raftID)
+	if err != nil {
+		return proto.MVCCStats{}, err
+	}
+	snap := s.engine.NewSnapshot()
+	defer snap.Close()
+
+	nowNanos := s.ctx.Clock.Now().WallTime
+	iter := newRangeDataIterator(rng.Desc(), snap)
+	computed, err := engine.MVCCComputeStats(iter, nowNanos)
+	iter.Close()
+	if err != nil {
+		return proto.MVCCStats{}, err
+	}
+	var stored proto.MVCCStats
+	if err := engine.MVCCGetRangeStats(snap, raftID, &stored); err != nil {
+		return proto.MVCCStats{}, err
+	}
+	// Stored age stats are only advanced on update; bring them up to
+	// date so they're comparable with the computed values.
+	elapsedSeconds := nowNanos/1e9 - stored.LastUpdateNanos/1e9
+	stored.IntentAge += stored.IntentCount * elapsedSeconds
+	stored.GCBytesAge += engine.MVCCComputeGCBytesAge(stored.KeyBytes+stored.ValBytes-stored.LiveBytes, elapsedSeconds)
+	stored.LastUpdateNanos = nowNanos
+
+	delta := computed.Delta(&stored)
+	if !gogoproto.Equal(&delta, &proto.MVCCStats{}) {
+		log.Warningf("range %d: stored MVCC stats differ from computed stats by %+v", raftID, delta)
+	}
+	return delta, nil
+}
+
+// AdminSplitAt splits the range containing splitKey at splitKey. The
+// split is performed by an AdminSplit command on the range, which
+// replicates the new range descriptors via Raft. Returns an error if
+// no range on this store contains splitKey or if splitKey is already
+// a range boundary.
+func (s *Store) AdminSplitAt(ctx context.Context, splitKey proto.Key) error {
+	rng := s.LookupRange(splitKey, nil)
+	if rng == nil {
+		return util.Errorf("store %d has no range containing split key %s", s.StoreID(), splitKey)
+	}
+	desc := rng.Desc()
+	if splitKey.Equal(desc.StartKey) {
+		return util.Errorf("key %s is already a range boundary", splitKey)
+	}
+	args := &proto.AdminSplitRequest{
+		RequestHeader: proto.RequestHeader{
+			Key:     desc.StartKey,
+			RaftID:  desc.RaftID,
+			Replica: proto.Replica{StoreID: s.StoreID()},
+		},
+		SplitKey: splitKey,
+	}
+	return s.ExecuteCmd(ctx, client.Call{Args: args, Reply: &proto.AdminSplitResponse{}})
+}
+
+// ComputeChecksum has each replica of the range with the given Raft
+// ID compute a checksum of the range's data by sending an
+// InternalComputeChecksum command to this store's replica. Returns
+// the timestamp of the command, which identifies the checksum on each
+// replica via Range.GetChecksum(). The command is addressed to the
+// range's start key only, so it neither waits on the range's other
+// commands in the command queue nor touches the timestamp cache.
+func (s *Store) ComputeChecksum(ctx context.Context, raftID int64) (proto.Timestamp, error) {
+	rng, err := s.GetRange(raftID)
+	if err != nil {
+		return proto.ZeroTimestamp, err
+	}
+	desc := rng.Desc()
+	args := &proto.InternalComputeChecksumRequest{
+		RequestHeader: proto.RequestHeader{
+			Key:     desc.StartKey,
+			RaftID:  raftID,
+			Replica: proto.Replica{StoreID: s.StoreID()},
+		},
+	}
+	if err := s.ExecuteCmd(ctx, client.Call{Args: args, Reply: &proto.InternalComputeChecksumResponse{}}); err != nil {
+		return proto.ZeroTimestamp, err
+	}
+	return args.Timestamp, nil
+}
+
+// CheckConsistency compares the data held by the replicas of the range
+// with the given Raft ID on the supplied stores. The checksum command
+// is sent to each store in turn until one accepts it (i.e. the one
+// holding the leader lease) and the checksums computed by all replicas
+// are then collected. Returns the replicas whose checksum disagrees
+// with that of the majority.
+func CheckConsistency(ctx context.Context, stores []*Store, raftID int64) ([]proto.Replica, error) {
+	var timestamp proto.Timestamp
+	var err error
+	for _, s := range stores {
+		if timestamp, err = s.ComputeChecksum(ctx, raftID); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Wait for each replica to apply the checksum command.
+	checksums := make([][]byte, len(stores))
+	retryOpts := checksumRetryOptions
+	retryOpts.Tag = fmt.Sprintf("range %d: checksum", raftID)
+	if err := retry.WithBackoff(retryOpts, func() (retry.Status, error) {
+		for i, s := range stores {
+			if checksums[i] != nil {
+				continue
+			}
+			rng, err := s.GetRange(raftID)
+			if err != nil {
+				return retry.Break, err
+			}
+			checksum, ok := rng.GetChecksum(timestamp)
+			if !ok {
+				return retry.Continue, util.Errorf("replica on store %d has not computed checksum", s.StoreID())
+			}
+			checksums[i] = checksum
+		}
+		return retry.Break, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	counts := map[string]int{}
+	var majority string
+	for _, checksum := range checksums {
+		counts[string(checksum)]++
+		if counts[string(checksum)] > counts[majority] {
+			majority = string(checksum)
+		}
+	}
+	if counts[majority]*2 <= len(checksums) {
+		return nil, util.Errorf("range %d: no majority among %d replica checksums", raftID, len(checksums))
+	}
+	var inconsistent []proto.Replica
+	for i, s := range stores {
+		if string(checksums[i]) == majority {
+			continue
+		}
+		rng, err := s.GetRange(raftID)
+		if err != nil {
+			return nil, err
+		}
+		_, replica := rng.Desc().FindReplica(s.StoreID())
+		if replica == nil {
+			return nil, util.Errorf("store %d not found in range %d descriptor", s.StoreID(), raftID)
+		}
+		log.Warningf("range %d: replica %s is inconsistent with the majority", raftID, replica)
+		inconsistent = append(inconsistent, *replica)
+	}
+	return inconsistent, nil
+}
+
 // setRangesMaxBytes sets the max bytes for every range according
 // to the zone configs.
 //
@@ -784,6 +1153,24 @@ func (s *Store) LookupRange(start, end proto.Key) *Range {
 	return s.rangesByKey[n]
 }
 
+// UnderReplicatedRanges returns the descriptors of all ranges on this
+// store which have fewer than target replicas, ordered by start key.
+// Only the ranges' cached descriptors are consulted.
+func (s *Store) UnderReplicatedRanges(target int) ([]proto.RangeDescriptor, error) {
+	if target <= 0 {
+		return nil, util.Errorf("target replica count must be positive: %d", target)
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var descs []proto.RangeDescriptor
+	for _, rng := range s.rangesByKey {
+		if desc := rng.Desc(); len(desc.Replicas) < target {
+			descs = append(descs, *desc)
+		}
+	}
+	return descs, nil
+}
+
 // RaftStatus returns the current raft status of the given range.
 func (s *Store) RaftStatus(raftID int64) *raft.Status {
 	return s.multiraft.Status(uint64(raftID))
@@ -913,6 +1300,21 @@ func (s *Store) Gossip() *gossip.Gossip { return s.ctx.Gossip }
 // SplitQueue accessor.
 func (s *Store) splitQueue() *splitQueue { return s._splitQueue }
 
+// RangeGCQueue accessor.
+func (s *Store) rangeGCQueue() *rangeGCQueue { return s._rangeGCQueue }
+
+// RaftProposalQuota accessor.
+func (s *Store) raftProposalQuota() int64 { return s.ctx.RaftProposalQuota }
+
+// RangeWriteRate accessor.
+func (s *Store) rangeWriteRate() int64 { return s.ctx.RangeWriteRate }
+
+// MaxIntentsPerTxn accessor.
+func (s *Store) maxIntentsPerTxn() int64 { return s.ctx.MaxIntentsPerTxn }
+
+// MaxCommandBytes accessor.
+func (s *Store) maxCommandBytes() int64 { return s.ctx.MaxCommandBytes }
+
 // Stopper accessor.
 func (s *Store) Stopper() *util.Stopper { return s.stopper }
 
@@ -1100,9 +1502,89 @@ func (s *Store) Attrs() proto.Attributes {
 	return s.engine.Attrs()
 }
 
-// Capacity returns the capacity of the underlying storage engine.
+// Capacity returns the capacity of the underlying storage engine,
+// along with the number of ranges on the store and the sum of their
+// live bytes. Live bytes are aggregated from each range's MVCC stats.
 func (s *Store) Capacity() (proto.StoreCapacity, error) {
-	return s.engine.Capacity()
+	capacity, err := s.engine.Capacity()
+	if err != nil {
+		return capacity, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	capacity.RangeCount = int32(len(s.ranges))
+	for _, rng := range s.ranges {
+		capacity.LiveBytes += rng.stats.GetMVCC().LiveBytes
+	}
+	return capacity, nil
+}
+
+// RangeSizeBuckets are the upper bounds, in bytes, of the buckets of a
+// RangeSizeHistogram. Ranges larger than the last bound fall into a
+// final, unbounded bucket.
+var RangeSizeBuckets = []int64{1 << 20, 4 << 20, 16 << 20, 64 << 20}
+
+// A RangeSizeHistogram describes the distribution of the sizes of the
+// ranges on a store.
+type RangeSizeHistogram struct {
+	RangeCount int64
+	// Counts[i] is the number of ranges larger than RangeSizeBuckets[i-1]
+	// and no larger than RangeSizeBuckets[i]. The final entry counts the
+	// ranges larger than every bucket bound.
+	Counts []int64
+}
+
+// RangeCount returns the number of ranges on the store.
+func (s *Store) RangeCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.ranges)
+}
+
+// RangeSizeHistogram returns the distribution of the sizes of the
+// store's ranges. Sizes are taken from each range's cached MVCC stats,
+// so no data is read from the engine.
+func (s *Store) RangeSizeHistogram() RangeSizeHistogram {
+	h := RangeSizeHistogram{Counts: make([]int64, len(RangeSizeBuckets)+1)}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h.RangeCount = int64(len(s.ranges))
+	for _, rng := range s.ranges {
+		size := rng.stats.GetSize()
+		h.Counts[sort.Search(len(RangeSizeBuckets), func(i int) bool {
+			return size <= RangeSizeBuckets[i]
+		})]++
+	}
+	return h
+}
+
+// A ReplicaStatEntry describes a single replica on a store.
+type ReplicaStatEntry struct {
+	RaftID   int64
+	StartKey proto.Key
+	EndKey   proto.Key
+	Stats    proto.MVCCStats
+}
+
+// ReplicaStats returns the range ID, key bounds and MVCC stats of
+// every initialized replica on the store, ordered by start key. The
+// store's lock is held for reading while the listing is built so that
+// it reflects a single point in time with respect to splits, merges
+// and rebalancing.
+func (s *Store) ReplicaStats() []ReplicaStatEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entries := make([]ReplicaStatEntry, 0, len(s.rangesByKey))
+	for _, rng := range s.rangesByKey {
+		desc := rng.Desc()
+		entries = append(entries, ReplicaStatEntry{
+			RaftID:   desc.RaftID,
+			StartKey: desc.StartKey,
+			EndKey:   desc.EndKey,
+			Stats:    rng.stats.GetMVCC(),
+		})
+	}
+	return entries
 }
 
 // Descriptor returns a StoreDescriptor including current store
@@ -1112,9 +1594,6 @@ func (s *Store) Descriptor() (*proto.StoreDescriptor, error) {
 	if err != nil {
 		return nil, err
 	}
-	s.mu.RLock()
-	capacity.RangeCount = int32(len(s.ranges))
-	s.mu.RUnlock()
 	// Initialize the store descriptor.
 	return &proto.StoreDescriptor{
 		StoreID:  s.Ident.StoreID,
@@ -1132,6 +1611,17 @@ func (s *Store) ExecuteCmd(ctx context.Context, call client.Call) error {
 	ctx = log.Add(s.Context(ctx), log.Method, args.Method())
 	// If the request has a zero timestamp, initialize to this node's clock.
 	header := args.Header()
+	// A draining store refuses new commands. The in-flight count is
+	// raised before checking so that Drain, which sets the flag before
+	// reading the count, can't miss a command which slips through.
+	atomic.AddInt32(&s.inFlight, 1)
+	defer atomic.AddInt32(&s.inFlight, -1)
+	if s.IsDraining() {
+		replica := header.Replica
+		err := &proto.NotLeaderError{Replica: &replica}
+		reply.Header().SetGoError(err)
+		return err
+	}
 	if err := verifyKeys(header.Key, header.EndKey, proto.IsRange(call.Args)); err != nil {
 		reply.Header().SetGoError(err)
 		return err
@@ -1148,6 +1638,14 @@ func (s *Store) ExecuteCmd(ctx context.Context, call client.Call) error {
 		}
 	}
 
+	// Split write batches too large for a single command, if so
+	// configured. Other commands exceeding the limit are refused by the
+	// range.
+	if wb, ok := args.(*proto.InternalWriteBatchRequest); ok && s.ctx.SplitLargeCommands &&
+		s.ctx.MaxCommandBytes > 0 && int64(gogoproto.Size(wb)) > s.ctx.MaxCommandBytes {
+		return s.executeSplitWriteBatch(ctx, wb, reply.(*proto.InternalWriteBatchResponse))
+	}
+
 	// Backoff and retry loop for handling errors.
 	retryOpts := *s.ctx.RangeRetryOptions
 	retryOpts.Tag = fmt.Sprintf("store: %s", args.Method())
@@ -1225,6 +1723,32 @@ func (s *Store) ExecuteCmd(ctx context.Context, call client.Call) error {
 	return reply.Header().GoError()
 }
 
+// executeSplitWriteBatch splits the write batch carried by args into
+// batches which each fit in a command of at most MaxCommandBytes, and
+// executes them one after another. The batches cover disjoint spans,
+// so that they don't conflict with one another in the timestamp
+// cache. Execution stops at the first error; batches applied until
+// then remain applied.
+func (s *Store) executeSplitWriteBatch(ctx context.Context, args *proto.InternalWriteBatchRequest,
+	reply *proto.InternalWriteBatchResponse) error {
+	// The size of the command without its repr bounds the overhead of
+	// each piece.
+	maxReprBytes := s.ctx.MaxCommandBytes - int64(gogoproto.Size(args)-len(args.Repr))
+	spans, err := engine.SplitBatchRepr(args.Repr, args.Key, args.EndKey, int(maxReprBytes))
+	if err != nil {
+		reply.SetGoError(err)
+		return err
+	}
+	for _, span := range spans {
+		pieceArgs := *args
+		pieceArgs.Key, pieceArgs.EndKey, pieceArgs.Repr = span.Key, span.EndKey, span.Repr
+		if err := s.ExecuteCmd(ctx, client.Call{Args: &pieceArgs, Reply: reply}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // resolveWriteIntentError tries to push the conflicting transaction:
 // either move its timestamp forward on a read/write conflict, or
 // abort it on a write/write conflict. If the push succeeds, we
@@ -1363,6 +1887,19 @@ func (s *Store) ProposeRaftCommand(idKey cmdIDKey, cmd proto.InternalRaftCommand
 	return s.multiraft.SubmitCommand(uint64(cmd.RaftID), string(idKey), data)
 }
 
+// ReadIndex confirms with a quorum of the range's replicas that the
+// local replica is still the raft leader and returns the index the
+// range must have applied before serving a linearizable read. Nothing
+// is appended to the raft log.
+func (s *Store) ReadIndex(raftID int64) (uint64, error) {
+	select {
+	case res := <-s.multiraft.ReadIndex(uint64(raftID)):
+		return res.Index, res.Err
+	case <-s.stopper.ShouldStop():
+		return 0, multiraft.ErrStopped
+	}
+}
+
 // processRaft processes read/write commands that have been committed
 // by the raft consensus algorithm, dispatching them to the
 // appropriate range. This method starts a goroutine to process Raft
@@ -1514,6 +2051,10 @@ func (s *Store) updateStoreStatus() {
 	timestamp := proto.Timestamp{WallTime: now}
 	scannerStats := s.scanner.Stats()
 
+	s.feed.idAllocatorMetrics(s.raftIDAlloc.Metrics())
+	s.feed.rangeSizeHistogram(s.RangeSizeHistogram())
+	s.feed.blockCacheStats(s.engine.BlockCacheStats())
+
 	// Get the zone configs.
 	zoneMap, err := s.Gossip().GetInfo(gossip.KeyConfigZone)
 	if err != nil || zoneMap == nil {
@@ -23,6 +23,7 @@ import (
 	"bytes"
 	"fmt"
 	"math"
+	"reflect"
 	"sort"
 	"strings"
 	"testing"
@@ -361,6 +362,83 @@ func TestStoreAddRemoveRanges(t *testing.T) {
 	}
 }
 
+// TestStoreUnderReplicatedRanges verifies that only ranges with fewer
+// replicas than the target are reported, in key order.
+func TestStoreUnderReplicatedRanges(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	store, _, stopper := createTestStore(t)
+	defer stopper.Stop()
+
+	// Replace the bootstrapped range with ranges of varying replica counts.
+	rng1, err := store.GetRange(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.RemoveRange(rng1); err != nil {
+		t.Fatal(err)
+	}
+	replicas := func(n int) []proto.Replica {
+		var reps []proto.Replica
+		for i := 1; i <= n; i++ {
+			reps = append(reps, proto.Replica{NodeID: proto.NodeID(i), StoreID: proto.StoreID(i)})
+		}
+		return reps
+	}
+	testData := []struct {
+		raftID     int64
+		start, end proto.Key
+		replicas   int
+	}{
+		{2, proto.Key("d"), proto.Key("e"), 1},
+		{3, proto.Key("a"), proto.Key("b"), 3},
+		{4, proto.Key("b"), proto.Key("c"), 2},
+		{5, proto.Key("c"), proto.Key("d"), 5},
+	}
+	for _, test := range testData {
+		desc := &proto.RangeDescriptor{
+			RaftID:   test.raftID,
+			StartKey: test.start,
+			EndKey:   test.end,
+			Replicas: replicas(test.replicas),
+		}
+		rng, err := NewRange(desc, store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.AddRangeTest(rng); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		target    int
+		expRaftID []int64
+	}{
+		{1, nil},
+		{2, []int64{2}},
+		{3, []int64{4, 2}},
+		{4, []int64{3, 4, 2}},
+		{6, []int64{3, 4, 5, 2}},
+	}
+	for i, test := range testCases {
+		descs, err := store.UnderReplicatedRanges(test.target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var raftIDs []int64
+		for _, desc := range descs {
+			raftIDs = append(raftIDs, desc.RaftID)
+		}
+		if !reflect.DeepEqual(raftIDs, test.expRaftID) {
+			t.Errorf("%d: expected under-replicated ranges %v; got %v", i, test.expRaftID, raftIDs)
+		}
+	}
+
+	if _, err := store.UnderReplicatedRanges(0); err == nil {
+		t.Error("expected error for non-positive target")
+	}
+}
+
 func TestStoreRangeIterator(t *testing.T) {
 	defer leaktest.AfterTest(t)
 	store, _, stopper := createTestStore(t)
@@ -757,6 +835,205 @@ func TestStoreSetRangesMaxBytes(t *testing.T) {
 	}
 }
 
+// TestStoreVerifyRangeStats writes some data, deliberately corrupts
+// the range's stored stats and verifies that recomputing the stats
+// detects the divergence.
+func TestStoreVerifyRangeStats(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	store, _, stopper := createTestStore(t)
+	defer stopper.Stop()
+
+	for _, k := range []string{"a", "b", "c"} {
+		pArgs, pReply := putArgs([]byte(k), []byte("value"), 1, store.StoreID())
+		pArgs.Timestamp = store.ctx.Clock.Now()
+		if err := store.ExecuteCmd(context.Background(), client.Call{Args: pArgs, Reply: pReply}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before, err := store.VerifyRangeStats(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Corrupt the stored stats.
+	rng, err := store.GetRange(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms := rng.stats.GetMVCC()
+	ms.LiveBytes += 100
+	ms.KeyCount -= 2
+	if err := rng.stats.SetMVCCStats(store.Engine(), ms); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := store.VerifyRangeStats(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := after.LiveBytes - before.LiveBytes; d != -100 {
+		t.Errorf("expected live bytes delta to change by -100; got %d", d)
+	}
+	if d := after.KeyCount - before.KeyCount; d != 2 {
+		t.Errorf("expected key count delta to change by 2; got %d", d)
+	}
+	if after.ValBytes != before.ValBytes || after.LiveCount != before.LiveCount {
+		t.Errorf("expected no change to uncorrupted stats; got %+v, before %+v", after, before)
+	}
+
+	// Restore the computed stats and verify the delta clears.
+	ms.Add(&after)
+	if err := rng.stats.SetMVCCStats(store.Engine(), ms); err != nil {
+		t.Fatal(err)
+	}
+	if delta, err := store.VerifyRangeStats(1); err != nil {
+		t.Fatal(err)
+	} else if delta.LiveBytes != 0 || delta.KeyCount != 0 {
+		t.Errorf("expected zero delta after correcting stats; got %+v", delta)
+	}
+}
+
+// TestStoreCapacity verifies that the store's capacity reports the
+// number of ranges and the live bytes aggregated over all of them.
+func TestStoreCapacity(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	store, _, stopper := createTestStore(t)
+	defer stopper.Stop()
+
+	rngB := splitTestRange(store, proto.KeyMin, proto.Key("b"), t)
+	rngC := splitTestRange(store, proto.Key("b"), proto.Key("c"), t)
+
+	before, err := store.Capacity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before.RangeCount != 3 {
+		t.Errorf("expected 3 ranges; got %d", before.RangeCount)
+	}
+	if before.Capacity == 0 || before.Used > before.Capacity || before.Available > before.Capacity {
+		t.Errorf("unexpected disk capacity %+v", before)
+	}
+
+	// Write a key to each range and tally the live bytes of the
+	// metadata and value written for each.
+	var expLiveBytes int64
+	for _, test := range []struct {
+		key    proto.Key
+		raftID int64
+	}{
+		{proto.Key("a"), 1},
+		{proto.Key("b1"), rngB.Desc().RaftID},
+		{proto.Key("c1"), rngC.Desc().RaftID},
+	} {
+		pArgs, pReply := putArgs(test.key, []byte("value"), test.raftID, store.StoreID())
+		pArgs.Timestamp = store.ctx.Clock.Now()
+		if err := store.ExecuteCmd(context.Background(), client.Call{Args: pArgs, Reply: pReply}); err != nil {
+			t.Fatal(err)
+		}
+		for _, encKey := range []proto.EncodedKey{
+			engine.MVCCEncodeKey(test.key),
+			engine.MVCCEncodeVersionKey(test.key, pArgs.Timestamp),
+		} {
+			val, err := store.Engine().Get(encKey)
+			if err != nil || val == nil {
+				t.Fatalf("unable to read %q: %v", encKey, err)
+			}
+			expLiveBytes += int64(len(val))
+		}
+		// The version key's length covers the key plus its timestamp.
+		expLiveBytes += int64(len(engine.MVCCEncodeVersionKey(test.key, pArgs.Timestamp)))
+	}
+
+	after, err := store.Capacity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delta := after.LiveBytes - before.LiveBytes; delta != expLiveBytes {
+		t.Errorf("expected live bytes to grow by %d; got %d", expLiveBytes, delta)
+	}
+}
+
+// TestStoreRangeSizeHistogram verifies that ranges land in the
+// histogram bucket matching the size recorded in their MVCC stats.
+func TestStoreRangeSizeHistogram(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	store, _, stopper := createTestStore(t)
+	defer stopper.Stop()
+
+	rngB := splitTestRange(store, proto.KeyMin, proto.Key("b"), t)
+	rngC := splitTestRange(store, proto.Key("b"), proto.Key("c"), t)
+	if count := store.RangeCount(); count != 3 {
+		t.Fatalf("expected 3 ranges; got %d", count)
+	}
+
+	// The first range holds only a little system data. Give the others
+	// sizes falling into the second and the unbounded buckets.
+	for _, test := range []struct {
+		rng  *Range
+		size int64
+	}{
+		{rngB, 2 << 20},
+		{rngC, 100 << 20},
+	} {
+		ms := proto.MVCCStats{KeyBytes: test.size / 2, ValBytes: test.size - test.size/2}
+		if err := test.rng.stats.SetMVCCStats(store.Engine(), ms); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := store.RangeSizeHistogram()
+	if h.RangeCount != 3 {
+		t.Errorf("expected 3 ranges; got %d", h.RangeCount)
+	}
+	if exp := []int64{1, 1, 0, 0, 1}; !reflect.DeepEqual(h.Counts, exp) {
+		t.Errorf("expected bucket counts %v; got %v", exp, h.Counts)
+	}
+}
+
+// TestStoreReplicaStats verifies that ReplicaStats lists every range
+// on the store in key order with its bounds and stats.
+func TestStoreReplicaStats(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	store, _, stopper := createTestStore(t)
+	defer stopper.Stop()
+
+	rngA := store.LookupRange(proto.KeyMin, nil)
+	rngB := splitTestRange(store, proto.KeyMin, proto.Key("b"), t)
+	rngC := splitTestRange(store, proto.Key("b"), proto.Key("c"), t)
+	ms := proto.MVCCStats{LiveBytes: 10, KeyBytes: 20, ValBytes: 30, KeyCount: 1}
+	if err := rngB.stats.SetMVCCStats(store.Engine(), ms); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := store.ReplicaStats()
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 replicas; got %d", len(entries))
+	}
+	for i, test := range []struct {
+		rng      *Range
+		startKey proto.Key
+		endKey   proto.Key
+	}{
+		{rngA, proto.KeyMin, proto.Key("b")},
+		{rngB, proto.Key("b"), proto.Key("c")},
+		{rngC, proto.Key("c"), proto.KeyMax},
+	} {
+		e := entries[i]
+		if e.RaftID != test.rng.Desc().RaftID {
+			t.Errorf("%d: expected raft ID %d; got %d", i, test.rng.Desc().RaftID, e.RaftID)
+		}
+		if !e.StartKey.Equal(test.startKey) || !e.EndKey.Equal(test.endKey) {
+			t.Errorf("%d: expected bounds [%q, %q); got [%q, %q)", i, test.startKey, test.endKey, e.StartKey, e.EndKey)
+		}
+		if !reflect.DeepEqual(e.Stats, test.rng.GetMVCCStats()) {
+			t.Errorf("%d: expected stats %+v; got %+v", i, test.rng.GetMVCCStats(), e.Stats)
+		}
+	}
+	if !reflect.DeepEqual(entries[1].Stats, ms) {
+		t.Errorf("expected stats %+v; got %+v", ms, entries[1].Stats)
+	}
+}
+
 // TestStoreResolveWriteIntent adds write intent and then verifies
 // that a put returns success and aborts intent's txn in the event the
 // pushee has lower priority. Othwerise, verifies that a
@@ -1412,3 +1689,85 @@ func TestMaybeRemove(t *testing.T) {
 		t.Errorf("Unexpected removed range %v", removedRng)
 	}
 }
+
+// TestStoreMaxCommandBytes verifies that client writes larger than the
+// store's MaxCommandBytes are refused, and that write batches are
+// instead split into commands under the limit if SplitLargeCommands
+// is set.
+func TestStoreMaxCommandBytes(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	store, _, stopper := createTestStore(t)
+	defer stopper.Stop()
+	const maxBytes = 1000
+	store.ctx.MaxCommandBytes = maxBytes
+
+	var sizes []int
+	TestingCommandFilter = func(args proto.Request, _ proto.Response) bool {
+		if _, ok := args.(*proto.InternalWriteBatchRequest); ok {
+			sizes = append(sizes, gogoproto.Size(args))
+		}
+		return false
+	}
+	defer func() { TestingCommandFilter = nil }()
+
+	// A single put larger than the limit is refused.
+	pArgs, pReply := putArgs(proto.Key("a"), make([]byte, maxBytes), 1, store.StoreID())
+	if err := store.ExecuteCmd(context.Background(), client.Call{Args: pArgs, Reply: pReply}); err == nil {
+		t.Fatal("expected error for put larger than the limit")
+	}
+
+	const numKeys = 100
+	ts := store.ctx.Clock.Now()
+	var b engine.RocksDBBatchBuilder
+	for i := 0; i < numKeys; i++ {
+		if err := b.MVCCPut(proto.Key(fmt.Sprintf("key%03d", i)), ts, proto.Value{Bytes: make([]byte, 50)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wbArgs := &proto.InternalWriteBatchRequest{
+		RequestHeader: proto.RequestHeader{
+			Key:       proto.Key("key"),
+			EndKey:    proto.Key("key").PrefixEnd(),
+			Timestamp: ts,
+			RaftID:    1,
+			Replica:   proto.Replica{StoreID: store.StoreID()},
+		},
+		Repr: b.Finish(),
+	}
+	scanKeys := func() int {
+		kvs, err := engine.MVCCScan(store.Engine(), wbArgs.Key, wbArgs.EndKey, 0, ts, true, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(kvs)
+	}
+
+	// By default, the oversized batch is refused as a whole.
+	if err := store.ExecuteCmd(context.Background(), client.Call{Args: wbArgs, Reply: &proto.InternalWriteBatchResponse{}}); err == nil {
+		t.Fatal("expected error for write batch larger than the limit")
+	}
+	if n := scanKeys(); n != 0 {
+		t.Errorf("expected refused batch not to be applied; found %d keys", n)
+	}
+	if len(sizes) != 0 {
+		t.Errorf("expected no write batch to be applied; got %d", len(sizes))
+	}
+
+	// With splitting enabled, it's applied in several commands, each
+	// under the limit.
+	store.ctx.SplitLargeCommands = true
+	if err := store.ExecuteCmd(context.Background(), client.Call{Args: wbArgs, Reply: &proto.InternalWriteBatchResponse{}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(sizes) < 2 {
+		t.Errorf("expected batch of %d bytes to be split; got %d commands", gogoproto.Size(wbArgs), len(sizes))
+	}
+	for i, size := range sizes {
+		if size > maxBytes {
+			t.Errorf("%d: expected command of at most %d bytes; got %d", i, maxBytes, size)
+		}
+	}
+	if n := scanKeys(); n != numKeys {
+		t.Errorf("expected %d keys; got %d", numKeys, n)
+	}
+}
@@ -32,6 +32,14 @@ const (
 	// than minCacheWindow will necessarily have to advance their commit
 	// timestamp.
 	MinTSCacheWindow = 10 * time.Second
+
+	// defaultTSCacheMaxBytes is the default memory budget of a
+	// timestamp cache. See TimestampCache.SetMaxBytes.
+	defaultTSCacheMaxBytes = 64 << 20 // 64M
+
+	// tsCacheEntryOverhead approximates the memory used by each cache
+	// entry in addition to its key and txn ID bytes.
+	tsCacheEntryOverhead = 128
 )
 
 // A TimestampCache maintains an interval tree FIFO cache of keys or
@@ -44,9 +52,17 @@ const (
 // recently evicted entry's timestamp. This value always ratchets
 // with monotonic increases. The low water mark is initialized to
 // the current system time plus the maximum clock offset.
+//
+// The memory used by the cache is bounded by a byte budget. While
+// over budget, the oldest entries are evicted, raising the low water
+// mark to their timestamps so that evicted keys still report a
+// timestamp at least as high as the one they were cached with.
+// Evictions happen synchronously within Add(), so the cache requires
+// no synchronization beyond that of its callers (the Range mutex).
 type TimestampCache struct {
 	cache            *cache.IntervalCache
 	lowWater, latest proto.Timestamp
+	bytes, maxBytes  int64 // Approximate size of entries and budget
 }
 
 // A cacheEntry combines the timestamp with an optional txn ID.
@@ -60,10 +76,12 @@ type cacheEntry struct {
 // hybrid clock.
 func NewTimestampCache(clock *hlc.Clock) *TimestampCache {
 	tc := &TimestampCache{
-		cache: cache.NewIntervalCache(cache.Config{Policy: cache.CacheFIFO}),
+		cache:    cache.NewIntervalCache(cache.Config{Policy: cache.CacheFIFO}),
+		maxBytes: defaultTSCacheMaxBytes,
 	}
 	tc.Clear(clock)
 	tc.cache.Config.ShouldEvict = tc.shouldEvict
+	tc.cache.Config.OnEvicted = tc.onEvicted
 	return tc
 }
 
@@ -71,6 +89,7 @@ func NewTimestampCache(clock *hlc.Clock) *TimestampCache {
 // current time plus the maximum clock offset.
 func (tc *TimestampCache) Clear(clock *hlc.Clock) {
 	tc.cache.Clear()
+	tc.bytes = 0
 	tc.lowWater = clock.Now()
 	tc.lowWater.WallTime += clock.MaxOffset().Nanoseconds()
 	tc.latest = tc.lowWater
@@ -84,6 +103,13 @@ func (tc *TimestampCache) SetLowWater(lowWater proto.Timestamp) {
 	}
 }
 
+// SetMaxBytes sets the approximate number of bytes the cache may use
+// before evicting its oldest entries. A value of zero disables the
+// budget. A lowered budget is enforced on the next call to Add().
+func (tc *TimestampCache) SetMaxBytes(maxBytes int64) {
+	tc.maxBytes = maxBytes
+}
+
 // Add the specified timestamp to the cache as covering the range of
 // keys from start to end. If end is nil, the range covers the start
 // key only. txnID is nil for no transaction. readOnly specifies
@@ -100,25 +126,85 @@ func (tc *TimestampCache) Add(start, end proto.Key, timestamp proto.Timestamp, t
 	// Only add to the cache if the timestamp is more recent than the
 	// low water mark.
 	if tc.lowWater.Less(timestamp) {
-		// Check existing, overlapping entries. Remove superseded
-		// entries or return without adding this entry if necessary.
+		// Check existing, overlapping or abutting entries. Coalesce
+		// entries with the same timestamp and txn, remove or trim
+		// superseded entries, or return without adding this entry if
+		// necessary.
 		key := tc.cache.NewKey(start, end)
-		for _, o := range tc.cache.GetOverlaps(start, end) {
+		overlaps := tc.cache.GetOverlaps(start, end.Next())
+		for _, o := range overlaps {
+			ce := o.Value.(cacheEntry)
+			if ce.readOnly == readOnly && o.Key.Contains(key) && !ce.timestamp.Less(timestamp) {
+				return // don't add this key; there's already a cache entry with >= timestamp.
+			}
+		}
+		for _, o := range overlaps {
 			ce := o.Value.(cacheEntry)
 			if ce.readOnly != readOnly {
 				continue
 			}
-			if o.Key.Contains(key) && !ce.timestamp.Less(timestamp) {
-				return // don't add this key; there's already a cache entry with >= timestamp.
+			oStart, oEnd := o.Key.Start().(proto.Key), o.Key.End().(proto.Key)
+			coalesce := ce.timestamp.Equal(timestamp) && proto.TxnIDEqual(ce.txnID, txnID)
+			if !o.Key.Overlap(key) && !coalesce {
+				continue // abutting entry which can't be coalesced.
+			}
+			if coalesce {
+				// Extend this entry to cover the existing one.
+				if oStart.Less(start) {
+					start = oStart
+				}
+				if end.Less(oEnd) {
+					end = oEnd
+				}
+				tc.cache.Del(o.Key)
 			} else if key.Contains(o.Key) && !timestamp.Less(ce.timestamp) {
 				tc.cache.Del(o.Key) // delete existing key; this cache entry supersedes.
+			} else if !timestamp.Less(ce.timestamp) && (txnID == nil || proto.TxnIDEqual(ce.txnID, txnID)) {
+				// This entry supersedes the overlapped part of the existing
+				// one for every reader, so trim the existing entry to the
+				// parts outside this one, splitting it if necessary.
+				tc.cache.Del(o.Key)
+				if oStart.Less(start) {
+					tc.add(tc.cache.NewKey(oStart, start), ce)
+				}
+				if end.Less(oEnd) {
+					tc.add(tc.cache.NewKey(end, oEnd), ce)
+				}
 			}
 		}
 		ce := cacheEntry{timestamp: timestamp, txnID: txnID, readOnly: readOnly}
-		tc.cache.Add(key, ce)
+		tc.add(tc.cache.NewKey(start, end), ce)
 	}
 }
 
+// add adds the entry to the underlying cache, accounting for its size.
+func (tc *TimestampCache) add(key, value interface{}) {
+	if old, ok := tc.cache.Get(key); ok {
+		tc.bytes -= cacheEntrySize(key, old)
+	}
+	tc.bytes += cacheEntrySize(key, value)
+	tc.cache.Add(key, value)
+}
+
+// onEvicted accounts for the removal of an entry from the underlying
+// cache.
+func (tc *TimestampCache) onEvicted(key, value interface{}) {
+	tc.bytes -= cacheEntrySize(key, value)
+}
+
+// cacheEntrySize returns the approximate number of bytes used by the
+// cache entry. Single keys share the byte slice of their start and end
+// keys; see Add().
+func cacheEntrySize(key, value interface{}) int64 {
+	ik := key.(*cache.IntervalKey)
+	start, end := ik.Start().(proto.Key), ik.End().(proto.Key)
+	size := int64(len(end) + len(value.(cacheEntry).txnID) + tsCacheEntryOverhead)
+	if !start.Next().Equal(end) {
+		size += int64(len(start))
+	}
+	return size
+}
+
 // GetMax returns the maximum read and write timestamps which overlap
 // the interval spanning from start to end. Cached timestamps matching
 // the specified txnID are not considered. If no part of the specified
@@ -156,6 +242,7 @@ func (tc *TimestampCache) GetMax(start, end proto.Key, txnID []byte) (proto.Time
 func (tc *TimestampCache) MergeInto(dest *TimestampCache, clear bool) {
 	if clear {
 		dest.cache.Clear()
+		dest.bytes = 0
 		dest.lowWater = tc.lowWater
 		dest.latest = tc.latest
 	} else {
@@ -167,12 +254,13 @@ func (tc *TimestampCache) MergeInto(dest *TimestampCache, clear bool) {
 		}
 	}
 	tc.cache.Do(func(k, v interface{}) {
-		dest.cache.Add(k, v)
+		dest.add(k, v)
 	})
 }
 
 // shouldEvict returns true if the cache entry's timestamp is no
-// longer within the MinTSCacheWindow.
+// longer within the MinTSCacheWindow or if the cache exceeds its
+// memory budget.
 func (tc *TimestampCache) shouldEvict(size int, key, value interface{}) bool {
 	ce := value.(cacheEntry)
 	// In case low water mark was set higher, evict any entries
@@ -180,6 +268,12 @@ func (tc *TimestampCache) shouldEvict(size int, key, value interface{}) bool {
 	if ce.timestamp.Less(tc.lowWater) {
 		return true
 	}
+	// If over budget, evict and raise the low water mark to cover the
+	// evictee, so that reads of its keys aren't forgotten.
+	if tc.maxBytes > 0 && tc.bytes > tc.maxBytes {
+		tc.SetLowWater(ce.timestamp)
+		return true
+	}
 	// Compute the edge of the cache window.
 	edge := tc.latest
 	edge.WallTime -= MinTSCacheWindow.Nanoseconds()
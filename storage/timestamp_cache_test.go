@@ -18,6 +18,7 @@
 package storage
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
@@ -175,6 +176,59 @@ func TestTimestampCacheEviction(t *testing.T) {
 	}
 }
 
+// TestTimestampCacheMaxBytes verifies that entries are evicted once
+// the cache exceeds its memory budget and that the low water mark
+// rises to cover the evicted entries.
+func TestTimestampCacheMaxBytes(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	manual := hlc.NewManualClock(0)
+	clock := hlc.NewClock(manual.UnixNano)
+	clock.SetMaxOffset(maxClockOffset)
+	tc := NewTimestampCache(clock)
+
+	// Allow for roughly ten entries.
+	key := func(i int) proto.Key {
+		return proto.Key(fmt.Sprintf("key%03d", i))
+	}
+	entrySize := cacheEntrySize(tc.cache.NewKey(key(0), key(0).Next()), cacheEntry{})
+	maxBytes := 10 * entrySize
+	tc.SetMaxBytes(maxBytes)
+
+	// Add reads of 100 keys, each at a later timestamp, all well within
+	// the MinTSCacheWindow.
+	const numKeys = 100
+	timestamps := make([]proto.Timestamp, numKeys)
+	manual.Set(maxClockOffset.Nanoseconds() + 1)
+	for i := 0; i < numKeys; i++ {
+		manual.Increment(1)
+		timestamps[i] = clock.Now()
+		tc.Add(key(i), nil, timestamps[i], nil, true)
+	}
+
+	if tc.bytes > maxBytes {
+		t.Errorf("expected cache to use at most %d bytes; got %d", maxBytes, tc.bytes)
+	}
+	if l := tc.cache.Len(); l == 0 || int64(l) > maxBytes/entrySize {
+		t.Errorf("expected between 1 and %d entries; got %d", maxBytes/entrySize, l)
+	}
+
+	// The low water mark must cover every evicted entry, so no key may
+	// report a timestamp below the one at which it was read.
+	evicted := numKeys - tc.cache.Len()
+	if tc.lowWater.Less(timestamps[evicted-1]) {
+		t.Errorf("expected low water mark >= %s; got %s", timestamps[evicted-1], tc.lowWater)
+	}
+	for i := 0; i < numKeys; i++ {
+		if rTS, _ := tc.GetMax(key(i), nil, nil); rTS.Less(timestamps[i]) {
+			t.Errorf("%d: expected read timestamp >= %s; got %s", i, timestamps[i], rTS)
+		}
+	}
+	// A key which was never read reports the low water mark.
+	if rTS, _ := tc.GetMax(proto.Key("notincache"), nil, nil); !rTS.Equal(tc.lowWater) {
+		t.Errorf("expected low water mark %s; got %s", tc.lowWater, rTS)
+	}
+}
+
 func TestTimestampCacheMergeInto(t *testing.T) {
 	defer leaktest.AfterTest(t)
 	manual := hlc.NewManualClock(0)
@@ -289,6 +343,80 @@ func TestTimestampCacheLayeredIntervals(t *testing.T) {
 	}
 }
 
+// TestTimestampCacheCoalescing verifies that overlapping entries
+// with the same timestamp and txn are coalesced, that an entry with a
+// higher timestamp splits the entries it lands within, and that
+// lookups are unaffected.
+func TestTimestampCacheCoalescing(t *testing.T) {
+	defer leaktest.AfterTest(t)
+	manual := hlc.NewManualClock(0)
+	clock := hlc.NewClock(manual.UnixNano)
+	clock.SetMaxOffset(maxClockOffset)
+	tc := NewTimestampCache(clock)
+	manual.Set(maxClockOffset.Nanoseconds() + 1)
+
+	key := func(i int) proto.Key {
+		return proto.Key(fmt.Sprintf("key%03d", i))
+	}
+
+	// Add overlapping spans at the same timestamp; they coalesce into
+	// a single entry.
+	const numSpans = 100
+	ts := clock.Now()
+	for i := 0; i < numSpans; i++ {
+		tc.Add(key(i), key(i+10), ts, nil, true)
+	}
+	if l := tc.cache.Len(); l != 1 {
+		t.Errorf("expected 1 entry; got %d", l)
+	}
+	for i := 0; i < numSpans+10; i++ {
+		if rTS, _ := tc.GetMax(key(i), nil, nil); !rTS.Equal(ts) {
+			t.Errorf("%d: expected %s; got %s", i, ts, rTS)
+		}
+	}
+	if rTS, _ := tc.GetMax(key(numSpans+10), nil, nil); !rTS.Equal(tc.lowWater) {
+		t.Errorf("expected low water mark %s; got %s", tc.lowWater, rTS)
+	}
+
+	// A read at a higher timestamp in the middle splits the entry.
+	midTS := clock.Now()
+	tc.Add(key(50), nil, midTS, nil, true)
+	if l := tc.cache.Len(); l != 3 {
+		t.Errorf("expected 3 entries; got %d", l)
+	}
+	for i, exp := range map[int]proto.Timestamp{49: ts, 50: midTS, 51: ts} {
+		if rTS, _ := tc.GetMax(key(i), nil, nil); !rTS.Equal(exp) {
+			t.Errorf("%d: expected %s; got %s", i, exp, rTS)
+		}
+	}
+	if rTS, _ := tc.GetMax(key(0), key(numSpans), nil); !rTS.Equal(midTS) {
+		t.Errorf("expected %s; got %s", midTS, rTS)
+	}
+
+	// Overlapping spans at increasing timestamps trim their
+	// predecessors. Each key reports the timestamp of the latest span
+	// covering it.
+	tc.Clear(clock)
+	manual.Increment(maxClockOffset.Nanoseconds() + 1)
+	timestamps := make([]proto.Timestamp, numSpans)
+	for i := 0; i < numSpans; i++ {
+		timestamps[i] = clock.Now()
+		tc.Add(key(i), key(i+10), timestamps[i], nil, true)
+	}
+	if l := tc.cache.Len(); l > numSpans {
+		t.Errorf("expected at most %d entries; got %d", numSpans, l)
+	}
+	for i := 0; i < numSpans+10; i++ {
+		exp := timestamps[numSpans-1]
+		if i < numSpans {
+			exp = timestamps[i]
+		}
+		if rTS, _ := tc.GetMax(key(i), nil, nil); !rTS.Equal(exp) {
+			t.Errorf("%d: expected %s; got %s", i, exp, rTS)
+		}
+	}
+}
+
 func TestTimestampCacheClear(t *testing.T) {
 	defer leaktest.AfterTest(t)
 	manual := hlc.NewManualClock(0)
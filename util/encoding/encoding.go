@@ -470,13 +470,13 @@ func EncodeBytesDecreasing(b []byte, data []byte) []byte {
 	return b
 }
 
-func decodeBytes(b []byte, r []byte, e escapes) ([]byte, []byte) {
+func decodeBytes(b []byte, r []byte, e escapes) ([]byte, []byte, error) {
 	if len(b) > 0 && b[0] == e.escape2 {
 		if len(b) == 1 {
-			panic("malformed escape")
+			return nil, nil, util.Errorf("malformed escape")
 		}
 		if b[1] != e.escapedFF {
-			panic("unknown escape")
+			return nil, nil, util.Errorf("unknown escape")
 		}
 		r = append(r, e.escapedNul)
 		b = b[2:]
@@ -485,10 +485,10 @@ func decodeBytes(b []byte, r []byte, e escapes) ([]byte, []byte) {
 	for {
 		i := bytes.IndexByte(b, e.escape1)
 		if i == -1 {
-			panic("did not find terminator")
+			return nil, nil, util.Errorf("did not find terminator")
 		}
 		if i+1 >= len(b) {
-			panic("malformed escape")
+			return nil, nil, util.Errorf("malformed escape")
 		}
 
 		v := b[i+1]
@@ -498,14 +498,14 @@ func decodeBytes(b []byte, r []byte, e escapes) ([]byte, []byte) {
 			} else {
 				r = append(r, b[:i]...)
 			}
-			return b[i+2:], r
+			return b[i+2:], r, nil
 		}
 
 		if v == e.escapedNul {
 			r = append(r, b[:i]...)
 			r = append(r, e.escapedFF)
 		} else {
-			panic("unknown escape")
+			return nil, nil, util.Errorf("unknown escape")
 		}
 
 		b = b[i+2:]
@@ -515,7 +515,18 @@ func decodeBytes(b []byte, r []byte, e escapes) ([]byte, []byte) {
 // DecodeBytes decodes a []byte value from the input buffer which was
 // encoded using EncodeBytes. The decoded bytes are appended to r. The
 // remainder of the input buffer and the decoded []byte are returned.
+// DecodeBytes panics if the input is malformed.
 func DecodeBytes(b []byte, r []byte) ([]byte, []byte) {
+	b, r, err := DecodeBytesChecked(b, r)
+	if err != nil {
+		panic(err.Error())
+	}
+	return b, r
+}
+
+// DecodeBytesChecked is like DecodeBytes but returns an error instead
+// of panicking if the input is malformed.
+func DecodeBytesChecked(b []byte, r []byte) ([]byte, []byte, error) {
 	return decodeBytes(b, r, ascendingEscapes)
 }
 
@@ -527,7 +538,10 @@ func DecodeBytesDecreasing(b []byte, r []byte) ([]byte, []byte) {
 	if r == nil {
 		r = []byte{}
 	}
-	b, r = decodeBytes(b, r, descendingEscapes)
+	b, r, err := decodeBytes(b, r, descendingEscapes)
+	if err != nil {
+		panic(err.Error())
+	}
 	onesComplement(r)
 	return b, r
 }
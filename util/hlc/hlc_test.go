@@ -102,6 +102,25 @@ func TestEqual(t *testing.T) {
 	}
 }
 
+// TestNowFrozenPhysicalTime verifies that successive calls to Now()
+// increment the logical component while physical time stands still,
+// and that it is reset once physical time advances.
+func TestNowFrozenPhysicalTime(t *testing.T) {
+	m := NewManualClock(5)
+	c := NewClock(m.UnixNano)
+	for i := int32(0); i < 10; i++ {
+		expected := proto.Timestamp{WallTime: 5, Logical: i}
+		if now := c.Now(); !now.Equal(expected) {
+			t.Fatalf("%d: expected %s; got %s", i, expected, now)
+		}
+	}
+	m.Increment(1)
+	expected := proto.Timestamp{WallTime: 6}
+	if now := c.Now(); !now.Equal(expected) {
+		t.Errorf("expected %s; got %s", expected, now)
+	}
+}
+
 // TestClock performs a complete test of all basic phenomena,
 // including backward jumps in local physical time and clock offset.
 func TestClock(t *testing.T) {
@@ -19,8 +19,15 @@ package util
 
 import (
 	"sync"
+	"time"
+
+	"golang.org/x/net/context"
 )
 
+// defaultTaskName is the bucket under which tasks started via
+// StartTask() are accounted in RunningTasks().
+const defaultTaskName = "default"
+
 // Closer is an interface for objects to attach to the stopper to
 // be closed once the stopper completes.
 type Closer interface {
@@ -46,6 +53,7 @@ type Closer interface {
 // be added to the stopper via AddCloser(), to be closed after the
 // stopper has stopped.
 type Stopper struct {
+	drainer  chan struct{}  // Closed when draining
 	stopper  chan struct{}  // Closed when stopping
 	stopped  chan struct{}  // Closed when stopped completely
 	stop     sync.WaitGroup // Incremented for outstanding workers
@@ -53,14 +61,17 @@ type Stopper struct {
 	drain    *sync.Cond     // Conditional variable to wait for outstanding tasks
 	draining bool           // true when Stop() has been called
 	numTasks int            // number of outstanding tasks
+	tasks    map[string]int // number of outstanding tasks by name
 	closers  []Closer
 }
 
 // NewStopper returns an instance of Stopper.
 func NewStopper() *Stopper {
 	s := &Stopper{
+		drainer: make(chan struct{}),
 		stopper: make(chan struct{}),
 		stopped: make(chan struct{}),
+		tasks:   map[string]int{},
 	}
 	s.drain = sync.NewCond(&s.mu)
 	return s
@@ -99,21 +110,60 @@ func (s *Stopper) AddCloser(c Closer) {
 // Returns true if the task can be launched or false to indicate the
 // system is currently draining and the task should be refused.
 func (s *Stopper) StartTask() bool {
+	return s.startTask(defaultTaskName)
+}
+
+// FinishTask removes one from the count of tasks left to drain in the
+// system. This function must be invoked for every call to StartTask().
+func (s *Stopper) FinishTask() {
+	s.finishTask(defaultTaskName)
+}
+
+// RunTask runs the supplied function synchronously as a task,
+// accounted for under the default name. Returns false without running
+// <f> if the stopper is draining.
+func (s *Stopper) RunTask(f func()) bool {
+	if !s.StartTask() {
+		return false
+	}
+	defer s.FinishTask()
+	f()
+	return true
+}
+
+// RunNamedTask runs the supplied function as a task accounted under
+// the given name in RunningTasks(). The function <f> is run in a
+// goroutine. Returns false without running <f> if the stopper is
+// draining.
+func (s *Stopper) RunNamedTask(name string, f func()) bool {
+	if !s.startTask(name) {
+		return false
+	}
+	go func() {
+		defer s.finishTask(name)
+		f()
+	}()
+	return true
+}
+
+func (s *Stopper) startTask(name string) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if s.draining {
 		return false
 	}
 	s.numTasks++
+	s.tasks[name]++
 	return true
 }
 
-// FinishTask removes one from the count of tasks left to drain in the
-// system. This function must be invoked for every call to StartTask().
-func (s *Stopper) FinishTask() {
+func (s *Stopper) finishTask(name string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.numTasks--
+	if s.tasks[name]--; s.tasks[name] <= 0 {
+		delete(s.tasks, name)
+	}
 	s.drain.Broadcast()
 }
 
@@ -124,6 +174,20 @@ func (s *Stopper) NumTasks() int {
 	return s.numTasks
 }
 
+// RunningTasks returns a map from task name to the number of
+// outstanding tasks with that name. Tasks started via StartTask() are
+// reported under the name "default". This is useful to determine
+// which components are holding up draining.
+func (s *Stopper) RunningTasks() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := make(map[string]int, len(s.tasks))
+	for name, num := range s.tasks {
+		m[name] = num
+	}
+	return m
+}
+
 // Stop signals all live workers to stop and then waits for each to
 // confirm it has stopped (workers do this by calling SetStopped()).
 func (s *Stopper) Stop() {
@@ -138,6 +202,28 @@ func (s *Stopper) Stop() {
 	close(s.stopped)
 }
 
+// StopWithDeadline is like Stop(), but gives up waiting after the
+// supplied duration. If the stopper fails to stop in time, an error
+// is returned listing the tasks which are still outstanding; the
+// stopper continues stopping in the background and IsStopped() is
+// signaled once it completes.
+func (s *Stopper) StopWithDeadline(d time.Duration) error {
+	done := make(chan struct{})
+	go func() {
+		s.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-time.After(d):
+	}
+	if tasks := s.RunningTasks(); len(tasks) > 0 {
+		return Errorf("stopper failed to stop within %s; outstanding tasks: %v", d, tasks)
+	}
+	return Errorf("stopper failed to stop within %s; waiting on workers", d)
+}
+
 // ShouldStop returns a channel which will be closed when Stop() has been
 // invoked and outstanding tasks have drained. SetStopped() should be called
 // to confirm.
@@ -149,6 +235,38 @@ func (s *Stopper) ShouldStop() <-chan struct{} {
 	return s.stopper
 }
 
+// WithContext returns a context derived from ctx which is cancelled
+// when ShouldStop() fires. This allows the stopper's shutdown signal
+// to be threaded through context-aware code which doesn't know about
+// the stopper. The returned context is also cancelled if ctx is or
+// when the returned cancel function is called, as with
+// context.WithCancel. Callers should call cancel once done with the
+// context to release the goroutine watching the stopper.
+func (s *Stopper) WithContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-s.ShouldStop():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// ShouldDrain returns a channel which will be closed as soon as the
+// stopper enters its draining phase, before outstanding tasks have
+// completed. Tasks which may run for a long time (e.g. retry loops)
+// should watch this channel and finish promptly once it is closed;
+// waiting on ShouldStop() from within a task would deadlock.
+func (s *Stopper) ShouldDrain() <-chan struct{} {
+	if s == nil {
+		// A nil stopper will never signal ShouldDrain, but will also never panic.
+		return nil
+	}
+	return s.drainer
+}
+
 // IsStopped returns a channel which will be closed after Stop() has
 // been invoked to full completion, meaning all workers have completed
 // and all closers have been closed.
@@ -172,6 +290,9 @@ func (s *Stopper) SetStopped() {
 func (s *Stopper) Quiesce() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if !s.draining {
+		close(s.drainer)
+	}
 	s.draining = true
 	for s.numTasks > 0 {
 		// Unlock s.mu, wait for the signal, and lock s.mu.
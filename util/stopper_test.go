@@ -18,8 +18,12 @@
 package util
 
 import (
+	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	"golang.org/x/net/context"
 )
 
 func TestStopper(t *testing.T) {
@@ -237,3 +241,183 @@ func TestStopperClosers(t *testing.T) {
 		t.Errorf("expected true & true; got %t & %t", tc1, tc2)
 	}
 }
+
+// TestStopperShouldDrain verifies that ShouldDrain is signaled while
+// tasks are still outstanding, allowing them to finish so that the
+// stopper can stop.
+func TestStopperShouldDrain(t *testing.T) {
+	s := NewStopper()
+	if !s.StartTask() {
+		t.Fatal("expected StartTask to succeed")
+	}
+	go func() {
+		<-s.ShouldDrain()
+		s.FinishTask()
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		s.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("stopper should have stopped once the draining task finished")
+	}
+}
+
+// TestStopperRunningTasks verifies that outstanding tasks are counted
+// by name and that tasks started via StartTask() are counted under the
+// default name.
+func TestStopperRunningTasks(t *testing.T) {
+	s := NewStopper()
+	if !s.StartTask() {
+		t.Fatal("expected StartTask to succeed")
+	}
+	release := make(chan struct{})
+	for name, num := range map[string]int{"gossip": 2, "kv": 1} {
+		for i := 0; i < num; i++ {
+			if !s.RunNamedTask(name, func() { <-release }) {
+				t.Fatalf("expected RunNamedTask(%q) to succeed", name)
+			}
+		}
+	}
+	expTasks := map[string]int{defaultTaskName: 1, "gossip": 2, "kv": 1}
+	if tasks := s.RunningTasks(); !reflect.DeepEqual(tasks, expTasks) {
+		t.Errorf("expected running tasks %v; got %v", expTasks, tasks)
+	}
+	if n := s.NumTasks(); n != 4 {
+		t.Errorf("expected 4 tasks; got %d", n)
+	}
+
+	close(release)
+	if err := IsTrueWithin(func() bool {
+		return reflect.DeepEqual(s.RunningTasks(), map[string]int{defaultTaskName: 1})
+	}, 100*time.Millisecond); err != nil {
+		t.Errorf("expected named tasks to finish; got %v", s.RunningTasks())
+	}
+	s.FinishTask()
+	if tasks := s.RunningTasks(); len(tasks) != 0 {
+		t.Errorf("expected no running tasks; got %v", tasks)
+	}
+
+	s.Stop()
+	if s.RunNamedTask("kv", func() {}) {
+		t.Error("expected RunNamedTask to fail on a stopped stopper")
+	}
+}
+
+// TestStopperQuiesceRejectsTasks verifies that tasks submitted while
+// the stopper is quiescing are rejected, that ShouldStop() is not
+// signaled until outstanding tasks have drained and that Quiesce()
+// returns once they have.
+func TestStopperQuiesceRejectsTasks(t *testing.T) {
+	s := NewStopper()
+	release := make(chan struct{})
+	if !s.RunNamedTask("outstanding", func() { <-release }) {
+		t.Fatal("expected RunNamedTask to succeed")
+	}
+
+	quiesced := make(chan struct{})
+	go func() {
+		s.Quiesce()
+		close(quiesced)
+	}()
+	<-s.ShouldDrain()
+
+	if s.RunTask(func() { t.Error("unexpected execution of task during quiesce") }) {
+		t.Error("expected RunTask to fail during quiesce")
+	}
+	if s.RunNamedTask("new", func() { t.Error("unexpected execution of task during quiesce") }) {
+		t.Error("expected RunNamedTask to fail during quiesce")
+	}
+	select {
+	case <-quiesced:
+		t.Fatal("expected Quiesce to wait for the outstanding task")
+	case <-s.ShouldStop():
+		t.Fatal("expected ShouldStop not to be signaled while quiescing")
+	case <-time.After(5 * time.Millisecond):
+		// Expected.
+	}
+
+	close(release)
+	select {
+	case <-quiesced:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("timed out waiting for Quiesce to return")
+	}
+	select {
+	case <-s.ShouldStop():
+		t.Fatal("expected ShouldStop not to be signaled before Stop")
+	default:
+	}
+	s.Stop()
+}
+
+// TestStopperStopWithDeadline verifies that StopWithDeadline returns
+// an error naming outstanding tasks if they don't finish in time and
+// that stopping completes once they do.
+func TestStopperStopWithDeadline(t *testing.T) {
+	s := NewStopper()
+	release := make(chan struct{})
+	if !s.RunNamedTask("slow", func() { <-release }) {
+		t.Fatal("expected RunNamedTask to succeed")
+	}
+	err := s.StopWithDeadline(5 * time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "slow:1") {
+		t.Errorf("expected error naming the slow task; got %v", err)
+	}
+
+	close(release)
+	select {
+	case <-s.IsStopped():
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("timed out waiting for stopper to stop")
+	}
+
+	// A stopper with no outstanding tasks stops within the deadline.
+	if err := NewStopper().StopWithDeadline(100 * time.Millisecond); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestStopperWithContext verifies that a context derived via
+// WithContext is cancelled when the stopper stops, but not while
+// tasks are still draining.
+func TestStopperWithContext(t *testing.T) {
+	s := NewStopper()
+	ctx, cancel := s.WithContext(context.Background())
+	defer cancel()
+	if !s.StartTask() {
+		t.Fatal("expected StartTask to succeed")
+	}
+	go s.Stop()
+
+	<-s.ShouldDrain()
+	select {
+	case <-ctx.Done():
+		t.Fatal("context cancelled before stopper stopped")
+	case <-time.After(5 * time.Millisecond):
+	}
+
+	s.FinishTask()
+	select {
+	case <-ctx.Done():
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("timed out waiting for context to be cancelled")
+	}
+	if err := ctx.Err(); err != context.Canceled {
+		t.Errorf("expected context.Canceled; got %v", err)
+	}
+	<-s.IsStopped()
+
+	// A context may also be cancelled explicitly.
+	s = NewStopper()
+	defer s.Stop()
+	ctx, cancel = s.WithContext(context.Background())
+	cancel()
+	if err := ctx.Err(); err != context.Canceled {
+		t.Errorf("expected context.Canceled; got %v", err)
+	}
+}